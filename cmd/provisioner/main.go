@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	nethttp "net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"smctf/internal/provisioner"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "listen address of the provisioner API")
+	var cfg provisioner.Config
+	flag.StringVar(&cfg.APIKey, "api-key", os.Getenv("STACKS_PROVISIONER_API_KEY"), "required X-API-KEY, empty accepts any request")
+	flag.StringVar(&cfg.PublicIP, "public-ip", "127.0.0.1", "node address reported for every stack")
+	flag.StringVar(&cfg.BindAddr, "bind-addr", "127.0.0.1", "address the backends listen on")
+	flag.IntVar(&cfg.PortMin, "port-min", 31000, "lowest node port")
+	flag.IntVar(&cfg.PortMax, "port-max", 31999, "highest node port")
+	flag.DurationVar(&cfg.DefaultTTL, "ttl", 2*time.Hour, "lifetime of a new stack")
+	flag.DurationVar(&cfg.StartDelay, "start-delay", 3*time.Second, "time a stack stays creating before it runs")
+	flag.Float64Var(&cfg.FailureRate, "failure-rate", 0, "fraction of creates answered with 503, between 0 and 1")
+	flag.StringVar(&cfg.Backend, "backend", "", "serve every node port with \"echo\" (TCP echo) or \"http\" (HTTP stub), empty serves nothing")
+	flag.StringVar(&cfg.CallbackURL, "callback-url", "", "status callback url, e.g. http://localhost:8080/internal/stacks/callback")
+	flag.StringVar(&cfg.CallbackSecret, "callback-secret", os.Getenv("STACKS_CALLBACK_SECRET"), "secret signing the status callbacks")
+	flag.Parse()
+
+	server, err := provisioner.New(cfg)
+	if err != nil {
+		log.Fatalf("provisioner config error: %v", err)
+	}
+	defer server.Close()
+
+	srv := &nethttp.Server{
+		Addr:              *addr,
+		Handler:           server,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      15 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go server.Run(ctx)
+
+	go func() {
+		log.Printf("reference provisioner listening on %s", *addr)
+		if err := srv.ListenAndServe(); err != nil && err != nethttp.ErrServerClosed {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown error: %v", err)
+	}
+}
@@ -70,6 +70,9 @@ func main() {
 	scoreRepo := repo.NewScoreboardRepo(database)
 	appConfigRepo := repo.NewAppConfigRepo(database)
 	stackRepo := repo.NewStackRepo(database)
+	apiTokenRepo := repo.NewAPITokenRepo(database)
+	loginFailureRepo := repo.NewLoginFailureRepo(database)
+	divisionRepo := repo.NewDivisionRepo(database)
 
 	var fileStore storage.ChallengeFileStore
 	if cfg.S3.Enabled {
@@ -80,12 +83,18 @@ func main() {
 		fileStore = store
 	}
 
-	authSvc := service.NewAuthService(cfg, database, userRepo, registrationKeyRepo, teamRepo, redisClient)
-	teamSvc := service.NewTeamService(teamRepo)
-	ctfSvc := service.NewCTFService(cfg, challengeRepo, submissionRepo, redisClient, fileStore)
 	appConfigSvc := service.NewAppConfigService(appConfigRepo, redisClient, cfg.Cache.AppConfigTTL)
-	stackClient := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout)
+	authSvc := service.NewAuthService(cfg, database, userRepo, registrationKeyRepo, teamRepo, loginFailureRepo, appConfigSvc, redisClient)
+	teamSvc := service.NewTeamService(teamRepo, divisionRepo)
+	ctfSvc := service.NewCTFService(cfg, challengeRepo, submissionRepo, redisClient, fileStore)
+	stackClient := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{
+		Retries:          cfg.Stack.ProvisionerRetries,
+		BreakerThreshold: cfg.Stack.BreakerThreshold,
+		BreakerCooldown:  cfg.Stack.BreakerCooldown,
+	})
 	stackSvc := service.NewStackService(cfg.Stack, stackRepo, challengeRepo, submissionRepo, stackClient, redisClient)
+	apiTokenSvc := service.NewAPITokenService(apiTokenRepo, userRepo)
+	powSvc := service.NewPoWService(appConfigSvc, redisClient, cfg.Security.PoWTTL)
 
 	if cfg, _, _, err := appConfigSvc.Get(ctx); err != nil {
 		log.Printf("app config load warning: %v", err)
@@ -93,7 +102,7 @@ func main() {
 		log.Printf("warning: ctf_start_at and ctf_end_at not configured; competition will always be active at all times")
 	}
 
-	router := httpserver.NewRouter(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, stackSvc, redisClient, logger)
+	router := httpserver.NewRouter(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, stackSvc, apiTokenSvc, powSvc, redisClient, logger)
 	srv := &nethttp.Server{
 		Addr:              cfg.HTTPAddr,
 		Handler:           router,
@@ -106,6 +115,15 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if cfg.Stack.Enabled && cfg.Stack.ReaperInterval > 0 {
+		reaper := service.NewStackReaper(stackSvc, redisClient, cfg.Stack.ReaperInterval)
+		go reaper.Run(ctx)
+	}
+
+	if cfg.Stack.Enabled && cfg.Stack.ProvisionWorkers > 0 {
+		go stackSvc.RunProvisionWorkers(ctx)
+	}
+
 	go func() {
 		log.Printf("server listening on %s", cfg.HTTPAddr)
 		if err := srv.ListenAndServe(); err != nil && err != nethttp.ErrServerClosed {
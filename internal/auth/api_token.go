@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	APITokenPrefix          = "smctf_"
+	apiTokenRandomBytes     = 32
+	apiTokenDisplayedLength = len(APITokenPrefix) + 6
+)
+
+func GenerateAPIToken() (string, error) {
+	buf := make([]byte, apiTokenRandomBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return APITokenPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// Tokens carry 256 bits of randomness, so a plain SHA-256 is enough to store them
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func APITokenDisplayPrefix(token string) string {
+	if len(token) <= apiTokenDisplayedLength {
+		return token
+	}
+
+	return token[:apiTokenDisplayedLength]
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIToken(t *testing.T) {
+	token, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken failed: %v", err)
+	}
+
+	if !IsAPIToken(token) {
+		t.Fatalf("expected prefix %s, got %s", APITokenPrefix, token)
+	}
+
+	other, err := GenerateAPIToken()
+	if err != nil {
+		t.Fatalf("GenerateAPIToken failed: %v", err)
+	}
+
+	if token == other {
+		t.Fatal("expected unique tokens")
+	}
+
+	if IsAPIToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatal("expected jwt not to be an api token")
+	}
+}
+
+func TestHashAPIToken(t *testing.T) {
+	hash := HashAPIToken("smctf_abc")
+	if len(hash) != 64 || hash != HashAPIToken("smctf_abc") {
+		t.Fatalf("unexpected hash %s", hash)
+	}
+
+	if hash == HashAPIToken("smctf_abd") {
+		t.Fatal("expected different hashes")
+	}
+}
+
+func TestAPITokenDisplayPrefix(t *testing.T) {
+	token := "smctf_abcdefghijkl"
+	prefix := APITokenDisplayPrefix(token)
+
+	if prefix != "smctf_abcdef" || !strings.HasPrefix(token, prefix) {
+		t.Fatalf("unexpected prefix %s", prefix)
+	}
+
+	if APITokenDisplayPrefix("smctf_") != "smctf_" {
+		t.Fatal("expected short token unchanged")
+	}
+}
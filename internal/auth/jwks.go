@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+
+	"smctf/internal/config"
+)
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Current signing key first, then previous keys that still verify
+func verificationKeys(cfg config.JWTConfig) []crypto.PublicKey {
+	keys := make([]crypto.PublicKey, 0, len(cfg.PublicKeys)+1)
+	if cfg.PrivateKey != nil {
+		keys = append(keys, cfg.PrivateKey.Public())
+	}
+
+	return append(keys, cfg.PublicKeys...)
+}
+
+// RFC 7638 thumbprint, used as the kid header
+func KeyID(key crypto.PublicKey) (string, error) {
+	var canonical any
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		canonical = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{E: encodeInt(k.E), Kty: "RSA", N: base64.RawURLEncoding.EncodeToString(k.N.Bytes())}
+	case ed25519.PublicKey:
+		canonical = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{Crv: "Ed25519", Kty: "OKP", X: base64.RawURLEncoding.EncodeToString(k)}
+	default:
+		return "", errors.New("unsupported key type")
+	}
+
+	payload, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func JWKS(cfg config.JWTConfig) (JWKSet, error) {
+	set := JWKSet{Keys: []JWK{}}
+	if !cfg.Asymmetric() {
+		return set, nil
+	}
+
+	for _, key := range verificationKeys(cfg) {
+		kid, err := KeyID(key)
+		if err != nil {
+			return JWKSet{}, err
+		}
+
+		jwk := JWK{Kid: kid, Use: "sig", Alg: cfg.Algorithm}
+		switch k := key.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = encodeInt(k.E)
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+func encodeInt(v int) string {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(v)).Bytes())
+}
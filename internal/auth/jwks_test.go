@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"smctf/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newEdDSAConfig(t *testing.T) config.JWTConfig {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+
+	return config.JWTConfig{
+		Issuer:     "test-issuer",
+		AccessTTL:  time.Hour,
+		RefreshTTL: 24 * time.Hour,
+		Algorithm:  config.JWTAlgorithmEdDSA,
+		PrivateKey: privateKey,
+	}
+}
+
+func TestAsymmetricTokenRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+
+	rsaCfg := config.JWTConfig{
+		Issuer:     "test-issuer",
+		AccessTTL:  time.Hour,
+		RefreshTTL: 24 * time.Hour,
+		Algorithm:  config.JWTAlgorithmRS256,
+		PrivateKey: rsaKey,
+	}
+
+	for _, cfg := range []config.JWTConfig{newEdDSAConfig(t), rsaCfg} {
+		t.Run(cfg.Algorithm, func(t *testing.T) {
+			token, err := GenerateAccessToken(cfg, 7, "user", "session-1")
+			if err != nil {
+				t.Fatalf("GenerateAccessToken failed: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatalf("parse unverified: %v", err)
+			}
+
+			kid, _ := KeyID(cfg.PrivateKey.Public())
+			if parsed.Header["kid"] != kid || parsed.Method.Alg() != cfg.Algorithm {
+				t.Fatalf("unexpected header: %v", parsed.Header)
+			}
+
+			claims, err := ParseToken(cfg, token)
+			if err != nil {
+				t.Fatalf("ParseToken failed: %v", err)
+			}
+
+			if claims.UserID != 7 || claims.SessionID != "session-1" {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestAsymmetricKeyRotation(t *testing.T) {
+	oldCfg := newEdDSAConfig(t)
+	token, err := GenerateAccessToken(oldCfg, 7, "user", "")
+	if err != nil {
+		t.Fatalf("GenerateAccessToken failed: %v", err)
+	}
+
+	rotated := newEdDSAConfig(t)
+	if _, err := ParseToken(rotated, token); err == nil {
+		t.Fatal("expected unknown key id error, got nil")
+	}
+
+	rotated.PublicKeys = append(rotated.PublicKeys, oldCfg.PrivateKey.Public())
+	if _, err := ParseToken(rotated, token); err != nil {
+		t.Fatalf("expected previous key to verify, got %v", err)
+	}
+
+	hmacCfg := oldCfg
+	hmacCfg.Algorithm = config.JWTAlgorithmHS256
+	hmacCfg.Secret = "test-secret"
+	if _, err := ParseToken(hmacCfg, token); err == nil {
+		t.Fatal("expected HS256 config to reject EdDSA token")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	set, err := JWKS(config.JWTConfig{Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("JWKS failed: %v", err)
+	}
+
+	if len(set.Keys) != 0 {
+		t.Fatalf("expected no keys for HS256, got %d", len(set.Keys))
+	}
+
+	previous := newEdDSAConfig(t)
+	cfg := newEdDSAConfig(t)
+	cfg.PublicKeys = append(cfg.PublicKeys, previous.PrivateKey.Public())
+
+	set, err = JWKS(cfg)
+	if err != nil {
+		t.Fatalf("JWKS failed: %v", err)
+	}
+
+	if len(set.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(set.Keys))
+	}
+
+	kid, _ := KeyID(cfg.PrivateKey.Public())
+	key := set.Keys[0]
+	if key.Kid != kid || key.Kty != "OKP" || key.Crv != "Ed25519" || key.Alg != config.JWTAlgorithmEdDSA || key.Use != "sig" || key.X == "" {
+		t.Fatalf("unexpected jwk: %+v", key)
+	}
+}
+
+func TestKeyIDRFC7638(t *testing.T) {
+	// Example key from RFC 8037 appendix A.3
+	x := []byte{0xd7, 0x5a, 0x98, 0x01, 0x82, 0xb1, 0x0a, 0xb7, 0xd5, 0x4b, 0xfe, 0xd3, 0xc9, 0x64, 0x07, 0x3a,
+		0x0e, 0xe1, 0x72, 0xf3, 0xda, 0xa6, 0x23, 0x25, 0xaf, 0x02, 0x1a, 0x68, 0xf7, 0x07, 0x51, 0x1a}
+
+	kid, err := KeyID(ed25519.PublicKey(x))
+	if err != nil {
+		t.Fatalf("KeyID failed: %v", err)
+	}
+
+	if kid != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Fatalf("unexpected thumbprint %s", kid)
+	}
+}
@@ -10,9 +10,10 @@ import (
 )
 
 type Claims struct {
-	UserID int64  `json:"uid"`
-	Role   string `json:"role"`
-	Type   string `json:"typ"`
+	UserID    int64  `json:"uid"`
+	Role      string `json:"role"`
+	Type      string `json:"typ"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -21,29 +22,30 @@ const (
 	TokenTypeRefresh = "refresh"
 )
 
-func GenerateAccessToken(cfg config.JWTConfig, userID int64, role string) (string, error) {
+func GenerateAccessToken(cfg config.JWTConfig, userID int64, role, sessionID string) (string, error) {
 	now := time.Now().UTC()
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
-		Type:   TokenTypeAccess,
+		UserID:    userID,
+		Role:      role,
+		Type:      TokenTypeAccess,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    cfg.Issuer,
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.AccessTTL)),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString([]byte(cfg.Secret))
+	return signToken(cfg, claims)
 }
 
-func GenerateRefreshToken(cfg config.JWTConfig, userID int64, role, jti string) (string, error) {
+func GenerateRefreshToken(cfg config.JWTConfig, userID int64, role, sessionID, jti string) (string, error) {
 	now := time.Now().UTC()
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
-		Type:   TokenTypeRefresh,
+		UserID:    userID,
+		Role:      role,
+		Type:      TokenTypeRefresh,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        jti,
 			Issuer:    cfg.Issuer,
@@ -51,18 +53,56 @@ func GenerateRefreshToken(cfg config.JWTConfig, userID int64, role, jti string)
 			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.RefreshTTL)),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString([]byte(cfg.Secret))
+	return signToken(cfg, claims)
+}
+
+func signToken(cfg config.JWTConfig, claims Claims) (string, error) {
+	if !cfg.Asymmetric() {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.Secret))
+	}
+
+	if cfg.PrivateKey == nil {
+		return "", errors.New("missing signing key")
+	}
+
+	kid, err := KeyID(cfg.PrivateKey.Public())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(cfg.Algorithm), claims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(cfg.PrivateKey)
 }
 
 func parseTokenWithClaims(cfg config.JWTConfig, tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
 	return jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if !cfg.Asymmetric() {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("unexpected signing method")
+			}
+
+			return []byte(cfg.Secret), nil
+		}
+
+		if token.Method.Alg() != cfg.Algorithm {
 			return nil, errors.New("unexpected signing method")
 		}
 
-		return []byte(cfg.Secret), nil
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("missing key id")
+		}
+
+		for _, key := range verificationKeys(cfg) {
+			if id, err := KeyID(key); err == nil && id == kid {
+				return key, nil
+			}
+		}
+
+		return nil, errors.New("unknown key id")
 	})
 }
 
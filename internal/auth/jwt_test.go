@@ -20,7 +20,7 @@ func TestGenerateAccessToken(t *testing.T) {
 		RefreshTTL: 24 * time.Hour,
 	}
 
-	token, err := GenerateAccessToken(cfg, 42, "admin")
+	token, err := GenerateAccessToken(cfg, 42, "admin", "session-1")
 	if err != nil {
 		t.Fatalf("GenerateAccessToken failed: %v", err)
 	}
@@ -46,6 +46,10 @@ func TestGenerateAccessToken(t *testing.T) {
 		t.Errorf("expected Type %s, got %s", TokenTypeAccess, claims.Type)
 	}
 
+	if claims.SessionID != "session-1" {
+		t.Errorf("expected SessionID session-1, got %s", claims.SessionID)
+	}
+
 	if claims.Issuer != cfg.Issuer {
 		t.Errorf("expected Issuer %s, got %s", cfg.Issuer, claims.Issuer)
 	}
@@ -60,7 +64,7 @@ func TestGenerateRefreshToken(t *testing.T) {
 	}
 
 	jti := "test-jti-123"
-	token, err := GenerateRefreshToken(cfg, 42, "user", jti)
+	token, err := GenerateRefreshToken(cfg, 42, "user", "session-1", jti)
 	if err != nil {
 		t.Fatalf("GenerateRefreshToken failed: %v", err)
 	}
@@ -90,6 +94,10 @@ func TestGenerateRefreshToken(t *testing.T) {
 		t.Errorf("expected JTI %s, got %s", jti, claims.ID)
 	}
 
+	if claims.SessionID != "session-1" {
+		t.Errorf("expected SessionID session-1, got %s", claims.SessionID)
+	}
+
 	if claims.Issuer != cfg.Issuer {
 		t.Errorf("expected Issuer %s, got %s", cfg.Issuer, claims.Issuer)
 	}
@@ -129,7 +137,7 @@ func TestParseTokenWrongSecret(t *testing.T) {
 		RefreshTTL: 24 * time.Hour,
 	}
 
-	token, err := GenerateAccessToken(cfg, 42, "admin")
+	token, err := GenerateAccessToken(cfg, 42, "admin", "")
 	if err != nil {
 		t.Fatalf("GenerateAccessToken failed: %v", err)
 	}
@@ -151,7 +159,7 @@ func TestParseTokenWrongIssuer(t *testing.T) {
 		RefreshTTL: 24 * time.Hour,
 	}
 
-	token, err := GenerateAccessToken(cfg, 42, "admin")
+	token, err := GenerateAccessToken(cfg, 42, "admin", "")
 	if err != nil {
 		t.Fatalf("GenerateAccessToken failed: %v", err)
 	}
@@ -173,7 +181,7 @@ func TestParseTokenExpiredToken(t *testing.T) {
 		RefreshTTL: 24 * time.Hour,
 	}
 
-	token, err := GenerateAccessToken(cfg, 42, "admin")
+	token, err := GenerateAccessToken(cfg, 42, "admin", "")
 	if err != nil {
 		t.Fatalf("GenerateAccessToken failed: %v", err)
 	}
@@ -0,0 +1,71 @@
+package auth
+
+const (
+	RoleUser            = "user"
+	RoleAdmin           = "admin"
+	RoleChallengeAuthor = "challenge_author"
+	RoleReviewer        = "reviewer"
+	RoleSupport         = "support"
+)
+
+const (
+	PermChallengesRead        = "challenges:read"
+	PermChallengesWrite       = "challenges:write"
+	PermChallengesAny         = "challenges:any"
+	PermConfigWrite           = "config:write"
+	PermRegistrationKeysRead  = "registration_keys:read"
+	PermRegistrationKeysWrite = "registration_keys:write"
+	PermStacksRead            = "stacks:read"
+	PermStacksWrite           = "stacks:write"
+	PermTeamsWrite            = "teams:write"
+	PermUsersRead             = "users:read"
+	PermUsersManage           = "users:manage"
+	PermRolesManage           = "roles:manage"
+)
+
+// Without challenges:any, challenge permissions only cover challenges the user authored
+var rolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermChallengesRead, PermChallengesWrite, PermChallengesAny,
+		PermConfigWrite,
+		PermRegistrationKeysRead, PermRegistrationKeysWrite,
+		PermStacksRead, PermStacksWrite,
+		PermTeamsWrite,
+		PermUsersRead, PermUsersManage,
+		PermRolesManage,
+	},
+	RoleChallengeAuthor: {
+		PermChallengesRead, PermChallengesWrite,
+	},
+	RoleReviewer: {
+		PermChallengesRead, PermChallengesAny,
+		PermRegistrationKeysRead,
+		PermStacksRead,
+		PermUsersRead,
+	},
+	RoleSupport: {
+		PermRegistrationKeysRead, PermRegistrationKeysWrite,
+		PermStacksRead, PermStacksWrite,
+		PermTeamsWrite,
+		PermUsersRead, PermUsersManage,
+	},
+}
+
+func ValidRole(role string) bool {
+	if role == RoleUser {
+		return true
+	}
+
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
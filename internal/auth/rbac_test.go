@@ -0,0 +1,46 @@
+package auth
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	cases := []struct {
+		role       string
+		permission string
+		want       bool
+	}{
+		{RoleAdmin, PermRolesManage, true},
+		{RoleAdmin, PermChallengesAny, true},
+		{RoleChallengeAuthor, PermChallengesWrite, true},
+		{RoleChallengeAuthor, PermChallengesAny, false},
+		{RoleReviewer, PermChallengesRead, true},
+		{RoleReviewer, PermChallengesWrite, false},
+		{RoleSupport, PermUsersManage, true},
+		{RoleSupport, PermConfigWrite, false},
+		{RoleSupport, PermStacksWrite, true},
+		{RoleReviewer, PermStacksRead, true},
+		{RoleReviewer, PermStacksWrite, false},
+		{RoleReviewer, PermUsersRead, true},
+		{RoleReviewer, PermUsersManage, false},
+		{RoleSupport, PermUsersRead, true},
+		{RoleUser, PermChallengesRead, false},
+		{"unknown", PermChallengesRead, false},
+	}
+
+	for _, tc := range cases {
+		if got := HasPermission(tc.role, tc.permission); got != tc.want {
+			t.Fatalf("HasPermission(%q, %q) = %v, want %v", tc.role, tc.permission, got, tc.want)
+		}
+	}
+}
+
+func TestValidRole(t *testing.T) {
+	for _, role := range []string{RoleUser, RoleAdmin, RoleChallengeAuthor, RoleReviewer, RoleSupport} {
+		if !ValidRole(role) {
+			t.Fatalf("expected %q to be valid", role)
+		}
+	}
+
+	if ValidRole("superuser") || ValidRole("") {
+		t.Fatal("expected unknown roles to be invalid")
+	}
+}
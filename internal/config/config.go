@@ -1,8 +1,10 @@
 package config
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
@@ -19,15 +21,16 @@ type Config struct {
 	AutoMigrate        bool
 	PasswordBcryptCost int
 
-	DB       DBConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	Security SecurityConfig
-	Cache    CacheConfig
-	CORS     CORSConfig
-	Logging  LoggingConfig
-	S3       S3Config
-	Stack    StackConfig
+	DB        DBConfig
+	Redis     RedisConfig
+	JWT       JWTConfig
+	Security  SecurityConfig
+	Cache     CacheConfig
+	CORS      CORSConfig
+	RateLimit RateLimitConfig
+	Logging   LoggingConfig
+	S3        S3Config
+	Stack     StackConfig
 }
 
 type DBConfig struct {
@@ -50,16 +53,32 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	Issuer     string
-	AccessTTL  time.Duration
-	RefreshTTL time.Duration
+	Secret             string
+	Issuer             string
+	AccessTTL          time.Duration
+	RefreshTTL         time.Duration
+	RevocationCacheTTL time.Duration
+	Algorithm          string
+	PrivateKeyFile     string
+	PublicKeyFiles     []string
+	PrivateKey         crypto.Signer
+	PublicKeys         []crypto.PublicKey
 }
 
 type SecurityConfig struct {
-	FlagHMACSecret   string
-	SubmissionWindow time.Duration
-	SubmissionMax    int
+	FlagHMACSecret         string
+	SubmissionWindow       time.Duration
+	SubmissionMax          int
+	SubmissionTeamMax      int
+	SubmissionIPMax        int
+	SubmissionChallengeMax int
+	SubmissionGlobalMax    int
+	LoginWindow            time.Duration
+	LoginAccountMax        int
+	LoginIPMax             int
+	LoginLockoutBase       time.Duration
+	LoginLockoutMax        time.Duration
+	PoWTTL                 time.Duration
 }
 
 type CacheConfig struct {
@@ -72,6 +91,15 @@ type CORSConfig struct {
 	AllowedOrigins []string
 }
 
+type RateLimitConfig struct {
+	Window         time.Duration
+	PublicMax      int
+	AuthMax        int
+	APIMax         int
+	Allowlist      []netip.Prefix
+	TrustedProxies []string
+}
+
 type LoggingConfig struct {
 	Dir               string
 	FilePrefix        string
@@ -97,13 +125,34 @@ type S3Config struct {
 }
 
 type StackConfig struct {
-	Enabled            bool
-	MaxPerUser         int
-	ProvisionerBaseURL string
-	ProvisionerAPIKey  string
-	ProvisionerTimeout time.Duration
-	CreateWindow       time.Duration
-	CreateMax          int
+	Enabled               bool
+	MaxPerUser            int
+	MaxPerTeam            int
+	ProvisionerBaseURL    string
+	ProvisionerAPIKey     string
+	ProvisionerTimeout    time.Duration
+	ProvisionerRetries    int
+	BreakerThreshold      int
+	BreakerCooldown       time.Duration
+	CreateWindow          time.Duration
+	CreateMax             int
+	CreateGlobalMax       int
+	ReaperInterval        time.Duration
+	ExtendDuration        time.Duration
+	ExtendMax             int
+	MaxLifetime           time.Duration
+	ProvisionWorkers      int
+	ProvisionQueue        int
+	MaxActive             int
+	MaxActivePerChallenge int
+	MaxCPUMilli           int
+	MaxMemoryMB           int
+	PodAllowPrivileged    bool
+	PodAllowHostAccess    bool
+	PodRequireLimits      bool
+	PodAllowedRegistries  []string
+	CallbackSecret        string
+	StatusMaxAge          time.Duration
 }
 
 const (
@@ -175,6 +224,20 @@ func Load() (Config, error) {
 		errs = append(errs, err)
 	}
 
+	jwtRevocationCacheTTL, err := getDuration("JWT_REVOCATION_CACHE_TTL", 5*time.Second)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	jwtAlgorithm := getEnv("JWT_ALGORITHM", JWTAlgorithmHS256)
+
+	jwtPrivateKeyFile := getEnv("JWT_PRIVATE_KEY_FILE", "")
+	jwtPublicKeyFiles := parseCSV(getEnv("JWT_PUBLIC_KEY_FILES", ""))
+	jwtPrivateKey, jwtPublicKeys, err := loadJWTKeys(jwtPrivateKeyFile, jwtPublicKeyFiles)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	submitWindow, err := getDuration("SUBMIT_WINDOW", 1*time.Minute)
 	if err != nil {
 		errs = append(errs, err)
@@ -185,6 +248,56 @@ func Load() (Config, error) {
 		errs = append(errs, err)
 	}
 
+	submitTeamMax, err := getEnvInt("SUBMIT_TEAM_MAX", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	submitIPMax, err := getEnvInt("SUBMIT_IP_MAX", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	submitChallengeMax, err := getEnvInt("SUBMIT_CHALLENGE_MAX", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	submitGlobalMax, err := getEnvInt("SUBMIT_GLOBAL_MAX", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	loginWindow, err := getDuration("LOGIN_WINDOW", 15*time.Minute)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	loginAccountMax, err := getEnvInt("LOGIN_ACCOUNT_MAX", 5)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	loginIPMax, err := getEnvInt("LOGIN_IP_MAX", 30)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	loginLockoutBase, err := getDuration("LOGIN_LOCKOUT_BASE", 1*time.Minute)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	loginLockoutMax, err := getDuration("LOGIN_LOCKOUT_MAX", 1*time.Hour)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	powTTL, err := getDuration("POW_TTL", 5*time.Minute)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	timelineCacheTTL, err := getDuration("TIMELINE_CACHE_TTL", 60*time.Second)
 	if err != nil {
 		errs = append(errs, err)
@@ -202,6 +315,36 @@ func Load() (Config, error) {
 
 	corsAllowedOrigins := parseCSV(getEnv("CORS_ALLOWED_ORIGINS", ""))
 
+	rateLimitWindow, err := getDuration("RATE_LIMIT_WINDOW", time.Minute)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitPublicMax, err := getEnvInt("RATE_LIMIT_PUBLIC_MAX", 240)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitAuthMax, err := getEnvInt("RATE_LIMIT_AUTH_MAX", 60)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitAPIMax, err := getEnvInt("RATE_LIMIT_API_MAX", 600)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitAllowlist, err := parseIPPrefixes("RATE_LIMIT_ALLOWLIST", parseCSV(getEnv("RATE_LIMIT_ALLOWLIST", "")))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	trustedProxies := parseCSV(getEnv("TRUSTED_PROXIES", ""))
+	if _, err := parseIPPrefixes("TRUSTED_PROXIES", trustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+
 	logDir := getEnv("LOG_DIR", "logs")
 	logPrefix := getEnv("LOG_FILE_PREFIX", "app")
 	logMaxBodyBytes, err := getEnvInt("LOG_MAX_BODY_BYTES", 1024*1024)
@@ -259,6 +402,11 @@ func Load() (Config, error) {
 		errs = append(errs, err)
 	}
 
+	stackMaxPerTeam, err := getEnvInt("STACKS_MAX_PER_TEAM", 3)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	stackTimeout, err := getDuration("STACKS_PROVISIONER_TIMEOUT", 5*time.Second)
 	if err != nil {
 		errs = append(errs, err)
@@ -274,6 +422,96 @@ func Load() (Config, error) {
 		errs = append(errs, err)
 	}
 
+	stackCreateGlobalMax, err := getEnvInt("STACKS_CREATE_GLOBAL_MAX", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackReaperInterval, err := getDuration("STACKS_REAPER_INTERVAL", time.Minute)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackExtendDuration, err := getDuration("STACKS_EXTEND_DURATION", 30*time.Minute)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackExtendMax, err := getEnvInt("STACKS_EXTEND_MAX", 2)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackMaxLifetime, err := getDuration("STACKS_MAX_LIFETIME", 4*time.Hour)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackProvisionWorkers, err := getEnvInt("STACKS_PROVISION_WORKERS", 4)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackProvisionQueue, err := getEnvInt("STACKS_PROVISION_QUEUE", 100)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackMaxActive, err := getEnvInt("STACKS_MAX_ACTIVE", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackMaxActivePerChallenge, err := getEnvInt("STACKS_MAX_ACTIVE_PER_CHALLENGE", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackMaxCPUMilli, err := getEnvInt("STACKS_MAX_CPU_MILLI", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackMaxMemoryMB, err := getEnvInt("STACKS_MAX_MEMORY_MB", 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackPodAllowPrivileged, err := getEnvBool("STACKS_POD_ALLOW_PRIVILEGED", false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackPodAllowHostAccess, err := getEnvBool("STACKS_POD_ALLOW_HOST_ACCESS", false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackPodRequireLimits, err := getEnvBool("STACKS_POD_REQUIRE_LIMITS", true)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackStatusMaxAge, err := getDuration("STACKS_STATUS_MAX_AGE", 15*time.Second)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackProvisionerRetries, err := getEnvInt("STACKS_PROVISIONER_RETRIES", 2)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackBreakerThreshold, err := getEnvInt("STACKS_PROVISIONER_BREAKER_THRESHOLD", 5)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stackBreakerCooldown, err := getDuration("STACKS_PROVISIONER_BREAKER_COOLDOWN", 30*time.Second)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	cfg := Config{
 		AppEnv:             appEnv,
 		HTTPAddr:           httpAddr,
@@ -298,15 +536,31 @@ func Load() (Config, error) {
 			PoolSize: redisPoolSize,
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", defaultJWTSecret),
-			Issuer:     getEnv("JWT_ISSUER", "smctf"),
-			AccessTTL:  jwtAccessTTL,
-			RefreshTTL: jwtRefreshTTL,
+			Secret:             getEnv("JWT_SECRET", defaultJWTSecret),
+			Issuer:             getEnv("JWT_ISSUER", "smctf"),
+			AccessTTL:          jwtAccessTTL,
+			RefreshTTL:         jwtRefreshTTL,
+			RevocationCacheTTL: jwtRevocationCacheTTL,
+			Algorithm:          jwtAlgorithm,
+			PrivateKeyFile:     jwtPrivateKeyFile,
+			PublicKeyFiles:     jwtPublicKeyFiles,
+			PrivateKey:         jwtPrivateKey,
+			PublicKeys:         jwtPublicKeys,
 		},
 		Security: SecurityConfig{
-			FlagHMACSecret:   getEnv("FLAG_HMAC_SECRET", defaultFlagSecret),
-			SubmissionWindow: submitWindow,
-			SubmissionMax:    submitMax,
+			FlagHMACSecret:         getEnv("FLAG_HMAC_SECRET", defaultFlagSecret),
+			SubmissionWindow:       submitWindow,
+			SubmissionMax:          submitMax,
+			SubmissionTeamMax:      submitTeamMax,
+			SubmissionIPMax:        submitIPMax,
+			SubmissionChallengeMax: submitChallengeMax,
+			SubmissionGlobalMax:    submitGlobalMax,
+			LoginWindow:            loginWindow,
+			LoginAccountMax:        loginAccountMax,
+			LoginIPMax:             loginIPMax,
+			LoginLockoutBase:       loginLockoutBase,
+			LoginLockoutMax:        loginLockoutMax,
+			PoWTTL:                 powTTL,
 		},
 		Cache: CacheConfig{
 			TimelineTTL:    timelineCacheTTL,
@@ -316,6 +570,14 @@ func Load() (Config, error) {
 		CORS: CORSConfig{
 			AllowedOrigins: corsAllowedOrigins,
 		},
+		RateLimit: RateLimitConfig{
+			Window:         rateLimitWindow,
+			PublicMax:      rateLimitPublicMax,
+			AuthMax:        rateLimitAuthMax,
+			APIMax:         rateLimitAPIMax,
+			Allowlist:      rateLimitAllowlist,
+			TrustedProxies: trustedProxies,
+		},
 		Logging: LoggingConfig{
 			Dir:               logDir,
 			FilePrefix:        logPrefix,
@@ -339,13 +601,34 @@ func Load() (Config, error) {
 			PresignTTL:      s3PresignTTL,
 		},
 		Stack: StackConfig{
-			Enabled:            stackEnabled,
-			MaxPerUser:         stackMaxPerUser,
-			ProvisionerBaseURL: getEnv("STACKS_PROVISIONER_BASE_URL", "http://localhost:8081"),
-			ProvisionerAPIKey:  getEnv("STACKS_PROVISIONER_API_KEY", ""),
-			ProvisionerTimeout: stackTimeout,
-			CreateWindow:       stackCreateWindow,
-			CreateMax:          stackCreateMax,
+			Enabled:               stackEnabled,
+			MaxPerUser:            stackMaxPerUser,
+			MaxPerTeam:            stackMaxPerTeam,
+			ProvisionerBaseURL:    getEnv("STACKS_PROVISIONER_BASE_URL", "http://localhost:8081"),
+			ProvisionerAPIKey:     getEnv("STACKS_PROVISIONER_API_KEY", ""),
+			ProvisionerTimeout:    stackTimeout,
+			ProvisionerRetries:    stackProvisionerRetries,
+			BreakerThreshold:      stackBreakerThreshold,
+			BreakerCooldown:       stackBreakerCooldown,
+			CreateWindow:          stackCreateWindow,
+			CreateMax:             stackCreateMax,
+			CreateGlobalMax:       stackCreateGlobalMax,
+			ReaperInterval:        stackReaperInterval,
+			ExtendDuration:        stackExtendDuration,
+			ExtendMax:             stackExtendMax,
+			MaxLifetime:           stackMaxLifetime,
+			ProvisionWorkers:      stackProvisionWorkers,
+			ProvisionQueue:        stackProvisionQueue,
+			MaxActive:             stackMaxActive,
+			MaxActivePerChallenge: stackMaxActivePerChallenge,
+			MaxCPUMilli:           stackMaxCPUMilli,
+			MaxMemoryMB:           stackMaxMemoryMB,
+			PodAllowPrivileged:    stackPodAllowPrivileged,
+			PodAllowHostAccess:    stackPodAllowHostAccess,
+			PodRequireLimits:      stackPodRequireLimits,
+			PodAllowedRegistries:  parseCSV(getEnv("STACKS_POD_ALLOWED_REGISTRIES", "")),
+			CallbackSecret:        getEnv("STACKS_CALLBACK_SECRET", ""),
+			StatusMaxAge:          stackStatusMaxAge,
 		},
 	}
 
@@ -444,8 +727,24 @@ func validateConfig(cfg Config) error {
 	}
 
 	// JWT validation
-	if cfg.JWT.Secret == "" {
-		errs = append(errs, errors.New("JWT_SECRET must not be empty"))
+	switch cfg.JWT.Algorithm {
+	case "", JWTAlgorithmHS256:
+		if cfg.JWT.Secret == "" {
+			errs = append(errs, errors.New("JWT_SECRET must not be empty"))
+		}
+	case JWTAlgorithmRS256, JWTAlgorithmEdDSA:
+		if cfg.JWT.PrivateKey == nil {
+			errs = append(errs, errors.New("JWT_PRIVATE_KEY_FILE must be set for asymmetric JWT_ALGORITHM"))
+		} else if err := checkJWTKeyType(cfg.JWT.Algorithm, cfg.JWT.PrivateKey.Public()); err != nil {
+			errs = append(errs, err)
+		}
+		for _, key := range cfg.JWT.PublicKeys {
+			if err := checkJWTKeyType(cfg.JWT.Algorithm, key); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	default:
+		errs = append(errs, errors.New("JWT_ALGORITHM must be HS256, RS256 or EdDSA"))
 	}
 	if cfg.JWT.Issuer == "" {
 		errs = append(errs, errors.New("JWT_ISSUER must not be empty"))
@@ -453,6 +752,9 @@ func validateConfig(cfg Config) error {
 	if cfg.JWT.AccessTTL <= 0 || cfg.JWT.RefreshTTL <= 0 {
 		errs = append(errs, errors.New("JWT_ACCESS_TTL and JWT_REFRESH_TTL must be positive"))
 	}
+	if cfg.JWT.RevocationCacheTTL < 0 {
+		errs = append(errs, errors.New("JWT_REVOCATION_CACHE_TTL must not be negative"))
+	}
 
 	// Security validation
 	if cfg.Security.FlagHMACSecret == "" {
@@ -461,10 +763,30 @@ func validateConfig(cfg Config) error {
 	if cfg.Security.SubmissionWindow <= 0 || cfg.Security.SubmissionMax <= 0 {
 		errs = append(errs, errors.New("SUBMIT_WINDOW and SUBMIT_MAX must be positive"))
 	}
+	if cfg.Security.SubmissionTeamMax < 0 || cfg.Security.SubmissionIPMax < 0 || cfg.Security.SubmissionChallengeMax < 0 || cfg.Security.SubmissionGlobalMax < 0 {
+		errs = append(errs, errors.New("SUBMIT_TEAM_MAX, SUBMIT_IP_MAX, SUBMIT_CHALLENGE_MAX and SUBMIT_GLOBAL_MAX must not be negative"))
+	}
+	if cfg.Security.LoginWindow <= 0 || cfg.Security.LoginAccountMax <= 0 || cfg.Security.LoginIPMax <= 0 {
+		errs = append(errs, errors.New("LOGIN_WINDOW, LOGIN_ACCOUNT_MAX and LOGIN_IP_MAX must be positive"))
+	}
+	if cfg.Security.LoginLockoutBase <= 0 || cfg.Security.LoginLockoutMax < cfg.Security.LoginLockoutBase {
+		errs = append(errs, errors.New("LOGIN_LOCKOUT_BASE must be positive and not exceed LOGIN_LOCKOUT_MAX"))
+	}
+	if cfg.Security.PoWTTL <= 0 {
+		errs = append(errs, errors.New("POW_TTL must be positive"))
+	}
+
+	// Rate limit validation
+	if cfg.RateLimit.Window <= 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_WINDOW must be positive"))
+	}
+	if cfg.RateLimit.PublicMax < 0 || cfg.RateLimit.AuthMax < 0 || cfg.RateLimit.APIMax < 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_PUBLIC_MAX, RATE_LIMIT_AUTH_MAX and RATE_LIMIT_API_MAX must not be negative"))
+	}
 
 	// Production-specific validation
 	if cfg.AppEnv == "production" {
-		if cfg.JWT.Secret == defaultJWTSecret {
+		if !cfg.JWT.Asymmetric() && cfg.JWT.Secret == defaultJWTSecret {
 			errs = append(errs, errors.New("JWT_SECRET must be set in production"))
 		}
 		if cfg.Security.FlagHMACSecret == defaultFlagSecret {
@@ -523,6 +845,9 @@ func validateConfig(cfg Config) error {
 		if cfg.Stack.MaxPerUser <= 0 {
 			errs = append(errs, errors.New("STACKS_MAX_PER_USER must be positive"))
 		}
+		if cfg.Stack.MaxPerTeam <= 0 {
+			errs = append(errs, errors.New("STACKS_MAX_PER_TEAM must be positive"))
+		}
 		if cfg.Stack.ProvisionerBaseURL == "" {
 			errs = append(errs, errors.New("STACKS_PROVISIONER_BASE_URL must not be empty"))
 		}
@@ -532,12 +857,66 @@ func validateConfig(cfg Config) error {
 		if cfg.Stack.ProvisionerAPIKey == "" {
 			errs = append(errs, errors.New("STACKS_PROVISIONER_API_KEY must not be empty"))
 		}
+		if cfg.Stack.ProvisionerRetries < 0 {
+			errs = append(errs, errors.New("STACKS_PROVISIONER_RETRIES must not be negative"))
+		}
+		if cfg.Stack.BreakerThreshold < 0 {
+			errs = append(errs, errors.New("STACKS_PROVISIONER_BREAKER_THRESHOLD must not be negative"))
+		}
+		if cfg.Stack.BreakerThreshold > 0 && cfg.Stack.BreakerCooldown <= 0 {
+			errs = append(errs, errors.New("STACKS_PROVISIONER_BREAKER_COOLDOWN must be positive"))
+		}
 		if cfg.Stack.CreateWindow <= 0 {
 			errs = append(errs, errors.New("STACKS_CREATE_WINDOW must be positive"))
 		}
 		if cfg.Stack.CreateMax <= 0 {
 			errs = append(errs, errors.New("STACKS_CREATE_MAX must be positive"))
 		}
+		if cfg.Stack.CreateGlobalMax < 0 {
+			errs = append(errs, errors.New("STACKS_CREATE_GLOBAL_MAX must not be negative"))
+		}
+		if cfg.Stack.ReaperInterval < 0 {
+			errs = append(errs, errors.New("STACKS_REAPER_INTERVAL must not be negative"))
+		}
+		if cfg.Stack.ExtendDuration <= 0 {
+			errs = append(errs, errors.New("STACKS_EXTEND_DURATION must be positive"))
+		}
+		if cfg.Stack.ExtendMax < 0 {
+			errs = append(errs, errors.New("STACKS_EXTEND_MAX must not be negative"))
+		}
+		if cfg.Stack.MaxLifetime <= 0 {
+			errs = append(errs, errors.New("STACKS_MAX_LIFETIME must be positive"))
+		}
+		if cfg.Stack.ProvisionWorkers < 0 {
+			errs = append(errs, errors.New("STACKS_PROVISION_WORKERS must not be negative"))
+		}
+		if cfg.Stack.ProvisionWorkers > 0 && cfg.Stack.ProvisionQueue <= 0 {
+			errs = append(errs, errors.New("STACKS_PROVISION_QUEUE must be positive"))
+		}
+		if cfg.Stack.MaxActive < 0 {
+			errs = append(errs, errors.New("STACKS_MAX_ACTIVE must not be negative"))
+		}
+		if cfg.Stack.MaxActivePerChallenge < 0 {
+			errs = append(errs, errors.New("STACKS_MAX_ACTIVE_PER_CHALLENGE must not be negative"))
+		}
+		if cfg.Stack.MaxCPUMilli < 0 {
+			errs = append(errs, errors.New("STACKS_MAX_CPU_MILLI must not be negative"))
+		}
+		if cfg.Stack.MaxMemoryMB < 0 {
+			errs = append(errs, errors.New("STACKS_MAX_MEMORY_MB must not be negative"))
+		}
+		// Admission provisions waiting stacks on whatever request or reaper run freed the slot, so it needs workers
+		if cfg.Stack.ProvisionWorkers == 0 && (cfg.Stack.MaxActive > 0 || cfg.Stack.MaxActivePerChallenge > 0 || cfg.Stack.MaxCPUMilli > 0 || cfg.Stack.MaxMemoryMB > 0) {
+			errs = append(errs, errors.New("STACKS_PROVISION_WORKERS must be positive when stack capacity limits are set"))
+		}
+		if cfg.Stack.StatusMaxAge < 0 {
+			errs = append(errs, errors.New("STACKS_STATUS_MAX_AGE must not be negative"))
+		}
+		for _, registry := range cfg.Stack.PodAllowedRegistries {
+			if strings.Contains(registry, "://") {
+				errs = append(errs, fmt.Errorf("STACKS_POD_ALLOWED_REGISTRIES: %q must not include a scheme", registry))
+			}
+		}
 	}
 
 	if len(errs) == 0 {
@@ -557,6 +936,7 @@ func Redact(cfg Config) Config {
 	cfg.S3.AccessKeyID = redact(cfg.S3.AccessKeyID)
 	cfg.S3.SecretAccessKey = redact(cfg.S3.SecretAccessKey)
 	cfg.Stack.ProvisionerAPIKey = redact(cfg.Stack.ProvisionerAPIKey)
+	cfg.Stack.CallbackSecret = redact(cfg.Stack.CallbackSecret)
 	return cfg
 }
 
@@ -574,6 +954,25 @@ func redact(value string) string {
 	return value[:visiblePrefix] + "***" + value[len(value)-visibleSuffix:]
 }
 
+// Accepts single addresses as well as CIDR ranges
+func parseIPPrefixes(key string, values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid address or CIDR %q", key, value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
 func parseCSV(value string) []string {
 	if value == "" {
 		return nil
@@ -618,15 +1017,36 @@ func FormatForLog(cfg Config) string {
 	fmt.Fprintf(&b, "  Issuer=%s\n", cfg.JWT.Issuer)
 	fmt.Fprintf(&b, "  AccessTTL=%s\n", cfg.JWT.AccessTTL)
 	fmt.Fprintf(&b, "  RefreshTTL=%s\n", cfg.JWT.RefreshTTL)
+	fmt.Fprintf(&b, "  RevocationCacheTTL=%s\n", cfg.JWT.RevocationCacheTTL)
+	fmt.Fprintf(&b, "  Algorithm=%s\n", cfg.JWT.Algorithm)
+	fmt.Fprintf(&b, "  PrivateKeyFile=%s\n", cfg.JWT.PrivateKeyFile)
+	fmt.Fprintf(&b, "  PublicKeyFiles=%s\n", strings.Join(cfg.JWT.PublicKeyFiles, ","))
 	fmt.Fprintln(&b, "Security:")
 	fmt.Fprintf(&b, "  FlagHMACSecret=%s\n", cfg.Security.FlagHMACSecret)
 	fmt.Fprintf(&b, "  SubmissionWindow=%s\n", cfg.Security.SubmissionWindow)
 	fmt.Fprintf(&b, "  SubmissionMax=%d\n", cfg.Security.SubmissionMax)
+	fmt.Fprintf(&b, "  SubmissionTeamMax=%d\n", cfg.Security.SubmissionTeamMax)
+	fmt.Fprintf(&b, "  SubmissionIPMax=%d\n", cfg.Security.SubmissionIPMax)
+	fmt.Fprintf(&b, "  SubmissionChallengeMax=%d\n", cfg.Security.SubmissionChallengeMax)
+	fmt.Fprintf(&b, "  SubmissionGlobalMax=%d\n", cfg.Security.SubmissionGlobalMax)
+	fmt.Fprintf(&b, "  LoginWindow=%s\n", cfg.Security.LoginWindow)
+	fmt.Fprintf(&b, "  LoginAccountMax=%d\n", cfg.Security.LoginAccountMax)
+	fmt.Fprintf(&b, "  LoginIPMax=%d\n", cfg.Security.LoginIPMax)
+	fmt.Fprintf(&b, "  LoginLockoutBase=%s\n", cfg.Security.LoginLockoutBase)
+	fmt.Fprintf(&b, "  LoginLockoutMax=%s\n", cfg.Security.LoginLockoutMax)
+	fmt.Fprintf(&b, "  PoWTTL=%s\n", cfg.Security.PoWTTL)
 	fmt.Fprintln(&b, "Cache:")
 	fmt.Fprintf(&b, "  TimelineTTL=%s\n", cfg.Cache.TimelineTTL)
 	fmt.Fprintf(&b, "  LeaderboardTTL=%s\n", cfg.Cache.LeaderboardTTL)
 	fmt.Fprintln(&b, "CORS:")
 	fmt.Fprintf(&b, "  AllowedOrigins=%s\n", strings.Join(cfg.CORS.AllowedOrigins, ","))
+	fmt.Fprintln(&b, "RateLimit:")
+	fmt.Fprintf(&b, "  Window=%s\n", cfg.RateLimit.Window)
+	fmt.Fprintf(&b, "  PublicMax=%d\n", cfg.RateLimit.PublicMax)
+	fmt.Fprintf(&b, "  AuthMax=%d\n", cfg.RateLimit.AuthMax)
+	fmt.Fprintf(&b, "  APIMax=%d\n", cfg.RateLimit.APIMax)
+	fmt.Fprintf(&b, "  Allowlist=%s\n", formatPrefixes(cfg.RateLimit.Allowlist))
+	fmt.Fprintf(&b, "  TrustedProxies=%s\n", strings.Join(cfg.RateLimit.TrustedProxies, ","))
 	fmt.Fprintln(&b, "Logging:")
 	fmt.Fprintf(&b, "  Dir=%s\n", cfg.Logging.Dir)
 	fmt.Fprintf(&b, "  FilePrefix=%s\n", cfg.Logging.FilePrefix)
@@ -650,10 +1070,40 @@ func FormatForLog(cfg Config) string {
 	fmt.Fprintln(&b, "Stack:")
 	fmt.Fprintf(&b, "  Enabled=%t\n", cfg.Stack.Enabled)
 	fmt.Fprintf(&b, "  MaxPerUser=%d\n", cfg.Stack.MaxPerUser)
+	fmt.Fprintf(&b, "  MaxPerTeam=%d\n", cfg.Stack.MaxPerTeam)
 	fmt.Fprintf(&b, "  ProvisionerBaseURL=%s\n", cfg.Stack.ProvisionerBaseURL)
 	fmt.Fprintf(&b, "  ProvisionerAPIKey=%s\n", cfg.Stack.ProvisionerAPIKey)
 	fmt.Fprintf(&b, "  ProvisionerTimeout=%s\n", cfg.Stack.ProvisionerTimeout)
+	fmt.Fprintf(&b, "  ProvisionerRetries=%d\n", cfg.Stack.ProvisionerRetries)
+	fmt.Fprintf(&b, "  BreakerThreshold=%d\n", cfg.Stack.BreakerThreshold)
+	fmt.Fprintf(&b, "  BreakerCooldown=%s\n", cfg.Stack.BreakerCooldown)
 	fmt.Fprintf(&b, "  CreateWindow=%s\n", cfg.Stack.CreateWindow)
 	fmt.Fprintf(&b, "  CreateMax=%d\n", cfg.Stack.CreateMax)
+	fmt.Fprintf(&b, "  CreateGlobalMax=%d\n", cfg.Stack.CreateGlobalMax)
+	fmt.Fprintf(&b, "  ReaperInterval=%s\n", cfg.Stack.ReaperInterval)
+	fmt.Fprintf(&b, "  ExtendDuration=%s\n", cfg.Stack.ExtendDuration)
+	fmt.Fprintf(&b, "  ExtendMax=%d\n", cfg.Stack.ExtendMax)
+	fmt.Fprintf(&b, "  MaxLifetime=%s\n", cfg.Stack.MaxLifetime)
+	fmt.Fprintf(&b, "  ProvisionWorkers=%d\n", cfg.Stack.ProvisionWorkers)
+	fmt.Fprintf(&b, "  ProvisionQueue=%d\n", cfg.Stack.ProvisionQueue)
+	fmt.Fprintf(&b, "  MaxActive=%d\n", cfg.Stack.MaxActive)
+	fmt.Fprintf(&b, "  MaxActivePerChallenge=%d\n", cfg.Stack.MaxActivePerChallenge)
+	fmt.Fprintf(&b, "  MaxCPUMilli=%d\n", cfg.Stack.MaxCPUMilli)
+	fmt.Fprintf(&b, "  MaxMemoryMB=%d\n", cfg.Stack.MaxMemoryMB)
+	fmt.Fprintf(&b, "  PodAllowPrivileged=%t\n", cfg.Stack.PodAllowPrivileged)
+	fmt.Fprintf(&b, "  PodAllowHostAccess=%t\n", cfg.Stack.PodAllowHostAccess)
+	fmt.Fprintf(&b, "  PodRequireLimits=%t\n", cfg.Stack.PodRequireLimits)
+	fmt.Fprintf(&b, "  PodAllowedRegistries=%s\n", strings.Join(cfg.Stack.PodAllowedRegistries, ","))
+	fmt.Fprintf(&b, "  CallbackSecret=%s\n", cfg.Stack.CallbackSecret)
+	fmt.Fprintf(&b, "  StatusMaxAge=%s\n", cfg.Stack.StatusMaxAge)
 	return b.String()
 }
+
+func formatPrefixes(prefixes []netip.Prefix) string {
+	parts := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		parts = append(parts, prefix.String())
+	}
+
+	return strings.Join(parts, ",")
+}
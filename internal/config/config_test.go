@@ -1,7 +1,12 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -51,6 +56,10 @@ func TestLoadConfig_Defaults(t *testing.T) {
 		t.Errorf("expected JWT.AccessTTL 24h, got %v", cfg.JWT.AccessTTL)
 	}
 
+	if cfg.JWT.RevocationCacheTTL != 5*time.Second {
+		t.Errorf("expected JWT.RevocationCacheTTL 5s, got %v", cfg.JWT.RevocationCacheTTL)
+	}
+
 	if cfg.S3.Enabled {
 		t.Errorf("expected S3.Enabled false by default")
 	}
@@ -66,6 +75,46 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	if cfg.Stack.CreateMax != 1 {
 		t.Errorf("expected Stack.CreateMax 1, got %d", cfg.Stack.CreateMax)
 	}
+
+	if cfg.Stack.ReaperInterval != time.Minute {
+		t.Errorf("expected Stack.ReaperInterval 1m, got %v", cfg.Stack.ReaperInterval)
+	}
+
+	if cfg.Stack.MaxPerTeam != 3 {
+		t.Errorf("expected Stack.MaxPerTeam 3, got %d", cfg.Stack.MaxPerTeam)
+	}
+
+	if cfg.Stack.ExtendDuration != 30*time.Minute || cfg.Stack.ExtendMax != 2 || cfg.Stack.MaxLifetime != 4*time.Hour {
+		t.Errorf("unexpected stack extend defaults: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.ProvisionWorkers != 4 || cfg.Stack.ProvisionQueue != 100 {
+		t.Errorf("unexpected stack provision defaults: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.MaxActive != 0 || cfg.Stack.MaxActivePerChallenge != 0 || cfg.Stack.MaxCPUMilli != 0 || cfg.Stack.MaxMemoryMB != 0 {
+		t.Errorf("unexpected stack capacity defaults: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.PodAllowPrivileged || cfg.Stack.PodAllowHostAccess || !cfg.Stack.PodRequireLimits || len(cfg.Stack.PodAllowedRegistries) != 0 {
+		t.Errorf("unexpected stack pod policy defaults: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.CallbackSecret != "" || cfg.Stack.StatusMaxAge != 15*time.Second {
+		t.Errorf("unexpected stack callback defaults: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.ProvisionerRetries != 2 || cfg.Stack.BreakerThreshold != 5 || cfg.Stack.BreakerCooldown != 30*time.Second {
+		t.Errorf("unexpected stack provisioner resilience defaults: %+v", cfg.Stack)
+	}
+
+	if cfg.RateLimit.Window != time.Minute || cfg.RateLimit.PublicMax != 240 || cfg.RateLimit.AuthMax != 60 || cfg.RateLimit.APIMax != 600 {
+		t.Errorf("unexpected RateLimit defaults: %+v", cfg.RateLimit)
+	}
+
+	if len(cfg.RateLimit.Allowlist) != 0 || len(cfg.RateLimit.TrustedProxies) != 0 {
+		t.Errorf("expected empty allowlist and trusted proxies, got %+v", cfg.RateLimit)
+	}
 }
 
 func TestLoadConfig_CustomValues(t *testing.T) {
@@ -87,6 +136,9 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 	os.Setenv("FLAG_HMAC_SECRET", "custom-flag-secret")
 	os.Setenv("SUBMIT_WINDOW", "30s")
 	os.Setenv("SUBMIT_MAX", "5")
+	os.Setenv("SUBMIT_IP_MAX", "20")
+	os.Setenv("LOGIN_ACCOUNT_MAX", "3")
+	os.Setenv("LOGIN_LOCKOUT_BASE", "30s")
 	os.Setenv("LOG_DIR", "logs-test")
 	os.Setenv("LOG_FILE_PREFIX", "app-test")
 	os.Setenv("LOG_DISCORD_WEBHOOK_URL", "https://discord.example/hook")
@@ -107,11 +159,35 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 	os.Setenv("S3_PRESIGN_TTL", "20m")
 	os.Setenv("STACKS_ENABLED", "true")
 	os.Setenv("STACKS_MAX_PER_USER", "5")
+	os.Setenv("STACKS_MAX_PER_TEAM", "7")
 	os.Setenv("STACKS_PROVISIONER_BASE_URL", "http://localhost:18081")
 	os.Setenv("STACKS_PROVISIONER_API_KEY", "custom-key")
 	os.Setenv("STACKS_PROVISIONER_TIMEOUT", "9s")
+	os.Setenv("STACKS_PROVISIONER_RETRIES", "4")
+	os.Setenv("STACKS_PROVISIONER_BREAKER_THRESHOLD", "0")
+	os.Setenv("STACKS_PROVISIONER_BREAKER_COOLDOWN", "1m")
 	os.Setenv("STACKS_CREATE_WINDOW", "2m")
 	os.Setenv("STACKS_CREATE_MAX", "2")
+	os.Setenv("STACKS_CREATE_GLOBAL_MAX", "50")
+	os.Setenv("STACKS_REAPER_INTERVAL", "30s")
+	os.Setenv("STACKS_EXTEND_DURATION", "15m")
+	os.Setenv("STACKS_EXTEND_MAX", "4")
+	os.Setenv("STACKS_MAX_LIFETIME", "6h")
+	os.Setenv("STACKS_PROVISION_WORKERS", "8")
+	os.Setenv("STACKS_PROVISION_QUEUE", "20")
+	os.Setenv("STACKS_MAX_ACTIVE", "50")
+	os.Setenv("STACKS_MAX_ACTIVE_PER_CHALLENGE", "10")
+	os.Setenv("STACKS_MAX_CPU_MILLI", "16000")
+	os.Setenv("STACKS_MAX_MEMORY_MB", "32768")
+	os.Setenv("STACKS_POD_ALLOW_PRIVILEGED", "true")
+	os.Setenv("STACKS_POD_ALLOW_HOST_ACCESS", "true")
+	os.Setenv("STACKS_POD_REQUIRE_LIMITS", "false")
+	os.Setenv("STACKS_POD_ALLOWED_REGISTRIES", "ghcr.io/smctf, registry.example.com")
+	os.Setenv("STACKS_CALLBACK_SECRET", "callback-secret")
+	os.Setenv("STACKS_STATUS_MAX_AGE", "2m")
+	os.Setenv("RATE_LIMIT_AUTH_MAX", "10")
+	os.Setenv("RATE_LIMIT_ALLOWLIST", "10.0.0.0/8, 203.0.113.5")
+	os.Setenv("TRUSTED_PROXIES", "172.16.0.0/12")
 
 	defer os.Clearenv()
 
@@ -159,6 +235,18 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 	if cfg.Security.SubmissionMax != 5 {
 		t.Errorf("expected Security.SubmissionMax 5, got %d", cfg.Security.SubmissionMax)
 	}
+
+	if cfg.Security.SubmissionIPMax != 20 || cfg.Security.SubmissionTeamMax != 0 {
+		t.Errorf("expected submission ip/team limits 20/0, got %d/%d", cfg.Security.SubmissionIPMax, cfg.Security.SubmissionTeamMax)
+	}
+
+	if cfg.Security.LoginAccountMax != 3 || cfg.Security.LoginIPMax != 30 {
+		t.Errorf("expected login limits 3/30, got %d/%d", cfg.Security.LoginAccountMax, cfg.Security.LoginIPMax)
+	}
+
+	if cfg.Security.LoginLockoutBase != 30*time.Second || cfg.Security.LoginLockoutMax != time.Hour {
+		t.Errorf("expected login lockout 30s..1h, got %v..%v", cfg.Security.LoginLockoutBase, cfg.Security.LoginLockoutMax)
+	}
 	if cfg.Logging.Dir != "logs-test" {
 		t.Errorf("expected Logging.Dir logs-test, got %s", cfg.Logging.Dir)
 	}
@@ -220,6 +308,54 @@ func TestLoadConfig_CustomValues(t *testing.T) {
 	if cfg.Stack.CreateMax != 2 {
 		t.Errorf("expected Stack.CreateMax 2, got %d", cfg.Stack.CreateMax)
 	}
+	if cfg.Stack.CreateGlobalMax != 50 {
+		t.Errorf("expected Stack.CreateGlobalMax 50, got %d", cfg.Stack.CreateGlobalMax)
+	}
+
+	if cfg.Stack.ReaperInterval != 30*time.Second {
+		t.Errorf("expected Stack.ReaperInterval 30s, got %v", cfg.Stack.ReaperInterval)
+	}
+
+	if cfg.Stack.MaxPerTeam != 7 {
+		t.Errorf("expected Stack.MaxPerTeam 7, got %d", cfg.Stack.MaxPerTeam)
+	}
+
+	if cfg.Stack.ExtendDuration != 15*time.Minute || cfg.Stack.ExtendMax != 4 || cfg.Stack.MaxLifetime != 6*time.Hour {
+		t.Errorf("unexpected stack extend config: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.ProvisionWorkers != 8 || cfg.Stack.ProvisionQueue != 20 {
+		t.Errorf("unexpected stack provision config: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.MaxActive != 50 || cfg.Stack.MaxActivePerChallenge != 10 || cfg.Stack.MaxCPUMilli != 16000 || cfg.Stack.MaxMemoryMB != 32768 {
+		t.Errorf("unexpected stack capacity config: %+v", cfg.Stack)
+	}
+
+	if !cfg.Stack.PodAllowPrivileged || !cfg.Stack.PodAllowHostAccess || cfg.Stack.PodRequireLimits {
+		t.Errorf("unexpected stack pod policy config: %+v", cfg.Stack)
+	}
+
+	if len(cfg.Stack.PodAllowedRegistries) != 2 || cfg.Stack.PodAllowedRegistries[0] != "ghcr.io/smctf" || cfg.Stack.PodAllowedRegistries[1] != "registry.example.com" {
+		t.Errorf("unexpected Stack.PodAllowedRegistries %v", cfg.Stack.PodAllowedRegistries)
+	}
+
+	if cfg.Stack.ProvisionerRetries != 4 || cfg.Stack.BreakerThreshold != 0 || cfg.Stack.BreakerCooldown != time.Minute {
+		t.Errorf("unexpected stack provisioner resilience config: %+v", cfg.Stack)
+	}
+
+	if cfg.Stack.CallbackSecret != "callback-secret" || cfg.Stack.StatusMaxAge != 2*time.Minute {
+		t.Errorf("unexpected stack callback config: %+v", cfg.Stack)
+	}
+	if cfg.RateLimit.AuthMax != 10 {
+		t.Errorf("expected RateLimit.AuthMax 10, got %d", cfg.RateLimit.AuthMax)
+	}
+	if len(cfg.RateLimit.Allowlist) != 2 || cfg.RateLimit.Allowlist[0].String() != "10.0.0.0/8" || cfg.RateLimit.Allowlist[1].String() != "203.0.113.5/32" {
+		t.Errorf("unexpected RateLimit.Allowlist %v", cfg.RateLimit.Allowlist)
+	}
+	if len(cfg.RateLimit.TrustedProxies) != 1 || cfg.RateLimit.TrustedProxies[0] != "172.16.0.0/12" {
+		t.Errorf("unexpected RateLimit.TrustedProxies %v", cfg.RateLimit.TrustedProxies)
+	}
 }
 
 func TestLoadConfig_InvalidValues(t *testing.T) {
@@ -246,6 +382,10 @@ func TestLoadConfig_InvalidValues(t *testing.T) {
 		{"invalid s3 force path", "S3_FORCE_PATH_STYLE", "bad-bool"},
 		{"invalid leaderboard cache ttl", "LEADERBOARD_CACHE_TTL", "bad-duration"},
 		{"invalid app config cache ttl", "APP_CONFIG_CACHE_TTL", "bad-duration"},
+		{"negative submit ip max", "SUBMIT_IP_MAX", "-1"},
+		{"invalid rate limit allowlist", "RATE_LIMIT_ALLOWLIST", "not-an-ip"},
+		{"invalid trusted proxies", "TRUSTED_PROXIES", "10.0.0.0/99"},
+		{"negative rate limit public max", "RATE_LIMIT_PUBLIC_MAX", "-5"},
 	}
 
 	for _, tt := range tests {
@@ -262,6 +402,107 @@ func TestLoadConfig_InvalidValues(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_StackCapacityNeedsWorkers(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+
+	os.Setenv("STACKS_PROVISION_WORKERS", "0")
+	os.Setenv("STACKS_MAX_CPU_MILLI", "4000")
+
+	_, err := Load()
+	if err == nil || !strings.Contains(err.Error(), "STACKS_PROVISION_WORKERS") {
+		t.Fatalf("expected provision workers error, got %v", err)
+	}
+
+	os.Setenv("STACKS_MAX_CPU_MILLI", "0")
+	if _, err := Load(); err != nil && strings.Contains(err.Error(), "STACKS_PROVISION_WORKERS") {
+		t.Fatalf("expected inline provisioning without limits, got %v", err)
+	}
+}
+
+func writeEd25519KeyPEM(t *testing.T, dir, name string, public bool) (string, ed25519.PublicKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	var block *pem.Block
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatalf("marshal public key: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			t.Fatalf("marshal private key: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	return path, pub
+}
+
+func TestLoadConfig_JWTKeys(t *testing.T) {
+	dir := t.TempDir()
+	privatePath, currentPub := writeEd25519KeyPEM(t, dir, "current.pem", false)
+	publicPath, previousPub := writeEd25519KeyPEM(t, dir, "previous.pub.pem", true)
+
+	os.Clearenv()
+	os.Setenv("STACKS_PROVISIONER_API_KEY", "test-key")
+	os.Setenv("JWT_ALGORITHM", "EdDSA")
+	os.Setenv("JWT_PRIVATE_KEY_FILE", privatePath)
+	os.Setenv("JWT_PUBLIC_KEY_FILES", publicPath)
+	defer os.Clearenv()
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if !cfg.JWT.Asymmetric() || cfg.JWT.PrivateKey == nil {
+		t.Fatalf("expected asymmetric config with private key")
+	}
+
+	if !currentPub.Equal(cfg.JWT.PrivateKey.Public()) {
+		t.Fatalf("unexpected private key loaded")
+	}
+
+	if len(cfg.JWT.PublicKeys) != 1 || !previousPub.Equal(cfg.JWT.PublicKeys[0]) {
+		t.Fatalf("unexpected public keys: %v", cfg.JWT.PublicKeys)
+	}
+
+	os.Setenv("JWT_ALGORITHM", "RS256")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected key type mismatch error")
+	}
+
+	os.Setenv("JWT_ALGORITHM", "EdDSA")
+	os.Setenv("JWT_PRIVATE_KEY_FILE", "")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected missing private key error")
+	}
+
+	os.Setenv("JWT_PRIVATE_KEY_FILE", filepath.Join(dir, "missing.pem"))
+	if _, err := Load(); err == nil {
+		t.Fatal("expected unreadable key file error")
+	}
+
+	os.Setenv("JWT_ALGORITHM", "none")
+	os.Setenv("JWT_PRIVATE_KEY_FILE", privatePath)
+	if _, err := Load(); err == nil {
+		t.Fatal("expected invalid algorithm error")
+	}
+}
+
 func TestLoadConfig_S3ValidationErrors(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -337,6 +578,12 @@ func TestValidateConfig_InvalidS3(t *testing.T) {
 			FlagHMACSecret:   "flag-secret",
 			SubmissionWindow: time.Minute,
 			SubmissionMax:    10,
+			LoginWindow:      15 * time.Minute,
+			LoginAccountMax:  5,
+			LoginIPMax:       30,
+			LoginLockoutBase: time.Minute,
+			LoginLockoutMax:  time.Hour,
+			PoWTTL:           5 * time.Minute,
 		},
 		Logging: LoggingConfig{
 			Dir:              "logs",
@@ -415,6 +662,12 @@ func TestValidateConfig_InvalidLogging(t *testing.T) {
 			FlagHMACSecret:   "flag-secret",
 			SubmissionWindow: time.Minute,
 			SubmissionMax:    10,
+			LoginWindow:      15 * time.Minute,
+			LoginAccountMax:  5,
+			LoginIPMax:       30,
+			LoginLockoutBase: time.Minute,
+			LoginLockoutMax:  time.Hour,
+			PoWTTL:           5 * time.Minute,
 		},
 		Logging: LoggingConfig{
 			Dir:              "",
@@ -574,6 +827,12 @@ func TestValidateConfig_EmptyValues(t *testing.T) {
 			FlagHMACSecret:   "flag-secret",
 			SubmissionWindow: time.Minute,
 			SubmissionMax:    10,
+			LoginWindow:      15 * time.Minute,
+			LoginAccountMax:  5,
+			LoginIPMax:       30,
+			LoginLockoutBase: time.Minute,
+			LoginLockoutMax:  time.Hour,
+			PoWTTL:           5 * time.Minute,
 		},
 		Logging: LoggingConfig{
 			Dir:              "logs",
@@ -620,6 +879,12 @@ func TestValidateConfig_InvalidDBConfig(t *testing.T) {
 			FlagHMACSecret:   "flag-secret",
 			SubmissionWindow: time.Minute,
 			SubmissionMax:    10,
+			LoginWindow:      15 * time.Minute,
+			LoginAccountMax:  5,
+			LoginIPMax:       30,
+			LoginLockoutBase: time.Minute,
+			LoginLockoutMax:  time.Hour,
+			PoWTTL:           5 * time.Minute,
 		},
 		Logging: LoggingConfig{
 			Dir:              "logs",
@@ -667,6 +932,12 @@ func TestValidateConfig_InvalidStackConfig(t *testing.T) {
 			FlagHMACSecret:   "flag-secret",
 			SubmissionWindow: time.Minute,
 			SubmissionMax:    10,
+			LoginWindow:      15 * time.Minute,
+			LoginAccountMax:  5,
+			LoginIPMax:       30,
+			LoginLockoutBase: time.Minute,
+			LoginLockoutMax:  time.Hour,
+			PoWTTL:           5 * time.Minute,
 		},
 		Cache: CacheConfig{
 			TimelineTTL:    time.Minute,
@@ -687,13 +958,22 @@ func TestValidateConfig_InvalidStackConfig(t *testing.T) {
 			WebhookMaxChars:  100,
 		},
 		Stack: StackConfig{
-			Enabled:            true,
-			MaxPerUser:         0,
-			ProvisionerBaseURL: "",
-			ProvisionerAPIKey:  "",
-			ProvisionerTimeout: 0,
-			CreateWindow:       0,
-			CreateMax:          0,
+			Enabled:              true,
+			MaxPerUser:           0,
+			ProvisionerBaseURL:   "",
+			ProvisionerAPIKey:    "",
+			ProvisionerTimeout:   0,
+			CreateWindow:         0,
+			CreateMax:            0,
+			ReaperInterval:       -time.Second,
+			ProvisionWorkers:     2,
+			ProvisionQueue:       0,
+			MaxActive:            -1,
+			MaxMemoryMB:          -1,
+			PodAllowedRegistries: []string{"https://ghcr.io"},
+			StatusMaxAge:         -time.Second,
+			ProvisionerRetries:   -1,
+			BreakerThreshold:     3,
 		},
 	}
 
@@ -705,6 +985,38 @@ func TestValidateConfig_InvalidStackConfig(t *testing.T) {
 	if !strings.Contains(err.Error(), "STACKS_MAX_PER_USER") {
 		t.Fatalf("expected stack error, got %v", err)
 	}
+
+	if !strings.Contains(err.Error(), "STACKS_REAPER_INTERVAL") {
+		t.Fatalf("expected reaper interval error, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "STACKS_MAX_PER_TEAM") {
+		t.Fatalf("expected team quota error, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "STACKS_EXTEND_DURATION") || !strings.Contains(err.Error(), "STACKS_MAX_LIFETIME") {
+		t.Fatalf("expected extend errors, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "STACKS_PROVISION_QUEUE") {
+		t.Fatalf("expected provision queue error, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "STACKS_MAX_ACTIVE") || !strings.Contains(err.Error(), "STACKS_MAX_MEMORY_MB") {
+		t.Fatalf("expected capacity errors, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "STACKS_POD_ALLOWED_REGISTRIES") {
+		t.Fatalf("expected registry error, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "STACKS_STATUS_MAX_AGE") {
+		t.Fatalf("expected status max age error, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "STACKS_PROVISIONER_RETRIES") || !strings.Contains(err.Error(), "STACKS_PROVISIONER_BREAKER_COOLDOWN") {
+		t.Fatalf("expected provisioner resilience errors, got %v", err)
+	}
 }
 
 func TestValidateConfig_AdditionalValidation(t *testing.T) {
@@ -779,6 +1091,7 @@ func TestRedact(t *testing.T) {
 		},
 		Stack: StackConfig{
 			ProvisionerAPIKey: "stack-key",
+			CallbackSecret:    "callback-secret",
 		},
 	}
 
@@ -818,6 +1131,10 @@ func TestRedact(t *testing.T) {
 	if redacted.Stack.ProvisionerAPIKey == cfg.Stack.ProvisionerAPIKey {
 		t.Fatalf("expected stack api key redacted")
 	}
+
+	if redacted.Stack.CallbackSecret == cfg.Stack.CallbackSecret {
+		t.Fatalf("expected stack callback secret redacted")
+	}
 }
 
 func TestRedactValueEdgeCases(t *testing.T) {
@@ -872,6 +1189,12 @@ func TestFormatForLog(t *testing.T) {
 			FlagHMACSecret:   "flagsecret",
 			SubmissionWindow: time.Minute,
 			SubmissionMax:    10,
+			LoginWindow:      15 * time.Minute,
+			LoginAccountMax:  5,
+			LoginIPMax:       30,
+			LoginLockoutBase: time.Minute,
+			LoginLockoutMax:  time.Hour,
+			PoWTTL:           5 * time.Minute,
 		},
 		Cache: CacheConfig{
 			TimelineTTL:    time.Minute,
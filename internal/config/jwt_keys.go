@@ -0,0 +1,116 @@
+package config
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// Reports whether tokens are signed with a private key instead of the shared secret
+func (c JWTConfig) Asymmetric() bool {
+	return c.Algorithm == JWTAlgorithmRS256 || c.Algorithm == JWTAlgorithmEdDSA
+}
+
+func loadJWTKeys(privateKeyFile string, publicKeyFiles []string) (crypto.Signer, []crypto.PublicKey, error) {
+	var signer crypto.Signer
+
+	if privateKeyFile != "" {
+		data, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+
+		signer, err = parsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE: %w", err)
+		}
+	}
+
+	publicKeys := make([]crypto.PublicKey, 0, len(publicKeyFiles))
+	for _, path := range publicKeyFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("JWT_PUBLIC_KEY_FILES: %w", err)
+		}
+
+		key, err := parsePublicKeyPEM(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("JWT_PUBLIC_KEY_FILES %s: %w", path, err)
+		}
+
+		publicKeys = append(publicKeys, key)
+	}
+
+	return signer, publicKeys, nil
+}
+
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+
+		return signer, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("unsupported private key format")
+}
+
+// Accepts public keys, or private keys whose public half is used
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	signer, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, errors.New("unsupported public key format")
+	}
+
+	return signer.Public(), nil
+}
+
+func checkJWTKeyType(algorithm string, key crypto.PublicKey) error {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if algorithm == JWTAlgorithmRS256 {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if algorithm == JWTAlgorithmEdDSA {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("JWT key type does not match JWT_ALGORITHM %s", algorithm)
+}
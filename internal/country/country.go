@@ -0,0 +1,66 @@
+package country
+
+import (
+	_ "embed"
+	"sort"
+	"strings"
+)
+
+// ISO 3166-1 alpha-2 codes, one "CODE<TAB>Name" per line
+//
+//go:embed countries.txt
+var countriesData string
+
+type Country struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+var (
+	names = parse(countriesData)
+	list  = sorted(names)
+)
+
+func parse(data string) map[string]string {
+	out := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		code, name, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok {
+			continue
+		}
+		out[code] = name
+	}
+
+	return out
+}
+
+func sorted(names map[string]string) []Country {
+	out := make([]Country, 0, len(names))
+	for code, name := range names {
+		out = append(out, Country{Code: code, Name: name})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// Normalizes user input to the upper case code form
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func Valid(code string) bool {
+	_, ok := names[code]
+	return ok
+}
+
+// Returns the English short name, or "" for unknown codes
+func Name(code string) string {
+	return names[code]
+}
+
+func List() []Country {
+	out := make([]Country, len(list))
+	copy(out, list)
+	return out
+}
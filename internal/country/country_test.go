@@ -0,0 +1,46 @@
+package country
+
+import "testing"
+
+func TestListLoaded(t *testing.T) {
+	countries := List()
+	if len(countries) != 249 {
+		t.Fatalf("expected 249 countries, got %d", len(countries))
+	}
+
+	for i := 1; i < len(countries); i++ {
+		if countries[i-1].Code >= countries[i].Code {
+			t.Fatalf("list not sorted at %d: %s >= %s", i, countries[i-1].Code, countries[i].Code)
+		}
+	}
+}
+
+func TestValidAndName(t *testing.T) {
+	if !Valid("KR") || Name("KR") != "Korea, Republic of" {
+		t.Fatalf("expected KR to be known, got %q", Name("KR"))
+	}
+
+	for _, code := range []string{"", "kr", "XX", "KOR", "UK"} {
+		if Valid(code) {
+			t.Fatalf("expected %q to be invalid", code)
+		}
+	}
+
+	if Name("XX") != "" {
+		t.Fatalf("expected empty name for unknown code")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize(" us "); got != "US" {
+		t.Fatalf("unexpected normalize result: %q", got)
+	}
+}
+
+func TestListReturnsCopy(t *testing.T) {
+	countries := List()
+	countries[0].Code = "ZZ"
+	if List()[0].Code == "ZZ" {
+		t.Fatalf("expected List to return a copy")
+	}
+}
@@ -38,18 +38,25 @@ func AutoMigrate(ctx context.Context, db *bun.DB) error {
 
 	modelsToCreate := []any{
 		(*models.AppConfig)(nil),
+		(*models.Division)(nil),
 		(*models.Team)(nil),
 		(*models.User)(nil),
 		(*models.Challenge)(nil),
 		(*models.Stack)(nil),
 		(*models.Submission)(nil),
 		(*models.RegistrationKey)(nil),
+		(*models.APIToken)(nil),
+		(*models.LoginFailure)(nil),
 	}
 
 	if err := createTables(ctx, db, modelsToCreate); err != nil {
 		return err
 	}
 
+	if err := addColumns(ctx, db); err != nil {
+		return err
+	}
+
 	return createIndexes(ctx, db)
 }
 
@@ -63,6 +70,127 @@ func createTables(ctx context.Context, db *bun.DB, modelsToCreate []any) error {
 	return nil
 }
 
+// Columns added after a table first shipped, CREATE TABLE IF NOT EXISTS skips them on existing databases
+func addColumns(ctx context.Context, db *bun.DB) error {
+	columns := []struct {
+		name  string
+		query string
+	}{
+		{
+			name:  "challenges.created_by",
+			query: "ALTER TABLE challenges ADD COLUMN IF NOT EXISTS created_by BIGINT",
+		},
+		{
+			name:  "registration_keys.max_uses",
+			query: "ALTER TABLE registration_keys ADD COLUMN IF NOT EXISTS max_uses INTEGER NOT NULL DEFAULT 1",
+		},
+		{
+			name:  "registration_keys.use_count",
+			query: "ALTER TABLE registration_keys ADD COLUMN IF NOT EXISTS use_count INTEGER NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "registration_keys.use_count backfill",
+			query: "UPDATE registration_keys SET use_count = 1 WHERE used_by IS NOT NULL AND use_count = 0",
+		},
+		{
+			name:  "registration_keys.expires_at",
+			query: "ALTER TABLE registration_keys ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ",
+		},
+		{
+			name:  "registration_keys.revoked_at",
+			query: "ALTER TABLE registration_keys ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ",
+		},
+		{
+			name:  "registration_keys.revoked_by",
+			query: "ALTER TABLE registration_keys ADD COLUMN IF NOT EXISTS revoked_by BIGINT",
+		},
+		{
+			name:  "registration_keys.division_id",
+			query: "ALTER TABLE registration_keys ADD COLUMN IF NOT EXISTS division_id BIGINT NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "teams.division_id",
+			query: "ALTER TABLE teams ADD COLUMN IF NOT EXISTS division_id BIGINT NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "users.affiliation",
+			query: "ALTER TABLE users ADD COLUMN IF NOT EXISTS affiliation TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "users.country",
+			query: "ALTER TABLE users ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "users.website",
+			query: "ALTER TABLE users ADD COLUMN IF NOT EXISTS website TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "users.bio",
+			query: "ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "teams.affiliation",
+			query: "ALTER TABLE teams ADD COLUMN IF NOT EXISTS affiliation TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "teams.country",
+			query: "ALTER TABLE teams ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "teams.website",
+			query: "ALTER TABLE teams ADD COLUMN IF NOT EXISTS website TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "teams.bio",
+			query: "ALTER TABLE teams ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT ''",
+		},
+		{
+			name:  "teams.captain_id",
+			query: "ALTER TABLE teams ADD COLUMN IF NOT EXISTS captain_id BIGINT NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "stacks.extend_count",
+			query: "ALTER TABLE stacks ADD COLUMN IF NOT EXISTS extend_count INTEGER NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "stacks.team_id",
+			query: "ALTER TABLE stacks ADD COLUMN IF NOT EXISTS team_id BIGINT NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "challenges.stack_team_shared",
+			query: "ALTER TABLE challenges ADD COLUMN IF NOT EXISTS stack_team_shared BOOLEAN NOT NULL DEFAULT false",
+		},
+		{
+			name:  "challenges.stack_cpu_milli",
+			query: "ALTER TABLE challenges ADD COLUMN IF NOT EXISTS stack_cpu_milli INTEGER NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "challenges.stack_memory_bytes",
+			query: "ALTER TABLE challenges ADD COLUMN IF NOT EXISTS stack_memory_bytes BIGINT NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "stacks.requested_cpu_milli",
+			query: "ALTER TABLE stacks ADD COLUMN IF NOT EXISTS requested_cpu_milli INTEGER NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "stacks.requested_memory_bytes",
+			query: "ALTER TABLE stacks ADD COLUMN IF NOT EXISTS requested_memory_bytes BIGINT NOT NULL DEFAULT 0",
+		},
+		{
+			name:  "stacks.last_error",
+			query: "ALTER TABLE stacks ADD COLUMN IF NOT EXISTS last_error TEXT",
+		},
+	}
+
+	for _, col := range columns {
+		if _, err := db.ExecContext(ctx, col.query); err != nil {
+			return fmt.Errorf("auto migrate add column %s: %w", col.name, err)
+		}
+	}
+
+	return nil
+}
+
 func createIndexes(ctx context.Context, db *bun.DB) error {
 	indexes := []struct {
 		name  string
@@ -88,6 +216,10 @@ func createIndexes(ctx context.Context, db *bun.DB) error {
 			name:  "idx_users_team_id",
 			query: "CREATE INDEX IF NOT EXISTS idx_users_team_id ON users (team_id)",
 		},
+		{
+			name:  "idx_teams_division_id",
+			query: "CREATE INDEX IF NOT EXISTS idx_teams_division_id ON teams (division_id)",
+		},
 		{
 			name:  "idx_registration_keys_team_id",
 			query: "CREATE INDEX IF NOT EXISTS idx_registration_keys_team_id ON registration_keys (team_id)",
@@ -98,11 +230,43 @@ func createIndexes(ctx context.Context, db *bun.DB) error {
 		},
 		{
 			name:  "idx_stacks_user_challenge",
-			query: "CREATE UNIQUE INDEX IF NOT EXISTS idx_stacks_user_challenge ON stacks (user_id, challenge_id)",
+			query: "DROP INDEX IF EXISTS idx_stacks_user_challenge",
+		},
+		{
+			name:  "idx_stacks_personal_challenge",
+			query: "CREATE UNIQUE INDEX IF NOT EXISTS idx_stacks_personal_challenge ON stacks (user_id, challenge_id) WHERE team_id = 0",
+		},
+		{
+			name:  "idx_stacks_team_challenge",
+			query: "CREATE UNIQUE INDEX IF NOT EXISTS idx_stacks_team_challenge ON stacks (team_id, challenge_id) WHERE team_id <> 0",
 		},
 		{
 			name:  "idx_stacks_stack_id",
-			query: "CREATE UNIQUE INDEX IF NOT EXISTS idx_stacks_stack_id ON stacks (stack_id)",
+			query: "DROP INDEX IF EXISTS idx_stacks_stack_id",
+		},
+		{
+			name:  "idx_stacks_provisioned_stack_id",
+			query: "CREATE UNIQUE INDEX IF NOT EXISTS idx_stacks_provisioned_stack_id ON stacks (stack_id) WHERE stack_id <> ''",
+		},
+		{
+			name:  "idx_stacks_waiting",
+			query: "CREATE INDEX IF NOT EXISTS idx_stacks_waiting ON stacks (created_at, id) WHERE status = 'waiting'",
+		},
+		{
+			name:  "idx_stacks_unprovisioned",
+			query: "CREATE INDEX IF NOT EXISTS idx_stacks_unprovisioned ON stacks (updated_at) WHERE stack_id = ''",
+		},
+		{
+			name:  "idx_api_tokens_user_id",
+			query: "CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id)",
+		},
+		{
+			name:  "idx_login_failures_email",
+			query: "CREATE INDEX IF NOT EXISTS idx_login_failures_email ON login_failures (email)",
+		},
+		{
+			name:  "idx_login_failures_ip",
+			query: "CREATE INDEX IF NOT EXISTS idx_login_failures_ip ON login_failures (ip)",
 		},
 	}
 
@@ -4,21 +4,31 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"smctf/internal/repo"
 	"smctf/internal/service"
+	"smctf/internal/stack"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
 type errorResponse struct {
-	Error     string                 `json:"error"`
-	Details   []service.FieldError   `json:"details,omitempty"`
-	RateLimit *service.RateLimitInfo `json:"rate_limit,omitempty"`
+	Error       string                 `json:"error"`
+	Details     []service.FieldError   `json:"details,omitempty"`
+	RateLimit   *service.RateLimitInfo `json:"rate_limit,omitempty"`
+	Provisioner *provisionerError      `json:"provisioner,omitempty"`
+}
+
+type provisionerError struct {
+	Status  int             `json:"status"`
+	Code    string          `json:"code,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Details json.RawMessage `json:"details,omitempty"`
 }
 
 func writeError(ctx *gin.Context, err error) {
@@ -29,6 +39,20 @@ func writeError(ctx *gin.Context, err error) {
 	ctx.JSON(status, resp)
 }
 
+// Like writeError, but also passes on what the provisioner answered. Only for admin routes.
+func writeAdminError(ctx *gin.Context, err error) {
+	status, resp, headers := mapError(err)
+	var apiErr *stack.APIError
+	if errors.As(err, &apiErr) {
+		resp.Provisioner = &provisionerError{Status: apiErr.Status, Code: apiErr.Code, Message: apiErr.Message, Details: apiErr.Details}
+	}
+
+	for key, value := range headers {
+		ctx.Header(key, value)
+	}
+	ctx.JSON(status, resp)
+}
+
 func mapError(err error) (int, errorResponse, map[string]string) {
 	status := http.StatusInternalServerError
 	resp := errorResponse{Error: "internal error"}
@@ -48,9 +72,25 @@ func mapError(err error) (int, errorResponse, map[string]string) {
 		resp.RateLimit = &rl.Info
 
 		headers := map[string]string{
-			"X-RateLimit-Limit":     strconv.Itoa(rl.Info.Limit),
-			"X-RateLimit-Remaining": strconv.Itoa(rl.Info.Remaining),
-			"X-RateLimit-Reset":     strconv.Itoa(rl.Info.ResetSeconds),
+			"RateLimit-Limit":     strconv.Itoa(rl.Info.Limit),
+			"RateLimit-Remaining": strconv.Itoa(rl.Info.Remaining),
+			"RateLimit-Reset":     strconv.Itoa(rl.Info.ResetSeconds),
+			"Retry-After":         strconv.Itoa(rl.Info.ResetSeconds),
+		}
+		if rl.Info.Policy != "" {
+			headers["RateLimit-Policy"] = rl.Info.Policy
+		}
+
+		return status, resp, headers
+	}
+
+	var ll *service.LoginLockedError
+	if errors.As(err, &ll) {
+		status = http.StatusTooManyRequests
+		resp.Error = ll.Error()
+
+		headers := map[string]string{
+			"Retry-After": strconv.Itoa(int(math.Ceil(ll.RetryAfter.Seconds()))),
 		}
 
 		return status, resp, headers
@@ -64,9 +104,36 @@ func mapError(err error) (int, errorResponse, map[string]string) {
 	case errors.Is(err, service.ErrInvalidCreds):
 		status = http.StatusUnauthorized
 		resp.Error = service.ErrInvalidCreds.Error()
+	case errors.Is(err, service.ErrLoginLocked):
+		status = http.StatusTooManyRequests
+		resp.Error = service.ErrLoginLocked.Error()
+	case errors.Is(err, service.ErrPoWRequired):
+		status = http.StatusBadRequest
+		resp.Error = service.ErrPoWRequired.Error()
+	case errors.Is(err, service.ErrPoWInvalid):
+		status = http.StatusBadRequest
+		resp.Error = service.ErrPoWInvalid.Error()
+	case errors.Is(err, service.ErrForbidden):
+		status = http.StatusForbidden
+		resp.Error = service.ErrForbidden.Error()
+	case errors.Is(err, service.ErrNotCaptain):
+		status = http.StatusForbidden
+		resp.Error = service.ErrNotCaptain.Error()
+	case errors.Is(err, service.ErrSessionNotFound):
+		status = http.StatusNotFound
+		resp.Error = service.ErrSessionNotFound.Error()
+	case errors.Is(err, service.ErrAPITokenNotFound):
+		status = http.StatusNotFound
+		resp.Error = service.ErrAPITokenNotFound.Error()
+	case errors.Is(err, service.ErrRegistrationKeyNotFound):
+		status = http.StatusNotFound
+		resp.Error = service.ErrRegistrationKeyNotFound.Error()
 	case errors.Is(err, service.ErrUserExists):
 		status = http.StatusConflict
 		resp.Error = service.ErrUserExists.Error()
+	case errors.Is(err, service.ErrTeamNotEmpty):
+		status = http.StatusConflict
+		resp.Error = service.ErrTeamNotEmpty.Error()
 	case errors.Is(err, service.ErrChallengeNotFound):
 		status = http.StatusNotFound
 		resp.Error = service.ErrChallengeNotFound.Error()
@@ -91,6 +158,12 @@ func mapError(err error) (int, errorResponse, map[string]string) {
 	case errors.Is(err, service.ErrStackLimitReached):
 		status = http.StatusConflict
 		resp.Error = service.ErrStackLimitReached.Error()
+	case errors.Is(err, service.ErrStackExtendLimit):
+		status = http.StatusConflict
+		resp.Error = service.ErrStackExtendLimit.Error()
+	case errors.Is(err, service.ErrStackNotReady):
+		status = http.StatusConflict
+		resp.Error = service.ErrStackNotReady.Error()
 	case errors.Is(err, service.ErrStackNotFound):
 		status = http.StatusNotFound
 		resp.Error = service.ErrStackNotFound.Error()
@@ -100,6 +173,12 @@ func mapError(err error) (int, errorResponse, map[string]string) {
 	case errors.Is(err, service.ErrStackInvalidSpec):
 		status = http.StatusBadRequest
 		resp.Error = service.ErrStackInvalidSpec.Error()
+	case errors.Is(err, service.ErrStackCallbackSignature):
+		status = http.StatusUnauthorized
+		resp.Error = service.ErrStackCallbackSignature.Error()
+	case errors.Is(err, service.ErrStackCallbackStale):
+		status = http.StatusConflict
+		resp.Error = service.ErrStackCallbackStale.Error()
 	case errors.Is(err, repo.ErrNotFound):
 		status = http.StatusNotFound
 		resp.Error = "not found"
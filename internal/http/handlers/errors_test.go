@@ -3,12 +3,16 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"smctf/internal/repo"
 	"smctf/internal/service"
+	"smctf/internal/stack"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -50,7 +54,23 @@ func TestMapErrorRateLimit(t *testing.T) {
 		t.Fatalf("rate limit: %+v", resp.RateLimit)
 	}
 
-	if headers["X-RateLimit-Limit"] != "5" || headers["X-RateLimit-Remaining"] != "1" || headers["X-RateLimit-Reset"] != "10" {
+	if headers["RateLimit-Limit"] != "5" || headers["RateLimit-Remaining"] != "1" || headers["RateLimit-Reset"] != "10" || headers["Retry-After"] != "10" {
+		t.Fatalf("headers: %+v", headers)
+	}
+}
+
+func TestMapErrorLoginLocked(t *testing.T) {
+	status, resp, headers := mapError(&service.LoginLockedError{RetryAfter: 1500 * time.Millisecond})
+
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("status: got %d", status)
+	}
+
+	if resp.Error != service.ErrLoginLocked.Error() {
+		t.Fatalf("error: got %q", resp.Error)
+	}
+
+	if headers["Retry-After"] != "2" {
 		t.Fatalf("headers: %+v", headers)
 	}
 }
@@ -64,6 +84,11 @@ func TestMapErrorSentinels(t *testing.T) {
 	}{
 		{service.ErrInvalidInput, http.StatusBadRequest, service.ErrInvalidInput.Error(), 1},
 		{service.ErrInvalidCreds, http.StatusUnauthorized, service.ErrInvalidCreds.Error(), 0},
+		{service.ErrLoginLocked, http.StatusTooManyRequests, service.ErrLoginLocked.Error(), 0},
+		{service.ErrPoWRequired, http.StatusBadRequest, service.ErrPoWRequired.Error(), 0},
+		{service.ErrPoWInvalid, http.StatusBadRequest, service.ErrPoWInvalid.Error(), 0},
+		{service.ErrForbidden, http.StatusForbidden, service.ErrForbidden.Error(), 0},
+		{service.ErrNotCaptain, http.StatusForbidden, service.ErrNotCaptain.Error(), 0},
 		{service.ErrUserExists, http.StatusConflict, service.ErrUserExists.Error(), 0},
 		{service.ErrChallengeNotFound, http.StatusNotFound, service.ErrChallengeNotFound.Error(), 0},
 		{service.ErrChallengeFileNotFound, http.StatusNotFound, service.ErrChallengeFileNotFound.Error(), 0},
@@ -75,7 +100,11 @@ func TestMapErrorSentinels(t *testing.T) {
 		{service.ErrStackLimitReached, http.StatusConflict, service.ErrStackLimitReached.Error(), 0},
 		{service.ErrStackNotFound, http.StatusNotFound, service.ErrStackNotFound.Error(), 0},
 		{service.ErrStackProvisionerDown, http.StatusServiceUnavailable, service.ErrStackProvisionerDown.Error(), 0},
+		{service.ErrStackExtendLimit, http.StatusConflict, service.ErrStackExtendLimit.Error(), 0},
+		{service.ErrStackNotReady, http.StatusConflict, service.ErrStackNotReady.Error(), 0},
 		{service.ErrStackInvalidSpec, http.StatusBadRequest, service.ErrStackInvalidSpec.Error(), 0},
+		{service.ErrStackCallbackSignature, http.StatusUnauthorized, service.ErrStackCallbackSignature.Error(), 0},
+		{service.ErrStackCallbackStale, http.StatusConflict, service.ErrStackCallbackStale.Error(), 0},
 		{repo.ErrNotFound, http.StatusNotFound, "not found", 0},
 	}
 
@@ -105,7 +134,7 @@ func TestWriteErrorRateLimitHeaders(t *testing.T) {
 		t.Fatalf("status: got %d", rec.Code)
 	}
 
-	if rec.Header().Get("X-RateLimit-Limit") != "5" {
+	if rec.Header().Get("RateLimit-Limit") != "5" {
 		t.Fatalf("missing limit header")
 	}
 }
@@ -200,3 +229,36 @@ func TestWriteErrorDefault(t *testing.T) {
 		t.Fatalf("status: got %d", rec.Code)
 	}
 }
+
+func TestWriteAdminErrorProvisionerDetails(t *testing.T) {
+	apiErr := &stack.APIError{Status: http.StatusBadGateway, Code: "node_down", Message: "node unreachable", Details: json.RawMessage(`{"node":"n1"}`)}
+	err := fmt.Errorf("%w: %w", service.ErrStackProvisionerDown, apiErr)
+
+	ctx, rec := newJSONContext(t, http.MethodDelete, "/", nil)
+	writeAdminError(ctx, err)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status: got %d", rec.Code)
+	}
+
+	var resp errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if resp.Error != service.ErrStackProvisionerDown.Error() || resp.Provisioner == nil {
+		t.Fatalf("unexpected response %s", rec.Body.String())
+	}
+
+	if resp.Provisioner.Status != http.StatusBadGateway || resp.Provisioner.Code != "node_down" || resp.Provisioner.Message != "node unreachable" || string(resp.Provisioner.Details) != `{"node":"n1"}` {
+		t.Fatalf("unexpected provisioner details %+v", resp.Provisioner)
+	}
+
+	// Players only get the mapped message
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/", nil)
+	writeError(ctx, err)
+
+	if strings.Contains(rec.Body.String(), "node unreachable") {
+		t.Fatalf("expected no provisioner details, got %s", rec.Body.String())
+	}
+}
@@ -2,16 +2,22 @@ package handlers
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"smctf/internal/auth"
 	"smctf/internal/config"
+	"smctf/internal/country"
 	"smctf/internal/http/middleware"
 	"smctf/internal/models"
 	"smctf/internal/repo"
@@ -30,11 +36,13 @@ type Handler struct {
 	score  *repo.ScoreboardRepo
 	teams  *service.TeamService
 	stacks *service.StackService
+	tokens *service.APITokenService
+	pow    *service.PoWService
 	redis  *redis.Client
 }
 
-func New(cfg config.Config, auth *service.AuthService, ctf *service.CTFService, app *service.AppConfigService, users *repo.UserRepo, score *repo.ScoreboardRepo, teams *service.TeamService, stacks *service.StackService, redis *redis.Client) *Handler {
-	return &Handler{cfg: cfg, auth: auth, ctf: ctf, app: app, users: users, score: score, teams: teams, stacks: stacks, redis: redis}
+func New(cfg config.Config, auth *service.AuthService, ctf *service.CTFService, app *service.AppConfigService, users *repo.UserRepo, score *repo.ScoreboardRepo, teams *service.TeamService, stacks *service.StackService, tokens *service.APITokenService, pow *service.PoWService, redis *redis.Client) *Handler {
+	return &Handler{cfg: cfg, auth: auth, ctf: ctf, app: app, users: users, score: score, teams: teams, stacks: stacks, tokens: tokens, pow: pow, redis: redis}
 }
 
 func windowStartFromMinutes(windowMinutes int) *time.Time {
@@ -135,6 +143,17 @@ func (h *Handler) ctfState(ctx *gin.Context) (service.CTFState, bool) {
 	return state, true
 }
 
+func (h *Handler) JWKS(ctx *gin.Context) {
+	set, err := auth.JWKS(h.cfg.JWT)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, set)
+}
+
 // App Config Handlers
 
 func (h *Handler) GetConfig(ctx *gin.Context) {
@@ -164,6 +183,10 @@ func (h *Handler) GetConfig(ctx *gin.Context) {
 		HeaderDescription: cfg.HeaderDescription,
 		CTFStartAt:        cfg.CTFStartAt,
 		CTFEndAt:          cfg.CTFEndAt,
+		PoWRegister:       cfg.PoWRegisterDifficulty(),
+		PoWSubmit:         cfg.PoWSubmitDifficulty(),
+		CompetitionMode:   cfg.CompetitionMode,
+		DivisionScoring:   cfg.DivisionScoring,
 		UpdatedAt:         updatedAt.UTC(),
 	})
 }
@@ -200,7 +223,7 @@ func (h *Handler) AdminUpdateConfig(ctx *gin.Context) {
 	ctfStartAt := optionalStringValue(req.CTFStartAt)
 	ctfEndAt := optionalStringValue(req.CTFEndAt)
 
-	cfg, updatedAt, _, err := h.app.Update(ctx.Request.Context(), req.Title, req.Description, req.HeaderTitle, req.HeaderDescription, ctfStartAt, ctfEndAt)
+	cfg, updatedAt, _, err := h.app.Update(ctx.Request.Context(), req.Title, req.Description, req.HeaderTitle, req.HeaderDescription, ctfStartAt, ctfEndAt, optionalIntString(req.PoWRegister), optionalIntString(req.PoWSubmit), req.CompetitionMode, req.DivisionScoring)
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -214,10 +237,22 @@ func (h *Handler) AdminUpdateConfig(ctx *gin.Context) {
 		HeaderDescription: cfg.HeaderDescription,
 		CTFStartAt:        cfg.CTFStartAt,
 		CTFEndAt:          cfg.CTFEndAt,
+		PoWRegister:       cfg.PoWRegisterDifficulty(),
+		PoWSubmit:         cfg.PoWSubmitDifficulty(),
+		CompetitionMode:   cfg.CompetitionMode,
+		DivisionScoring:   cfg.DivisionScoring,
 		UpdatedAt:         updatedAt.UTC(),
 	})
 }
 
+func optionalIntString(value *int) *string {
+	if value == nil {
+		return nil
+	}
+	str := strconv.Itoa(*value)
+	return &str
+}
+
 func optionalStringValue(value optionalString) *string {
 	if !value.Set {
 		return nil
@@ -231,6 +266,45 @@ func optionalStringValue(value optionalString) *string {
 
 // Auth Handlers
 
+func (h *Handler) IssuePoW(ctx *gin.Context) {
+	var req powRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	if h.pow == nil {
+		writeError(ctx, service.NewValidationError(service.FieldError{Field: "purpose", Reason: "disabled"}))
+		return
+	}
+
+	challenge, err := h.pow.Issue(ctx.Request.Context(), req.Purpose)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, powChallengeResponse{
+		Nonce:      challenge.Nonce,
+		Purpose:    challenge.Purpose,
+		Difficulty: challenge.Difficulty,
+		ExpiresAt:  challenge.ExpiresAt,
+	})
+}
+
+func (h *Handler) verifyPoW(ctx *gin.Context, purpose, nonce, solution string) bool {
+	if h.pow == nil {
+		return true
+	}
+
+	if err := h.pow.Verify(ctx.Request.Context(), purpose, nonce, solution); err != nil {
+		writeError(ctx, err)
+		return false
+	}
+
+	return true
+}
+
 func (h *Handler) Register(ctx *gin.Context) {
 	var req registerRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -238,6 +312,10 @@ func (h *Handler) Register(ctx *gin.Context) {
 		return
 	}
 
+	if !h.verifyPoW(ctx, service.PoWPurposeRegister, req.PoWNonce, req.PoWSolution) {
+		return
+	}
+
 	ip := ctx.ClientIP()
 
 	user, err := h.auth.Register(ctx.Request.Context(), req.Email, req.Username, req.Password, req.RegistrationKey, ip)
@@ -259,7 +337,7 @@ func (h *Handler) Login(ctx *gin.Context) {
 		writeBindError(ctx, err)
 		return
 	}
-	accessToken, refreshToken, user, err := h.auth.Login(ctx.Request.Context(), req.Email, req.Password)
+	accessToken, refreshToken, user, err := h.auth.Login(ctx.Request.Context(), req.Email, req.Password, ctx.Request.UserAgent(), ctx.ClientIP())
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -282,7 +360,7 @@ func (h *Handler) Refresh(ctx *gin.Context) {
 		writeBindError(ctx, err)
 		return
 	}
-	accessToken, refreshToken, err := h.auth.Refresh(ctx.Request.Context(), req.RefreshToken)
+	accessToken, refreshToken, err := h.auth.Refresh(ctx.Request.Context(), req.RefreshToken, ctx.Request.UserAgent(), ctx.ClientIP())
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -323,24 +401,136 @@ func (h *Handler) UpdateMe(ctx *gin.Context) {
 		return
 	}
 
-	userID := middleware.UserID(ctx)
+	update := service.AccountUpdate{
+		Username:    req.Username,
+		NewPassword: req.NewPassword,
+		Profile:     service.ProfileUpdate{Affiliation: req.Affiliation, Country: req.Country, Website: req.Website, Bio: req.Bio},
+	}
+	if req.CurrentPassword != nil {
+		update.CurrentPassword = *req.CurrentPassword
+	}
+
+	user, err := h.auth.UpdateAccount(ctx.Request.Context(), middleware.UserID(ctx), update, middleware.SessionID(ctx))
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	// Usernames and profiles both show on the leaderboard
+	if req.Username != nil || req.Affiliation != nil || req.Country != nil || req.Website != nil || req.Bio != nil {
+		h.invalidateLeaderboardCache()
+	}
+
+	ctx.JSON(http.StatusOK, newUserMeResponse(user))
+}
+
+// Team profile edits are reserved for the caller's team captain
+func (h *Handler) UpdateMyTeam(ctx *gin.Context) {
+	var req profileUpdateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
 
+	userID := middleware.UserID(ctx)
 	user, err := h.users.GetByID(ctx.Request.Context(), userID)
 	if err != nil {
 		writeError(ctx, err)
 		return
 	}
 
-	if req.Username != nil {
-		user.Username = *req.Username
+	update := service.ProfileUpdate{Affiliation: req.Affiliation, Country: req.Country, Website: req.Website, Bio: req.Bio}
+	team, err := h.teams.UpdateTeamProfile(ctx.Request.Context(), userID, user.TeamID, update)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	ctx.JSON(http.StatusOK, team)
+}
+
+func (h *Handler) ListSessions(ctx *gin.Context) {
+	sessions, err := h.auth.ListSessions(ctx.Request.Context(), middleware.UserID(ctx))
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	currentID := middleware.SessionID(ctx)
+	resp := make([]sessionResponse, 0, len(sessions))
+	for i := range sessions {
+		resp = append(resp, newSessionResponse(&sessions[i], currentID))
 	}
 
-	if err := h.users.Update(ctx.Request.Context(), user); err != nil {
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) RevokeSession(ctx *gin.Context) {
+	if err := h.auth.RevokeSession(ctx.Request.Context(), middleware.UserID(ctx), ctx.Param("id")); err != nil {
 		writeError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, newUserMeResponse(user))
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (h *Handler) RevokeOtherSessions(ctx *gin.Context) {
+	revoked, err := h.auth.RevokeAllSessions(ctx.Request.Context(), middleware.UserID(ctx), middleware.SessionID(ctx))
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+func (h *Handler) ListAPITokens(ctx *gin.Context) {
+	tokens, err := h.tokens.ListTokens(ctx.Request.Context(), middleware.UserID(ctx))
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	resp := make([]apiTokenResponse, 0, len(tokens))
+	for i := range tokens {
+		resp = append(resp, newAPITokenResponse(&tokens[i]))
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) CreateAPIToken(ctx *gin.Context) {
+	var req createAPITokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	raw, token, err := h.tokens.CreateToken(ctx.Request.Context(), middleware.UserID(ctx), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, createAPITokenResponse{
+		Token:            raw,
+		apiTokenResponse: newAPITokenResponse(token),
+	})
+}
+
+func (h *Handler) RevokeAPIToken(ctx *gin.Context) {
+	tokenID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.tokens.RevokeToken(ctx.Request.Context(), middleware.UserID(ctx), tokenID); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
 // Challenge Handlers
@@ -389,6 +579,11 @@ func (h *Handler) SubmitFlag(ctx *gin.Context) {
 		writeBindError(ctx, err)
 		return
 	}
+
+	if !h.verifyPoW(ctx, service.PoWPurposeSubmit, req.PoWNonce, req.PoWSolution) {
+		return
+	}
+
 	correct, err := h.ctf.SubmitFlag(ctx.Request.Context(), middleware.UserID(ctx), challengeID, req.Flag)
 	if err != nil {
 		writeError(ctx, err)
@@ -399,7 +594,7 @@ func (h *Handler) SubmitFlag(ctx *gin.Context) {
 		h.invalidateTimelineCache()
 		h.invalidateLeaderboardCache()
 		if h.stacks != nil {
-			_ = h.stacks.DeleteStackByUserAndChallenge(ctx.Request.Context(), middleware.UserID(ctx), challengeID)
+			_ = h.stacks.DeleteSolvedStacks(ctx.Request.Context(), middleware.UserID(ctx), challengeID)
 		}
 	}
 
@@ -436,7 +631,12 @@ func (h *Handler) CreateStack(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, newStackResponse(stackModel, string(state)))
+	status := http.StatusCreated
+	if !stackModel.Provisioned() {
+		status = http.StatusAccepted
+	}
+
+	ctx.JSON(status, newStackResponse(stackModel, string(state)))
 }
 
 func (h *Handler) GetStack(ctx *gin.Context) {
@@ -460,7 +660,17 @@ func (h *Handler) GetStack(ctx *gin.Context) {
 		return
 	}
 
-	stackModel, err := h.stacks.GetStack(ctx.Request.Context(), middleware.UserID(ctx), challengeID)
+	wait := 0
+	if value := strings.TrimSpace(ctx.Query("wait")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(ctx, service.NewValidationError(service.FieldError{Field: "wait", Reason: "invalid"}))
+			return
+		}
+		wait = parsed
+	}
+
+	stackModel, err := h.stacks.WaitStack(ctx.Request.Context(), middleware.UserID(ctx), challengeID, time.Duration(wait)*time.Second)
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -498,6 +708,45 @@ func (h *Handler) DeleteStack(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"status": "ok", "ctf_state": string(state)})
 }
 
+func (h *Handler) ExtendStack(ctx *gin.Context) {
+	h.stackAction(ctx, h.stacks.ExtendStack)
+}
+
+func (h *Handler) RestartStack(ctx *gin.Context) {
+	h.stackAction(ctx, h.stacks.RestartStack)
+}
+
+// Extend and restart only make sense while the CTF is running
+func (h *Handler) stackAction(ctx *gin.Context, action func(context.Context, int64, int64) (*models.Stack, error)) {
+	if h.stacks == nil {
+		writeError(ctx, service.ErrStackDisabled)
+		return
+	}
+
+	state, ok := h.ctfState(ctx)
+	if !ok {
+		return
+	}
+
+	if state != service.CTFStateActive {
+		ctx.JSON(http.StatusOK, ctfStateResponse{CTFState: string(state)})
+		return
+	}
+
+	challengeID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	stackModel, err := action(ctx.Request.Context(), middleware.UserID(ctx), challengeID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newStackResponse(stackModel, string(state)))
+}
+
 func (h *Handler) ListStacks(ctx *gin.Context) {
 	if h.stacks == nil {
 		writeError(ctx, service.ErrStackDisabled)
@@ -529,6 +778,98 @@ func (h *Handler) ListStacks(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, stacksListResponse{CTFState: string(state), Stacks: resp})
 }
 
+const (
+	stackEventKeepalive   = 25 * time.Second
+	maxStackCallbackBytes = 64 << 10
+	stackTimestampHeader  = "X-Stack-Timestamp"
+	stackSignatureHeader  = "X-Stack-Signature"
+)
+
+// Streams stack changes as server-sent events until the client disconnects
+func (h *Handler) StackEvents(ctx *gin.Context) {
+	if h.stacks == nil {
+		writeError(ctx, service.ErrStackDisabled)
+		return
+	}
+
+	state, ok := h.ctfState(ctx)
+	if !ok {
+		return
+	}
+
+	if state == service.CTFStateNotStarted {
+		ctx.JSON(http.StatusOK, ctfStateResponse{CTFState: string(state)})
+		return
+	}
+
+	reqCtx := ctx.Request.Context()
+	events, err := h.stacks.SubscribeStackEvents(reqCtx, middleware.UserID(ctx))
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	// The server WriteTimeout would cut the stream, it ends with the request context instead
+	_ = http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.WriteHeaderNow()
+	ctx.Writer.Flush()
+
+	keepalive := time.NewTicker(stackEventKeepalive)
+	defer keepalive.Stop()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case <-reqCtx.Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+
+			ctx.SSEvent(event.Type, newStackResponse(&event.Stack, string(state)))
+			return true
+		case <-keepalive.C:
+			_, _ = io.WriteString(w, ": keepalive\n\n")
+			return true
+		}
+	})
+}
+
+// Signed status reports from the provisioner. Not behind user auth, the signature is the credential.
+func (h *Handler) StackStatusCallback(ctx *gin.Context) {
+	if h.stacks == nil {
+		writeError(ctx, service.ErrStackDisabled)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxStackCallbackBytes))
+	if err != nil {
+		writeError(ctx, service.NewValidationError(service.FieldError{Field: "body", Reason: "too large"}))
+		return
+	}
+
+	if err := h.stacks.HandleStatusCallback(ctx.Request.Context(), ctx.GetHeader(stackTimestampHeader), ctx.GetHeader(stackSignatureHeader), body); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (h *Handler) authorizeChallenge(ctx *gin.Context, challengeID int64) bool {
+	if err := h.ctf.AuthorizeChallenge(ctx.Request.Context(), challengeID, middleware.UserID(ctx), middleware.Role(ctx)); err != nil {
+		writeError(ctx, err)
+		return false
+	}
+
+	return true
+}
+
 func (h *Handler) CreateChallenge(ctx *gin.Context) {
 	var req createChallengeRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -556,7 +897,12 @@ func (h *Handler) CreateChallenge(ctx *gin.Context) {
 		stackTargetPort = *req.StackTargetPort
 	}
 
-	challenge, err := h.ctf.CreateChallenge(ctx.Request.Context(), req.Title, req.Description, req.Category, req.Points, minimumPoints, req.Flag, active, stackEnabled, stackTargetPort, req.StackPodSpec)
+	stackTeamShared := false
+	if req.StackTeamShared != nil {
+		stackTeamShared = *req.StackTeamShared
+	}
+
+	challenge, err := h.ctf.CreateChallenge(ctx.Request.Context(), req.Title, req.Description, req.Category, req.Points, minimumPoints, req.Flag, active, stackEnabled, stackTargetPort, req.StackPodSpec, stackTeamShared, middleware.UserID(ctx))
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -572,13 +918,17 @@ func (h *Handler) UpdateChallenge(ctx *gin.Context) {
 		return
 	}
 
+	if !h.authorizeChallenge(ctx, challengeID) {
+		return
+	}
+
 	var req updateChallengeRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		writeBindError(ctx, err)
 		return
 	}
 
-	challenge, err := h.ctf.UpdateChallenge(ctx.Request.Context(), challengeID, req.Title, req.Description, req.Category, req.Points, req.MinimumPoints, req.Flag, req.IsActive, req.StackEnabled, req.StackTargetPort, req.StackPodSpec)
+	challenge, err := h.ctf.UpdateChallenge(ctx.Request.Context(), challengeID, req.Title, req.Description, req.Category, req.Points, req.MinimumPoints, req.Flag, req.IsActive, req.StackEnabled, req.StackTargetPort, req.StackPodSpec, req.StackTeamShared)
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -594,6 +944,10 @@ func (h *Handler) AdminGetChallenge(ctx *gin.Context) {
 		return
 	}
 
+	if !h.authorizeChallenge(ctx, challengeID) {
+		return
+	}
+
 	challenge, err := h.ctf.GetChallengeByID(ctx.Request.Context(), challengeID)
 	if err != nil {
 		writeError(ctx, err)
@@ -603,6 +957,7 @@ func (h *Handler) AdminGetChallenge(ctx *gin.Context) {
 	resp := adminChallengeResponse{
 		challengeResponse: newChallengeResponse(challenge),
 		StackPodSpec:      challenge.StackPodSpec,
+		CreatedBy:         challenge.CreatedBy,
 	}
 
 	ctx.JSON(http.StatusOK, resp)
@@ -614,6 +969,10 @@ func (h *Handler) DeleteChallenge(ctx *gin.Context) {
 		return
 	}
 
+	if !h.authorizeChallenge(ctx, challengeID) {
+		return
+	}
+
 	if err := h.ctf.DeleteChallenge(ctx.Request.Context(), challengeID); err != nil {
 		writeError(ctx, err)
 		return
@@ -629,6 +988,10 @@ func (h *Handler) RequestChallengeFileUpload(ctx *gin.Context) {
 		return
 	}
 
+	if !h.authorizeChallenge(ctx, challengeID) {
+		return
+	}
+
 	var req challengeFileUploadRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		writeBindError(ctx, err)
@@ -686,6 +1049,10 @@ func (h *Handler) DeleteChallengeFile(ctx *gin.Context) {
 		return
 	}
 
+	if !h.authorizeChallenge(ctx, challengeID) {
+		return
+	}
+
 	challenge, err := h.ctf.DeleteChallengeFile(ctx.Request.Context(), challengeID)
 	if err != nil {
 		writeError(ctx, err)
@@ -709,12 +1076,16 @@ func (h *Handler) CreateRegistrationKeys(ctx *gin.Context) {
 		count = *req.Count
 	}
 
-	if req.TeamID == nil {
-		writeError(ctx, service.NewValidationError(service.FieldError{Field: "team_id", Reason: "required"}))
-		return
+	var teamID int64
+	if req.TeamID != nil {
+		teamID = *req.TeamID
+	}
+
+	var divisionID int64
+	if req.DivisionID != nil {
+		divisionID = *req.DivisionID
 	}
 
-	teamID := *req.TeamID
 	adminID := middleware.UserID(ctx)
 	admin, err := h.users.GetByID(ctx.Request.Context(), adminID)
 	if err != nil {
@@ -722,18 +1093,30 @@ func (h *Handler) CreateRegistrationKeys(ctx *gin.Context) {
 		return
 	}
 
-	keys, err := h.auth.CreateRegistrationKeys(ctx.Request.Context(), adminID, count, teamID)
-	if err != nil {
-		writeError(ctx, err)
-		return
+	maxUses := 0
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
 	}
 
-	team, err := h.teams.GetTeam(ctx.Request.Context(), teamID)
+	keys, err := h.auth.CreateRegistrationKeys(ctx.Request.Context(), adminID, count, teamID, divisionID, maxUses, req.ExpiresAt)
 	if err != nil {
 		writeError(ctx, err)
 		return
 	}
 
+	teamName, divisionName := "", ""
+	if teamID != 0 {
+		team, err := h.teams.GetTeam(ctx.Request.Context(), teamID)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+		teamName = team.Name
+		if divisionID != 0 {
+			divisionName = team.DivisionName
+		}
+	}
+
 	resp := make([]models.RegistrationKeySummary, 0, len(keys))
 	for _, key := range keys {
 		resp = append(resp, models.RegistrationKeySummary{
@@ -742,12 +1125,18 @@ func (h *Handler) CreateRegistrationKeys(ctx *gin.Context) {
 			CreatedBy:         key.CreatedBy,
 			CreatedByUsername: admin.Username,
 			TeamID:            key.TeamID,
-			TeamName:          team.Name,
+			TeamName:          teamName,
+			DivisionID:        key.DivisionID,
+			DivisionName:      divisionName,
+			MaxUses:           key.MaxUses,
+			UseCount:          key.UseCount,
 			UsedBy:            key.UsedBy,
 			UsedByUsername:    nil,
 			UsedByIP:          nil,
 			CreatedAt:         key.CreatedAt,
 			UsedAt:            key.UsedAt,
+			ExpiresAt:         key.ExpiresAt,
+			Status:            key.Status(time.Now().UTC()),
 		})
 	}
 
@@ -755,7 +1144,12 @@ func (h *Handler) CreateRegistrationKeys(ctx *gin.Context) {
 }
 
 func (h *Handler) ListRegistrationKeys(ctx *gin.Context) {
-	rows, err := h.auth.ListRegistrationKeys(ctx.Request.Context())
+	filter, ok := parseRegistrationKeyFilter(ctx)
+	if !ok {
+		return
+	}
+
+	rows, err := h.auth.ListRegistrationKeys(ctx.Request.Context(), filter)
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -764,14 +1158,176 @@ func (h *Handler) ListRegistrationKeys(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, rows)
 }
 
-// Scoreboard Handlers
-
-func aggregateUserTimeline(raw []models.UserTimelineRow) []models.TimelineSubmission {
-	if len(raw) == 0 {
-		return []models.TimelineSubmission{}
+func (h *Handler) RevokeRegistrationKey(ctx *gin.Context) {
+	keyID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
 	}
 
-	type teamKey struct {
+	key, err := h.auth.RevokeRegistrationKey(ctx.Request.Context(), middleware.UserID(ctx), keyID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, key)
+}
+
+// CSV of every matching key, or an HTML page of cut-out slips for the active ones
+func (h *Handler) ExportRegistrationKeys(ctx *gin.Context) {
+	format := strings.TrimSpace(ctx.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "html" {
+		writeError(ctx, service.NewValidationError(service.FieldError{Field: "format", Reason: "invalid"}))
+		return
+	}
+
+	filter, ok := parseRegistrationKeyFilter(ctx)
+	if !ok {
+		return
+	}
+
+	rows, err := h.auth.ExportRegistrationKeys(ctx.Request.Context(), filter)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	if format == "html" {
+		active := make([]models.RegistrationKeySummary, 0, len(rows))
+		for _, row := range rows {
+			if row.Status == models.RegistrationKeyActive {
+				active = append(active, row)
+			}
+		}
+
+		ctx.Header("Content-Type", "text/html; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		if err := registrationKeySlips.Execute(ctx.Writer, active); err != nil {
+			_ = ctx.Error(err)
+		}
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", `attachment; filename="registration-keys.csv"`)
+	ctx.Status(http.StatusOK)
+
+	w := csv.NewWriter(ctx.Writer)
+	_ = w.Write([]string{"code", "team", "status", "use_count", "max_uses", "expires_at", "created_at"})
+	for _, row := range rows {
+		_ = w.Write([]string{
+			row.Code,
+			csvSafe(row.TeamName),
+			row.Status,
+			strconv.Itoa(row.UseCount),
+			strconv.Itoa(row.MaxUses),
+			formatOptionalTime(row.ExpiresAt),
+			row.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		_ = ctx.Error(err)
+	}
+}
+
+func parseRegistrationKeyFilter(ctx *gin.Context) (models.RegistrationKeyFilter, bool) {
+	var filter models.RegistrationKeyFilter
+
+	if value := strings.TrimSpace(ctx.Query("team_id")); value != "" {
+		teamID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			writeError(ctx, service.NewValidationError(service.FieldError{Field: "team_id", Reason: "invalid"}))
+			return filter, false
+		}
+		filter.TeamID = &teamID
+	}
+
+	if value := strings.TrimSpace(ctx.Query("used")); value != "" {
+		used, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(ctx, service.NewValidationError(service.FieldError{Field: "used", Reason: "invalid"}))
+			return filter, false
+		}
+		filter.Used = &used
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{
+		{name: "limit", dst: &filter.Limit},
+		{name: "offset", dst: &filter.Offset},
+	} {
+		value := strings.TrimSpace(ctx.Query(param.name))
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(ctx, service.NewValidationError(service.FieldError{Field: param.name, Reason: "invalid"}))
+			return filter, false
+		}
+		*param.dst = parsed
+	}
+
+	return filter, true
+}
+
+// Spreadsheet apps evaluate cells starting with these characters as formulas
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+var registrationKeySlips = template.Must(template.New("slips").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Registration keys</title>
+<style>
+body { font-family: sans-serif; margin: 0; }
+.slips { display: grid; grid-template-columns: repeat(3, 1fr); }
+.slip { border: 1px dashed #888; padding: 12px; page-break-inside: avoid; }
+.code { font-family: monospace; font-size: 28px; letter-spacing: 4px; margin: 6px 0; }
+.meta { font-size: 12px; color: #444; }
+</style>
+</head>
+<body>
+<div class="slips">
+{{- range .}}
+<div class="slip">
+<div class="meta">{{.TeamName}}</div>
+<div class="code">{{.Code}}</div>
+<div class="meta">{{if gt .MaxUses 1}}{{.MaxUses}} uses{{else}}single use{{end}}{{with .ExpiresAt}} &middot; expires {{.UTC.Format "2006-01-02 15:04"}} UTC{{end}}</div>
+</div>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+// Scoreboard Handlers
+
+func aggregateUserTimeline(raw []models.UserTimelineRow) []models.TimelineSubmission {
+	if len(raw) == 0 {
+		return []models.TimelineSubmission{}
+	}
+
+	type teamKey struct {
 		userID int64
 		bucket time.Time
 	}
@@ -874,45 +1430,165 @@ func parseWindowOrError(ctx *gin.Context) (int, bool) {
 	return windowMinutes, true
 }
 
+// Missing division_id means every division
+func parseDivisionQuery(ctx *gin.Context) (int64, bool) {
+	value := strings.TrimSpace(ctx.Query("division_id"))
+	if value == "" {
+		return 0, true
+	}
+
+	divisionID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || divisionID <= 0 {
+		writeError(ctx, service.NewValidationError(service.FieldError{Field: "division_id", Reason: "invalid"}))
+		return 0, false
+	}
+
+	return divisionID, true
+}
+
+func divisionCacheKey(base string, divisionID int64) string {
+	if divisionID == 0 {
+		return base
+	}
+
+	return fmt.Sprintf("%s:division:%d", base, divisionID)
+}
+
+// Adds ?country and ?affiliation on top of ?division_id. Unknown country codes are rejected.
+// Matches the longest affiliation a profile can hold
+const maxAffiliationFilterLength = 100
+
+func parseLeaderboardFilter(ctx *gin.Context) (models.LeaderboardFilter, bool) {
+	divisionID, ok := parseDivisionQuery(ctx)
+	if !ok {
+		return models.LeaderboardFilter{}, false
+	}
+
+	filter := models.LeaderboardFilter{
+		DivisionID:  divisionID,
+		Country:     country.Normalize(ctx.Query("country")),
+		Affiliation: strings.TrimSpace(ctx.Query("affiliation")),
+	}
+
+	if filter.Country != "" && !country.Valid(filter.Country) {
+		writeError(ctx, service.NewValidationError(service.FieldError{Field: "country", Reason: "invalid"}))
+		return models.LeaderboardFilter{}, false
+	}
+
+	if utf8.RuneCountInString(filter.Affiliation) > maxAffiliationFilterLength {
+		writeError(ctx, service.NewValidationError(service.FieldError{Field: "affiliation", Reason: "too long"}))
+		return models.LeaderboardFilter{}, false
+	}
+
+	return filter, true
+}
+
+// Affiliations are free text, so filtering by one is not cached. Otherwise every distinct query would leave a cache entry behind.
+func leaderboardCacheKey(base string, filter models.LeaderboardFilter) (string, bool) {
+	if filter.Affiliation != "" {
+		return "", false
+	}
+
+	key := divisionCacheKey(base, filter.DivisionID)
+	if filter.Country != "" {
+		key += ":country:" + filter.Country
+	}
+
+	return key, true
+}
+
 func (h *Handler) Leaderboard(ctx *gin.Context) {
-	cacheKey := "leaderboard:users"
-	if h.respondFromCache(ctx, cacheKey) {
+	filter, ok := parseLeaderboardFilter(ctx)
+	if !ok {
 		return
 	}
 
-	rows, err := h.score.Leaderboard(ctx.Request.Context())
+	cacheKey, cacheable := leaderboardCacheKey("leaderboard:users", filter)
+	if cacheable && h.respondFromCache(ctx, cacheKey) {
+		return
+	}
+
+	rows, err := h.score.Leaderboard(ctx.Request.Context(), filter)
 	if err != nil {
 		writeError(ctx, err)
 		return
 	}
 
-	h.storeCache(ctx, cacheKey, rows, h.cfg.Cache.LeaderboardTTL)
+	if cacheable {
+		h.storeCache(ctx, cacheKey, rows, h.cfg.Cache.LeaderboardTTL)
+	}
 	ctx.JSON(http.StatusOK, rows)
 }
 
 func (h *Handler) TeamLeaderboard(ctx *gin.Context) {
-	cacheKey := "leaderboard:teams"
-	if h.respondFromCache(ctx, cacheKey) {
+	filter, ok := parseLeaderboardFilter(ctx)
+	if !ok {
+		return
+	}
+
+	cacheKey, cacheable := leaderboardCacheKey("leaderboard:teams", filter)
+	if cacheable && h.respondFromCache(ctx, cacheKey) {
 		return
 	}
 
-	rows, err := h.score.TeamLeaderboard(ctx.Request.Context())
+	rows, err := h.score.TeamLeaderboard(ctx.Request.Context(), filter)
 	if err != nil {
 		writeError(ctx, err)
 		return
 	}
 
-	h.storeCache(ctx, cacheKey, rows, h.cfg.Cache.LeaderboardTTL)
+	if cacheable {
+		h.storeCache(ctx, cacheKey, rows, h.cfg.Cache.LeaderboardTTL)
+	}
 	ctx.JSON(http.StatusOK, rows)
 }
 
+func (h *Handler) CountryLeaderboard(ctx *gin.Context) {
+	h.groupLeaderboard(ctx, models.LeaderboardGroupCountry, "leaderboard:countries")
+}
+
+func (h *Handler) AffiliationLeaderboard(ctx *gin.Context) {
+	h.groupLeaderboard(ctx, models.LeaderboardGroupAffiliation, "leaderboard:affiliations")
+}
+
+func (h *Handler) groupLeaderboard(ctx *gin.Context, group, base string) {
+	divisionID, ok := parseDivisionQuery(ctx)
+	if !ok {
+		return
+	}
+
+	cacheKey := divisionCacheKey(base, divisionID)
+	if h.respondFromCache(ctx, cacheKey) {
+		return
+	}
+
+	rows, err := h.score.GroupLeaderboard(ctx.Request.Context(), group, divisionID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	response := groupLeaderboardResponse{Entries: rows}
+	h.storeCache(ctx, cacheKey, response, h.cfg.Cache.LeaderboardTTL)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) ListCountries(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, country.List())
+}
+
 func (h *Handler) Timeline(ctx *gin.Context) {
 	windowMinutes, ok := parseWindowOrError(ctx)
 	if !ok {
 		return
 	}
 
-	cacheKey := fmt.Sprintf("timeline:%d", windowMinutes)
+	divisionID, ok := parseDivisionQuery(ctx)
+	if !ok {
+		return
+	}
+
+	cacheKey := divisionCacheKey(fmt.Sprintf("timeline:%d", windowMinutes), divisionID)
 
 	if h.respondFromCache(ctx, cacheKey) {
 		return
@@ -920,7 +1596,7 @@ func (h *Handler) Timeline(ctx *gin.Context) {
 
 	windowStart := windowStartFromMinutes(windowMinutes)
 
-	raw, err := h.score.TimelineSubmissions(ctx.Request.Context(), windowStart)
+	raw, err := h.score.TimelineSubmissions(ctx.Request.Context(), windowStart, divisionID)
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -940,7 +1616,12 @@ func (h *Handler) TeamTimeline(ctx *gin.Context) {
 		return
 	}
 
-	cacheKey := fmt.Sprintf("timeline:teams:%d", windowMinutes)
+	divisionID, ok := parseDivisionQuery(ctx)
+	if !ok {
+		return
+	}
+
+	cacheKey := divisionCacheKey(fmt.Sprintf("timeline:teams:%d", windowMinutes), divisionID)
 
 	if h.respondFromCache(ctx, cacheKey) {
 		return
@@ -948,7 +1629,7 @@ func (h *Handler) TeamTimeline(ctx *gin.Context) {
 
 	windowStart := windowStartFromMinutes(windowMinutes)
 
-	raw, err := h.score.TimelineTeamSubmissions(ctx.Request.Context(), windowStart)
+	raw, err := h.score.TimelineTeamSubmissions(ctx.Request.Context(), windowStart, divisionID)
 	if err != nil {
 		writeError(ctx, err)
 		return
@@ -962,6 +1643,51 @@ func (h *Handler) TeamTimeline(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
+// Division Handlers
+
+func (h *Handler) ListDivisions(ctx *gin.Context) {
+	divisions, err := h.teams.ListDivisions(ctx.Request.Context())
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, divisions)
+}
+
+func (h *Handler) CreateDivision(ctx *gin.Context) {
+	var req createDivisionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	division, err := h.teams.CreateDivision(ctx.Request.Context(), req.Name)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, division)
+}
+
+func (h *Handler) DeleteDivision(ctx *gin.Context) {
+	divisionID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.teams.DeleteDivision(ctx.Request.Context(), divisionID); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	h.invalidateTimelineCache()
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
 // Team Handlers
 
 func (h *Handler) CreateTeam(ctx *gin.Context) {
@@ -980,6 +1706,148 @@ func (h *Handler) CreateTeam(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, newTeamResponse(team))
 }
 
+func (h *Handler) UpdateTeam(ctx *gin.Context) {
+	teamID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	var req updateTeamRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	team, err := h.teams.RenameTeam(ctx.Request.Context(), teamID, req.Name)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	h.invalidateTimelineCache()
+
+	ctx.JSON(http.StatusOK, newTeamResponse(team))
+}
+
+func (h *Handler) DeleteTeam(ctx *gin.Context) {
+	teamID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.teams.DeleteTeam(ctx.Request.Context(), middleware.UserID(ctx), teamID); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	h.invalidateTimelineCache()
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (h *Handler) MergeTeam(ctx *gin.Context) {
+	teamID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	var req mergeTeamRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	team, err := h.teams.MergeTeams(ctx.Request.Context(), teamID, *req.SourceTeamID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	h.invalidateTimelineCache()
+
+	ctx.JSON(http.StatusOK, team)
+}
+
+func (h *Handler) SetTeamDivision(ctx *gin.Context) {
+	teamID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	var req setTeamDivisionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	team, err := h.teams.SetTeamDivision(ctx.Request.Context(), teamID, *req.DivisionID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	h.invalidateTimelineCache()
+
+	ctx.JSON(http.StatusOK, team)
+}
+
+func (h *Handler) SetTeamCaptain(ctx *gin.Context) {
+	teamID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	var req setTeamCaptainRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	team, err := h.teams.SetCaptain(ctx.Request.Context(), teamID, *req.UserID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	h.invalidateTimelineCache()
+
+	ctx.JSON(http.StatusOK, team)
+}
+
+func (h *Handler) AdminMoveUserTeam(ctx *gin.Context) {
+	userID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	var req moveUserTeamRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	if err := h.teams.MoveUser(ctx.Request.Context(), userID, *req.TeamID); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	h.invalidateLeaderboardCache()
+	h.invalidateTimelineCache()
+
+	user, err := h.users.GetByID(ctx.Request.Context(), userID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserDetailResponse(user))
+}
+
 func (h *Handler) ListTeams(ctx *gin.Context) {
 	teams, err := h.teams.ListTeams(ctx.Request.Context())
 	if err != nil {
@@ -1068,6 +1936,220 @@ func (h *Handler) GetUser(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, newUserDetailResponse(user))
 }
 
+func (h *Handler) AdminRevokeUserSessions(ctx *gin.Context) {
+	userID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := h.users.GetByID(ctx.Request.Context(), userID); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	// API tokens go first: revoking them is the step that can fail, and a retry then still finds the sessions
+	revokedTokens := 0
+	if h.tokens != nil {
+		var err error
+		revokedTokens, err = h.tokens.RevokeUserTokens(ctx.Request.Context(), userID)
+		if err != nil {
+			writeError(ctx, err)
+			return
+		}
+	}
+
+	revoked, err := h.auth.RevokeUser(ctx.Request.Context(), userID)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"revoked": revoked, "revoked_tokens": revokedTokens})
+}
+
+func (h *Handler) AdminUnlockUser(ctx *gin.Context) {
+	userID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.auth.UnlockAccount(ctx.Request.Context(), userID); err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (h *Handler) AdminListLoginFailures(ctx *gin.Context) {
+	limit := 0
+	if value := strings.TrimSpace(ctx.Query("limit")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(ctx, service.NewValidationError(service.FieldError{Field: "limit", Reason: "invalid"}))
+			return
+		}
+		limit = parsed
+	}
+
+	failures, err := h.auth.ListLoginFailures(ctx.Request.Context(), ctx.Query("email"), ctx.Query("ip"), limit)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	resp := make([]loginFailureResponse, 0, len(failures))
+	for i := range failures {
+		resp = append(resp, newLoginFailureResponse(&failures[i]))
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (h *Handler) AdminListStacks(ctx *gin.Context) {
+	if h.stacks == nil {
+		writeError(ctx, service.ErrStackDisabled)
+		return
+	}
+
+	filter, ok := parseStackFilter(ctx)
+	if !ok {
+		return
+	}
+
+	rows, total, err := h.stacks.AdminListStacks(ctx.Request.Context(), filter)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, adminStacksResponse{Stacks: rows, Total: total})
+}
+
+func (h *Handler) AdminStackCounts(ctx *gin.Context) {
+	if h.stacks == nil {
+		writeError(ctx, service.ErrStackDisabled)
+		return
+	}
+
+	rows, err := h.stacks.AdminStackCounts(ctx.Request.Context())
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rows)
+}
+
+func (h *Handler) AdminDeleteStack(ctx *gin.Context) {
+	if h.stacks == nil {
+		writeError(ctx, service.ErrStackDisabled)
+		return
+	}
+
+	id, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.stacks.AdminDeleteStack(ctx.Request.Context(), id); err != nil {
+		writeAdminError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (h *Handler) AdminDeleteStacks(ctx *gin.Context) {
+	if h.stacks == nil {
+		writeError(ctx, service.ErrStackDisabled)
+		return
+	}
+
+	var req adminDeleteStacksRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	filter := models.StackFilter{ChallengeID: req.ChallengeID, UserID: req.UserID, TeamID: req.TeamID, Status: req.Status}
+	deleted, failed, err := h.stacks.AdminDeleteStacks(ctx.Request.Context(), filter)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, adminDeleteStacksResponse{Deleted: deleted, Failed: failed})
+}
+
+func parseStackFilter(ctx *gin.Context) (models.StackFilter, bool) {
+	filter := models.StackFilter{Status: ctx.Query("status")}
+
+	for _, param := range []struct {
+		name string
+		dst  *int64
+	}{
+		{name: "challenge_id", dst: &filter.ChallengeID},
+		{name: "user_id", dst: &filter.UserID},
+		{name: "team_id", dst: &filter.TeamID},
+	} {
+		value := strings.TrimSpace(ctx.Query(param.name))
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			writeError(ctx, service.NewValidationError(service.FieldError{Field: param.name, Reason: "invalid"}))
+			return filter, false
+		}
+		*param.dst = parsed
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *int
+	}{
+		{name: "limit", dst: &filter.Limit},
+		{name: "offset", dst: &filter.Offset},
+	} {
+		value := strings.TrimSpace(ctx.Query(param.name))
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(ctx, service.NewValidationError(service.FieldError{Field: param.name, Reason: "invalid"}))
+			return filter, false
+		}
+		*param.dst = parsed
+	}
+
+	return filter, true
+}
+
+func (h *Handler) AdminUpdateUserRole(ctx *gin.Context) {
+	userID, ok := parseIDParamOrError(ctx, "id")
+	if !ok {
+		return
+	}
+
+	var req updateUserRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		writeBindError(ctx, err)
+		return
+	}
+
+	user, err := h.auth.UpdateRole(ctx.Request.Context(), middleware.UserID(ctx), userID, req.Role)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newUserDetailResponse(user))
+}
+
 func (h *Handler) GetUserSolved(ctx *gin.Context) {
 	userID, ok := parseIDParamOrError(ctx, "id")
 	if !ok {
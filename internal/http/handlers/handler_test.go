@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -82,6 +88,38 @@ func TestParseIDParam(t *testing.T) {
 	}
 }
 
+func TestHandlerJWKS(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	cfg := config.Config{JWT: config.JWTConfig{Algorithm: config.JWTAlgorithmEdDSA, PrivateKey: privateKey}}
+	h := New(cfg, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
+
+	ctx, rec := newJSONContext(t, http.MethodGet, "/.well-known/jwks.json", nil)
+	h.JWKS(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("jwks status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+		} `json:"keys"`
+	}
+	decodeJSON(t, rec, &set)
+
+	if len(set.Keys) != 1 || set.Keys[0].Kid == "" || set.Keys[0].Kty != "OKP" {
+		t.Fatalf("unexpected jwks: %s", rec.Body.String())
+	}
+
+	if rec.Header().Get("Cache-Control") == "" {
+		t.Fatalf("expected cache-control header")
+	}
+}
+
 // App Config Tests
 
 func TestNormalizeETag(t *testing.T) {
@@ -425,6 +463,7 @@ func TestHandlerChallengesAndSubmit(t *testing.T) {
 
 	ctx, rec = newJSONContext(t, http.MethodPut, "/api/admin/challenges/1", updateReq)
 	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprintf("%d", challenge.ID)}}
+	ctx.Set("role", "admin")
 
 	env.handler.UpdateChallenge(ctx)
 	if rec.Code != http.StatusOK {
@@ -441,6 +480,7 @@ func TestHandlerChallengesAndSubmit(t *testing.T) {
 
 	ctx, rec = newJSONContext(t, http.MethodPut, "/api/admin/challenges/1", map[string]any{"flag": "new"})
 	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprintf("%d", challenge.ID)}}
+	ctx.Set("role", "admin")
 
 	env.handler.UpdateChallenge(ctx)
 	if rec.Code != http.StatusBadRequest {
@@ -449,6 +489,7 @@ func TestHandlerChallengesAndSubmit(t *testing.T) {
 
 	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/admin/challenges/1", nil)
 	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprintf("%d", challenge.ID)}}
+	ctx.Set("role", "admin")
 
 	env.handler.DeleteChallenge(ctx)
 	if rec.Code != http.StatusOK {
@@ -504,6 +545,7 @@ func TestHandlerRequestChallengeFileUpload(t *testing.T) {
 
 	ctx, rec := newJSONContext(t, http.MethodPost, "/api/admin/challenges/1/file/upload", map[string]string{"filename": "bundle.zip"})
 	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprintf("%d", challenge.ID)}}
+	ctx.Set("role", "admin")
 
 	env.handler.RequestChallengeFileUpload(ctx)
 	if rec.Code != http.StatusOK {
@@ -517,6 +559,7 @@ func TestHandlerRequestChallengeFileUploadBindError(t *testing.T) {
 
 	ctx, rec := newJSONContext(t, http.MethodPost, "/api/admin/challenges/1/file/upload", "")
 	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprintf("%d", challenge.ID)}}
+	ctx.Set("role", "admin")
 
 	env.handler.RequestChallengeFileUpload(ctx)
 	if rec.Code != http.StatusBadRequest {
@@ -543,10 +586,11 @@ func TestHandlerRequestChallengeFileUploadStorageUnavailable(t *testing.T) {
 
 	ctfSvc := service.NewCTFService(env.cfg, env.challengeRepo, env.submissionRepo, env.redis, nil)
 	scoreRepo := repo.NewScoreboardRepo(env.db)
-	handler := New(env.cfg, env.authSvc, ctfSvc, env.appConfigSvc, env.userRepo, scoreRepo, env.teamSvc, nil, env.redis)
+	handler := New(env.cfg, env.authSvc, ctfSvc, env.appConfigSvc, env.userRepo, scoreRepo, env.teamSvc, nil, env.apiTokenSvc, env.powSvc, env.redis)
 
 	ctx, rec := newJSONContext(t, http.MethodPost, "/api/admin/challenges/1/file/upload", map[string]string{"filename": "bundle.zip"})
 	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprintf("%d", challenge.ID)}}
+	ctx.Set("role", "admin")
 
 	handler.RequestChallengeFileUpload(ctx)
 	if rec.Code != http.StatusServiceUnavailable {
@@ -620,6 +664,112 @@ func setupHandlerStackService(t *testing.T, env handlerEnv, client stack.API) (*
 	return stackSvc, stackRepo
 }
 
+func TestStackStatusCallbackHandler(t *testing.T) {
+	env := setupHandlerTest(t)
+	challenge := createHandlerStackChallenge(t, env, "stack")
+
+	stackRepo := repo.NewStackRepo(env.db)
+	row := &models.Stack{UserID: 1, ChallengeID: challenge.ID, StackID: "stack-cb", Status: "creating", TargetPort: 80, CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()}
+	if err := stackRepo.Create(context.Background(), row); err != nil {
+		t.Fatalf("create stack: %v", err)
+	}
+
+	stackCfg := config.StackConfig{Enabled: true, MaxPerUser: 3, CreateWindow: time.Minute, CreateMax: 5, CallbackSecret: "secret"}
+	env.handler.stacks = service.NewStackService(stackCfg, stackRepo, env.challengeRepo, env.submissionRepo, &stack.MockClient{}, env.redis)
+
+	body := `{"stack_id":"stack-cb","status":"running","node_port":31000,"target_port":80}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	ctx, rec := newJSONContext(t, http.MethodPost, "/internal/stacks/callback", body)
+	ctx.Request.Header.Set(stackTimestampHeader, timestamp)
+	ctx.Request.Header.Set(stackSignatureHeader, stack.SignCallback("wrong", timestamp, []byte(body)))
+	env.handler.StackStatusCallback(ctx)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPost, "/internal/stacks/callback", body)
+	ctx.Request.Header.Set(stackTimestampHeader, timestamp)
+	ctx.Request.Header.Set(stackSignatureHeader, stack.SignCallback("secret", timestamp, []byte(body)))
+	env.handler.StackStatusCallback(ctx)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	updated, err := stackRepo.GetByStackID(context.Background(), "stack-cb")
+	if err != nil {
+		t.Fatalf("get stack: %v", err)
+	}
+
+	if updated.Status != "running" || updated.NodePort == nil || *updated.NodePort != 31000 {
+		t.Fatalf("unexpected stack after callback: %+v", updated)
+	}
+}
+
+func TestStackEventsOutlivesWriteTimeout(t *testing.T) {
+	env := setupHandlerTest(t)
+	user := createHandlerUser(t, env, "sse@example.com", "sse", "pass", "user")
+	challenge := createHandlerStackChallenge(t, env, "stack")
+
+	stackRepo := repo.NewStackRepo(env.db)
+	createdAt := time.Now().Add(-time.Minute).UTC()
+	row := &models.Stack{UserID: user.ID, ChallengeID: challenge.ID, StackID: "stack-sse", Status: "creating", TargetPort: 80, CreatedAt: createdAt, UpdatedAt: createdAt}
+	if err := stackRepo.Create(context.Background(), row); err != nil {
+		t.Fatalf("create stack: %v", err)
+	}
+
+	stackCfg := config.StackConfig{Enabled: true, MaxPerUser: 3, CreateWindow: time.Minute, CreateMax: 5, CallbackSecret: "secret"}
+	stackSvc := service.NewStackService(stackCfg, stackRepo, env.challengeRepo, env.submissionRepo, &stack.MockClient{}, env.redis)
+	env.handler.stacks = stackSvc
+
+	router := gin.New()
+	router.GET("/api/stacks/events", func(ctx *gin.Context) {
+		ctx.Set("userID", user.ID)
+		env.handler.StackEvents(ctx)
+	})
+
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 200 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/api/stacks/events", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	// Publish only once the write timeout has passed
+	time.Sleep(3 * server.Config.WriteTimeout)
+
+	body := []byte(`{"stack_id":"stack-sse","status":"running","node_port":31000,"target_port":80}`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if err := stackSvc.HandleStatusCallback(context.Background(), timestamp, stack.SignCallback("secret", timestamp, body), body); err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if scanner.Text() == "event:"+service.StackEventUpdated {
+			return
+		}
+	}
+
+	t.Fatalf("stream ended before the event: %v", scanner.Err())
+}
+
 func TestStackHandlersCRUD(t *testing.T) {
 	env := setupHandlerTest(t)
 	user := createHandlerUser(t, env, "u1@example.com", "u1", "pass", "user")
@@ -805,6 +955,7 @@ func TestAdminGetChallengeIncludesStackSpec(t *testing.T) {
 
 	ctx, rec := newJSONContext(t, http.MethodGet, "/api/admin/challenges/"+fmt.Sprint(challenge.ID), nil)
 	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(challenge.ID)}}
+	ctx.Set("role", "admin")
 	env.handler.AdminGetChallenge(ctx)
 	if rec.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", rec.Code)
@@ -915,6 +1066,179 @@ func TestHandlerRegistrationKeys(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("list keys status %d: %s", rec.Code, rec.Body.String())
 	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/admin/registration-keys?used=maybe", nil)
+	ctx.Set("userID", admin.ID)
+
+	env.handler.ListRegistrationKeys(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("list keys invalid filter status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerRevokeAndExportRegistrationKeys(t *testing.T) {
+	env := setupHandlerTest(t)
+	admin := createHandlerUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	team := createHandlerTeam(t, env, "=Alpha")
+	active := createHandlerRegistrationKeyWithTeam(t, env, "111111", admin.ID, team.ID)
+	revoked := createHandlerRegistrationKeyWithTeam(t, env, "222222", admin.ID, team.ID)
+
+	ctx, rec := newJSONContext(t, http.MethodPost, "/api/admin/registration-keys/"+fmt.Sprint(revoked.ID)+"/revoke", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(revoked.ID)}}
+	ctx.Set("userID", admin.ID)
+
+	env.handler.RevokeRegistrationKey(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var key models.RegistrationKeySummary
+	decodeJSON(t, rec, &key)
+	if key.Status != models.RegistrationKeyRevoked {
+		t.Fatalf("expected revoked status, got %+v", key)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPost, "/api/admin/registration-keys/9999/revoke", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: "9999"}}
+	ctx.Set("userID", admin.ID)
+
+	env.handler.RevokeRegistrationKey(ctx)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("revoke missing status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/admin/registration-keys/export", nil)
+	ctx.Set("userID", admin.ID)
+
+	env.handler.ExportRegistrationKeys(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export csv status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+
+	if len(records) != 3 || records[0][0] != "code" {
+		t.Fatalf("unexpected csv: %v", records)
+	}
+
+	if records[1][1] != "'=Alpha" {
+		t.Fatalf("expected escaped team name, got %q", records[1][1])
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/admin/registration-keys/export?format=html", nil)
+	ctx.Set("userID", admin.ID)
+
+	env.handler.ExportRegistrationKeys(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export html status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, active.Code) || strings.Contains(body, revoked.Code) {
+		t.Fatalf("expected only active keys on slips: %s", body)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/admin/registration-keys/export?format=pdf", nil)
+	ctx.Set("userID", admin.ID)
+
+	env.handler.ExportRegistrationKeys(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("export invalid format status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCSVSafe(t *testing.T) {
+	cases := map[string]string{
+		"Alpha":     "Alpha",
+		"=1+1":      "'=1+1",
+		"+cmd":      "'+cmd",
+		"-x":        "'-x",
+		"@SUM(A1)":  "'@SUM(A1)",
+		"":          "",
+		"Team =One": "Team =One",
+	}
+
+	for in, want := range cases {
+		if got := csvSafe(in); got != want {
+			t.Fatalf("csvSafe(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// Team Administration Handler Tests
+
+func TestHandlerTeamAdministration(t *testing.T) {
+	env := setupHandlerTest(t)
+	target := createHandlerTeam(t, env, "Target")
+	source := createHandlerTeam(t, env, "Source")
+	empty := createHandlerTeam(t, env, "Empty")
+	user := createHandlerUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", source.ID)
+
+	for _, key := range []string{"leaderboard:teams", "timeline:teams:0"} {
+		if err := env.redis.Set(context.Background(), key, "{}", time.Minute).Err(); err != nil {
+			t.Fatalf("set cache: %v", err)
+		}
+	}
+
+	ctx, rec := newJSONContext(t, http.MethodPut, "/api/admin/teams/"+fmt.Sprint(target.ID), map[string]string{"name": "Target Prime"})
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(target.ID)}}
+	env.handler.UpdateTeam(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The caches are dropped in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for env.redis.Exists(context.Background(), "leaderboard:teams", "timeline:teams:0").Val() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected rename to invalidate the leaderboard and timeline caches")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/admin/teams/"+fmt.Sprint(source.ID), nil)
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(source.ID)}}
+	env.handler.DeleteTeam(ctx)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("delete non-empty status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/admin/users/"+fmt.Sprint(user.ID)+"/team", map[string]int64{"team_id": empty.ID})
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(user.ID)}}
+	env.handler.AdminMoveUserTeam(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("move status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var moved map[string]any
+	decodeJSON(t, rec, &moved)
+	if moved["team_id"] != float64(empty.ID) {
+		t.Fatalf("expected user moved, got %v", moved)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPost, "/api/admin/teams/"+fmt.Sprint(target.ID)+"/merge", map[string]int64{"source_team_id": empty.ID})
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(target.ID)}}
+	env.handler.MergeTeam(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPost, "/api/admin/teams/"+fmt.Sprint(target.ID)+"/merge", map[string]any{})
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(target.ID)}}
+	env.handler.MergeTeam(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("merge missing source status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/admin/teams/"+fmt.Sprint(source.ID), nil)
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(source.ID)}}
+	env.handler.DeleteTeam(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete empty status %d: %s", rec.Code, rec.Body.String())
+	}
 }
 
 // Scoreboard Helper Tests
@@ -1147,6 +1471,88 @@ func TestHandlerTimelineUsesCache(t *testing.T) {
 	}
 }
 
+func TestHandlerDivisions(t *testing.T) {
+	env := setupHandlerTest(t)
+	teamA := createHandlerTeam(t, env, "Alpha")
+	teamB := createHandlerTeam(t, env, "Beta")
+	user1 := createHandlerUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", teamA.ID)
+	user2 := createHandlerUserWithTeam(t, env, "u2@example.com", "u2", "pass", "user", teamB.ID)
+	ch := createHandlerChallenge(t, env, "Ch1", 100, "FLAG{1}", true)
+
+	createHandlerSubmission(t, env, user1.ID, ch.ID, true, time.Now().Add(-2*time.Minute))
+	createHandlerSubmission(t, env, user2.ID, ch.ID, true, time.Now().Add(-1*time.Minute))
+
+	ctx, rec := newJSONContext(t, http.MethodPost, "/api/admin/divisions", map[string]string{"name": "University"})
+	env.handler.CreateDivision(ctx)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create division status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var division struct {
+		ID int64 `json:"id"`
+	}
+	decodeJSON(t, rec, &division)
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/admin/teams/"+fmt.Sprint(teamB.ID)+"/division", map[string]int64{"division_id": division.ID})
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(teamB.ID)}}
+	env.handler.SetTeamDivision(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set division status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/admin/teams/"+fmt.Sprint(teamB.ID)+"/division", map[string]any{})
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(teamB.ID)}}
+	env.handler.SetTeamDivision(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("set division missing status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/leaderboard/teams?division_id="+fmt.Sprint(division.ID), nil)
+	env.handler.TeamLeaderboard(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("division leaderboard status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var leaderboard struct {
+		Entries []struct {
+			TeamID     int64 `json:"team_id"`
+			DivisionID int64 `json:"division_id"`
+		} `json:"entries"`
+	}
+	decodeJSON(t, rec, &leaderboard)
+	if len(leaderboard.Entries) != 1 || leaderboard.Entries[0].TeamID != teamB.ID || leaderboard.Entries[0].DivisionID != division.ID {
+		t.Fatalf("unexpected division leaderboard: %+v", leaderboard)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/timeline/teams?division_id=abc", nil)
+	env.handler.TeamTimeline(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid division status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/divisions", nil)
+	env.handler.ListDivisions(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list divisions status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var divisions []struct {
+		Name      string `json:"name"`
+		TeamCount int    `json:"team_count"`
+	}
+	decodeJSON(t, rec, &divisions)
+	if len(divisions) != 1 || divisions[0].Name != "University" || divisions[0].TeamCount != 1 {
+		t.Fatalf("unexpected divisions: %+v", divisions)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/admin/divisions/"+fmt.Sprint(division.ID), nil)
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(division.ID)}}
+	env.handler.DeleteDivision(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete division status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestHandlerTeamTimelineUsesCache(t *testing.T) {
 	env := setupHandlerTest(t)
 	cacheKey := "timeline:teams:0"
@@ -1210,7 +1616,7 @@ func TestHandlerTeamLeaderboardUsesCache(t *testing.T) {
 func TestHandlerLeaderboardError(t *testing.T) {
 	closedDB := newClosedHandlerDB(t)
 	scoreRepo := repo.NewScoreboardRepo(closedDB)
-	handler := New(handlerCfg, nil, nil, nil, nil, scoreRepo, nil, nil, handlerRedis)
+	handler := New(handlerCfg, nil, nil, nil, nil, scoreRepo, nil, nil, nil, nil, handlerRedis)
 
 	ctx, rec := newJSONContext(t, http.MethodGet, "/api/leaderboard", nil)
 	handler.Leaderboard(ctx)
@@ -1229,7 +1635,7 @@ func TestHandlerListChallengesError(t *testing.T) {
 	scoreRepo := repo.NewScoreboardRepo(closedDB)
 	appConfigRepo := repo.NewAppConfigRepo(closedDB)
 	appConfigSvc := service.NewAppConfigService(appConfigRepo, handlerRedis, handlerCfg.Cache.AppConfigTTL)
-	handler := New(handlerCfg, nil, ctfSvc, appConfigSvc, nil, scoreRepo, nil, nil, handlerRedis)
+	handler := New(handlerCfg, nil, ctfSvc, appConfigSvc, nil, scoreRepo, nil, nil, nil, nil, handlerRedis)
 
 	ctx, rec := newJSONContext(t, http.MethodGet, "/api/challenges", nil)
 	handler.ListChallenges(ctx)
@@ -1359,3 +1765,241 @@ func TestHandlerMeUpdateUsers(t *testing.T) {
 		t.Fatalf("get user status %d: %s", rec.Code, rec.Body.String())
 	}
 }
+
+func TestHandlerSessions(t *testing.T) {
+	env := setupHandlerTest(t)
+	user := createHandlerUser(t, env, "user@example.com", "user1", "pass", "user")
+	admin := createHandlerUser(t, env, "admin@example.com", "admin", "pass", "admin")
+
+	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "agent-a", "10.0.0.1"); err != nil {
+		t.Fatalf("login a: %v", err)
+	}
+
+	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "agent-b", "10.0.0.2"); err != nil {
+		t.Fatalf("login b: %v", err)
+	}
+
+	ctx, rec := newJSONContext(t, http.MethodGet, "/api/me/sessions", nil)
+	ctx.Set("userID", user.ID)
+
+	env.handler.ListSessions(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list sessions status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var sessions []sessionResponse
+	decodeJSON(t, rec, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/me/sessions/missing", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: "missing"}}
+	ctx.Set("userID", user.ID)
+
+	env.handler.RevokeSession(ctx)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("revoke missing status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/me/sessions/"+sessions[0].ID, nil)
+	ctx.Params = gin.Params{{Key: "id", Value: sessions[0].ID}}
+	ctx.Set("userID", user.ID)
+
+	env.handler.RevokeSession(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke session status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/me/sessions", nil)
+	ctx.Set("userID", user.ID)
+	ctx.Set("sessionID", sessions[1].ID)
+
+	env.handler.RevokeOtherSessions(ctx)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"revoked":0`)) {
+		t.Fatalf("revoke others status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if _, _, err := env.apiTokenSvc.CreateToken(context.Background(), user.ID, "bot", []string{models.ScopeRead}, nil); err != nil {
+		t.Fatalf("create api token: %v", err)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/admin/users/1/sessions", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprintf("%d", user.ID)}}
+	ctx.Set("userID", admin.ID)
+
+	env.handler.AdminRevokeUserSessions(ctx)
+	if rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"revoked":1`)) || !bytes.Contains(rec.Body.Bytes(), []byte(`"revoked_tokens":1`)) {
+		t.Fatalf("admin revoke status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodDelete, "/api/admin/users/999999/sessions", nil)
+	ctx.Params = gin.Params{{Key: "id", Value: "999999"}}
+
+	env.handler.AdminRevokeUserSessions(ctx)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("admin revoke missing status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerUpdateMePassword(t *testing.T) {
+	env := setupHandlerTest(t)
+	user := createHandlerUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	ctx, rec := newJSONContext(t, http.MethodPut, "/api/me", map[string]string{"current_password": "wrong", "new_password": "newpass"})
+	ctx.Set("userID", user.ID)
+
+	env.handler.UpdateMe(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("update password invalid status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/me", map[string]string{"username": "user2", "current_password": "pass", "new_password": "newpass"})
+	ctx.Set("userID", user.ID)
+
+	env.handler.UpdateMe(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update password status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "newpass", "", ""); err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
+
+	createHandlerUser(t, env, "other@example.com", "taken", "pass", "user")
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/me", map[string]string{"username": "taken"})
+	ctx.Set("userID", user.ID)
+
+	env.handler.UpdateMe(ctx)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("update taken username status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandlerProfilesAndCountryBoards(t *testing.T) {
+	env := setupHandlerTest(t)
+	team := createHandlerTeam(t, env, "Alpha")
+	captain := createHandlerUserWithTeam(t, env, "c@example.com", "captain", "pass", "user", team.ID)
+	member := createHandlerUserWithTeam(t, env, "m@example.com", "member", "pass", "user", team.ID)
+	ch := createHandlerChallenge(t, env, "Ch1", 100, "FLAG{1}", true)
+	createHandlerSubmission(t, env, captain.ID, ch.ID, true, time.Now().Add(-time.Minute))
+
+	ctx, rec := newJSONContext(t, http.MethodPut, "/api/me", map[string]string{"country": "kr", "affiliation": "KAIST"})
+	ctx.Set("userID", captain.ID)
+	env.handler.UpdateMe(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update profile status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var me struct {
+		Country     string `json:"country"`
+		Affiliation string `json:"affiliation"`
+	}
+	decodeJSON(t, rec, &me)
+	if me.Country != "KR" || me.Affiliation != "KAIST" {
+		t.Fatalf("unexpected profile: %+v", me)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/me", map[string]string{"website": "not a url"})
+	ctx.Set("userID", captain.ID)
+	env.handler.UpdateMe(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid website status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if err := env.redis.Set(context.Background(), "leaderboard:teams", "{}", time.Minute).Err(); err != nil {
+		t.Fatalf("set cache: %v", err)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/admin/teams/"+fmt.Sprint(team.ID)+"/captain", map[string]int64{"user_id": captain.ID})
+	ctx.Params = gin.Params{{Key: "id", Value: fmt.Sprint(team.ID)}}
+	env.handler.SetTeamCaptain(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set captain status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for env.redis.Exists(context.Background(), "leaderboard:teams").Val() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected a captain change to invalidate the leaderboard cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/me/team", map[string]string{"bio": "hello"})
+	ctx.Set("userID", member.ID)
+	env.handler.UpdateMyTeam(ctx)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("member team edit status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodPut, "/api/me/team", map[string]string{"country": "KR", "bio": "hello"})
+	ctx.Set("userID", captain.ID)
+	env.handler.UpdateMyTeam(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("captain team edit status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/leaderboard?country=xx", nil)
+	env.handler.Leaderboard(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid country status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/leaderboard?affiliation="+strings.Repeat("a", 101), nil)
+	env.handler.Leaderboard(ctx)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("long affiliation status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/leaderboard/teams?country=kr", nil)
+	env.handler.TeamLeaderboard(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("team country leaderboard status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var teams struct {
+		Entries []struct {
+			TeamID  int64  `json:"team_id"`
+			Country string `json:"country"`
+		} `json:"entries"`
+	}
+	decodeJSON(t, rec, &teams)
+	if len(teams.Entries) != 1 || teams.Entries[0].TeamID != team.ID || teams.Entries[0].Country != "KR" {
+		t.Fatalf("unexpected team leaderboard: %+v", teams)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/leaderboard/countries", nil)
+	env.handler.CountryLeaderboard(ctx)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("country leaderboard status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var groups struct {
+		Entries []models.GroupLeaderboardEntry `json:"entries"`
+	}
+	decodeJSON(t, rec, &groups)
+	if len(groups.Entries) != 1 || groups.Entries[0].Key != "KR" || groups.Entries[0].Score != 100 || groups.Entries[0].MemberCount != 1 {
+		t.Fatalf("unexpected country groups: %+v", groups)
+	}
+
+	ctx, rec = newJSONContext(t, http.MethodGet, "/api/countries", nil)
+	env.handler.ListCountries(ctx)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"code":"KR"`) {
+		t.Fatalf("list countries status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLeaderboardCacheKey(t *testing.T) {
+	if got, ok := leaderboardCacheKey("leaderboard:users", models.LeaderboardFilter{}); !ok || got != "leaderboard:users" {
+		t.Fatalf("unexpected key: %s", got)
+	}
+
+	if got, ok := leaderboardCacheKey("leaderboard:users", models.LeaderboardFilter{DivisionID: 2, Country: "KR"}); !ok || got != "leaderboard:users:division:2:country:KR" {
+		t.Fatalf("unexpected key: %s", got)
+	}
+
+	if _, ok := leaderboardCacheKey("leaderboard:users", models.LeaderboardFilter{Affiliation: "Seoul Univ"}); ok {
+		t.Fatalf("expected affiliation filters to skip the cache")
+	}
+}
@@ -38,6 +38,8 @@ type handlerEnv struct {
 	ctfSvc         *service.CTFService
 	teamSvc        *service.TeamService
 	appConfigSvc   *service.AppConfigService
+	apiTokenSvc    *service.APITokenService
+	powSvc         *service.PoWService
 	handler        *Handler
 }
 
@@ -154,7 +156,7 @@ func setHandlerCTFWindow(t *testing.T, env handlerEnv, startAt, endAt *time.Time
 		endValue = &value
 	}
 
-	if _, _, _, err := env.appConfigSvc.Update(context.Background(), nil, nil, nil, nil, startValue, endValue); err != nil {
+	if _, _, _, err := env.appConfigSvc.Update(context.Background(), nil, nil, nil, nil, startValue, endValue, nil, nil, nil, nil); err != nil {
 		t.Fatalf("set ctf window: %v", err)
 	}
 }
@@ -222,11 +224,13 @@ func setupHandlerTest(t *testing.T) handlerEnv {
 	fileStore := storage.NewMemoryChallengeFileStore(10 * time.Minute)
 
 	appConfigSvc := service.NewAppConfigService(appConfigRepo, handlerRedis, handlerCfg.Cache.AppConfigTTL)
-	authSvc := service.NewAuthService(handlerCfg, handlerDB, userRepo, regRepo, teamRepo, handlerRedis)
-	teamSvc := service.NewTeamService(teamRepo)
+	authSvc := service.NewAuthService(handlerCfg, handlerDB, userRepo, regRepo, teamRepo, repo.NewLoginFailureRepo(handlerDB), appConfigSvc, handlerRedis)
+	teamSvc := service.NewTeamService(teamRepo, repo.NewDivisionRepo(handlerDB))
 	ctfSvc := service.NewCTFService(handlerCfg, challengeRepo, submissionRepo, handlerRedis, fileStore)
+	apiTokenSvc := service.NewAPITokenService(repo.NewAPITokenRepo(handlerDB), userRepo)
+	powSvc := service.NewPoWService(appConfigSvc, handlerRedis, time.Minute)
 
-	handler := New(handlerCfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, nil, handlerRedis)
+	handler := New(handlerCfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, nil, apiTokenSvc, powSvc, handlerRedis)
 
 	return handlerEnv{
 		cfg:            handlerCfg,
@@ -242,6 +246,8 @@ func setupHandlerTest(t *testing.T) handlerEnv {
 		ctfSvc:         ctfSvc,
 		teamSvc:        teamSvc,
 		appConfigSvc:   appConfigSvc,
+		apiTokenSvc:    apiTokenSvc,
+		powSvc:         powSvc,
 		handler:        handler,
 	}
 }
@@ -249,7 +255,7 @@ func setupHandlerTest(t *testing.T) handlerEnv {
 func resetHandlerState(t *testing.T) {
 	t.Helper()
 
-	if _, err := handlerDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, stacks, challenges, users, teams RESTART IDENTITY CASCADE"); err != nil {
+	if _, err := handlerDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, api_tokens, login_failures, stacks, challenges, users, teams, divisions RESTART IDENTITY CASCADE"); err != nil {
 		t.Fatalf("truncate tables: %v", err)
 	}
 
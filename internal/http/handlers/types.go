@@ -14,6 +14,10 @@ type appConfigResponse struct {
 	HeaderDescription string    `json:"header_description"`
 	CTFStartAt        string    `json:"ctf_start_at"`
 	CTFEndAt          string    `json:"ctf_end_at"`
+	PoWRegister       int       `json:"pow_register_difficulty"`
+	PoWSubmit         int       `json:"pow_submit_difficulty"`
+	CompetitionMode   string    `json:"competition_mode"`
+	DivisionScoring   string    `json:"division_scoring"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
@@ -44,10 +48,37 @@ type adminConfigUpdateRequest struct {
 	HeaderDescription *string        `json:"header_description"`
 	CTFStartAt        optionalString `json:"ctf_start_at"`
 	CTFEndAt          optionalString `json:"ctf_end_at"`
+	PoWRegister       *int           `json:"pow_register_difficulty"`
+	PoWSubmit         *int           `json:"pow_submit_difficulty"`
+	CompetitionMode   *string        `json:"competition_mode"`
+	DivisionScoring   *string        `json:"division_scoring"`
 }
 
 type meUpdateRequest struct {
-	Username *string `json:"username"`
+	Username        *string `json:"username"`
+	CurrentPassword *string `json:"current_password"`
+	NewPassword     *string `json:"new_password"`
+	Affiliation     *string `json:"affiliation"`
+	Country         *string `json:"country"`
+	Website         *string `json:"website"`
+	Bio             *string `json:"bio"`
+}
+
+type profileUpdateRequest struct {
+	Affiliation *string `json:"affiliation"`
+	Country     *string `json:"country"`
+	Website     *string `json:"website"`
+	Bio         *string `json:"bio"`
+}
+
+type updateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type createAPITokenRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
 }
 
 type registerRequest struct {
@@ -55,6 +86,12 @@ type registerRequest struct {
 	Username        string `json:"username" binding:"required"`
 	Password        string `json:"password" binding:"required"`
 	RegistrationKey string `json:"registration_key" binding:"required"`
+	PoWNonce        string `json:"pow_nonce"`
+	PoWSolution     string `json:"pow_solution"`
+}
+
+type powRequest struct {
+	Purpose string `json:"purpose" binding:"required"`
 }
 
 type loginRequest struct {
@@ -77,6 +114,7 @@ type createChallengeRequest struct {
 	StackEnabled    *bool   `json:"stack_enabled"`
 	StackTargetPort *int    `json:"stack_target_port"`
 	StackPodSpec    *string `json:"stack_pod_spec"`
+	StackTeamShared *bool   `json:"stack_team_shared"`
 }
 
 type updateChallengeRequest struct {
@@ -90,6 +128,7 @@ type updateChallengeRequest struct {
 	StackEnabled    *bool   `json:"stack_enabled"`
 	StackTargetPort *int    `json:"stack_target_port"`
 	StackPodSpec    *string `json:"stack_pod_spec"`
+	StackTeamShared *bool   `json:"stack_team_shared"`
 }
 
 type challengeFileUploadRequest struct {
@@ -97,18 +136,54 @@ type challengeFileUploadRequest struct {
 }
 
 type submitRequest struct {
-	Flag string `json:"flag" binding:"required"`
+	Flag        string `json:"flag" binding:"required"`
+	PoWNonce    string `json:"pow_nonce"`
+	PoWSolution string `json:"pow_solution"`
 }
 
 type createRegistrationKeysRequest struct {
-	Count  *int   `json:"count" binding:"required"`
-	TeamID *int64 `json:"team_id" binding:"required"`
+	Count      *int       `json:"count" binding:"required"`
+	TeamID     *int64     `json:"team_id"`
+	DivisionID *int64     `json:"division_id"`
+	MaxUses    *int       `json:"max_uses"`
+	ExpiresAt  *time.Time `json:"expires_at"`
 }
 
 type createTeamRequest struct {
 	Name string `json:"name" binding:"required"`
 }
 
+type updateTeamRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type setTeamDivisionRequest struct {
+	DivisionID *int64 `json:"division_id" binding:"required"`
+}
+
+type setTeamCaptainRequest struct {
+	UserID *int64 `json:"user_id" binding:"required"`
+}
+
+type createDivisionRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type mergeTeamRequest struct {
+	SourceTeamID *int64 `json:"source_team_id" binding:"required"`
+}
+
+type moveUserTeamRequest struct {
+	TeamID *int64 `json:"team_id" binding:"required"`
+}
+
+type adminDeleteStacksRequest struct {
+	ChallengeID int64  `json:"challenge_id"`
+	UserID      int64  `json:"user_id"`
+	TeamID      int64  `json:"team_id"`
+	Status      string `json:"status"`
+}
+
 type registerResponse struct {
 	ID       int64  `json:"id"`
 	Email    string `json:"email"`
@@ -134,20 +209,28 @@ type refreshResponse struct {
 }
 
 type userMeResponse struct {
-	ID       int64  `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	TeamID   int64  `json:"team_id"`
-	TeamName string `json:"team_name"`
+	ID          int64  `json:"id"`
+	Email       string `json:"email"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	TeamID      int64  `json:"team_id"`
+	TeamName    string `json:"team_name"`
+	Affiliation string `json:"affiliation"`
+	Country     string `json:"country"`
+	Website     string `json:"website"`
+	Bio         string `json:"bio"`
 }
 
 type userDetailResponse struct {
-	ID       int64  `json:"id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	TeamID   int64  `json:"team_id"`
-	TeamName string `json:"team_name"`
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	TeamID      int64  `json:"team_id"`
+	TeamName    string `json:"team_name"`
+	Affiliation string `json:"affiliation"`
+	Country     string `json:"country"`
+	Website     string `json:"website"`
+	Bio         string `json:"bio"`
 }
 
 type challengeResponse struct {
@@ -164,6 +247,7 @@ type challengeResponse struct {
 	FileName        *string `json:"file_name,omitempty"`
 	StackEnabled    bool    `json:"stack_enabled"`
 	StackTargetPort int     `json:"stack_target_port"`
+	StackTeamShared bool    `json:"stack_team_shared"`
 }
 
 type ctfStateResponse struct {
@@ -178,6 +262,7 @@ type challengesListResponse struct {
 type adminChallengeResponse struct {
 	challengeResponse
 	StackPodSpec *string `json:"stack_pod_spec,omitempty"`
+	CreatedBy    *int64  `json:"created_by,omitempty"`
 }
 
 type presignedPostResponse struct {
@@ -198,9 +283,39 @@ type challengeFileUploadResponse struct {
 }
 
 type teamResponse struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	DivisionID int64     `json:"division_id"`
+	CaptainID  int64     `json:"captain_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+type apiTokenResponse struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type createAPITokenResponse struct {
+	Token string `json:"token"`
+	apiTokenResponse
+}
+
+type groupLeaderboardResponse struct {
+	Entries []models.GroupLeaderboardEntry `json:"entries"`
 }
 
 type timelineResponse struct {
@@ -212,16 +327,29 @@ type teamTimelineResponse struct {
 }
 
 type stackResponse struct {
-	StackID      string     `json:"stack_id"`
-	ChallengeID  int64      `json:"challenge_id"`
-	Status       string     `json:"status"`
-	NodePublicIP *string    `json:"node_public_ip,omitempty"`
-	NodePort     *int       `json:"node_port,omitempty"`
-	TargetPort   int        `json:"target_port"`
-	TTLExpiresAt *time.Time `json:"ttl_expires_at,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	CTFState     string     `json:"-"`
+	StackID       string     `json:"stack_id"`
+	ChallengeID   int64      `json:"challenge_id"`
+	TeamID        int64      `json:"team_id,omitempty"`
+	Status        string     `json:"status"`
+	NodePublicIP  *string    `json:"node_public_ip,omitempty"`
+	NodePort      *int       `json:"node_port,omitempty"`
+	TargetPort    int        `json:"target_port"`
+	TTLExpiresAt  *time.Time `json:"ttl_expires_at,omitempty"`
+	ExtendCount   int        `json:"extend_count"`
+	QueuePosition int        `json:"queue_position,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	CTFState      string     `json:"-"`
+}
+
+type adminStacksResponse struct {
+	Stacks []models.StackSummary `json:"stacks"`
+	Total  int                   `json:"total"`
+}
+
+type adminDeleteStacksResponse struct {
+	Deleted int `json:"deleted"`
+	Failed  int `json:"failed"`
 }
 
 type stacksListResponse struct {
@@ -231,37 +359,100 @@ type stacksListResponse struct {
 
 func newStackResponse(stack *models.Stack, ctfState string) stackResponse {
 	return stackResponse{
-		StackID:      stack.StackID,
-		ChallengeID:  stack.ChallengeID,
-		Status:       stack.Status,
-		NodePublicIP: stack.NodePublicIP,
-		NodePort:     stack.NodePort,
-		TargetPort:   stack.TargetPort,
-		TTLExpiresAt: stack.TTLExpiresAt,
-		CreatedAt:    stack.CreatedAt.UTC(),
-		UpdatedAt:    stack.UpdatedAt.UTC(),
-		CTFState:     ctfState,
+		StackID:       stack.StackID,
+		ChallengeID:   stack.ChallengeID,
+		TeamID:        stack.TeamID,
+		Status:        stack.Status,
+		NodePublicIP:  stack.NodePublicIP,
+		NodePort:      stack.NodePort,
+		TargetPort:    stack.TargetPort,
+		TTLExpiresAt:  stack.TTLExpiresAt,
+		ExtendCount:   stack.ExtendCount,
+		QueuePosition: stack.QueuePosition,
+		CreatedAt:     stack.CreatedAt.UTC(),
+		UpdatedAt:     stack.UpdatedAt.UTC(),
+		CTFState:      ctfState,
+	}
+}
+
+func newSessionResponse(session *models.Session, currentID string) sessionResponse {
+	return sessionResponse{
+		ID:         session.ID,
+		Device:     session.Device,
+		IP:         session.IP,
+		CreatedAt:  session.CreatedAt.UTC(),
+		LastUsedAt: session.LastUsedAt.UTC(),
+		Current:    currentID != "" && session.ID == currentID,
+	}
+}
+
+func newAPITokenResponse(token *models.APIToken) apiTokenResponse {
+	return apiTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt.UTC(),
+	}
+}
+
+type powChallengeResponse struct {
+	Nonce      string    `json:"nonce"`
+	Purpose    string    `json:"purpose"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type loginFailureResponse struct {
+	ID        int64     `json:"id"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	Device    string    `json:"device"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newLoginFailureResponse(failure *models.LoginFailure) loginFailureResponse {
+	return loginFailureResponse{
+		ID:        failure.ID,
+		UserID:    failure.UserID,
+		Email:     failure.Email,
+		IP:        failure.IP,
+		Device:    failure.Device,
+		Reason:    failure.Reason,
+		CreatedAt: failure.CreatedAt.UTC(),
 	}
 }
 
 func newUserMeResponse(user *models.User) userMeResponse {
 	return userMeResponse{
-		ID:       user.ID,
-		Email:    user.Email,
-		Username: user.Username,
-		Role:     user.Role,
-		TeamID:   user.TeamID,
-		TeamName: user.TeamName,
+		ID:          user.ID,
+		Email:       user.Email,
+		Username:    user.Username,
+		Role:        user.Role,
+		TeamID:      user.TeamID,
+		TeamName:    user.TeamName,
+		Affiliation: user.Affiliation,
+		Country:     user.Country,
+		Website:     user.Website,
+		Bio:         user.Bio,
 	}
 }
 
 func newUserDetailResponse(user *models.User) userDetailResponse {
 	return userDetailResponse{
-		ID:       user.ID,
-		Username: user.Username,
-		Role:     user.Role,
-		TeamID:   user.TeamID,
-		TeamName: user.TeamName,
+		ID:          user.ID,
+		Username:    user.Username,
+		Role:        user.Role,
+		TeamID:      user.TeamID,
+		TeamName:    user.TeamName,
+		Affiliation: user.Affiliation,
+		Country:     user.Country,
+		Website:     user.Website,
+		Bio:         user.Bio,
 	}
 }
 
@@ -281,13 +472,16 @@ func newChallengeResponse(challenge *models.Challenge) challengeResponse {
 		FileName:        challenge.FileName,
 		StackEnabled:    challenge.StackEnabled,
 		StackTargetPort: challenge.StackTargetPort,
+		StackTeamShared: challenge.StackTeamShared,
 	}
 }
 
 func newTeamResponse(team *models.Team) teamResponse {
 	return teamResponse{
-		ID:        team.ID,
-		Name:      team.Name,
-		CreatedAt: team.CreatedAt,
+		ID:         team.ID,
+		Name:       team.Name,
+		DivisionID: team.DivisionID,
+		CaptainID:  team.CaptainID,
+		CreatedAt:  team.CreatedAt,
 	}
 }
@@ -0,0 +1,110 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	env := setupTest(t, testCfg)
+	_ = createUser(t, env, "admin@example.com", "admin", "adminpass", "admin")
+	adminAccess, _, _ := loginUser(t, env.router, "admin@example.com", "adminpass")
+
+	rec := doRequest(t, env.router, http.MethodPost, "/api/me/tokens", map[string]any{
+		"name":   "ci",
+		"scopes": []string{"admin:challenges"},
+	}, authHeader(adminAccess))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created struct {
+		ID     int64    `json:"id"`
+		Token  string   `json:"token"`
+		Prefix string   `json:"prefix"`
+		Scopes []string `json:"scopes"`
+	}
+	decodeJSON(t, rec, &created)
+
+	if created.Token == "" || created.Prefix == "" || len(created.Scopes) != 1 {
+		t.Fatalf("unexpected token response: %+v", created)
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/challenges", map[string]any{
+		"title":       "From CI",
+		"description": "desc",
+		"category":    "Web",
+		"points":      100,
+		"flag":        "flag{ci}",
+		"is_active":   true,
+	}, authHeader(created.Token))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/me", nil, authHeader(created.Token))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected missing read scope, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/teams", map[string]string{"name": "Alpha"}, authHeader(created.Token))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected api token rejected on admin route, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/me/tokens", nil, authHeader(created.Token))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected api token rejected on token management, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/me/tokens", nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodDelete, "/api/me/tokens/"+itoa(created.ID), nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/admin/challenges/1", nil, authHeader(created.Token))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked token rejected, status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPITokenScopeRestrictions(t *testing.T) {
+	env := setupTest(t, testCfg)
+	access, _, _ := registerAndLogin(t, env, "user@example.com", "user1", "strong-password")
+
+	rec := doRequest(t, env.router, http.MethodPost, "/api/me/tokens", map[string]any{
+		"name":   "bot",
+		"scopes": []string{"admin:challenges"},
+	}, authHeader(access))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected admin scope rejected, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/me/tokens", map[string]any{
+		"name":   "bot",
+		"scopes": []string{"read"},
+	}, authHeader(access))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created struct {
+		Token string `json:"token"`
+	}
+	decodeJSON(t, rec, &created)
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/me", nil, authHeader(created.Token))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/challenges/1/submit", map[string]string{"flag": "flag{x}"}, authHeader(created.Token))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected missing submit scope, status %d: %s", rec.Code, rec.Body.String())
+	}
+}
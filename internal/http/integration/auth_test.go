@@ -5,6 +5,7 @@ import (
 	"smctf/internal/models"
 	"smctf/internal/service"
 	"testing"
+	"time"
 )
 
 func TestRegister(t *testing.T) {
@@ -347,3 +348,125 @@ func TestMeSolved(t *testing.T) {
 		t.Fatalf("expected solved timestamp and id, got %+v for user %d", solved[0], userID)
 	}
 }
+
+func TestSessions(t *testing.T) {
+	env := setupTest(t, testCfg)
+	access, refresh, _ := registerAndLogin(t, env, "user@example.com", "user1", "strong-password")
+	_, otherRefresh, _ := loginUser(t, env.router, "user@example.com", "strong-password")
+
+	rec := doRequest(t, env.router, http.MethodGet, "/api/me/sessions", nil, authHeader(access))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var sessions []struct {
+		ID      string `json:"id"`
+		Current bool   `json:"current"`
+	}
+	decodeJSON(t, rec, &sessions)
+
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	current := 0
+	for _, session := range sessions {
+		if session.Current {
+			current++
+		}
+	}
+
+	if current != 1 {
+		t.Fatalf("expected exactly one current session, got %+v", sessions)
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/me", map[string]string{"current_password": "strong-password", "new_password": "stronger-password"}, authHeader(access))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": otherRefresh}, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected other session revoked, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": refresh}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected current session kept, status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	env := setupTest(t, testCfg)
+	access, refresh, _ := registerAndLogin(t, env, "user@example.com", "user1", "strong-password")
+
+	rec := doRequest(t, env.router, http.MethodGet, "/api/me", nil, authHeader(access))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/logout", map[string]string{"refresh_token": refresh}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/me", nil, authHeader(access))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked access token, status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	cfg := testCfg
+	cfg.Security.LoginWindow = time.Minute
+	cfg.Security.LoginAccountMax = 2
+	cfg.Security.LoginIPMax = 10
+	cfg.Security.LoginLockoutBase = time.Minute
+	cfg.Security.LoginLockoutMax = time.Hour
+
+	env := setupTest(t, cfg)
+	admin := ensureAdminUser(t, env)
+	adminAccess, _, _ := loginUser(t, env.router, admin.Email, "adminpass")
+	_, _, userID := registerAndLogin(t, env, "user@example.com", "user1", "strong-password")
+
+	body := map[string]string{"email": "user@example.com", "password": "wrong"}
+	for i := 0; i < 2; i++ {
+		rec := doRequest(t, env.router, http.MethodPost, "/api/auth/login", body, nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d status %d: %s", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	good := map[string]string{"email": "user@example.com", "password": "strong-password"}
+	rec := doRequest(t, env.router, http.MethodPost, "/api/auth/login", good, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected lockout, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/admin/login-failures?email=user@example.com", nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list failures status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var failures []struct {
+		Reason string `json:"reason"`
+	}
+	decodeJSON(t, rec, &failures)
+	if len(failures) != 3 || failures[0].Reason != models.LoginFailureLocked {
+		t.Fatalf("unexpected failures: %+v", failures)
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/users/"+itoa(userID)+"/unlock", nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unlock status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/login", good, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login after unlock status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -3,6 +3,7 @@ package http_test
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -247,6 +248,10 @@ func TestSubmitFlag(t *testing.T) {
 			if rec.Code != http.StatusOK {
 				t.Fatalf("status %d at attempt %d: %s", rec.Code, i+1, rec.Body.String())
 			}
+
+			if rec.Header().Get("RateLimit-Remaining") != strconv.Itoa(env.cfg.Security.SubmissionMax-i-1) {
+				t.Fatalf("unexpected remaining header at attempt %d: %q", i+1, rec.Header().Get("RateLimit-Remaining"))
+			}
 		}
 
 		rec := doRequest(t, env.router, http.MethodPost, "/api/challenges/"+itoa(challenge.ID)+"/submit", map[string]string{"flag": "flag{nope}"}, authHeader(access))
@@ -265,7 +270,7 @@ func TestSubmitFlag(t *testing.T) {
 			t.Fatalf("unexpected rate limit info: %+v", resp.RateLimit)
 		}
 
-		if rec.Header().Get("X-RateLimit-Limit") == "" || rec.Header().Get("X-RateLimit-Remaining") == "" || rec.Header().Get("X-RateLimit-Reset") == "" {
+		if rec.Header().Get("RateLimit-Limit") == "" || rec.Header().Get("RateLimit-Remaining") != "0" || rec.Header().Get("RateLimit-Reset") == "" || rec.Header().Get("Retry-After") == "" {
 			t.Fatalf("missing rate limit headers")
 		}
 	})
@@ -0,0 +1,86 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDivisions(t *testing.T) {
+	env := setupTest(t, testCfg)
+	admin := ensureAdminUser(t, env)
+	adminAccess, _, _ := loginUser(t, env.router, admin.Email, "adminpass")
+	team := createTeam(t, env, "Alpha")
+	other := createTeam(t, env, "Beta")
+
+	rec := doRequest(t, env.router, http.MethodPost, "/api/admin/divisions", map[string]string{"name": "High School"}, authHeader(adminAccess))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var division struct {
+		ID int64 `json:"id"`
+	}
+	decodeJSON(t, rec, &division)
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/teams/"+itoa(team.ID)+"/division", map[string]int64{"division_id": division.ID}, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/registration-keys", map[string]any{
+		"count":       1,
+		"team_id":     other.ID,
+		"division_id": division.ID,
+	}, authHeader(adminAccess))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected mismatched team to be rejected, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/registration-keys", map[string]any{
+		"count":       1,
+		"team_id":     team.ID,
+		"division_id": division.ID,
+	}, authHeader(adminAccess))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var keys []struct {
+		Code         string `json:"code"`
+		DivisionName string `json:"division_name"`
+	}
+	decodeJSON(t, rec, &keys)
+	if len(keys) != 1 || keys[0].DivisionName != "High School" {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/register", map[string]string{
+		"email":            "student@example.com",
+		"username":         "student",
+		"password":         "strong-password",
+		"registration_key": keys[0].Code,
+	}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/leaderboard/teams?division_id="+itoa(division.ID), nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var leaderboard struct {
+		Entries []struct {
+			TeamID int64 `json:"team_id"`
+		} `json:"entries"`
+	}
+	decodeJSON(t, rec, &leaderboard)
+	if len(leaderboard.Entries) != 1 || leaderboard.Entries[0].TeamID != team.ID {
+		t.Fatalf("unexpected division leaderboard: %+v", leaderboard)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/divisions", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+}
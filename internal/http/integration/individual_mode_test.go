@@ -0,0 +1,70 @@
+package http_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestIndividualMode(t *testing.T) {
+	env := setupTest(t, testCfg)
+	admin := ensureAdminUser(t, env)
+	adminAccess, _, _ := loginUser(t, env.router, admin.Email, "adminpass")
+
+	rec := doRequest(t, env.router, http.MethodPut, "/api/admin/config", map[string]string{"competition_mode": "individual"}, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, path := range []string{"/api/teams", "/api/leaderboard/teams", "/api/timeline/teams"} {
+		rec = doRequest(t, env.router, http.MethodGet, path, nil, nil)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: status %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	team := createTeam(t, env, "Alpha")
+	key := createRegistrationKeyWithTeam(t, env, admin.ID, team.ID)
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/register", map[string]string{
+		"email":            "solo@example.com",
+		"username":         "solo",
+		"password":         "strong-password",
+		"registration_key": key.Code,
+	}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	soloAccess, _, soloID := loginUser(t, env.router, "solo@example.com", "strong-password")
+	user, err := env.userRepo.GetByID(context.Background(), soloID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+
+	if user.TeamID != 0 {
+		t.Fatalf("expected no team, got %d", user.TeamID)
+	}
+
+	otherAccess, _, _ := registerAndLogin(t, env, "other@example.com", "other", "strong-password")
+
+	challenge := createChallenge(t, env, "Warmup", 100, "flag{ok}", true)
+	for _, access := range []string{soloAccess, otherAccess} {
+		rec = doRequest(t, env.router, http.MethodPost, "/api/challenges/"+itoa(challenge.ID)+"/submit", map[string]string{"flag": "flag{ok}"}, authHeader(access))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("submit status %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var resp struct {
+			Correct bool `json:"correct"`
+		}
+		decodeJSON(t, rec, &resp)
+		if !resp.Correct {
+			t.Fatalf("expected every user to solve")
+		}
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/leaderboard", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("leaderboard status %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package http_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"smctf/internal/service"
+)
+
+func solvePoW(t *testing.T, nonce string, difficulty int) string {
+	t.Helper()
+
+	for i := 0; i < 1<<22; i++ {
+		solution := strconv.Itoa(i)
+		if service.PoWSolved(nonce, solution, difficulty) {
+			return solution
+		}
+	}
+
+	t.Fatalf("no solution found for difficulty %d", difficulty)
+	return ""
+}
+
+func TestRegisterProofOfWork(t *testing.T) {
+	env := setupTest(t, testCfg)
+	admin := ensureAdminUser(t, env)
+	adminAccess, _, _ := loginUser(t, env.router, admin.Email, "adminpass")
+
+	rec := doRequest(t, env.router, http.MethodPut, "/api/admin/config", map[string]int{"pow_register_difficulty": 8}, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update config status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	key := createRegistrationKey(t, env, admin.ID)
+	body := map[string]string{
+		"email":            "user@example.com",
+		"username":         "user1",
+		"password":         "strong-password",
+		"registration_key": key.Code,
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/register", body, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected pow required, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var errResp errorResp
+	decodeJSON(t, rec, &errResp)
+	if errResp.Error != service.ErrPoWRequired.Error() {
+		t.Fatalf("unexpected error: %+v", errResp)
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/pow", map[string]string{"purpose": "register"}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("issue pow status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var challenge struct {
+		Nonce      string `json:"nonce"`
+		Difficulty int    `json:"difficulty"`
+	}
+	decodeJSON(t, rec, &challenge)
+	if challenge.Nonce == "" || challenge.Difficulty != 8 {
+		t.Fatalf("unexpected challenge: %+v", challenge)
+	}
+
+	body["pow_nonce"] = challenge.Nonce
+	body["pow_solution"] = "x"
+	for service.PoWSolved(challenge.Nonce, body["pow_solution"], challenge.Difficulty) {
+		body["pow_solution"] += "x"
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/register", body, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid pow, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/pow", map[string]string{"purpose": "register"}, nil)
+	decodeJSON(t, rec, &challenge)
+
+	body["pow_nonce"] = challenge.Nonce
+	body["pow_solution"] = solvePoW(t, challenge.Nonce, challenge.Difficulty)
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/register", body, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register status %d: %s", rec.Code, rec.Body.String())
+	}
+}
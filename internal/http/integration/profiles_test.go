@@ -0,0 +1,94 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProfilesAndCountryLeaderboards(t *testing.T) {
+	env := setupTest(t, testCfg)
+	admin := ensureAdminUser(t, env)
+	team := createTeam(t, env, "Alpha")
+
+	tokens := make([]string, 0, 2)
+	for _, name := range []string{"first", "second"} {
+		key := createRegistrationKeyWithTeam(t, env, admin.ID, team.ID)
+		rec := doRequest(t, env.router, http.MethodPost, "/api/auth/register", map[string]string{
+			"email":            name + "@example.com",
+			"username":         name,
+			"password":         "strong-password",
+			"registration_key": key.Code,
+		}, nil)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("register status %d: %s", rec.Code, rec.Body.String())
+		}
+
+		access, _, _ := loginUser(t, env.router, name+"@example.com", "strong-password")
+		tokens = append(tokens, access)
+	}
+
+	rec := doRequest(t, env.router, http.MethodPut, "/api/me", map[string]string{"country": "de", "affiliation": "TU Berlin"}, authHeader(tokens[1]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update me status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/me/team", map[string]string{"country": "DE"}, authHeader(tokens[1]))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected non-captain to be rejected, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/me/team", map[string]string{"country": "DE", "website": "https://alpha.example"}, authHeader(tokens[0]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("captain update status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/teams/"+itoa(team.ID), nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get team status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var teamResp struct {
+		Country string `json:"country"`
+		Website string `json:"website"`
+	}
+	decodeJSON(t, rec, &teamResp)
+	if teamResp.Country != "DE" || teamResp.Website != "https://alpha.example" {
+		t.Fatalf("unexpected team: %+v", teamResp)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/leaderboard?affiliation=tu%20berlin", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("leaderboard status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var board struct {
+		Entries []struct {
+			Username string `json:"username"`
+		} `json:"entries"`
+	}
+	decodeJSON(t, rec, &board)
+	if len(board.Entries) != 1 || board.Entries[0].Username != "second" {
+		t.Fatalf("unexpected affiliation leaderboard: %+v", board)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/leaderboard/affiliations", nil, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("affiliations status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var groups struct {
+		Entries []struct {
+			Key         string `json:"key"`
+			MemberCount int    `json:"member_count"`
+		} `json:"entries"`
+	}
+	decodeJSON(t, rec, &groups)
+	if len(groups.Entries) != 1 || groups.Entries[0].Key != "TU Berlin" || groups.Entries[0].MemberCount != 1 {
+		t.Fatalf("unexpected affiliation groups: %+v", groups)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/leaderboard/countries?division_id=x", nil, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid division, status %d: %s", rec.Code, rec.Body.String())
+	}
+}
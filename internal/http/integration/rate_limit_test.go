@@ -0,0 +1,64 @@
+package http_test
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestGlobalRateLimit(t *testing.T) {
+	cfg := testCfg
+	cfg.RateLimit.Window = time.Minute
+	cfg.RateLimit.PublicMax = 2
+	cfg.RateLimit.AuthMax = 1
+
+	env := setupTest(t, cfg)
+
+	for i := 0; i < 2; i++ {
+		rec := doRequest(t, env.router, http.MethodGet, "/api/leaderboard", nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d status %d: %s", i, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Fatalf("missing rate limit headers: %v", rec.Header())
+		}
+	}
+
+	rec := doRequest(t, env.router, http.MethodGet, "/api/timeline", nil, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected public limit, status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp errorResp
+	decodeJSON(t, rec, &resp)
+	if resp.Error != "too many requests" || resp.RateLimit == nil || resp.RateLimit.Policy != "ip" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// Groups are limited separately
+	body := map[string]string{"email": "nobody@example.com", "password": "wrong"}
+	if rec := doRequest(t, env.router, http.MethodPost, "/api/auth/login", body, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("login status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := doRequest(t, env.router, http.MethodPost, "/api/auth/login", body, nil); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected auth limit, status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGlobalRateLimitAllowlist(t *testing.T) {
+	cfg := testCfg
+	cfg.RateLimit.Window = time.Minute
+	cfg.RateLimit.PublicMax = 1
+	cfg.RateLimit.Allowlist = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+
+	env := setupTest(t, cfg)
+
+	for i := 0; i < 3; i++ {
+		rec := doRequest(t, env.router, http.MethodGet, "/api/leaderboard", nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d status %d: %s", i, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestChallengeAuthorOwnsChallenges(t *testing.T) {
+	env := setupTest(t, testCfg)
+	_ = createUser(t, env, "author1@example.com", "author1", "authorpass", "challenge_author")
+	_ = createUser(t, env, "author2@example.com", "author2", "authorpass", "challenge_author")
+	_ = createUser(t, env, "reviewer@example.com", "reviewer", "reviewerpass", "reviewer")
+	legacy := createChallenge(t, env, "Legacy", 100, "flag{legacy}", true)
+
+	author1, _, author1ID := loginUser(t, env.router, "author1@example.com", "authorpass")
+	author2, _, _ := loginUser(t, env.router, "author2@example.com", "authorpass")
+	reviewer, _, _ := loginUser(t, env.router, "reviewer@example.com", "reviewerpass")
+
+	body := map[string]any{
+		"title":       "Owned",
+		"description": "desc",
+		"category":    "Web",
+		"points":      100,
+		"flag":        "flag{owned}",
+	}
+
+	rec := doRequest(t, env.router, http.MethodPost, "/api/admin/challenges", body, authHeader(reviewer))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("reviewer create status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/challenges", body, authHeader(author1))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("author create status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	decodeJSON(t, rec, &created)
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/admin/challenges/"+itoa(created.ID), nil, authHeader(reviewer))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reviewer get status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var detail struct {
+		CreatedBy *int64 `json:"created_by"`
+	}
+	decodeJSON(t, rec, &detail)
+	if detail.CreatedBy == nil || *detail.CreatedBy != author1ID {
+		t.Fatalf("expected created_by %d, got %v", author1ID, detail.CreatedBy)
+	}
+
+	update := map[string]any{"title": "Renamed"}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/challenges/"+itoa(created.ID), update, authHeader(author2))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("other author update status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/challenges/"+itoa(legacy.ID), update, authHeader(author1))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("legacy update status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/challenges/"+itoa(created.ID), update, authHeader(reviewer))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("reviewer update status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/admin/login-failures", nil, authHeader(reviewer))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reviewer login failures status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/users/"+itoa(author1ID)+"/unlock", nil, authHeader(reviewer))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("reviewer unlock status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/challenges/"+itoa(created.ID), update, authHeader(author1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("author update status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodDelete, "/api/admin/challenges/"+itoa(created.ID), nil, authHeader(author2))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("other author delete status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/registration-keys", map[string]any{"count": 1, "team_id": 1}, authHeader(author1))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("author registration keys status %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminUpdateUserRole(t *testing.T) {
+	env := setupTest(t, testCfg)
+	admin := ensureAdminUser(t, env)
+	_ = createUser(t, env, "support@example.com", "support", "supportpass", "support")
+	user := createUser(t, env, "user@example.com", "user1", "userpass", "user")
+
+	adminAccess, _, _ := loginUser(t, env.router, admin.Email, "adminpass")
+	supportAccess, _, _ := loginUser(t, env.router, "support@example.com", "supportpass")
+
+	rec := doRequest(t, env.router, http.MethodDelete, "/api/admin/users/"+itoa(user.ID)+"/sessions", nil, authHeader(supportAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("support revoke status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/users/"+itoa(user.ID)+"/role", map[string]string{"role": "reviewer"}, authHeader(supportAccess))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("support role status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/users/"+itoa(user.ID)+"/role", map[string]string{"role": "root"}, authHeader(adminAccess))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid role status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	_, userRefresh, _ := loginUser(t, env.router, "user@example.com", "userpass")
+
+	rec = doRequest(t, env.router, http.MethodPut, "/api/admin/users/"+itoa(user.ID)+"/role", map[string]string{"role": "reviewer"}, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update role status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/auth/refresh", map[string]string{"refresh_token": userRefresh}, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var refreshed struct {
+		AccessToken string `json:"access_token"`
+	}
+	decodeJSON(t, rec, &refreshed)
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/me", nil, authHeader(refreshed.AccessToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("me status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var me struct {
+		Role string `json:"role"`
+	}
+	decodeJSON(t, rec, &me)
+	if me.Role != "reviewer" {
+		t.Fatalf("expected reviewer, got %s", me.Role)
+	}
+}
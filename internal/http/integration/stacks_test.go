@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"smctf/internal/config"
 	apphttp "smctf/internal/http"
 	"smctf/internal/models"
+	"smctf/internal/provisioner"
 	"smctf/internal/repo"
 	"smctf/internal/service"
 	"smctf/internal/stack"
@@ -95,6 +97,42 @@ func (p *provisionerStub) handler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_ = json.NewEncoder(w).Encode(resp)
 		return
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/stacks/") && (strings.HasSuffix(r.URL.Path, "/extend") || strings.HasSuffix(r.URL.Path, "/restart")):
+		action := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		stackID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/stacks/"), "/"+action)
+		var req stack.ExtendRequest
+		if action == "extend" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		p.mu.Lock()
+		info, ok := p.stacks[stackID]
+		if ok && action == "extend" {
+			info.TTLExpiresAt = req.TTLExpiresAt
+		}
+		if ok && action == "restart" {
+			info.NodePort++
+		}
+		p.stacks[stackID] = info
+		p.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(stack.StackStatus{
+			StackID:      info.StackID,
+			Status:       info.Status,
+			TTL:          info.TTLExpiresAt,
+			NodePort:     info.NodePort,
+			TargetPort:   info.TargetPort,
+			NodePublicIP: info.NodePublicIP,
+		})
+		return
 	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/stacks/"):
 		stackID := strings.TrimPrefix(r.URL.Path, "/stacks/")
 		p.mu.Lock()
@@ -131,13 +169,27 @@ func setupStackTest(t *testing.T, cfg config.Config, client *stack.Client) testE
 
 	fileStore := storage.NewMemoryChallengeFileStore(10 * time.Minute)
 
-	authSvc := service.NewAuthService(cfg, testDB, userRepo, registrationKeyRepo, teamRepo, testRedis)
-	teamSvc := service.NewTeamService(teamRepo)
-	ctfSvc := service.NewCTFService(cfg, challengeRepo, submissionRepo, testRedis, fileStore)
 	appConfigSvc := service.NewAppConfigService(appConfigRepo, testRedis, cfg.Cache.AppConfigTTL)
+	authSvc := service.NewAuthService(cfg, testDB, userRepo, registrationKeyRepo, teamRepo, repo.NewLoginFailureRepo(testDB), appConfigSvc, testRedis)
+	teamSvc := service.NewTeamService(teamRepo, repo.NewDivisionRepo(testDB))
+	ctfSvc := service.NewCTFService(cfg, challengeRepo, submissionRepo, testRedis, fileStore)
 	stackSvc := service.NewStackService(cfg.Stack, stackRepo, challengeRepo, submissionRepo, client, testRedis)
+	apiTokenSvc := service.NewAPITokenService(repo.NewAPITokenRepo(testDB), userRepo)
+
+	if cfg.Stack.ProvisionWorkers > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			stackSvc.RunProvisionWorkers(ctx)
+			close(done)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+	}
 
-	router := apphttp.NewRouter(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, stackSvc, testRedis, testLogger)
+	router := apphttp.NewRouter(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, stackSvc, apiTokenSvc, nil, testRedis, testLogger)
 
 	return testEnv{
 		cfg:            cfg,
@@ -196,7 +248,7 @@ func TestStackLifecycle(t *testing.T) {
 		CreateMax:          1,
 	}
 
-	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout)
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
 	env := setupStackTest(t, cfg, client)
 
 	_ = createUser(t, env, "admin@example.com", "admin", "adminpass", "admin")
@@ -219,6 +271,161 @@ func TestStackLifecycle(t *testing.T) {
 	}
 }
 
+func TestStackAsyncCreate(t *testing.T) {
+	stub := newProvisionerStub()
+	server := httptest.NewServer(http.HandlerFunc(stub.handler))
+	defer server.Close()
+
+	cfg := testCfg
+	cfg.Stack = config.StackConfig{
+		Enabled:            true,
+		MaxPerUser:         3,
+		ProvisionerBaseURL: server.URL,
+		ProvisionerAPIKey:  "test-key",
+		ProvisionerTimeout: 2 * time.Second,
+		CreateWindow:       time.Minute,
+		CreateMax:          5,
+		ProvisionWorkers:   1,
+		ProvisionQueue:     10,
+	}
+
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
+	env := setupStackTest(t, cfg, client)
+
+	user, _, _ := registerAndLogin(t, env, "user@example.com", "user", "strong-pass")
+	challenge := createStackChallenge(t, env, "StackChal")
+
+	rec := doRequest(t, env.router, http.MethodPost, "/api/challenges/"+itoa(challenge.ID)+"/stack", nil, authHeader(user))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created struct {
+		StackID string `json:"stack_id"`
+		Status  string `json:"status"`
+	}
+	decodeJSON(t, rec, &created)
+
+	if created.StackID != "" || created.Status != models.StackStatusPending {
+		t.Fatalf("expected pending stack, got %+v", created)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/challenges/"+itoa(challenge.ID)+"/stack?wait=5", nil, authHeader(user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("wait stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var ready struct {
+		StackID string `json:"stack_id"`
+		Status  string `json:"status"`
+	}
+	decodeJSON(t, rec, &ready)
+
+	if ready.StackID == "" || ready.Status != "running" {
+		t.Fatalf("expected running stack, got %+v", ready)
+	}
+
+	// Creating again returns the same instance instead of launching another
+	rec = doRequest(t, env.router, http.MethodPost, "/api/challenges/"+itoa(challenge.ID)+"/stack", nil, authHeader(user))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create again status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	stub.mu.Lock()
+	launched := len(stub.stacks)
+	stub.mu.Unlock()
+
+	if launched != 1 {
+		t.Fatalf("expected one provisioned stack, got %d", launched)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/challenges/"+itoa(challenge.ID)+"/stack?wait=30", nil, authHeader(user))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for long wait, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStackExtendAndRestart(t *testing.T) {
+	stub := newProvisionerStub()
+	server := httptest.NewServer(http.HandlerFunc(stub.handler))
+	defer server.Close()
+
+	cfg := testCfg
+	cfg.Stack = config.StackConfig{
+		Enabled:            true,
+		MaxPerUser:         3,
+		ProvisionerBaseURL: server.URL,
+		ProvisionerAPIKey:  "test-key",
+		ProvisionerTimeout: 2 * time.Second,
+		CreateWindow:       time.Minute,
+		CreateMax:          1,
+		ExtendDuration:     30 * time.Minute,
+		ExtendMax:          1,
+		MaxLifetime:        4 * time.Hour,
+	}
+
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
+	env := setupStackTest(t, cfg, client)
+
+	_ = createUser(t, env, "admin@example.com", "admin", "adminpass", "admin")
+	user, _, _ := registerAndLogin(t, env, "user@example.com", "user", "strong-pass")
+	challenge := createStackChallenge(t, env, "StackChal")
+	base := "/api/challenges/" + itoa(challenge.ID) + "/stack"
+
+	rec := doRequest(t, env.router, http.MethodPost, base+"/extend", nil, authHeader(user))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("extend without stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, base, nil, authHeader(user))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created struct {
+		NodePort     int       `json:"node_port"`
+		TTLExpiresAt time.Time `json:"ttl_expires_at"`
+	}
+	decodeJSON(t, rec, &created)
+
+	rec = doRequest(t, env.router, http.MethodPost, base+"/extend", nil, authHeader(user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("extend status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var extended struct {
+		ExtendCount  int       `json:"extend_count"`
+		TTLExpiresAt time.Time `json:"ttl_expires_at"`
+	}
+	decodeJSON(t, rec, &extended)
+
+	if extended.ExtendCount != 1 || extended.TTLExpiresAt.Sub(created.TTLExpiresAt).Round(time.Second) != 30*time.Minute {
+		t.Fatalf("unexpected extend response: %+v (created %v)", extended, created.TTLExpiresAt)
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, base+"/extend", nil, authHeader(user))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("second extend status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Restarts skip the create rate limit, which only allows one create per window here
+	for i := 0; i < 2; i++ {
+		rec = doRequest(t, env.router, http.MethodPost, base+"/restart", nil, authHeader(user))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("restart status %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	var restarted struct {
+		NodePort int `json:"node_port"`
+	}
+	decodeJSON(t, rec, &restarted)
+
+	if restarted.NodePort != created.NodePort+2 {
+		t.Fatalf("expected restarted node port %d, got %d", created.NodePort+2, restarted.NodePort)
+	}
+}
+
 func TestStackCreateBlockedAfterSolve(t *testing.T) {
 	stub := newProvisionerStub()
 	server := httptest.NewServer(http.HandlerFunc(stub.handler))
@@ -235,7 +442,7 @@ func TestStackCreateBlockedAfterSolve(t *testing.T) {
 		CreateMax:          1,
 	}
 
-	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout)
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
 	env := setupStackTest(t, cfg, client)
 
 	_ = createUser(t, env, "admin@example.com", "admin", "adminpass", "admin")
@@ -269,7 +476,7 @@ func TestStackCreateRateLimit(t *testing.T) {
 		CreateMax:          1,
 	}
 
-	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout)
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
 	env := setupStackTest(t, cfg, client)
 
 	_ = createUser(t, env, "admin@example.com", "admin", "adminpass", "admin")
@@ -304,7 +511,7 @@ func TestStacksBlockedBeforeStart(t *testing.T) {
 		CreateMax:          1,
 	}
 
-	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout)
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
 	env := setupStackTest(t, cfg, client)
 	start := time.Now().Add(2 * time.Hour)
 	end := time.Now().Add(4 * time.Hour)
@@ -371,7 +578,7 @@ func TestStacksCreateBlockedAfterEnd(t *testing.T) {
 		CreateMax:          1,
 	}
 
-	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout)
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
 	env := setupStackTest(t, cfg, client)
 	end := time.Now().Add(-2 * time.Hour)
 	setCTFWindow(t, env, nil, &end)
@@ -390,3 +597,283 @@ func TestStacksCreateBlockedAfterEnd(t *testing.T) {
 		t.Fatalf("expected ctf_state ended, got %v", resp["ctf_state"])
 	}
 }
+
+func TestAdminStacks(t *testing.T) {
+	stub := newProvisionerStub()
+	server := httptest.NewServer(http.HandlerFunc(stub.handler))
+	defer server.Close()
+
+	cfg := testCfg
+	cfg.Stack = config.StackConfig{
+		Enabled:            true,
+		MaxPerUser:         3,
+		MaxPerTeam:         3,
+		ProvisionerBaseURL: server.URL,
+		ProvisionerAPIKey:  "test-key",
+		ProvisionerTimeout: 2 * time.Second,
+		CreateWindow:       time.Minute,
+		CreateMax:          5,
+	}
+
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
+	env := setupStackTest(t, cfg, client)
+
+	_ = createUser(t, env, "admin@example.com", "admin", "adminpass", "admin")
+	adminAccess, _, _ := loginUser(t, env.router, "admin@example.com", "adminpass")
+	alice, _, _ := registerAndLogin(t, env, "alice@example.com", "alice", "strong-pass")
+	bob, _, _ := registerAndLogin(t, env, "bob@example.com", "bob", "strong-pass")
+	web := createStackChallenge(t, env, "Web Stack")
+	pwn := createStackChallenge(t, env, "Pwn Stack")
+
+	for _, create := range []struct {
+		access    string
+		challenge int64
+	}{
+		{alice, web.ID},
+		{alice, pwn.ID},
+		{bob, web.ID},
+	} {
+		rec := doRequest(t, env.router, http.MethodPost, "/api/challenges/"+itoa(create.challenge)+"/stack", nil, authHeader(create.access))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create stack status %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := doRequest(t, env.router, http.MethodGet, "/api/admin/stacks", nil, authHeader(alice))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("user list status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var list struct {
+		Stacks []models.StackSummary `json:"stacks"`
+		Total  int                   `json:"total"`
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/admin/stacks?challenge_id="+itoa(web.ID)+"&limit=1", nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list status %d: %s", rec.Code, rec.Body.String())
+	}
+	decodeJSON(t, rec, &list)
+
+	if list.Total != 2 || len(list.Stacks) != 1 || list.Stacks[0].Username != "bob" || list.Stacks[0].ChallengeTitle != "Web Stack" {
+		t.Fatalf("unexpected filtered list: %+v", list)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/admin/stacks/counts", nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("counts status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var counts []models.StackCount
+	decodeJSON(t, rec, &counts)
+	if len(counts) != 2 || counts[0].ChallengeID != web.ID || counts[0].Status != "running" || counts[0].Count != 2 || counts[1].Count != 1 {
+		t.Fatalf("unexpected counts: %+v", counts)
+	}
+
+	rec = doRequest(t, env.router, http.MethodDelete, "/api/admin/stacks/"+itoa(list.Stacks[0].ID), nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodDelete, "/api/admin/stacks/"+itoa(list.Stacks[0].ID), nil, authHeader(adminAccess))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("second delete status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A failed create never got a stack_id
+	failed := &models.Stack{UserID: list.Stacks[0].UserID, ChallengeID: pwn.ID, Status: models.StackStatusFailed, TargetPort: 80, CreatedAt: time.Now().UTC(), UpdatedAt: time.Now().UTC()}
+	if err := repo.NewStackRepo(testDB).Create(context.Background(), failed); err != nil {
+		t.Fatalf("create failed stack: %v", err)
+	}
+
+	rec = doRequest(t, env.router, http.MethodDelete, "/api/admin/stacks/"+itoa(failed.ID), nil, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete failed stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/stacks/delete", map[string]any{}, authHeader(adminAccess))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unfiltered bulk delete status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/api/admin/stacks/delete", map[string]any{"challenge_id": web.ID}, authHeader(adminAccess))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bulk delete status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var bulk struct {
+		Deleted int `json:"deleted"`
+		Failed  int `json:"failed"`
+	}
+	decodeJSON(t, rec, &bulk)
+	if bulk.Deleted != 1 || bulk.Failed != 0 {
+		t.Fatalf("unexpected bulk result: %+v", bulk)
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/admin/stacks", nil, authHeader(adminAccess))
+	decodeJSON(t, rec, &list)
+	if list.Total != 1 || list.Stacks[0].ChallengeID != pwn.ID {
+		t.Fatalf("expected only the pwn stack left, got %+v", list)
+	}
+
+	stub.mu.Lock()
+	remaining := len(stub.stacks)
+	stub.mu.Unlock()
+	if remaining != 1 {
+		t.Fatalf("expected provisioner to keep one stack, got %d", remaining)
+	}
+}
+
+func TestStackStatusCallback(t *testing.T) {
+	stub := newProvisionerStub()
+	server := httptest.NewServer(http.HandlerFunc(stub.handler))
+	defer server.Close()
+
+	cfg := testCfg
+	cfg.Stack = config.StackConfig{
+		Enabled:            true,
+		MaxPerUser:         3,
+		ProvisionerBaseURL: server.URL,
+		ProvisionerAPIKey:  "test-key",
+		ProvisionerTimeout: 2 * time.Second,
+		CreateWindow:       time.Minute,
+		CreateMax:          1,
+		CallbackSecret:     "callback-secret",
+		StatusMaxAge:       time.Minute,
+	}
+
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{})
+	env := setupStackTest(t, cfg, client)
+
+	user, _, _ := registerAndLogin(t, env, "user@example.com", "user", "strong-pass")
+	challenge := createStackChallenge(t, env, "StackChal")
+
+	rec := doRequest(t, env.router, http.MethodPost, "/api/challenges/"+itoa(challenge.ID)+"/stack", nil, authHeader(user))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var created map[string]any
+	decodeJSON(t, rec, &created)
+
+	body := `{"stack_id":"` + created["stack_id"].(string) + `","status":"running","node_port":32000,"target_port":80,"node_public_ip":"127.0.0.2"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	rec = doRequest(t, env.router, http.MethodPost, "/internal/stacks/callback", body, map[string]string{"X-Stack-Timestamp": timestamp, "X-Stack-Signature": "sha256=00"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned callback status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, "/internal/stacks/callback", body, map[string]string{"X-Stack-Timestamp": timestamp, "X-Stack-Signature": stack.SignCallback("callback-secret", timestamp, []byte(body))})
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("callback status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, "/api/stacks", nil, authHeader(user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list stacks status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var listed struct {
+		Stacks []map[string]any `json:"stacks"`
+	}
+	decodeJSON(t, rec, &listed)
+	if len(listed.Stacks) != 1 || listed.Stacks[0]["node_port"] != float64(32000) || listed.Stacks[0]["node_public_ip"] != "127.0.0.2" {
+		t.Fatalf("expected callback state to be served, got %+v", listed.Stacks)
+	}
+}
+
+func TestStackReferenceProvisioner(t *testing.T) {
+	var router http.Handler
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+	}))
+	defer app.Close()
+
+	ref, err := provisioner.New(provisioner.Config{
+		APIKey:         "test-key",
+		PortMin:        31000,
+		PortMax:        31009,
+		CallbackURL:    app.URL + "/internal/stacks/callback",
+		CallbackSecret: "callback-secret",
+	})
+	if err != nil {
+		t.Fatalf("provisioner: %v", err)
+	}
+	defer ref.Close()
+
+	server := httptest.NewServer(ref)
+	defer server.Close()
+
+	cfg := testCfg
+	cfg.Stack = config.StackConfig{
+		Enabled:            true,
+		MaxPerUser:         3,
+		ProvisionerBaseURL: server.URL,
+		ProvisionerAPIKey:  "test-key",
+		ProvisionerTimeout: 2 * time.Second,
+		CreateWindow:       time.Minute,
+		CreateMax:          5,
+		ProvisionWorkers:   1,
+		ProvisionQueue:     10,
+		CallbackSecret:     "callback-secret",
+		StatusMaxAge:       time.Minute,
+	}
+
+	client := stack.NewClient(cfg.Stack.ProvisionerBaseURL, cfg.Stack.ProvisionerAPIKey, cfg.Stack.ProvisionerTimeout, stack.ClientPolicy{Retries: 1})
+	env := setupStackTest(t, cfg, client)
+	router = env.router
+
+	user, _, _ := registerAndLogin(t, env, "user@example.com", "user", "strong-pass")
+	challenge := createStackChallenge(t, env, "StackChal")
+	base := "/api/challenges/" + itoa(challenge.ID) + "/stack"
+
+	rec := doRequest(t, env.router, http.MethodPost, base, nil, authHeader(user))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, env.router, http.MethodGet, base+"?wait=5", nil, authHeader(user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("wait stack status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var ready struct {
+		StackID  string `json:"stack_id"`
+		Status   string `json:"status"`
+		NodePort int    `json:"node_port"`
+	}
+	decodeJSON(t, rec, &ready)
+
+	if ready.StackID == "" || ready.Status != provisioner.StatusRunning || ready.NodePort != 31000 || ref.Count() != 1 {
+		t.Fatalf("expected running stack on the first node port, got %+v", ready)
+	}
+
+	rec = doRequest(t, env.router, http.MethodPost, base+"/restart", nil, authHeader(user))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restart status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The provisioner loses the node and reports it through a signed callback
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/debug/stacks/"+ready.StackID+"/status", strings.NewReader(`{"status":"node_deleted"}`))
+	req.Header.Set("X-API-KEY", "test-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("force status: %v", err)
+	}
+	resp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec = doRequest(t, env.router, http.MethodGet, base, nil, authHeader(user))
+		if rec.Code == http.StatusNotFound {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the callback to remove the stack, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
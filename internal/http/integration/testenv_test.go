@@ -139,6 +139,7 @@ func TestMain(m *testing.M) {
 			FlagHMACSecret:   "test-flag-secret",
 			SubmissionWindow: 2 * time.Minute,
 			SubmissionMax:    5,
+			PoWTTL:           time.Minute,
 		},
 		Cache: config.CacheConfig{
 			TimelineTTL:    2 * time.Minute,
@@ -260,12 +261,14 @@ func setupTest(t *testing.T, cfg config.Config) testEnv {
 
 	fileStore := storage.NewMemoryChallengeFileStore(10 * time.Minute)
 
-	authSvc := service.NewAuthService(cfg, testDB, userRepo, registrationKeyRepo, teamRepo, testRedis)
-	teamSvc := service.NewTeamService(teamRepo)
-	ctfSvc := service.NewCTFService(cfg, challengeRepo, submissionRepo, testRedis, fileStore)
 	appConfigSvc := service.NewAppConfigService(appConfigRepo, testRedis, cfg.Cache.AppConfigTTL)
+	authSvc := service.NewAuthService(cfg, testDB, userRepo, registrationKeyRepo, teamRepo, repo.NewLoginFailureRepo(testDB), appConfigSvc, testRedis)
+	teamSvc := service.NewTeamService(teamRepo, repo.NewDivisionRepo(testDB))
+	ctfSvc := service.NewCTFService(cfg, challengeRepo, submissionRepo, testRedis, fileStore)
+	apiTokenSvc := service.NewAPITokenService(repo.NewAPITokenRepo(testDB), userRepo)
+	powSvc := service.NewPoWService(appConfigSvc, testRedis, cfg.Security.PoWTTL)
 
-	router := apphttp.NewRouter(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, nil, testRedis, testLogger)
+	router := apphttp.NewRouter(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, nil, apiTokenSvc, powSvc, testRedis, testLogger)
 
 	return testEnv{
 		cfg:            cfg,
@@ -304,7 +307,7 @@ func setCTFWindow(t *testing.T, env testEnv, startAt, endAt *time.Time) {
 		endValue = &value
 	}
 
-	if _, _, _, err := env.appConfigSvc.Update(context.Background(), nil, nil, nil, nil, startValue, endValue); err != nil {
+	if _, _, _, err := env.appConfigSvc.Update(context.Background(), nil, nil, nil, nil, startValue, endValue, nil, nil, nil, nil); err != nil {
 		t.Fatalf("set ctf window: %v", err)
 	}
 }
@@ -312,7 +315,7 @@ func setCTFWindow(t *testing.T, env testEnv, startAt, endAt *time.Time) {
 func resetState(t *testing.T) {
 	t.Helper()
 
-	if _, err := testDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, stacks, challenges, users, teams RESTART IDENTITY CASCADE"); err != nil {
+	if _, err := testDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, api_tokens, login_failures, stacks, challenges, users, teams, divisions RESTART IDENTITY CASCADE"); err != nil {
 		t.Fatalf("truncate tables: %v", err)
 	}
 
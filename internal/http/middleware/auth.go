@@ -1,26 +1,44 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
 	"smctf/internal/auth"
 	"smctf/internal/config"
+	"smctf/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 const (
-	ctxUserIDKey = "userID"
-	ctxRoleKey   = "role"
+	ctxUserIDKey    = "userID"
+	ctxRoleKey      = "role"
+	ctxSessionIDKey = "sessionID"
+	ctxAPITokenKey  = "apiToken"
 
 	errMissingAuth  = "missing authorization"
 	errInvalidAuth  = "invalid authorization"
 	errInvalidToken = "invalid token"
 	errForbidden    = "forbidden"
+	errScope        = "insufficient scope"
+	errUnavailable  = "service unavailable"
+	errTooMany      = "too many requests"
+	errNotFound     = "not found"
 )
 
-func Auth(cfg config.JWTConfig) gin.HandlerFunc {
+type AccessRevocationChecker interface {
+	IsAccessRevoked(ctx context.Context, claims *auth.Claims) (bool, error)
+}
+
+// Resolves a personal API token, a nil token means it is unknown, revoked or expired
+type APITokenAuthenticator interface {
+	AuthenticateAPIToken(ctx context.Context, token string) (*models.APIToken, *models.User, error)
+}
+
+// Accepts access JWTs, and personal API tokens when apiTokens is set. API token requests are limited by RequireScope.
+func Auth(cfg config.JWTConfig, revocations AccessRevocationChecker, apiTokens APITokenAuthenticator) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authHeader := ctx.GetHeader("Authorization")
 		if authHeader == "" {
@@ -34,6 +52,11 @@ func Auth(cfg config.JWTConfig) gin.HandlerFunc {
 			return
 		}
 
+		if auth.IsAPIToken(parts[1]) {
+			authenticateAPIToken(ctx, apiTokens, parts[1])
+			return
+		}
+
 		claims, err := auth.ParseToken(cfg, parts[1])
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errInvalidToken})
@@ -45,15 +68,64 @@ func Auth(cfg config.JWTConfig) gin.HandlerFunc {
 			return
 		}
 
+		if revocations != nil {
+			revoked, err := revocations.IsAccessRevoked(ctx.Request.Context(), claims)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errUnavailable})
+				return
+			}
+
+			if revoked {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errInvalidToken})
+				return
+			}
+		}
+
 		ctx.Set(ctxUserIDKey, claims.UserID)
 		ctx.Set(ctxRoleKey, claims.Role)
+		ctx.Set(ctxSessionIDKey, claims.SessionID)
+		ctx.Next()
+	}
+}
+
+func authenticateAPIToken(ctx *gin.Context, apiTokens APITokenAuthenticator, raw string) {
+	if apiTokens == nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errInvalidToken})
+		return
+	}
+
+	token, user, err := apiTokens.AuthenticateAPIToken(ctx.Request.Context(), raw)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errUnavailable})
+		return
+	}
+
+	if token == nil || user == nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errInvalidToken})
+		return
+	}
+
+	ctx.Set(ctxUserIDKey, user.ID)
+	ctx.Set(ctxRoleKey, user.Role)
+	ctx.Set(ctxAPITokenKey, token)
+	ctx.Next()
+}
+
+// Only restricts API token requests, JWT sessions carry every scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token := APIToken(ctx); token != nil && !token.HasScope(scope) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errScope})
+			return
+		}
+
 		ctx.Next()
 	}
 }
 
-func RequireRole(role string) gin.HandlerFunc {
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		if Role(ctx) != role {
+		if !auth.HasPermission(Role(ctx), permission) {
 			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errForbidden})
 			return
 		}
@@ -81,3 +153,24 @@ func Role(ctx *gin.Context) string {
 
 	return ""
 }
+
+func SessionID(ctx *gin.Context) string {
+	if v, ok := ctx.Get(ctxSessionIDKey); ok {
+		if sessionID, ok := v.(string); ok {
+			return sessionID
+		}
+	}
+
+	return ""
+}
+
+// Returns the API token of the request, nil for JWT sessions
+func APIToken(ctx *gin.Context) *models.APIToken {
+	if v, ok := ctx.Get(ctxAPITokenKey); ok {
+		if token, ok := v.(*models.APIToken); ok {
+			return token
+		}
+	}
+
+	return nil
+}
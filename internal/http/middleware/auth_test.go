@@ -1,13 +1,17 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"smctf/internal/auth"
 	"smctf/internal/config"
+	"smctf/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,11 +33,16 @@ func TestAuthMiddleware(t *testing.T) {
 		t.Fatalf("expected empty role, got %s", Role(&gin.Context{}))
 	}
 
+	if SessionID(&gin.Context{}) != "" {
+		t.Fatalf("expected empty session id, got %s", SessionID(&gin.Context{}))
+	}
+
 	router := gin.New()
-	router.GET("/protected", Auth(cfg), func(ctx *gin.Context) {
+	router.GET("/protected", Auth(cfg, nil, nil), func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{
-			"user_id": UserID(ctx),
-			"role":    Role(ctx),
+			"user_id":    UserID(ctx),
+			"role":       Role(ctx),
+			"session_id": SessionID(ctx),
 		})
 	})
 
@@ -63,7 +72,7 @@ func TestAuthMiddleware(t *testing.T) {
 		t.Fatalf("expected 401, got %d", rec.Code)
 	}
 
-	refresh, err := auth.GenerateRefreshToken(cfg, 42, "user", "jti-1")
+	refresh, err := auth.GenerateRefreshToken(cfg, 42, "user", "session-1", "jti-1")
 	if err != nil {
 		t.Fatalf("refresh token: %v", err)
 	}
@@ -77,7 +86,7 @@ func TestAuthMiddleware(t *testing.T) {
 		t.Fatalf("expected 401, got %d", rec.Code)
 	}
 
-	access, err := auth.GenerateAccessToken(cfg, 42, "admin")
+	access, err := auth.GenerateAccessToken(cfg, 42, "admin", "session-1")
 	if err != nil {
 		t.Fatalf("access token: %v", err)
 	}
@@ -90,9 +99,22 @@ func TestAuthMiddleware(t *testing.T) {
 	if rec.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", rec.Code)
 	}
+
+	if !strings.Contains(rec.Body.String(), `"session_id":"session-1"`) {
+		t.Fatalf("expected session id in context, got %s", rec.Body.String())
+	}
 }
 
-func TestRequireRole(t *testing.T) {
+type stubRevocations struct {
+	revoked bool
+	err     error
+}
+
+func (s stubRevocations) IsAccessRevoked(ctx context.Context, claims *auth.Claims) (bool, error) {
+	return s.revoked, s.err
+}
+
+func TestAuthMiddlewareRevocation(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	cfg := config.JWTConfig{
 		Secret:     "secret",
@@ -101,36 +123,159 @@ func TestRequireRole(t *testing.T) {
 		RefreshTTL: time.Hour,
 	}
 
-	router := gin.New()
-	router.GET("/admin", Auth(cfg), RequireRole("admin"), func(ctx *gin.Context) {
-		ctx.Status(http.StatusOK)
-	})
-
-	userToken, err := auth.GenerateAccessToken(cfg, 1, "user")
+	access, err := auth.GenerateAccessToken(cfg, 42, "user", "session-1")
 	if err != nil {
-		t.Fatalf("user token: %v", err)
+		t.Fatalf("access token: %v", err)
 	}
 
-	rec := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
-	req.Header.Set("Authorization", "Bearer "+userToken)
+	tests := []struct {
+		name     string
+		checker  stubRevocations
+		expected int
+	}{
+		{"not revoked", stubRevocations{}, http.StatusOK},
+		{"revoked", stubRevocations{revoked: true}, http.StatusUnauthorized},
+		{"checker error", stubRevocations{err: errors.New("redis down")}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/protected", Auth(cfg, tt.checker, nil), func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
 
-	router.ServeHTTP(rec, req)
-	if rec.Code != http.StatusForbidden {
-		t.Fatalf("expected 403, got %d", rec.Code)
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			req.Header.Set("Authorization", "Bearer "+access)
+
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Fatalf("expected %d, got %d", tt.expected, rec.Code)
+			}
+		})
 	}
+}
 
-	adminToken, err := auth.GenerateAccessToken(cfg, 1, "admin")
+type stubAPITokens struct {
+	token *models.APIToken
+	user  *models.User
+	err   error
+}
+
+func (s stubAPITokens) AuthenticateAPIToken(ctx context.Context, token string) (*models.APIToken, *models.User, error) {
+	return s.token, s.user, s.err
+}
+
+func TestAuthMiddlewareAPIToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.JWTConfig{
+		Secret:     "secret",
+		Issuer:     "issuer",
+		AccessTTL:  time.Hour,
+		RefreshTTL: time.Hour,
+	}
+
+	valid := stubAPITokens{
+		token: &models.APIToken{ID: 1, UserID: 7, Scopes: []string{models.ScopeRead}},
+		user:  &models.User{ID: 7, Role: "user"},
+	}
+
+	tests := []struct {
+		name      string
+		apiTokens APITokenAuthenticator
+		path      string
+		expected  int
+	}{
+		{"tokens disabled", nil, "/read", http.StatusUnauthorized},
+		{"unknown token", stubAPITokens{}, "/read", http.StatusUnauthorized},
+		{"lookup error", stubAPITokens{err: errors.New("db down")}, "/read", http.StatusServiceUnavailable},
+		{"scope granted", valid, "/read", http.StatusOK},
+		{"scope missing", valid, "/submit", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			group := router.Group("", Auth(cfg, nil, tt.apiTokens))
+			group.GET("/read", RequireScope(models.ScopeRead), func(ctx *gin.Context) {
+				if UserID(ctx) != 7 || APIToken(ctx) == nil {
+					ctx.Status(http.StatusInternalServerError)
+					return
+				}
+				ctx.Status(http.StatusOK)
+			})
+			group.GET("/submit", RequireScope(models.ScopeSubmit), func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer smctf_abc")
+
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.expected {
+				t.Fatalf("expected %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+
+	access, err := auth.GenerateAccessToken(cfg, 7, "user", "")
 	if err != nil {
-		t.Fatalf("admin token: %v", err)
+		t.Fatalf("access token: %v", err)
 	}
 
-	rec = httptest.NewRecorder()
-	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
-	req.Header.Set("Authorization", "Bearer "+adminToken)
+	router := gin.New()
+	router.GET("/submit", Auth(cfg, nil, valid), RequireScope(models.ScopeSubmit), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/submit", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
 
 	router.ServeHTTP(rec, req)
 	if rec.Code != http.StatusOK {
-		t.Fatalf("expected 200, got %d", rec.Code)
+		t.Fatalf("expected jwt to pass scope check, got %d", rec.Code)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.JWTConfig{
+		Secret:     "secret",
+		Issuer:     "issuer",
+		AccessTTL:  time.Hour,
+		RefreshTTL: time.Hour,
+	}
+
+	router := gin.New()
+	router.GET("/admin/challenges/1", Auth(cfg, nil, nil), RequirePermission(auth.PermChallengesRead), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	cases := []struct {
+		role string
+		want int
+	}{
+		{auth.RoleUser, http.StatusForbidden},
+		{auth.RoleSupport, http.StatusForbidden},
+		{auth.RoleReviewer, http.StatusOK},
+		{auth.RoleChallengeAuthor, http.StatusOK},
+		{auth.RoleAdmin, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		token, err := auth.GenerateAccessToken(cfg, 1, tc.role, "")
+		if err != nil {
+			t.Fatalf("%s token: %v", tc.role, err)
+		}
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin/challenges/1", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d", tc.role, tc.want, rec.Code)
+		}
 	}
 }
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"smctf/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Exposes the outcome of service rate limits as RateLimit-* headers on any route that checked one
+func RateLimitHeaders() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx := service.WithRateLimitRequest(ctx.Request.Context(), ctx.ClientIP())
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Writer = &rateLimitWriter{ResponseWriter: ctx.Writer, ctx: reqCtx}
+		ctx.Next()
+	}
+}
+
+// Throttles a route group per client IP. Allowlisted addresses are exempt, and Redis failures let requests through.
+func RateLimit(limiter *service.RateLimiter, name string, policy service.RateLimitPolicy, allowlist []netip.Prefix) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if limiter == nil || policy.Limit <= 0 {
+			ctx.Next()
+			return
+		}
+
+		ip := ctx.ClientIP()
+		if allowlisted(allowlist, ip) {
+			ctx.Next()
+			return
+		}
+
+		_, err := limiter.Allow(ctx.Request.Context(), name, service.RateLimitSubject{IP: ip}, policy)
+		var rl *service.RateLimitError
+		if errors.As(err, &rl) {
+			SetRateLimitHeaders(ctx.Writer.Header(), rl.Info)
+			ctx.Header("Retry-After", strconv.Itoa(rl.Info.ResetSeconds))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": errTooMany, "rate_limit": rl.Info})
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+func allowlisted(allowlist []netip.Prefix, ip string) bool {
+	if len(allowlist) == 0 {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range allowlist {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func SetRateLimitHeaders(header http.Header, info service.RateLimitInfo) {
+	header.Set("RateLimit-Limit", strconv.Itoa(info.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(info.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(info.ResetSeconds))
+	if info.Policy != "" {
+		header.Set("RateLimit-Policy", info.Policy)
+	}
+}
+
+// Headers must be in place before the status line goes out, so they are set on the first write
+type rateLimitWriter struct {
+	gin.ResponseWriter
+	ctx     context.Context
+	written bool
+}
+
+func (w *rateLimitWriter) setHeaders() {
+	if w.written {
+		return
+	}
+	w.written = true
+
+	if info, ok := service.RateLimitResult(w.ctx); ok {
+		SetRateLimitHeaders(w.Header(), info)
+	}
+}
+
+func (w *rateLimitWriter) WriteHeader(code int) {
+	w.setHeaders()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *rateLimitWriter) WriteHeaderNow() {
+	w.setHeaders()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *rateLimitWriter) Write(data []byte) (int, error) {
+	w.setHeaders()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *rateLimitWriter) WriteString(s string) (int, error) {
+	w.setHeaders()
+	return w.ResponseWriter.WriteString(s)
+}
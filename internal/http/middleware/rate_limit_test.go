@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"smctf/internal/service"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRateLimiter(t *testing.T) *service.RateLimiter {
+	t.Helper()
+
+	redisServer, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("start redis: %v", err)
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		redisServer.Close()
+	})
+
+	return service.NewRateLimiter(client)
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := newTestRateLimiter(t)
+	policy := service.RateLimitPolicy{Scope: service.RateLimitScopeIP, Limit: 3, Window: time.Minute}
+
+	router := gin.New()
+	router.Use(RateLimitHeaders())
+	router.GET("/limited", func(ctx *gin.Context) {
+		if _, err := limiter.Allow(ctx.Request.Context(), "test", service.RateLimitSubject{IP: ctx.ClientIP()}, policy); err != nil {
+			ctx.Status(http.StatusTooManyRequests)
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/open", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/limited", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	if rec.Header().Get("RateLimit-Limit") != "3" || rec.Header().Get("RateLimit-Remaining") != "2" || rec.Header().Get("RateLimit-Reset") != "60" {
+		t.Fatalf("unexpected headers: %v", rec.Header())
+	}
+
+	if rec.Header().Get("RateLimit-Policy") != service.RateLimitScopeIP {
+		t.Fatalf("unexpected policy header: %q", rec.Header().Get("RateLimit-Policy"))
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/open", nil))
+	if rec.Header().Get("RateLimit-Limit") != "" {
+		t.Fatalf("expected no rate limit headers on unlimited route")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter := newTestRateLimiter(t)
+	policy := service.RateLimitPolicy{Scope: service.RateLimitScopeIP, Limit: 2, Window: time.Minute}
+	allowlist := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	router := gin.New()
+	router.Use(RateLimitHeaders(), RateLimit(limiter, "test", policy, allowlist))
+	router.GET("/test", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := request("203.0.113.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d: expected 200, got %d", i, rec.Code)
+		}
+	}
+
+	rec := request("203.0.113.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("unexpected headers: %v", rec.Header())
+	}
+
+	if rec := request("203.0.113.2:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expected other ip to pass, got %d", rec.Code)
+	}
+
+	for i := 0; i < 5; i++ {
+		if rec := request("10.1.2.3:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("expected allowlisted ip to pass, got %d", rec.Code)
+		}
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RateLimit(nil, "test", service.RateLimitPolicy{Limit: 1, Window: time.Minute}, nil))
+	router.GET("/test", func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+	}
+}
+
+func TestAllowlisted(t *testing.T) {
+	allowlist := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}
+
+	cases := map[string]bool{
+		"10.2.3.4":        true,
+		"::ffff:10.2.3.4": true,
+		"2001:db8::1":     true,
+		"192.168.0.1":     false,
+		"not-an-ip":       false,
+	}
+
+	for ip, want := range cases {
+		if got := allowlisted(allowlist, ip); got != want {
+			t.Fatalf("allowlisted(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"smctf/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Hides team routes in individual mode. Config lookup failures let the request through.
+func RequireTeams(appConfig *service.AppConfigService) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if appConfig == nil {
+			ctx.Next()
+			return
+		}
+
+		individual, err := appConfig.IndividualMode(ctx.Request.Context())
+		if err == nil && individual {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errNotFound})
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -2,13 +2,16 @@ package http
 
 import (
 	"io"
+	"log"
 	nethttp "net/http"
 	"os"
 
+	"smctf/internal/auth"
 	"smctf/internal/config"
 	"smctf/internal/http/handlers"
 	"smctf/internal/http/middleware"
 	"smctf/internal/logging"
+	"smctf/internal/models"
 	"smctf/internal/repo"
 	"smctf/internal/service"
 
@@ -16,7 +19,7 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-func NewRouter(cfg config.Config, authSvc *service.AuthService, ctfSvc *service.CTFService, appConfigSvc *service.AppConfigService, userRepo *repo.UserRepo, scoreRepo *repo.ScoreboardRepo, teamSvc *service.TeamService, stackSvc *service.StackService, redis *redis.Client, logger *logging.Logger) *gin.Engine {
+func NewRouter(cfg config.Config, authSvc *service.AuthService, ctfSvc *service.CTFService, appConfigSvc *service.AppConfigService, userRepo *repo.UserRepo, scoreRepo *repo.ScoreboardRepo, teamSvc *service.TeamService, stackSvc *service.StackService, apiTokenSvc *service.APITokenService, powSvc *service.PoWService, redis *redis.Client, logger *logging.Logger) *gin.Engine {
 	if cfg.AppEnv == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -27,62 +30,136 @@ func NewRouter(cfg config.Config, authSvc *service.AuthService, ctfSvc *service.
 	}
 
 	r := gin.New()
+	// Without trusted proxies ClientIP ignores forwarding headers and uses the peer address
+	if err := r.SetTrustedProxies(cfg.RateLimit.TrustedProxies); err != nil {
+		log.Printf("trusted proxies config warning: %v", err)
+	}
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
 	r.Use(middleware.RequestLogger(cfg.Logging, logger))
 	r.Use(middleware.CORS(cfg.AppEnv != "production", cfg.CORS.AllowedOrigins))
+	r.Use(middleware.RateLimitHeaders())
+
+	h := handlers.New(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, stackSvc, apiTokenSvc, powSvc, redis)
+
+	var apiTokens middleware.APITokenAuthenticator
+	if apiTokenSvc != nil {
+		apiTokens = apiTokenSvc
+	}
 
-	h := handlers.New(cfg, authSvc, ctfSvc, appConfigSvc, userRepo, scoreRepo, teamSvc, stackSvc, redis)
+	var limiter *service.RateLimiter
+	if redis != nil {
+		limiter = service.NewRateLimiter(redis)
+	}
+
+	groupLimit := func(name string, max int) gin.HandlerFunc {
+		policy := service.RateLimitPolicy{Scope: service.RateLimitScopeIP, Limit: max, Window: cfg.RateLimit.Window}
+		return middleware.RateLimit(limiter, name, policy, cfg.RateLimit.Allowlist)
+	}
+	publicLimit := groupLimit("public", cfg.RateLimit.PublicMax)
+	authLimit := groupLimit("auth", cfg.RateLimit.AuthMax)
+	apiLimit := groupLimit("api", cfg.RateLimit.APIMax)
 
 	r.GET("/healthz", func(ctx *gin.Context) {
 		ctx.JSON(nethttp.StatusOK, gin.H{"status": "ok"})
 	})
+	r.GET("/.well-known/jwks.json", h.JWKS)
+
+	// Only reachable once a shared secret is configured for the provisioner
+	if cfg.Stack.CallbackSecret != "" {
+		r.POST("/internal/stacks/callback", h.StackStatusCallback)
+	}
 
 	api := r.Group("/api")
 	{
-		api.GET("/config", h.GetConfig)
-
-		api.POST("/auth/register", h.Register)
-		api.POST("/auth/login", h.Login)
-		api.POST("/auth/refresh", h.Refresh)
-		api.POST("/auth/logout", h.Logout)
-
-		api.GET("/challenges", h.ListChallenges)
-		api.GET("/leaderboard", h.Leaderboard)
-		api.GET("/leaderboard/teams", h.TeamLeaderboard)
-		api.GET("/timeline", h.Timeline)
-		api.GET("/timeline/teams", h.TeamTimeline)
-		api.GET("/teams", h.ListTeams)
-		api.GET("/teams/:id", h.GetTeam)
-		api.GET("/teams/:id/members", h.ListTeamMembers)
-		api.GET("/teams/:id/solved", h.ListTeamSolved)
-		api.GET("/users", h.ListUsers)
-		api.GET("/users/:id", h.GetUser)
-		api.GET("/users/:id/solved", h.GetUserSolved)
-
-		auth := api.Group("")
-		auth.Use(middleware.Auth(cfg.JWT))
-		auth.GET("/me", h.Me)
-		auth.PUT("/me", h.UpdateMe)
-		auth.POST("/challenges/:id/submit", h.SubmitFlag)
-		auth.POST("/challenges/:id/file/download", h.RequestChallengeFileDownload)
-		auth.GET("/stacks", h.ListStacks)
-		auth.POST("/challenges/:id/stack", h.CreateStack)
-		auth.GET("/challenges/:id/stack", h.GetStack)
-		auth.DELETE("/challenges/:id/stack", h.DeleteStack)
+		credentials := api.Group("")
+		credentials.Use(authLimit)
+		credentials.POST("/pow", h.IssuePoW)
+		credentials.POST("/auth/register", h.Register)
+		credentials.POST("/auth/login", h.Login)
+		credentials.POST("/auth/refresh", h.Refresh)
+		credentials.POST("/auth/logout", h.Logout)
+
+		public := api.Group("")
+		public.Use(publicLimit)
+		public.GET("/config", h.GetConfig)
+		public.GET("/challenges", h.ListChallenges)
+		public.GET("/leaderboard", h.Leaderboard)
+		public.GET("/leaderboard/countries", h.CountryLeaderboard)
+		public.GET("/leaderboard/affiliations", h.AffiliationLeaderboard)
+		public.GET("/countries", h.ListCountries)
+		public.GET("/timeline", h.Timeline)
+		public.GET("/users", h.ListUsers)
+		public.GET("/users/:id", h.GetUser)
+		public.GET("/users/:id/solved", h.GetUserSolved)
+
+		teams := public.Group("")
+		teams.Use(middleware.RequireTeams(appConfigSvc))
+		teams.GET("/leaderboard/teams", h.TeamLeaderboard)
+		teams.GET("/timeline/teams", h.TeamTimeline)
+		teams.GET("/teams", h.ListTeams)
+		teams.GET("/teams/:id", h.GetTeam)
+		teams.GET("/teams/:id/members", h.ListTeamMembers)
+		teams.GET("/teams/:id/solved", h.ListTeamSolved)
+		teams.GET("/divisions", h.ListDivisions)
+
+		authed := api.Group("")
+		authed.Use(apiLimit, middleware.Auth(cfg.JWT, authSvc, nil))
+		authed.PUT("/me", h.UpdateMe)
+		authed.PUT("/me/team", middleware.RequireTeams(appConfigSvc), h.UpdateMyTeam)
+		authed.GET("/me/sessions", h.ListSessions)
+		authed.DELETE("/me/sessions", h.RevokeOtherSessions)
+		authed.DELETE("/me/sessions/:id", h.RevokeSession)
+		authed.GET("/me/tokens", h.ListAPITokens)
+		authed.POST("/me/tokens", h.CreateAPIToken)
+		authed.DELETE("/me/tokens/:id", h.RevokeAPIToken)
+
+		scoped := api.Group("")
+		scoped.Use(apiLimit, middleware.Auth(cfg.JWT, authSvc, apiTokens))
+		scoped.GET("/me", middleware.RequireScope(models.ScopeRead), h.Me)
+		scoped.POST("/challenges/:id/submit", middleware.RequireScope(models.ScopeSubmit), h.SubmitFlag)
+		scoped.POST("/challenges/:id/file/download", middleware.RequireScope(models.ScopeRead), h.RequestChallengeFileDownload)
+		scoped.GET("/stacks", middleware.RequireScope(models.ScopeStacks), h.ListStacks)
+		scoped.GET("/stacks/events", middleware.RequireScope(models.ScopeStacks), h.StackEvents)
+		scoped.POST("/challenges/:id/stack", middleware.RequireScope(models.ScopeStacks), h.CreateStack)
+		scoped.GET("/challenges/:id/stack", middleware.RequireScope(models.ScopeStacks), h.GetStack)
+		scoped.DELETE("/challenges/:id/stack", middleware.RequireScope(models.ScopeStacks), h.DeleteStack)
+		scoped.POST("/challenges/:id/stack/extend", middleware.RequireScope(models.ScopeStacks), h.ExtendStack)
+		scoped.POST("/challenges/:id/stack/restart", middleware.RequireScope(models.ScopeStacks), h.RestartStack)
+
+		adminChallenges := api.Group("/admin/challenges")
+		adminChallenges.Use(apiLimit, middleware.Auth(cfg.JWT, authSvc, apiTokens), middleware.RequireScope(models.ScopeAdminChallenges))
+		adminChallenges.POST("", middleware.RequirePermission(auth.PermChallengesWrite), h.CreateChallenge)
+		adminChallenges.GET("/:id", middleware.RequirePermission(auth.PermChallengesRead), h.AdminGetChallenge)
+		adminChallenges.PUT("/:id", middleware.RequirePermission(auth.PermChallengesWrite), h.UpdateChallenge)
+		adminChallenges.DELETE("/:id", middleware.RequirePermission(auth.PermChallengesWrite), h.DeleteChallenge)
+		adminChallenges.POST("/:id/file/upload", middleware.RequirePermission(auth.PermChallengesWrite), h.RequestChallengeFileUpload)
+		adminChallenges.DELETE("/:id/file", middleware.RequirePermission(auth.PermChallengesWrite), h.DeleteChallengeFile)
 
 		admin := api.Group("/admin")
-		admin.Use(middleware.Auth(cfg.JWT), middleware.RequireRole("admin"))
-		admin.PUT("/config", h.AdminUpdateConfig)
-		admin.POST("/challenges", h.CreateChallenge)
-		admin.GET("/challenges/:id", h.AdminGetChallenge)
-		admin.PUT("/challenges/:id", h.UpdateChallenge)
-		admin.DELETE("/challenges/:id", h.DeleteChallenge)
-		admin.POST("/challenges/:id/file/upload", h.RequestChallengeFileUpload)
-		admin.DELETE("/challenges/:id/file", h.DeleteChallengeFile)
-		admin.POST("/registration-keys", h.CreateRegistrationKeys)
-		admin.GET("/registration-keys", h.ListRegistrationKeys)
-		admin.POST("/teams", h.CreateTeam)
+		admin.Use(apiLimit, middleware.Auth(cfg.JWT, authSvc, nil))
+		admin.PUT("/config", middleware.RequirePermission(auth.PermConfigWrite), h.AdminUpdateConfig)
+		admin.POST("/registration-keys", middleware.RequirePermission(auth.PermRegistrationKeysWrite), h.CreateRegistrationKeys)
+		admin.GET("/registration-keys", middleware.RequirePermission(auth.PermRegistrationKeysRead), h.ListRegistrationKeys)
+		admin.GET("/registration-keys/export", middleware.RequirePermission(auth.PermRegistrationKeysRead), h.ExportRegistrationKeys)
+		admin.POST("/registration-keys/:id/revoke", middleware.RequirePermission(auth.PermRegistrationKeysWrite), h.RevokeRegistrationKey)
+		admin.POST("/teams", middleware.RequirePermission(auth.PermTeamsWrite), h.CreateTeam)
+		admin.PUT("/teams/:id", middleware.RequirePermission(auth.PermTeamsWrite), h.UpdateTeam)
+		admin.DELETE("/teams/:id", middleware.RequirePermission(auth.PermTeamsWrite), h.DeleteTeam)
+		admin.POST("/teams/:id/merge", middleware.RequirePermission(auth.PermTeamsWrite), h.MergeTeam)
+		admin.PUT("/teams/:id/division", middleware.RequirePermission(auth.PermTeamsWrite), h.SetTeamDivision)
+		admin.PUT("/teams/:id/captain", middleware.RequirePermission(auth.PermTeamsWrite), h.SetTeamCaptain)
+		admin.POST("/divisions", middleware.RequirePermission(auth.PermTeamsWrite), h.CreateDivision)
+		admin.DELETE("/divisions/:id", middleware.RequirePermission(auth.PermTeamsWrite), h.DeleteDivision)
+		admin.PUT("/users/:id/team", middleware.RequirePermission(auth.PermTeamsWrite), h.AdminMoveUserTeam)
+		admin.DELETE("/users/:id/sessions", middleware.RequirePermission(auth.PermUsersManage), h.AdminRevokeUserSessions)
+		admin.PUT("/users/:id/role", middleware.RequirePermission(auth.PermRolesManage), h.AdminUpdateUserRole)
+		admin.POST("/users/:id/unlock", middleware.RequirePermission(auth.PermUsersManage), h.AdminUnlockUser)
+		admin.GET("/login-failures", middleware.RequirePermission(auth.PermUsersRead), h.AdminListLoginFailures)
+		admin.GET("/stacks", middleware.RequirePermission(auth.PermStacksRead), h.AdminListStacks)
+		admin.GET("/stacks/counts", middleware.RequirePermission(auth.PermStacksRead), h.AdminStackCounts)
+		admin.DELETE("/stacks/:id", middleware.RequirePermission(auth.PermStacksWrite), h.AdminDeleteStack)
+		admin.POST("/stacks/delete", middleware.RequirePermission(auth.PermStacksWrite), h.AdminDeleteStacks)
 	}
 
 	return r
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	ScopeRead            = "read"
+	ScopeSubmit          = "submit"
+	ScopeStacks          = "stacks"
+	ScopeAdminChallenges = "admin:challenges"
+)
+
+// Database model for personal API tokens, only the SHA-256 hash of the secret is stored
+type APIToken struct {
+	bun.BaseModel `bun:"table:api_tokens"`
+	ID            int64      `bun:",pk,autoincrement"`
+	UserID        int64      `bun:"user_id,notnull"`
+	Name          string     `bun:"name,notnull"`
+	TokenHash     string     `bun:"token_hash,unique,notnull"`
+	Prefix        string     `bun:"prefix,notnull"`
+	Scopes        []string   `bun:"scopes,array,notnull"`
+	ExpiresAt     *time.Time `bun:"expires_at,nullzero"`
+	LastUsedAt    *time.Time `bun:"last_used_at,nullzero"`
+	RevokedAt     *time.Time `bun:"revoked_at,nullzero"`
+	CreatedAt     time.Time  `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
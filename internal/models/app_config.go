@@ -12,3 +12,13 @@ type AppConfig struct {
 	Value         string    `bun:"value,notnull"`
 	UpdatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 }
+
+const (
+	AppConfigKeyCompetitionMode = "competition_mode"
+	CompetitionModeTeam         = "team"
+	CompetitionModeIndividual   = "individual"
+
+	AppConfigKeyDivisionScoring = "division_scoring"
+	DivisionScoringGlobal       = "global"
+	DivisionScoringDivision     = "division"
+)
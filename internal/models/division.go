@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Database model for divisions, the brackets teams compete in
+type Division struct {
+	bun.BaseModel `bun:"table:divisions"`
+	ID            int64     `bun:",pk,autoincrement" json:"id"`
+	Name          string    `bun:",unique,notnull" json:"name"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp" json:"created_at"`
+}
+
+type DivisionSummary struct {
+	ID        int64     `bun:"id" json:"id"`
+	Name      string    `bun:"name" json:"name"`
+	CreatedAt time.Time `bun:"created_at" json:"created_at"`
+	TeamCount int       `bun:"team_count" json:"team_count"`
+}
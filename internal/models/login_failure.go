@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	LoginFailureInvalidCredentials = "invalid_credentials"
+	LoginFailureLocked             = "locked"
+)
+
+// Database model for failed login attempts
+type LoginFailure struct {
+	bun.BaseModel `bun:"table:login_failures"`
+	ID            int64     `bun:",pk,autoincrement"`
+	UserID        *int64    `bun:"user_id,nullzero"`
+	Email         string    `bun:",notnull"`
+	IP            string    `bun:"ip,notnull"`
+	Device        string    `bun:",notnull"`
+	Reason        string    `bun:",notnull"`
+	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
@@ -13,12 +13,19 @@ type RegistrationKey struct {
 	Code          string     `bun:",unique,notnull"`
 	CreatedBy     int64      `bun:",notnull"`
 	TeamID        int64      `bun:"team_id,notnull"`
+	DivisionID    int64      `bun:"division_id,notnull,default:0"`
+	MaxUses       int        `bun:"max_uses,notnull,default:1"`
+	UseCount      int        `bun:"use_count,notnull,default:0"`
 	UsedBy        *int64     `bun:",nullzero"`
 	UsedByIP      *string    `bun:",nullzero"`
 	CreatedAt     time.Time  `bun:",nullzero,notnull,default:current_timestamp"`
 	UsedAt        *time.Time `bun:",nullzero"`
+	ExpiresAt     *time.Time `bun:",nullzero"`
+	RevokedAt     *time.Time `bun:",nullzero"`
+	RevokedBy     *int64     `bun:",nullzero"`
 }
 
+// used_by, used_by_ip and used_at describe the most recent use
 type RegistrationKeySummary struct {
 	ID                int64      `bun:"id" json:"id"`
 	Code              string     `bun:"code" json:"code"`
@@ -26,9 +33,48 @@ type RegistrationKeySummary struct {
 	CreatedByUsername string     `bun:"created_by_username" json:"created_by_username"`
 	TeamID            int64      `bun:"team_id" json:"team_id"`
 	TeamName          string     `bun:"team_name" json:"team_name"`
+	DivisionID        int64      `bun:"division_id" json:"division_id"`
+	DivisionName      string     `bun:"division_name" json:"division_name"`
+	MaxUses           int        `bun:"max_uses" json:"max_uses"`
+	UseCount          int        `bun:"use_count" json:"use_count"`
 	UsedBy            *int64     `bun:"used_by" json:"used_by,omitempty"`
 	UsedByUsername    *string    `bun:"used_by_username" json:"used_by_username,omitempty"`
 	UsedByIP          *string    `bun:"used_by_ip" json:"used_by_ip,omitempty"`
 	CreatedAt         time.Time  `bun:"created_at" json:"created_at"`
 	UsedAt            *time.Time `bun:"used_at" json:"used_at,omitempty"`
+	ExpiresAt         *time.Time `bun:"expires_at" json:"expires_at,omitempty"`
+	RevokedAt         *time.Time `bun:"revoked_at" json:"revoked_at,omitempty"`
+	Status            string     `bun:"-" json:"status"`
+}
+
+type RegistrationKeyFilter struct {
+	TeamID *int64
+	Used   *bool
+	Limit  int
+	Offset int
+}
+
+const (
+	RegistrationKeyActive  = "active"
+	RegistrationKeyUsed    = "used"
+	RegistrationKeyExpired = "expired"
+	RegistrationKeyRevoked = "revoked"
+)
+
+func (k *RegistrationKey) Status(now time.Time) string {
+	return RegistrationKeyStatus(k.RevokedAt, k.ExpiresAt, k.UseCount, k.MaxUses, now)
+}
+
+// A revoked or exhausted key reports that state even after it has expired
+func RegistrationKeyStatus(revokedAt, expiresAt *time.Time, useCount, maxUses int, now time.Time) string {
+	switch {
+	case revokedAt != nil:
+		return RegistrationKeyRevoked
+	case useCount >= maxUses:
+		return RegistrationKeyUsed
+	case expiresAt != nil && !now.Before(*expiresAt):
+		return RegistrationKeyExpired
+	default:
+		return RegistrationKeyActive
+	}
 }
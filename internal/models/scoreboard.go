@@ -2,18 +2,43 @@ package models
 
 import "time"
 
+const (
+	LeaderboardGroupCountry     = "country"
+	LeaderboardGroupAffiliation = "affiliation"
+)
+
+// Zero values leave a dimension unfiltered. Affiliation matches case-insensitively.
+type LeaderboardFilter struct {
+	DivisionID  int64
+	Country     string
+	Affiliation string
+}
+
 type LeaderboardEntry struct {
-	UserID   int64              `bun:"user_id" json:"user_id"`
-	Username string             `bun:"username" json:"username"`
-	Score    int                `bun:"score" json:"score"`
-	Solves   []LeaderboardSolve `json:"solves"`
+	UserID      int64              `bun:"user_id" json:"user_id"`
+	Username    string             `bun:"username" json:"username"`
+	Country     string             `bun:"country" json:"country"`
+	Affiliation string             `bun:"affiliation" json:"affiliation"`
+	Score       int                `bun:"score" json:"score"`
+	Solves      []LeaderboardSolve `json:"solves"`
 }
 
 type TeamLeaderboardEntry struct {
-	TeamID   int64              `bun:"team_id" json:"team_id"`
-	TeamName string             `bun:"team_name" json:"team_name"`
-	Score    int                `bun:"score" json:"score"`
-	Solves   []LeaderboardSolve `json:"solves"`
+	TeamID      int64              `bun:"team_id" json:"team_id"`
+	TeamName    string             `bun:"team_name" json:"team_name"`
+	DivisionID  int64              `bun:"division_id" json:"division_id"`
+	Country     string             `bun:"country" json:"country"`
+	Affiliation string             `bun:"affiliation" json:"affiliation"`
+	Score       int                `bun:"score" json:"score"`
+	Solves      []LeaderboardSolve `json:"solves"`
+}
+
+// Summed user scores for one country or affiliation
+type GroupLeaderboardEntry struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	MemberCount int    `json:"member_count"`
+	Score       int    `json:"score"`
 }
 
 type LeaderboardChallenge struct {
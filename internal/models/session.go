@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Refresh session stored in Redis, one per login
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int64     `json:"user_id"`
+	RefreshJTI string    `json:"refresh_jti"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
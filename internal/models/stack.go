@@ -7,16 +7,93 @@ import (
 )
 
 type Stack struct {
-	bun.BaseModel `bun:"table:stacks"`
-	ID            int64      `bun:",pk,autoincrement"`
-	UserID        int64      `bun:"user_id,notnull"`
-	ChallengeID   int64      `bun:"challenge_id,notnull"`
-	StackID       string     `bun:"stack_id,notnull"`
-	Status        string     `bun:"status,notnull"`
-	NodePublicIP  *string    `bun:"node_public_ip,nullzero"`
-	NodePort      *int       `bun:"node_port,nullzero"`
-	TargetPort    int        `bun:"target_port,notnull"`
-	TTLExpiresAt  *time.Time `bun:"ttl_expires_at,nullzero"`
-	CreatedAt     time.Time  `bun:",nullzero,notnull,default:current_timestamp"`
-	UpdatedAt     time.Time  `bun:",nullzero,notnull,default:current_timestamp"`
+	bun.BaseModel        `bun:"table:stacks"`
+	ID                   int64      `bun:",pk,autoincrement"`
+	UserID               int64      `bun:"user_id,notnull"`
+	TeamID               int64      `bun:"team_id,notnull,default:0"`
+	ChallengeID          int64      `bun:"challenge_id,notnull"`
+	StackID              string     `bun:"stack_id,notnull"`
+	Status               string     `bun:"status,notnull"`
+	NodePublicIP         *string    `bun:"node_public_ip,nullzero"`
+	NodePort             *int       `bun:"node_port,nullzero"`
+	TargetPort           int        `bun:"target_port,notnull"`
+	TTLExpiresAt         *time.Time `bun:"ttl_expires_at,nullzero"`
+	ExtendCount          int        `bun:"extend_count,notnull,default:0"`
+	RequestedCPUMilli    int        `bun:"requested_cpu_milli,notnull,default:0"`
+	RequestedMemoryBytes int64      `bun:"requested_memory_bytes,notnull,default:0"`
+	LastError            *string    `bun:"last_error,nullzero"`
+	CreatedAt            time.Time  `bun:",nullzero,notnull,default:current_timestamp"`
+	UpdatedAt            time.Time  `bun:",nullzero,notnull,default:current_timestamp"`
+	QueuePosition        int        `bun:"-"`
+}
+
+// Statuses of a row whose instance is not created yet. StackID stays empty until provisioning succeeds.
+const (
+	StackStatusWaiting      = "waiting"
+	StackStatusPending      = "pending"
+	StackStatusProvisioning = "provisioning"
+	StackStatusFailed       = "failed"
+)
+
+func (s *Stack) Provisioned() bool {
+	return s.StackID != ""
+}
+
+// Admin view of a stack. team_id is the sharing team for shared stacks and the owner's team otherwise.
+type StackSummary struct {
+	ID             int64      `bun:"id" json:"id"`
+	StackID        string     `bun:"stack_id" json:"stack_id"`
+	UserID         int64      `bun:"user_id" json:"user_id"`
+	Username       string     `bun:"username" json:"username"`
+	TeamID         int64      `bun:"team_id" json:"team_id"`
+	TeamName       string     `bun:"team_name" json:"team_name"`
+	Shared         bool       `bun:"shared" json:"shared"`
+	ChallengeID    int64      `bun:"challenge_id" json:"challenge_id"`
+	ChallengeTitle string     `bun:"challenge_title" json:"challenge_title"`
+	Status         string     `bun:"status" json:"status"`
+	NodePublicIP   *string    `bun:"node_public_ip" json:"node_public_ip,omitempty"`
+	NodePort       *int       `bun:"node_port" json:"node_port,omitempty"`
+	TargetPort     int        `bun:"target_port" json:"target_port"`
+	TTLExpiresAt   *time.Time `bun:"ttl_expires_at" json:"ttl_expires_at,omitempty"`
+	ExtendCount    int        `bun:"extend_count" json:"extend_count"`
+	LastError      *string    `bun:"last_error" json:"last_error,omitempty"`
+	CreatedAt      time.Time  `bun:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `bun:"updated_at" json:"updated_at"`
+}
+
+// Zero values match everything
+type StackFilter struct {
+	ChallengeID int64
+	UserID      int64
+	TeamID      int64
+	Status      string
+	Limit       int
+	Offset      int
+}
+
+func (f StackFilter) Empty() bool {
+	return f.ChallengeID == 0 && f.UserID == 0 && f.TeamID == 0 && f.Status == ""
+}
+
+type StackCount struct {
+	ChallengeID    int64  `bun:"challenge_id" json:"challenge_id"`
+	ChallengeTitle string `bun:"challenge_title" json:"challenge_title"`
+	Status         string `bun:"status" json:"status"`
+	Count          int    `bun:"count" json:"count"`
+}
+
+// Capacity held by the stacks of one challenge. Waiting and failed rows hold none.
+type StackUsage struct {
+	ChallengeID int64 `bun:"challenge_id"`
+	Count       int   `bun:"count"`
+	CPUMilli    int64 `bun:"cpu_milli"`
+	MemoryBytes int64 `bun:"memory_bytes"`
+}
+
+// Waiting row with the resources its challenge is expected to request
+type WaitingStack struct {
+	ID          int64 `bun:"id"`
+	ChallengeID int64 `bun:"challenge_id"`
+	CPUMilli    int   `bun:"cpu_milli"`
+	MemoryBytes int64 `bun:"memory_bytes"`
 }
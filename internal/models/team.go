@@ -11,15 +11,36 @@ type Team struct {
 	bun.BaseModel `bun:"table:teams"`
 	ID            int64     `bun:",pk,autoincrement"`
 	Name          string    `bun:",unique,notnull"`
+	DivisionID    int64     `bun:"division_id,notnull,default:0"`
+	CaptainID     int64     `bun:"captain_id,notnull,default:0"`
+	Affiliation   string    `bun:"affiliation,notnull,default:''"`
+	Country       string    `bun:"country,notnull,default:''"`
+	Website       string    `bun:"website,notnull,default:''"`
+	Bio           string    `bun:"bio,notnull,default:''"`
 	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 }
 
 type TeamSummary struct {
-	ID          int64     `bun:"id" json:"id"`
-	Name        string    `bun:"name" json:"name"`
-	CreatedAt   time.Time `bun:"created_at" json:"created_at"`
-	MemberCount int       `bun:"member_count" json:"member_count"`
-	TotalScore  int       `bun:"total_score" json:"total_score"`
+	ID           int64     `bun:"id" json:"id"`
+	Name         string    `bun:"name" json:"name"`
+	DivisionID   int64     `bun:"division_id" json:"division_id"`
+	DivisionName string    `bun:"division_name" json:"division_name"`
+	CaptainID    int64     `bun:"captain_id" json:"captain_id"`
+	Affiliation  string    `bun:"affiliation" json:"affiliation"`
+	Country      string    `bun:"country" json:"country"`
+	Website      string    `bun:"website" json:"website"`
+	Bio          string    `bun:"bio" json:"bio"`
+	CreatedAt    time.Time `bun:"created_at" json:"created_at"`
+	MemberCount  int       `bun:"member_count" json:"member_count"`
+	TotalScore   int       `bun:"total_score" json:"total_score"`
+}
+
+// Public profile fields shared by users and teams
+type Profile struct {
+	Affiliation string
+	Country     string
+	Website     string
+	Bio         string
 }
 
 type TeamMember struct {
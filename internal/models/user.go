@@ -16,6 +16,10 @@ type User struct {
 	Role          string    `bun:",notnull"`
 	TeamID        int64     `bun:"team_id,notnull"`
 	TeamName      string    `bun:"team_name,scanonly"`
+	Affiliation   string    `bun:"affiliation,notnull,default:''"`
+	Country       string    `bun:"country,notnull,default:''"`
+	Website       string    `bun:"website,notnull,default:''"`
+	Bio           string    `bun:"bio,notnull,default:''"`
 	CreatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 	UpdatedAt     time.Time `bun:",nullzero,notnull,default:current_timestamp"`
 }
@@ -0,0 +1,141 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"smctf/internal/stack"
+)
+
+var errNoFreePort = errors.New("no free node port")
+
+// Picks the lowest free port of the range. With a backend the port also has to be free on the host.
+func (s *Server) allocatePort(stackID string, targetPort int, inst *instance) (int, error) {
+	for port := s.cfg.PortMin; port <= s.cfg.PortMax; port++ {
+		if s.ports[port] {
+			continue
+		}
+
+		backend, err := s.startBackend(port, stackID, targetPort)
+		if err != nil {
+			continue
+		}
+
+		s.ports[port] = true
+		inst.backend = backend
+		inst.holdsPort = true
+		return port, nil
+	}
+
+	return 0, errNoFreePort
+}
+
+// Frees the node port, the instance keeps reporting it until it is removed
+func (s *Server) stopBackend(inst *instance) {
+	if inst.backend != nil {
+		_ = inst.backend.Close()
+		inst.backend = nil
+	}
+
+	if inst.holdsPort {
+		delete(s.ports, inst.info.NodePort)
+		inst.holdsPort = false
+	}
+}
+
+func (s *Server) startBackend(port int, stackID string, targetPort int) (io.Closer, error) {
+	if s.cfg.Backend == BackendNone {
+		return nil, nil
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.cfg.BindAddr, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.Backend == BackendHTTP {
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = fmt.Fprintf(w, "%s: %s %s (target port %d)\n", stackID, r.Method, r.URL.Path, targetPort)
+		})}
+
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("provisioner backend %s error: %v", stackID, err)
+			}
+		}()
+
+		return server, nil
+	}
+
+	go serveEcho(listener)
+	return listener, nil
+}
+
+func serveEcho(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}()
+	}
+}
+
+// Sums the requests of the regular containers, falling back to their limits like the scheduler does
+func requestedResources(spec *stack.PodSpec) (int, int64) {
+	cpuMilli, memoryBytes := 0, int64(0)
+	for _, container := range spec.Containers {
+		cpu, memory := container.Resources.Requests["cpu"], container.Resources.Requests["memory"]
+		if cpu == "" {
+			cpu = container.Resources.Limits["cpu"]
+		}
+
+		if memory == "" {
+			memory = container.Resources.Limits["memory"]
+		}
+
+		cpuMilli += int(parseQuantity(cpu) * 1000)
+		memoryBytes += int64(parseQuantity(memory))
+	}
+
+	return cpuMilli, memoryBytes
+}
+
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"m", 1e-3}, {"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// Approximates a Kubernetes quantity, anything unparsable counts as zero
+func parseQuantity(value string) float64 {
+	value = strings.TrimSpace(value)
+	multiplier := 1.0
+	for _, unit := range quantitySuffixes {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		return 0
+	}
+
+	return parsed * multiplier
+}
@@ -0,0 +1,527 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"smctf/internal/stack"
+)
+
+// Reference implementation of the provisioner API spoken by stack.Client, for local development and tests.
+// Everything lives in memory and is lost on restart.
+type Config struct {
+	APIKey         string
+	PublicIP       string
+	BindAddr       string
+	PortMin        int
+	PortMax        int
+	DefaultTTL     time.Duration
+	StartDelay     time.Duration
+	FailureRate    float64
+	Backend        string
+	CallbackURL    string
+	CallbackSecret string
+}
+
+const (
+	BackendNone = ""
+	BackendEcho = "echo"
+	BackendHTTP = "http"
+)
+
+const (
+	StatusCreating    = "creating"
+	StatusRunning     = "running"
+	StatusStopped     = "stopped"
+	StatusFailed      = "failed"
+	StatusNodeDeleted = "node_deleted"
+)
+
+const (
+	defaultPublicIP  = "127.0.0.1"
+	defaultPortMin   = 31000
+	defaultPortMax   = 31999
+	defaultTTL       = 2 * time.Hour
+	stoppedRetention = time.Minute
+	sweepInterval    = time.Second
+	callbackTimeout  = 5 * time.Second
+	maxRequestBytes  = 1 << 20
+)
+
+type instance struct {
+	info      stack.StackInfo
+	readyAt   time.Time
+	stoppedAt time.Time
+	backend   io.Closer
+	holdsPort bool
+}
+
+type Server struct {
+	cfg        Config
+	mux        *http.ServeMux
+	now        func() time.Time
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	stacks map[string]*instance
+	keys   map[string]string
+	ports  map[int]bool
+}
+
+func New(cfg Config) (*Server, error) {
+	if cfg.PublicIP == "" {
+		cfg.PublicIP = defaultPublicIP
+	}
+
+	if cfg.BindAddr == "" {
+		cfg.BindAddr = defaultPublicIP
+	}
+
+	if cfg.PortMin == 0 && cfg.PortMax == 0 {
+		cfg.PortMin, cfg.PortMax = defaultPortMin, defaultPortMax
+	}
+
+	if cfg.DefaultTTL == 0 {
+		cfg.DefaultTTL = defaultTTL
+	}
+
+	switch {
+	case cfg.PortMin <= 0 || cfg.PortMax > 65535 || cfg.PortMin > cfg.PortMax:
+		return nil, fmt.Errorf("provisioner: invalid port range %d-%d", cfg.PortMin, cfg.PortMax)
+	case cfg.DefaultTTL < 0 || cfg.StartDelay < 0:
+		return nil, errors.New("provisioner: durations must not be negative")
+	case cfg.FailureRate < 0 || cfg.FailureRate > 1:
+		return nil, errors.New("provisioner: failure rate must be between 0 and 1")
+	case cfg.Backend != BackendNone && cfg.Backend != BackendEcho && cfg.Backend != BackendHTTP:
+		return nil, fmt.Errorf("provisioner: unknown backend %q", cfg.Backend)
+	case cfg.CallbackURL != "" && cfg.CallbackSecret == "":
+		return nil, errors.New("provisioner: callback url needs a callback secret")
+	}
+
+	s := &Server{
+		cfg:        cfg,
+		mux:        http.NewServeMux(),
+		now:        time.Now,
+		httpClient: &http.Client{Timeout: callbackTimeout},
+		stacks:     make(map[string]*instance),
+		keys:       make(map[string]string),
+		ports:      make(map[int]bool),
+	}
+
+	s.mux.HandleFunc("POST /stacks", s.createStack)
+	s.mux.HandleFunc("GET /stacks", s.listStacks)
+	s.mux.HandleFunc("GET /stacks/{id}", s.getStack)
+	s.mux.HandleFunc("DELETE /stacks/{id}", s.deleteStack)
+	s.mux.HandleFunc("GET /stacks/{id}/status", s.getStackStatus)
+	s.mux.HandleFunc("POST /stacks/{id}/extend", s.extendStack)
+	s.mux.HandleFunc("POST /stacks/{id}/restart", s.restartStack)
+	s.mux.HandleFunc("POST /debug/stacks/{id}/status", s.forceStatus)
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.APIKey != "" && r.Header.Get("X-API-KEY") != s.cfg.APIKey {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "invalid api key", nil)
+		return
+	}
+
+	s.sync()
+	s.mux.ServeHTTP(w, r)
+}
+
+// Applies due status transitions every second until ctx is done, so callbacks and TTL expiry happen without requests
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sync()
+		}
+	}
+}
+
+// Stops every backend listener
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, inst := range s.stacks {
+		s.stopBackend(inst)
+	}
+}
+
+// Number of stacks the provisioner still knows, stopped ones included
+func (s *Server) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.stacks)
+}
+
+func (s *Server) createStack(w http.ResponseWriter, r *http.Request) {
+	var req stack.CreateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid json", nil)
+		return
+	}
+
+	if req.TargetPort < 1 || req.TargetPort > 65535 {
+		writeError(w, http.StatusBadRequest, "invalid_request", "target_port must be between 1 and 65535", nil)
+		return
+	}
+
+	spec, err := stack.ParsePodSpec(req.PodSpec)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_spec", err.Error(), nil)
+		return
+	}
+
+	if !spec.ExposesPort(req.TargetPort) {
+		writeError(w, http.StatusUnprocessableEntity, "invalid_spec", "target port is not exposed by the pod spec", map[string]int{"target_port": req.TargetPort})
+		return
+	}
+
+	key := r.Header.Get("Idempotency-Key")
+	now := s.now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key != "" {
+		if inst, ok := s.stacks[s.keys[key]]; ok {
+			writeJSON(w, http.StatusOK, inst.info)
+			return
+		}
+	}
+
+	if s.cfg.FailureRate > 0 && rand.Float64() < s.cfg.FailureRate {
+		writeError(w, http.StatusServiceUnavailable, "simulated_failure", "simulated provisioner failure", nil)
+		return
+	}
+
+	stackID := fmt.Sprintf("stack-%08x", rand.Uint32())
+	for s.stacks[stackID] != nil {
+		stackID = fmt.Sprintf("stack-%08x", rand.Uint32())
+	}
+
+	inst := &instance{readyAt: now.Add(s.cfg.StartDelay)}
+	port, err := s.allocatePort(stackID, req.TargetPort, inst)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "no_capacity", err.Error(), nil)
+		return
+	}
+
+	cpuMilli, memoryBytes := requestedResources(spec)
+	inst.info = stack.StackInfo{
+		StackID:              stackID,
+		PodID:                stackID + "-pod",
+		Namespace:            "stacks",
+		NodeID:               "local",
+		NodePublicIP:         s.cfg.PublicIP,
+		PodSpec:              req.PodSpec,
+		TargetPort:           req.TargetPort,
+		NodePort:             port,
+		ServiceName:          "svc-" + stackID,
+		Status:               StatusCreating,
+		TTLExpiresAt:         now.Add(s.cfg.DefaultTTL),
+		CreatedAt:            now,
+		UpdatedAt:            now,
+		RequestedCPUMilli:    cpuMilli,
+		RequestedMemoryBytes: int(memoryBytes),
+	}
+
+	if s.cfg.StartDelay == 0 {
+		inst.info.Status = StatusRunning
+	}
+
+	s.stacks[stackID] = inst
+	if key != "" {
+		s.keys[key] = stackID
+	}
+
+	writeJSON(w, http.StatusCreated, inst.info)
+}
+
+func (s *Server) listStacks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stacks := make([]stack.StackInfo, 0, len(s.stacks))
+	for _, inst := range s.stacks {
+		stacks = append(stacks, inst.info)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"stacks": stacks})
+}
+
+func (s *Server) getStack(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, inst.info)
+}
+
+func (s *Server) getStackStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, statusOf(inst))
+}
+
+func (s *Server) deleteStack(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	s.stopBackend(inst)
+	delete(s.stacks, inst.info.StackID)
+
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": true, "stack_id": inst.info.StackID})
+}
+
+func (s *Server) extendStack(w http.ResponseWriter, r *http.Request) {
+	var req stack.ExtendRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid json", nil)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.lookupActive(w, r)
+	if !ok {
+		return
+	}
+
+	if !req.TTLExpiresAt.After(s.now()) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "ttl_expires_at must be in the future", nil)
+		return
+	}
+
+	inst.info.TTLExpiresAt = req.TTLExpiresAt.UTC()
+	inst.info.UpdatedAt = s.now().UTC()
+
+	writeJSON(w, http.StatusOK, statusOf(inst))
+}
+
+// Goes through creating again for StartDelay, the node port is kept
+func (s *Server) restartStack(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.lookupActive(w, r)
+	if !ok {
+		return
+	}
+
+	now := s.now().UTC()
+	inst.readyAt = now.Add(s.cfg.StartDelay)
+	inst.info.Status = StatusRunning
+	if s.cfg.StartDelay > 0 {
+		inst.info.Status = StatusCreating
+	}
+	inst.info.UpdatedAt = now
+
+	writeJSON(w, http.StatusOK, statusOf(inst))
+}
+
+// Not part of the provisioner API. Lets developers push a stack into any status, e.g. failed or node_deleted.
+func (s *Server) forceStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil || req.Status == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "status is required", nil)
+		return
+	}
+
+	s.mu.Lock()
+	inst, ok := s.lookup(w, r)
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+
+	changed := s.setStatus(inst, req.Status, s.now().UTC())
+	status := statusOf(inst)
+	s.mu.Unlock()
+
+	if changed {
+		s.notify([]stack.StackStatus{status})
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*instance, bool) {
+	inst, ok := s.stacks[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "stack not found", nil)
+		return nil, false
+	}
+
+	return inst, true
+}
+
+// Stopped stacks are only kept so their final status can be read
+func (s *Server) lookupActive(w http.ResponseWriter, r *http.Request) (*instance, bool) {
+	inst, ok := s.lookup(w, r)
+	if ok && terminal(inst.info.Status) {
+		writeError(w, http.StatusNotFound, "not_found", "stack not found", nil)
+		return nil, false
+	}
+
+	return inst, ok
+}
+
+// Applies the transitions that are due and reports them to the callback url
+func (s *Server) sync() {
+	s.mu.Lock()
+	changed := s.advance(s.now().UTC())
+	s.mu.Unlock()
+
+	s.notify(changed)
+}
+
+func (s *Server) advance(now time.Time) []stack.StackStatus {
+	changed := make([]stack.StackStatus, 0)
+	for id, inst := range s.stacks {
+		switch {
+		case terminal(inst.info.Status):
+			if now.Sub(inst.stoppedAt) >= stoppedRetention {
+				delete(s.stacks, id)
+			}
+			continue
+		case !now.Before(inst.info.TTLExpiresAt):
+			s.setStatus(inst, StatusStopped, now)
+		case inst.info.Status == StatusCreating && !now.Before(inst.readyAt):
+			s.setStatus(inst, StatusRunning, now)
+		default:
+			continue
+		}
+
+		changed = append(changed, statusOf(inst))
+	}
+
+	return changed
+}
+
+func (s *Server) setStatus(inst *instance, status string, now time.Time) bool {
+	if inst.info.Status == status {
+		return false
+	}
+
+	inst.info.Status = status
+	inst.info.UpdatedAt = now
+	if terminal(status) {
+		inst.stoppedAt = now
+		s.stopBackend(inst)
+	}
+
+	return true
+}
+
+// Sends signed status callbacks in the background, delivery is best effort like a real provisioner's
+func (s *Server) notify(statuses []stack.StackStatus) {
+	if s.cfg.CallbackURL == "" || len(statuses) == 0 {
+		return
+	}
+
+	go func() {
+		for _, status := range statuses {
+			if err := s.sendCallback(status); err != nil {
+				log.Printf("provisioner callback %s error: %v", status.StackID, err)
+			}
+		}
+	}()
+}
+
+func (s *Server) sendCallback(status stack.StackStatus) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, s.cfg.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Stack-Timestamp", timestamp)
+	req.Header.Set("X-Stack-Signature", stack.SignCallback(s.cfg.CallbackSecret, timestamp, body))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func statusOf(inst *instance) stack.StackStatus {
+	return stack.StackStatus{
+		StackID:      inst.info.StackID,
+		Status:       inst.info.Status,
+		TTL:          inst.info.TTLExpiresAt,
+		NodePort:     inst.info.NodePort,
+		TargetPort:   inst.info.TargetPort,
+		NodePublicIP: inst.info.NodePublicIP,
+	}
+}
+
+func terminal(status string) bool {
+	return status == StatusStopped || status == StatusFailed || status == StatusNodeDeleted
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// Uses the error body stack.Client decodes into stack.APIError
+func writeError(w http.ResponseWriter, status int, code, message string, details any) {
+	body := map[string]any{"error": message, "code": code}
+	if details != nil {
+		body["details"] = details
+	}
+
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,405 @@
+package provisioner
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"smctf/internal/stack"
+)
+
+const testPodSpec = `apiVersion: v1
+kind: Pod
+spec:
+  containers:
+    - name: app
+      image: nginx:stable
+      ports:
+        - containerPort: 80
+      resources:
+        requests:
+          cpu: 250m
+          memory: 64Mi
+        limits:
+          cpu: 500m
+          memory: 128Mi
+`
+
+type testEnv struct {
+	server *Server
+	client *stack.Client
+	clock  *testClock
+	url    string
+}
+
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestProvisioner(t *testing.T, cfg Config) testEnv {
+	t.Helper()
+
+	if cfg.APIKey == "" {
+		cfg.APIKey = "test-key"
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	clock := &testClock{now: time.Date(2026, 2, 10, 2, 0, 0, 0, time.UTC)}
+	server.now = clock.Now
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Close()
+	})
+
+	return testEnv{
+		server: server,
+		client: stack.NewClient(httpServer.URL, cfg.APIKey, 2*time.Second, stack.ClientPolicy{}),
+		clock:  clock,
+		url:    httpServer.URL,
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	cases := []Config{
+		{PortMin: 32000, PortMax: 31000},
+		{FailureRate: 1.5},
+		{Backend: "ssh"},
+		{CallbackURL: "http://localhost:8080/internal/stacks/callback"},
+		{StartDelay: -time.Second},
+	}
+
+	for _, cfg := range cases {
+		if _, err := New(cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestProvisionerLifecycle(t *testing.T) {
+	env := newTestProvisioner(t, Config{StartDelay: 3 * time.Second, DefaultTTL: time.Hour})
+	ctx := context.Background()
+
+	info, err := env.client.CreateStack(ctx, 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	if info.Status != StatusCreating || info.NodePort != defaultPortMin || info.NodePublicIP != "127.0.0.1" || info.TargetPort != 80 {
+		t.Fatalf("unexpected stack %+v", info)
+	}
+
+	if info.RequestedCPUMilli != 250 || info.RequestedMemoryBytes != 64<<20 {
+		t.Fatalf("unexpected requested resources %d %d", info.RequestedCPUMilli, info.RequestedMemoryBytes)
+	}
+
+	env.clock.Add(3 * time.Second)
+	status, err := env.client.GetStackStatus(ctx, info.StackID)
+	if err != nil {
+		t.Fatalf("GetStackStatus: %v", err)
+	}
+
+	if status.Status != StatusRunning || !status.TTL.Equal(info.TTLExpiresAt) {
+		t.Fatalf("expected running stack, got %+v", status)
+	}
+
+	extended, err := env.client.ExtendStack(ctx, info.StackID, info.TTLExpiresAt.Add(30*time.Minute))
+	if err != nil {
+		t.Fatalf("ExtendStack: %v", err)
+	}
+
+	if !extended.TTL.Equal(info.TTLExpiresAt.Add(30 * time.Minute)) {
+		t.Fatalf("unexpected ttl %v", extended.TTL)
+	}
+
+	restarted, err := env.client.RestartStack(ctx, info.StackID)
+	if err != nil {
+		t.Fatalf("RestartStack: %v", err)
+	}
+
+	if restarted.Status != StatusCreating || restarted.NodePort != info.NodePort {
+		t.Fatalf("unexpected restarted stack %+v", restarted)
+	}
+
+	if err := env.client.DeleteStack(ctx, info.StackID); err != nil {
+		t.Fatalf("DeleteStack: %v", err)
+	}
+
+	if _, err := env.client.GetStackStatus(ctx, info.StackID); !errors.Is(err, stack.ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if err := env.client.DeleteStack(ctx, info.StackID); !errors.Is(err, stack.ErrNotFound) {
+		t.Fatalf("expected not found on second delete, got %v", err)
+	}
+
+	if env.server.Count() != 0 {
+		t.Fatalf("expected no stacks, got %d", env.server.Count())
+	}
+
+	// The freed node port is handed out again
+	again, err := env.client.CreateStack(ctx, 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	if again.NodePort != info.NodePort {
+		t.Fatalf("expected node port %d to be reused, got %d", info.NodePort, again.NodePort)
+	}
+}
+
+func TestProvisionerTTLExpiry(t *testing.T) {
+	env := newTestProvisioner(t, Config{DefaultTTL: time.Minute})
+	ctx := context.Background()
+
+	info, err := env.client.CreateStack(ctx, 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	if info.Status != StatusRunning {
+		t.Fatalf("expected running without start delay, got %q", info.Status)
+	}
+
+	env.clock.Add(time.Minute)
+	status, err := env.client.GetStackStatus(ctx, info.StackID)
+	if err != nil {
+		t.Fatalf("GetStackStatus: %v", err)
+	}
+
+	if status.Status != StatusStopped {
+		t.Fatalf("expected stopped stack, got %q", status.Status)
+	}
+
+	if _, err := env.client.ExtendStack(ctx, info.StackID, env.clock.Now().Add(time.Hour)); !errors.Is(err, stack.ErrNotFound) {
+		t.Fatalf("expected stopped stack to refuse extend, got %v", err)
+	}
+
+	env.clock.Add(stoppedRetention)
+	if _, err := env.client.GetStackStatus(ctx, info.StackID); !errors.Is(err, stack.ErrNotFound) {
+		t.Fatalf("expected stopped stack to be purged, got %v", err)
+	}
+
+	if env.server.Count() != 0 {
+		t.Fatalf("expected no stacks, got %d", env.server.Count())
+	}
+}
+
+func TestProvisionerIdempotencyKey(t *testing.T) {
+	env := newTestProvisioner(t, Config{})
+
+	ctx := stack.WithIdempotencyKey(context.Background(), "stack-1-1")
+	first, err := env.client.CreateStack(ctx, 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	second, err := env.client.CreateStack(ctx, 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	if first.StackID != second.StackID || env.server.Count() != 1 {
+		t.Fatalf("expected the same stack, got %s and %s (%d stacks)", first.StackID, second.StackID, env.server.Count())
+	}
+
+	other, err := env.client.CreateStack(context.Background(), 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	if other.StackID == first.StackID || other.NodePort == first.NodePort {
+		t.Fatalf("expected a new stack, got %+v", other)
+	}
+}
+
+func TestProvisionerErrors(t *testing.T) {
+	env := newTestProvisioner(t, Config{FailureRate: 1, PortMin: 31000, PortMax: 31000})
+	ctx := context.Background()
+
+	_, err := env.client.CreateStack(ctx, 8080, testPodSpec)
+	var apiErr *stack.APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, stack.ErrInvalid) || apiErr.Code != "invalid_spec" || string(apiErr.Details) != `{"target_port":8080}` {
+		t.Fatalf("expected invalid spec, got %v", err)
+	}
+
+	if _, err := env.client.CreateStack(ctx, 80, "kind: Service"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected invalid spec, got %v", err)
+	}
+
+	if _, err := env.client.CreateStack(ctx, 80, testPodSpec); !errors.As(err, &apiErr) || !errors.Is(err, stack.ErrUnavailable) || apiErr.Code != "simulated_failure" {
+		t.Fatalf("expected simulated failure, got %v", err)
+	}
+
+	wrongKey := stack.NewClient(env.url, "wrong", time.Second, stack.ClientPolicy{})
+	if _, err := wrongKey.GetStackStatus(ctx, "stack-1"); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+}
+
+func TestProvisionerPortExhaustion(t *testing.T) {
+	env := newTestProvisioner(t, Config{PortMin: 31000, PortMax: 31000})
+	ctx := context.Background()
+
+	if _, err := env.client.CreateStack(ctx, 80, testPodSpec); err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	var apiErr *stack.APIError
+	if _, err := env.client.CreateStack(ctx, 80, testPodSpec); !errors.As(err, &apiErr) || apiErr.Code != "no_capacity" {
+		t.Fatalf("expected no capacity, got %v", err)
+	}
+}
+
+func TestProvisionerEchoBackend(t *testing.T) {
+	port := freePort(t)
+	env := newTestProvisioner(t, Config{Backend: BackendEcho, PortMin: port, PortMax: port})
+	ctx := context.Background()
+
+	info, err := env.client.CreateStack(ctx, 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(info.NodePublicIP, strconv.Itoa(info.NodePort)))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("expected echo, got %q (%v)", line, err)
+	}
+
+	if err := env.client.DeleteStack(ctx, info.StackID); err != nil {
+		t.Fatalf("DeleteStack: %v", err)
+	}
+
+	if conn, err := net.Dial("tcp", net.JoinHostPort(info.NodePublicIP, strconv.Itoa(info.NodePort))); err == nil {
+		conn.Close()
+		t.Fatal("expected the backend to be closed after delete")
+	}
+}
+
+func TestProvisionerHTTPBackend(t *testing.T) {
+	port := freePort(t)
+	env := newTestProvisioner(t, Config{Backend: BackendHTTP, PortMin: port, PortMax: port})
+
+	info, err := env.client.CreateStack(context.Background(), 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	resp, err := http.Get("http://" + net.JoinHostPort(info.NodePublicIP, strconv.Itoa(info.NodePort)) + "/hello")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), info.StackID) || !strings.Contains(string(body), "/hello") {
+		t.Fatalf("unexpected backend response %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestProvisionerCallbacks(t *testing.T) {
+	received := make(chan string, 4)
+	callbacks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get("X-Stack-Timestamp")
+		if r.Header.Get("X-Stack-Signature") != stack.SignCallback("callback-secret", timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			received <- "bad signature"
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		received <- string(body)
+	}))
+	defer callbacks.Close()
+
+	env := newTestProvisioner(t, Config{StartDelay: time.Second, CallbackURL: callbacks.URL, CallbackSecret: "callback-secret"})
+
+	info, err := env.client.CreateStack(context.Background(), 80, testPodSpec)
+	if err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	env.clock.Add(time.Second)
+	env.server.sync()
+
+	select {
+	case body := <-received:
+		if !strings.Contains(body, `"stack_id":"`+info.StackID+`"`) || !strings.Contains(body, `"status":"running"`) {
+			t.Fatalf("unexpected callback %s", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a running callback")
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, env.url+"/debug/stacks/"+info.StackID+"/status", strings.NewReader(`{"status":"node_deleted"}`))
+	req.Header.Set("X-API-KEY", "test-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("force status: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("force status code %d", resp.StatusCode)
+	}
+
+	select {
+	case body := <-received:
+		if !strings.Contains(body, `"status":"node_deleted"`) {
+			t.Fatalf("unexpected callback %s", body)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a node_deleted callback")
+	}
+}
@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"smctf/internal/models"
+
+	"github.com/uptrace/bun"
+)
+
+type APITokenRepo struct {
+	db *bun.DB
+}
+
+func NewAPITokenRepo(db *bun.DB) *APITokenRepo {
+	return &APITokenRepo{db: db}
+}
+
+func (r *APITokenRepo) Create(ctx context.Context, token *models.APIToken) error {
+	if _, err := r.db.NewInsert().Model(token).Exec(ctx); err != nil {
+		return wrapError("apiTokenRepo.Create", err)
+	}
+
+	return nil
+}
+
+func (r *APITokenRepo) GetByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	token := new(models.APIToken)
+	if err := r.db.NewSelect().
+		Model(token).
+		Where("token_hash = ?", hash).
+		Scan(ctx); err != nil {
+		return nil, wrapNotFound("apiTokenRepo.GetByHash", err)
+	}
+
+	return token, nil
+}
+
+func (r *APITokenRepo) GetByID(ctx context.Context, id int64) (*models.APIToken, error) {
+	token := new(models.APIToken)
+	if err := r.db.NewSelect().
+		Model(token).
+		Where("id = ?", id).
+		Scan(ctx); err != nil {
+		return nil, wrapNotFound("apiTokenRepo.GetByID", err)
+	}
+
+	return token, nil
+}
+
+func (r *APITokenRepo) ListByUser(ctx context.Context, userID int64) ([]models.APIToken, error) {
+	tokens := make([]models.APIToken, 0)
+	if err := r.db.NewSelect().
+		Model(&tokens).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Order("id DESC").
+		Scan(ctx); err != nil {
+		return nil, wrapError("apiTokenRepo.ListByUser", err)
+	}
+
+	return tokens, nil
+}
+
+func (r *APITokenRepo) CountActiveByUser(ctx context.Context, userID int64) (int, error) {
+	count, err := r.db.NewSelect().
+		Model((*models.APIToken)(nil)).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Count(ctx)
+	if err != nil {
+		return 0, wrapError("apiTokenRepo.CountActiveByUser", err)
+	}
+
+	return count, nil
+}
+
+func (r *APITokenRepo) Revoke(ctx context.Context, id int64, revokedAt time.Time) error {
+	if _, err := r.db.NewUpdate().
+		Model((*models.APIToken)(nil)).
+		Set("revoked_at = ?", revokedAt).
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Exec(ctx); err != nil {
+		return wrapError("apiTokenRepo.Revoke", err)
+	}
+
+	return nil
+}
+
+// Revokes every active token of the user and returns how many there were
+func (r *APITokenRepo) RevokeByUser(ctx context.Context, userID int64, revokedAt time.Time) (int, error) {
+	res, err := r.db.NewUpdate().
+		Model((*models.APIToken)(nil)).
+		Set("revoked_at = ?", revokedAt).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return 0, wrapError("apiTokenRepo.RevokeByUser", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, wrapError("apiTokenRepo.RevokeByUser", err)
+	}
+
+	return int(n), nil
+}
+
+func (r *APITokenRepo) TouchLastUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	if _, err := r.db.NewUpdate().
+		Model((*models.APIToken)(nil)).
+		Set("last_used_at = ?", usedAt).
+		Where("id = ?", id).
+		Exec(ctx); err != nil {
+		return wrapError("apiTokenRepo.TouchLastUsed", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"smctf/internal/models"
+)
+
+func TestAPITokenRepoCRUD(t *testing.T) {
+	env := setupRepoTest(t)
+	user := createUser(t, env, "user@example.com", "user", "pass", "user")
+
+	token := &models.APIToken{
+		UserID:    user.ID,
+		Name:      "bot",
+		TokenHash: "hash-1",
+		Prefix:    "smctf_abcdef",
+		Scopes:    []string{models.ScopeRead, models.ScopeSubmit},
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := env.apiTokenRepo.Create(context.Background(), token); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := env.apiTokenRepo.GetByHash(context.Background(), "hash-1")
+	if err != nil {
+		t.Fatalf("GetByHash: %v", err)
+	}
+
+	if got.ID != token.ID || len(got.Scopes) != 2 || got.Scopes[1] != models.ScopeSubmit {
+		t.Fatalf("unexpected token: %+v", got)
+	}
+
+	usedAt := time.Now().UTC()
+	if err := env.apiTokenRepo.TouchLastUsed(context.Background(), token.ID, usedAt); err != nil {
+		t.Fatalf("TouchLastUsed: %v", err)
+	}
+
+	count, err := env.apiTokenRepo.CountActiveByUser(context.Background(), user.ID)
+	if err != nil || count != 1 {
+		t.Fatalf("CountActiveByUser: count %d err %v", count, err)
+	}
+
+	if err := env.apiTokenRepo.Revoke(context.Background(), token.ID, time.Now().UTC()); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	got, err = env.apiTokenRepo.GetByID(context.Background(), token.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if got.RevokedAt == nil || got.LastUsedAt == nil {
+		t.Fatalf("expected revoked and used token, got %+v", got)
+	}
+
+	rows, err := env.apiTokenRepo.ListByUser(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+
+	if len(rows) != 0 {
+		t.Fatalf("expected revoked token hidden, got %d", len(rows))
+	}
+
+	if _, err := env.apiTokenRepo.GetByHash(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAPITokenRepoRevokeByUser(t *testing.T) {
+	env := setupRepoTest(t)
+	user := createUser(t, env, "user@example.com", "user", "pass", "user")
+	other := createUser(t, env, "other@example.com", "other", "pass", "user")
+
+	for i, owner := range []int64{user.ID, user.ID, other.ID} {
+		token := &models.APIToken{UserID: owner, Name: "bot", TokenHash: fmt.Sprintf("hash-%d", i), Prefix: "smctf_abcdef", Scopes: []string{models.ScopeRead}, CreatedAt: time.Now().UTC()}
+		if err := env.apiTokenRepo.Create(context.Background(), token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	revoked, err := env.apiTokenRepo.RevokeByUser(context.Background(), user.ID, time.Now().UTC())
+	if err != nil || revoked != 2 {
+		t.Fatalf("RevokeByUser: revoked %d err %v", revoked, err)
+	}
+
+	if revoked, err := env.apiTokenRepo.RevokeByUser(context.Background(), user.ID, time.Now().UTC()); err != nil || revoked != 0 {
+		t.Fatalf("expected nothing left to revoke, revoked %d err %v", revoked, err)
+	}
+
+	if count, err := env.apiTokenRepo.CountActiveByUser(context.Background(), other.ID); err != nil || count != 1 {
+		t.Fatalf("expected other user untouched, count %d err %v", count, err)
+	}
+}
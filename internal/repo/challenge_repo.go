@@ -55,6 +55,20 @@ func (r *ChallengeRepo) Update(ctx context.Context, challenge *models.Challenge)
 	return nil
 }
 
+// Records what the last stack instance requested so later ones can be admitted against the capacity limits
+func (r *ChallengeRepo) UpdateStackUsage(ctx context.Context, id int64, cpuMilli int, memoryBytes int64) error {
+	if _, err := r.db.NewUpdate().
+		Model((*models.Challenge)(nil)).
+		Set("stack_cpu_milli = ?", cpuMilli).
+		Set("stack_memory_bytes = ?", memoryBytes).
+		Where("id = ?", id).
+		Exec(ctx); err != nil {
+		return wrapError("challengeRepo.UpdateStackUsage", err)
+	}
+
+	return nil
+}
+
 func (r *ChallengeRepo) Delete(ctx context.Context, challenge *models.Challenge) error {
 	if _, err := r.db.NewDelete().Model(challenge).WherePK().Exec(ctx); err != nil {
 		return wrapError("challengeRepo.Delete", err)
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"context"
+
+	"smctf/internal/models"
+
+	"github.com/uptrace/bun"
+)
+
+type DivisionRepo struct {
+	db *bun.DB
+}
+
+func NewDivisionRepo(db *bun.DB) *DivisionRepo {
+	return &DivisionRepo{db: db}
+}
+
+func (r *DivisionRepo) Create(ctx context.Context, division *models.Division) error {
+	if _, err := r.db.NewInsert().Model(division).Exec(ctx); err != nil {
+		return wrapError("divisionRepo.Create", err)
+	}
+
+	return nil
+}
+
+func (r *DivisionRepo) GetByID(ctx context.Context, id int64) (*models.Division, error) {
+	division := new(models.Division)
+	if err := r.db.NewSelect().Model(division).Where("id = ?", id).Scan(ctx); err != nil {
+		return nil, wrapNotFound("divisionRepo.GetByID", err)
+	}
+
+	return division, nil
+}
+
+func (r *DivisionRepo) List(ctx context.Context) ([]models.DivisionSummary, error) {
+	rows := make([]models.DivisionSummary, 0)
+	if err := r.db.NewSelect().
+		TableExpr("divisions AS d").
+		ColumnExpr("d.id AS id").
+		ColumnExpr("d.name AS name").
+		ColumnExpr("d.created_at AS created_at").
+		ColumnExpr("COUNT(t.id) AS team_count").
+		Join("LEFT JOIN teams AS t ON t.division_id = d.id").
+		GroupExpr("d.id, d.name, d.created_at").
+		OrderExpr("d.name ASC, d.id ASC").
+		Scan(ctx, &rows); err != nil {
+		return nil, wrapError("divisionRepo.List", err)
+	}
+
+	return rows, nil
+}
+
+// Teams and registration keys in the division are left without one
+func (r *DivisionRepo) Delete(ctx context.Context, id int64) error {
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().Model((*models.Division)(nil)).Where("id = ?", id).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.NewUpdate().
+			Model((*models.Team)(nil)).
+			Set("division_id = 0").
+			Where("division_id = ?", id).
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.RegistrationKey)(nil)).
+			Set("division_id = 0").
+			Where("division_id = ?", id).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return wrapNotFound("divisionRepo.Delete", err)
+	}
+
+	return nil
+}
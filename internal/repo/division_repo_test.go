@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"smctf/internal/models"
+)
+
+func TestDivisionRepoListCountsTeams(t *testing.T) {
+	env := setupRepoTest(t)
+	highSchool := createDivision(t, env, "High School")
+	open := createDivision(t, env, "Open")
+	_ = createTeamInDivision(t, env, "Alpha", highSchool.ID)
+	_ = createTeamInDivision(t, env, "Beta", highSchool.ID)
+	_ = createTeam(t, env, "Gamma")
+
+	rows, err := env.divisionRepo.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(rows) != 2 || rows[0].ID != highSchool.ID || rows[1].ID != open.ID {
+		t.Fatalf("unexpected divisions: %+v", rows)
+	}
+
+	if rows[0].TeamCount != 2 || rows[1].TeamCount != 0 {
+		t.Fatalf("unexpected team counts: %+v", rows)
+	}
+}
+
+func TestDivisionRepoDeleteClearsTeamsAndKeys(t *testing.T) {
+	env := setupRepoTest(t)
+	division := createDivision(t, env, "University")
+	team := createTeamInDivision(t, env, "Alpha", division.ID)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+
+	key := &models.RegistrationKey{
+		Code:       "123456",
+		CreatedBy:  admin.ID,
+		TeamID:     team.ID,
+		DivisionID: division.ID,
+		MaxUses:    1,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := env.regKeyRepo.Create(context.Background(), key); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	if err := env.divisionRepo.Delete(context.Background(), division.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	stored, err := env.teamRepo.GetByID(context.Background(), team.ID)
+	if err != nil {
+		t.Fatalf("get team: %v", err)
+	}
+
+	if stored.DivisionID != 0 {
+		t.Fatalf("expected team division cleared, got %d", stored.DivisionID)
+	}
+
+	storedKey, err := env.regKeyRepo.GetByCodeForUpdate(context.Background(), env.db, key.Code)
+	if err != nil {
+		t.Fatalf("get key: %v", err)
+	}
+
+	if storedKey.DivisionID != 0 {
+		t.Fatalf("expected key division cleared, got %d", storedKey.DivisionID)
+	}
+
+	if err := env.divisionRepo.Delete(context.Background(), division.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"context"
+
+	"smctf/internal/models"
+
+	"github.com/uptrace/bun"
+)
+
+type LoginFailureRepo struct {
+	db *bun.DB
+}
+
+func NewLoginFailureRepo(db *bun.DB) *LoginFailureRepo {
+	return &LoginFailureRepo{db: db}
+}
+
+func (r *LoginFailureRepo) Create(ctx context.Context, failure *models.LoginFailure) error {
+	if _, err := r.db.NewInsert().Model(failure).Exec(ctx); err != nil {
+		return wrapError("loginFailureRepo.Create", err)
+	}
+
+	return nil
+}
+
+// Empty email or ip match every row
+func (r *LoginFailureRepo) List(ctx context.Context, email, ip string, limit int) ([]models.LoginFailure, error) {
+	failures := make([]models.LoginFailure, 0)
+	query := r.db.NewSelect().
+		Model(&failures).
+		Order("id DESC").
+		Limit(limit)
+
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+
+	if ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, wrapError("loginFailureRepo.List", err)
+	}
+
+	return failures, nil
+}
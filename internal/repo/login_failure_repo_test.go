@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"smctf/internal/models"
+)
+
+func TestLoginFailureRepoCreateAndList(t *testing.T) {
+	env := setupRepoTest(t)
+	user := createUser(t, env, "user@example.com", "user", "pass", "user")
+
+	failures := []*models.LoginFailure{
+		{UserID: &user.ID, Email: "user@example.com", IP: "10.0.0.1", Reason: models.LoginFailureInvalidCredentials},
+		{Email: "nobody@example.com", IP: "10.0.0.1", Reason: models.LoginFailureInvalidCredentials},
+		{Email: "user@example.com", IP: "10.0.0.2", Reason: models.LoginFailureLocked},
+	}
+
+	for _, failure := range failures {
+		failure.CreatedAt = time.Now().UTC()
+		if err := env.loginFailures.Create(context.Background(), failure); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	rows, err := env.loginFailures.List(context.Background(), "user@example.com", "", 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(rows) != 2 || rows[0].Reason != models.LoginFailureLocked || rows[1].UserID == nil || *rows[1].UserID != user.ID {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+
+	rows, err = env.loginFailures.List(context.Background(), "", "10.0.0.1", 1)
+	if err != nil {
+		t.Fatalf("List by ip: %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].Email != "nobody@example.com" {
+		t.Fatalf("unexpected ip rows: %+v", rows)
+	}
+}
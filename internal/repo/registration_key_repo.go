@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"smctf/internal/models"
 
@@ -46,25 +47,78 @@ func (r *RegistrationKeyRepo) baseRegistrationKeySummaryQuery() *bun.SelectQuery
 		ColumnExpr("rk.created_by AS created_by").
 		ColumnExpr("creator.username AS created_by_username").
 		ColumnExpr("rk.team_id AS team_id").
-		ColumnExpr("g.name AS team_name").
+		ColumnExpr("COALESCE(g.name, '') AS team_name").
+		ColumnExpr("rk.division_id AS division_id").
+		ColumnExpr("COALESCE(d.name, '') AS division_name").
+		ColumnExpr("rk.max_uses AS max_uses").
+		ColumnExpr("rk.use_count AS use_count").
 		ColumnExpr("rk.used_by AS used_by").
 		ColumnExpr("used.username AS used_by_username").
 		ColumnExpr("rk.used_by_ip AS used_by_ip").
 		ColumnExpr("rk.created_at AS created_at").
 		ColumnExpr("rk.used_at AS used_at").
+		ColumnExpr("rk.expires_at AS expires_at").
+		ColumnExpr("rk.revoked_at AS revoked_at").
 		Join("JOIN users AS creator ON creator.id = rk.created_by").
-		Join("JOIN teams AS g ON g.id = rk.team_id").
+		Join("LEFT JOIN teams AS g ON g.id = rk.team_id").
+		Join("LEFT JOIN divisions AS d ON d.id = rk.division_id").
 		Join("LEFT JOIN users AS used ON used.id = rk.used_by")
 }
 
-func (r *RegistrationKeyRepo) List(ctx context.Context) ([]models.RegistrationKeySummary, error) {
+// Zero limit returns every matching row
+func (r *RegistrationKeyRepo) List(ctx context.Context, filter models.RegistrationKeyFilter) ([]models.RegistrationKeySummary, error) {
 	keys := make([]models.RegistrationKeySummary, 0)
 
 	query := r.baseRegistrationKeySummaryQuery().OrderExpr("rk.id DESC")
 
+	if filter.TeamID != nil {
+		query = query.Where("rk.team_id = ?", *filter.TeamID)
+	}
+
+	if filter.Used != nil {
+		if *filter.Used {
+			query = query.Where("rk.use_count > 0")
+		} else {
+			query = query.Where("rk.use_count = 0")
+		}
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
 	if err := query.Scan(ctx, &keys); err != nil {
 		return nil, wrapError("registrationKeyRepo.List", err)
 	}
 
 	return keys, nil
 }
+
+func (r *RegistrationKeyRepo) GetSummaryByID(ctx context.Context, id int64) (*models.RegistrationKeySummary, error) {
+	key := new(models.RegistrationKeySummary)
+
+	if err := r.baseRegistrationKeySummaryQuery().Where("rk.id = ?", id).Scan(ctx, key); err != nil {
+		return nil, wrapNotFound("registrationKeyRepo.GetSummaryByID", err)
+	}
+
+	return key, nil
+}
+
+// Revoking an already revoked key keeps the original revocation
+func (r *RegistrationKeyRepo) Revoke(ctx context.Context, id, revokedBy int64, revokedAt time.Time) error {
+	if _, err := r.db.NewUpdate().
+		Model((*models.RegistrationKey)(nil)).
+		Set("revoked_at = ?", revokedAt).
+		Set("revoked_by = ?", revokedBy).
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Exec(ctx); err != nil {
+		return wrapError("registrationKeyRepo.Revoke", err)
+	}
+
+	return nil
+}
@@ -41,7 +41,7 @@ func TestRegistrationKeyRepoCRUD(t *testing.T) {
 		t.Fatalf("expected key id %d, got %d", key.ID, got.ID)
 	}
 
-	rows, err := env.regKeyRepo.List(context.Background())
+	rows, err := env.regKeyRepo.List(context.Background(), models.RegistrationKeyFilter{})
 	if err != nil {
 		t.Fatalf("List: %v", err)
 	}
@@ -70,3 +70,90 @@ func TestRegistrationKeyRepoNotFound(t *testing.T) {
 		t.Fatalf("expected ErrNotFound, got %v", err)
 	}
 }
+
+func TestRegistrationKeyRepoListFilters(t *testing.T) {
+	env := setupRepoTest(t)
+	alpha := createTeam(t, env, "Alpha")
+	beta := createTeam(t, env, "Beta")
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+
+	codes := []struct {
+		code   string
+		teamID int64
+		uses   int
+	}{
+		{code: "100001", teamID: alpha.ID, uses: 0},
+		{code: "100002", teamID: alpha.ID, uses: 1},
+		{code: "100003", teamID: beta.ID, uses: 0},
+	}
+
+	for _, c := range codes {
+		key := &models.RegistrationKey{
+			Code:      c.code,
+			CreatedBy: admin.ID,
+			TeamID:    c.teamID,
+			MaxUses:   1,
+			UseCount:  c.uses,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := env.regKeyRepo.Create(context.Background(), key); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	used := false
+	rows, err := env.regKeyRepo.List(context.Background(), models.RegistrationKeyFilter{TeamID: &alpha.ID, Used: &used})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].Code != "100001" {
+		t.Fatalf("expected unused alpha key, got %+v", rows)
+	}
+
+	rows, err = env.regKeyRepo.List(context.Background(), models.RegistrationKeyFilter{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("List page: %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].Code != "100002" {
+		t.Fatalf("expected second newest key, got %+v", rows)
+	}
+}
+
+func TestRegistrationKeyRepoRevoke(t *testing.T) {
+	env := setupRepoTest(t)
+	team := createTeam(t, env, "Alpha")
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+
+	key := &models.RegistrationKey{Code: "123456", CreatedBy: admin.ID, TeamID: team.ID, CreatedAt: time.Now().UTC()}
+	if err := env.regKeyRepo.Create(context.Background(), key); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	first := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	if err := env.regKeyRepo.Revoke(context.Background(), key.ID, admin.ID, first); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	if err := env.regKeyRepo.Revoke(context.Background(), key.ID, admin.ID, time.Now().UTC()); err != nil {
+		t.Fatalf("Revoke again: %v", err)
+	}
+
+	got, err := env.regKeyRepo.GetSummaryByID(context.Background(), key.ID)
+	if err != nil {
+		t.Fatalf("GetSummaryByID: %v", err)
+	}
+
+	if got.RevokedAt == nil || !got.RevokedAt.Equal(first) {
+		t.Fatalf("expected original revoked_at, got %+v", got.RevokedAt)
+	}
+
+	if got.MaxUses != 1 || got.UseCount != 0 {
+		t.Fatalf("expected default uses, got %+v", got)
+	}
+
+	if _, err := env.regKeyRepo.GetSummaryByID(context.Background(), 9999); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
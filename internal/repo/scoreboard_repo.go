@@ -2,9 +2,12 @@ package repo
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"strings"
 	"time"
 
+	"smctf/internal/country"
 	"smctf/internal/models"
 	"smctf/internal/scoring"
 
@@ -27,7 +30,7 @@ type leaderboardChallengeRow struct {
 	MinimumPoints int    `bun:"minimum_points"`
 }
 
-func (r *ScoreboardRepo) leaderboardChallenges(ctx context.Context) ([]models.LeaderboardChallenge, map[int64]int, error) {
+func (r *ScoreboardRepo) leaderboardChallenges(ctx context.Context, divisionID int64) ([]models.LeaderboardChallenge, map[int64]int, error) {
 	rows := make([]leaderboardChallengeRow, 0)
 	if err := r.db.NewSelect().
 		TableExpr("challenges AS c").
@@ -41,12 +44,17 @@ func (r *ScoreboardRepo) leaderboardChallenges(ctx context.Context) ([]models.Le
 		return nil, nil, wrapError("scoreboardRepo.leaderboardChallenges", err)
 	}
 
-	solveCounts, err := solveCountsByChallenge(ctx, r.db)
+	scope, err := scoringDivision(ctx, r.db, divisionID)
+	if err != nil {
+		return nil, nil, wrapError("scoreboardRepo.leaderboardChallenges scope", err)
+	}
+
+	solveCounts, err := solveCountsByChallenge(ctx, r.db, scope)
 	if err != nil {
 		return nil, nil, wrapError("scoreboardRepo.leaderboardChallenges solve counts", err)
 	}
 
-	decay, err := decayFactor(ctx, r.db)
+	decay, err := decayFactor(ctx, r.db, scope)
 	if err != nil {
 		return nil, nil, wrapError("scoreboardRepo.leaderboardChallenges decay", err)
 	}
@@ -68,19 +76,31 @@ func (r *ScoreboardRepo) leaderboardChallenges(ctx context.Context) ([]models.Le
 	return challenges, pointsMap, nil
 }
 
-func (r *ScoreboardRepo) Leaderboard(ctx context.Context) (models.LeaderboardResponse, error) {
-	challenges, pointsMap, err := r.leaderboardChallenges(ctx)
+// Division 0 ranks every user, otherwise only members of teams in that division. Country and affiliation match the user's profile.
+func (r *ScoreboardRepo) Leaderboard(ctx context.Context, filter models.LeaderboardFilter) (models.LeaderboardResponse, error) {
+	challenges, pointsMap, err := r.leaderboardChallenges(ctx, filter.DivisionID)
 	if err != nil {
 		return models.LeaderboardResponse{}, wrapError("scoreboardRepo.Leaderboard", err)
 	}
 
 	rows := make([]models.LeaderboardEntry, 0)
-	if err := r.db.NewSelect().
+	query := r.db.NewSelect().
 		TableExpr("users AS u").
 		ColumnExpr("u.id AS user_id").
 		ColumnExpr("u.username AS username").
-		OrderExpr("u.id ASC").
-		Scan(ctx, &rows); err != nil {
+		ColumnExpr("u.country AS country").
+		ColumnExpr("u.affiliation AS affiliation").
+		OrderExpr("u.id ASC")
+
+	if filter.DivisionID != 0 {
+		query = query.
+			Join("JOIN teams AS t ON t.id = u.team_id").
+			Where("t.division_id = ?", filter.DivisionID)
+	}
+
+	query = applyProfileFilter(query, "u", filter)
+
+	if err := query.Scan(ctx, &rows); err != nil {
 		return models.LeaderboardResponse{}, wrapError("scoreboardRepo.Leaderboard", err)
 	}
 
@@ -162,30 +182,47 @@ func (r *ScoreboardRepo) Leaderboard(ctx context.Context) (models.LeaderboardRes
 	}, nil
 }
 
-func (r *ScoreboardRepo) TeamLeaderboard(ctx context.Context) (models.TeamLeaderboardResponse, error) {
-	challenges, pointsMap, err := r.leaderboardChallenges(ctx)
+// Country and affiliation match the team's own profile, not its members'
+func (r *ScoreboardRepo) TeamLeaderboard(ctx context.Context, filter models.LeaderboardFilter) (models.TeamLeaderboardResponse, error) {
+	challenges, pointsMap, err := r.leaderboardChallenges(ctx, filter.DivisionID)
 	if err != nil {
 		return models.TeamLeaderboardResponse{}, wrapError("scoreboardRepo.TeamLeaderboard", err)
 	}
 
 	var teamRows []struct {
-		ID   int64  `bun:"id"`
-		Name string `bun:"name"`
+		ID          int64  `bun:"id"`
+		Name        string `bun:"name"`
+		DivisionID  int64  `bun:"division_id"`
+		Country     string `bun:"country"`
+		Affiliation string `bun:"affiliation"`
 	}
 
-	if err := r.db.NewSelect().
+	query := r.db.NewSelect().
 		TableExpr("teams AS t").
 		ColumnExpr("t.id AS id").
 		ColumnExpr("t.name AS name").
-		Scan(ctx, &teamRows); err != nil {
+		ColumnExpr("t.division_id AS division_id").
+		ColumnExpr("t.country AS country").
+		ColumnExpr("t.affiliation AS affiliation")
+
+	if filter.DivisionID != 0 {
+		query = query.Where("t.division_id = ?", filter.DivisionID)
+	}
+
+	query = applyProfileFilter(query, "t", filter)
+
+	if err := query.Scan(ctx, &teamRows); err != nil {
 		return models.TeamLeaderboardResponse{}, wrapError("scoreboardRepo.TeamLeaderboard teams", err)
 	}
 
 	teamEntries := make(map[int64]*models.TeamLeaderboardEntry, len(teamRows))
 	for _, row := range teamRows {
 		teamEntries[row.ID] = &models.TeamLeaderboardEntry{
-			TeamID:   row.ID,
-			TeamName: row.Name,
+			TeamID:      row.ID,
+			TeamName:    row.Name,
+			DivisionID:  row.DivisionID,
+			Country:     row.Country,
+			Affiliation: row.Affiliation,
 		}
 	}
 
@@ -274,8 +311,86 @@ func (r *ScoreboardRepo) TeamLeaderboard(ctx context.Context) (models.TeamLeader
 	}, nil
 }
 
-func (r *ScoreboardRepo) TimelineSubmissions(ctx context.Context, since *time.Time) ([]models.UserTimelineRow, error) {
-	pointsMap, err := dynamicPointsMap(ctx, r.db)
+// Sums user scores per country or affiliation. Users without a value for the group are left out.
+func (r *ScoreboardRepo) GroupLeaderboard(ctx context.Context, group string, divisionID int64) ([]models.GroupLeaderboardEntry, error) {
+	if group != models.LeaderboardGroupCountry && group != models.LeaderboardGroupAffiliation {
+		return nil, wrapError("scoreboardRepo.GroupLeaderboard", fmt.Errorf("unknown group %q", group))
+	}
+
+	board, err := r.Leaderboard(ctx, models.LeaderboardFilter{DivisionID: divisionID})
+	if err != nil {
+		return nil, wrapError("scoreboardRepo.GroupLeaderboard", err)
+	}
+
+	groups := make(map[string]*models.GroupLeaderboardEntry)
+	spellings := make(map[string]map[string]int)
+	for _, entry := range board.Entries {
+		key, name := entry.Country, country.Name(entry.Country)
+		if group == models.LeaderboardGroupAffiliation {
+			// Same normalization as the affiliation filter, so a group key can be fed back to it
+			name = strings.TrimSpace(entry.Affiliation)
+			key = strings.ToLower(name)
+		}
+
+		if key == "" {
+			continue
+		}
+
+		row, ok := groups[key]
+		if !ok {
+			row = &models.GroupLeaderboardEntry{Key: key, Name: name}
+			groups[key] = row
+			spellings[key] = make(map[string]int)
+		}
+
+		spellings[key][name]++
+		row.MemberCount++
+		row.Score += entry.Score
+	}
+
+	rows := make([]models.GroupLeaderboardEntry, 0, len(groups))
+	for key, row := range groups {
+		row.Name = mostCommonSpelling(spellings[key])
+		rows = append(rows, *row)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Score == rows[j].Score {
+			return rows[i].Key < rows[j].Key
+		}
+
+		return rows[i].Score > rows[j].Score
+	})
+
+	return rows, nil
+}
+
+// Picks the name most members wrote, ties go to the first in byte order so the result is stable
+func mostCommonSpelling(counts map[string]int) string {
+	best, bestCount := "", 0
+	for name, count := range counts {
+		if count > bestCount || (count == bestCount && name < best) {
+			best, bestCount = name, count
+		}
+	}
+
+	return best
+}
+
+func applyProfileFilter(query *bun.SelectQuery, alias string, filter models.LeaderboardFilter) *bun.SelectQuery {
+	if filter.Country != "" {
+		query = query.Where("?.country = ?", bun.Ident(alias), filter.Country)
+	}
+
+	if filter.Affiliation != "" {
+		query = query.Where("LOWER(TRIM(?.affiliation)) = LOWER(TRIM(?))", bun.Ident(alias), filter.Affiliation)
+	}
+
+	return query
+}
+
+func (r *ScoreboardRepo) TimelineSubmissions(ctx context.Context, since *time.Time, divisionID int64) ([]models.UserTimelineRow, error) {
+	pointsMap, err := divisionPointsMap(ctx, r.db, divisionID)
 	if err != nil {
 		return nil, wrapError("scoreboardRepo.TimelineSubmissions", err)
 	}
@@ -290,6 +405,12 @@ func (r *ScoreboardRepo) TimelineSubmissions(ctx context.Context, since *time.Ti
 		Join("JOIN users AS u ON u.id = s.user_id").
 		Where("s.correct = true")
 
+	if divisionID != 0 {
+		query = query.
+			Join("JOIN teams AS g ON g.id = u.team_id").
+			Where("g.division_id = ?", divisionID)
+	}
+
 	query = applyTimelineWindow(query, since)
 
 	if err := query.Scan(ctx, &rows); err != nil {
@@ -303,8 +424,8 @@ func (r *ScoreboardRepo) TimelineSubmissions(ctx context.Context, since *time.Ti
 	return rows, nil
 }
 
-func (r *ScoreboardRepo) TimelineTeamSubmissions(ctx context.Context, since *time.Time) ([]models.TeamTimelineRow, error) {
-	pointsMap, err := dynamicPointsMap(ctx, r.db)
+func (r *ScoreboardRepo) TimelineTeamSubmissions(ctx context.Context, since *time.Time, divisionID int64) ([]models.TeamTimelineRow, error) {
+	pointsMap, err := divisionPointsMap(ctx, r.db, divisionID)
 	if err != nil {
 		return nil, wrapError("scoreboardRepo.TimelineTeamSubmissions", err)
 	}
@@ -320,6 +441,10 @@ func (r *ScoreboardRepo) TimelineTeamSubmissions(ctx context.Context, since *tim
 		Join("JOIN teams AS g ON g.id = u.team_id").
 		Where("s.correct = true")
 
+	if divisionID != 0 {
+		query = query.Where("g.division_id = ?", divisionID)
+	}
+
 	query = applyTimelineWindow(query, since)
 
 	if err := query.Scan(ctx, &rows); err != nil {
@@ -23,7 +23,7 @@ func TestScoreboardRepoLeaderboardAndTimeline(t *testing.T) {
 	createSubmission(t, env, user1.ID, ch2.ID, true, time.Now().Add(-2*time.Minute))
 	createSubmission(t, env, user2.ID, ch2.ID, false, time.Now().Add(-1*time.Minute))
 
-	leaderboard, err := scoreRepo.Leaderboard(context.Background())
+	leaderboard, err := scoreRepo.Leaderboard(context.Background(), models.LeaderboardFilter{})
 	if err != nil {
 		t.Fatalf("Leaderboard: %v", err)
 	}
@@ -49,7 +49,7 @@ func TestScoreboardRepoLeaderboardAndTimeline(t *testing.T) {
 	}
 
 	since := time.Now().Add(-2*time.Minute - time.Second)
-	rows, err := scoreRepo.TimelineSubmissions(context.Background(), &since)
+	rows, err := scoreRepo.TimelineSubmissions(context.Background(), &since, 0)
 	if err != nil {
 		t.Fatalf("TimelineSubmissions: %v", err)
 	}
@@ -80,7 +80,7 @@ func TestScoreboardRepoTeamLeaderboardAndTimeline(t *testing.T) {
 	createSubmission(t, env, user2.ID, ch2.ID, true, time.Now().Add(-2*time.Minute))
 	createSubmission(t, env, user3.ID, ch2.ID, true, time.Now().Add(-1*time.Minute))
 
-	leaderboard, err := scoreRepo.TeamLeaderboard(context.Background())
+	leaderboard, err := scoreRepo.TeamLeaderboard(context.Background(), models.LeaderboardFilter{})
 	if err != nil {
 		t.Fatalf("TeamLeaderboard: %v", err)
 	}
@@ -97,7 +97,7 @@ func TestScoreboardRepoTeamLeaderboardAndTimeline(t *testing.T) {
 		t.Fatalf("unexpected team leaderboard last row: %+v", leaderboard.Entries[2])
 	}
 
-	rows, err := scoreRepo.TimelineTeamSubmissions(context.Background(), nil)
+	rows, err := scoreRepo.TimelineTeamSubmissions(context.Background(), nil, 0)
 	if err != nil {
 		t.Fatalf("TimelineTeamSubmissions: %v", err)
 	}
@@ -120,7 +120,7 @@ func TestScoreboardRepoTimelineNoSince(t *testing.T) {
 
 	createSubmission(t, env, user.ID, ch.ID, true, time.Now().Add(-time.Minute))
 
-	rows, err := scoreRepo.TimelineSubmissions(context.Background(), nil)
+	rows, err := scoreRepo.TimelineSubmissions(context.Background(), nil, 0)
 	if err != nil {
 		t.Fatalf("TimelineSubmissions: %v", err)
 	}
@@ -141,7 +141,7 @@ func TestScoreboardRepoTimelineOrdering(t *testing.T) {
 	createSubmission(t, env, user.ID, ch.ID, true, now.Add(-2*time.Minute))
 	createSubmission(t, env, user.ID, ch.ID, true, now.Add(-time.Minute))
 
-	rows, err := scoreRepo.TimelineSubmissions(context.Background(), nil)
+	rows, err := scoreRepo.TimelineSubmissions(context.Background(), nil, 0)
 	if err != nil {
 		t.Fatalf("TimelineSubmissions: %v", err)
 	}
@@ -166,7 +166,7 @@ func TestScoreboardRepoLeaderboardTieBreak(t *testing.T) {
 	createSubmission(t, env, user1.ID, ch.ID, true, time.Now().Add(-time.Minute))
 	createSubmission(t, env, user2.ID, ch.ID, true, time.Now().Add(-time.Minute))
 
-	rows, err := scoreRepo.Leaderboard(context.Background())
+	rows, err := scoreRepo.Leaderboard(context.Background(), models.LeaderboardFilter{})
 	if err != nil {
 		t.Fatalf("Leaderboard: %v", err)
 	}
@@ -189,7 +189,7 @@ func TestScoreboardRepoTimelineIncludesUsername(t *testing.T) {
 
 	createSubmission(t, env, user.ID, ch.ID, true, time.Now().Add(-time.Minute))
 
-	rows, err := scoreRepo.TimelineSubmissions(context.Background(), nil)
+	rows, err := scoreRepo.TimelineSubmissions(context.Background(), nil, 0)
 	if err != nil {
 		t.Fatalf("TimelineSubmissions: %v", err)
 	}
@@ -209,7 +209,7 @@ func TestScoreboardRepoTeamLeaderboardIncludesEmptyTeam(t *testing.T) {
 	ch := createChallenge(t, env, "ch1", 100, "FLAG{1}", true)
 	createSubmission(t, env, user.ID, ch.ID, true, time.Now().UTC())
 
-	rows, err := scoreRepo.TeamLeaderboard(context.Background())
+	rows, err := scoreRepo.TeamLeaderboard(context.Background(), models.LeaderboardFilter{})
 	if err != nil {
 		t.Fatalf("TeamLeaderboard: %v", err)
 	}
@@ -236,3 +236,144 @@ func TestScoreboardRepoTeamLeaderboardIncludesEmptyTeam(t *testing.T) {
 		t.Fatalf("expected beta score 0, got %d", beta.Score)
 	}
 }
+
+func TestScoreboardRepoDivisionFilter(t *testing.T) {
+	env := setupRepoTest(t)
+	scoreRepo := NewScoreboardRepo(env.db)
+
+	division := createDivision(t, env, "High School")
+	teamA := createTeamInDivision(t, env, "Alpha", division.ID)
+	teamB := createTeam(t, env, "Beta")
+	user1 := createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", teamA.ID)
+	user2 := createUserWithTeam(t, env, "u2@example.com", "u2", "pass", "user", teamB.ID)
+
+	ch := createChallenge(t, env, "ch1", 100, "FLAG{1}", true)
+	createSubmission(t, env, user1.ID, ch.ID, true, time.Now().Add(-2*time.Minute))
+	createSubmission(t, env, user2.ID, ch.ID, true, time.Now().Add(-1*time.Minute))
+
+	teams, err := scoreRepo.TeamLeaderboard(context.Background(), models.LeaderboardFilter{DivisionID: division.ID})
+	if err != nil {
+		t.Fatalf("TeamLeaderboard: %v", err)
+	}
+
+	if len(teams.Entries) != 1 || teams.Entries[0].TeamID != teamA.ID || teams.Entries[0].DivisionID != division.ID {
+		t.Fatalf("unexpected division team leaderboard: %+v", teams.Entries)
+	}
+
+	users, err := scoreRepo.Leaderboard(context.Background(), models.LeaderboardFilter{DivisionID: division.ID})
+	if err != nil {
+		t.Fatalf("Leaderboard: %v", err)
+	}
+
+	if len(users.Entries) != 1 || users.Entries[0].UserID != user1.ID {
+		t.Fatalf("unexpected division leaderboard: %+v", users.Entries)
+	}
+
+	rows, err := scoreRepo.TimelineTeamSubmissions(context.Background(), nil, division.ID)
+	if err != nil {
+		t.Fatalf("TimelineTeamSubmissions: %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].TeamID != teamA.ID {
+		t.Fatalf("unexpected division team timeline: %+v", rows)
+	}
+
+	userRows, err := scoreRepo.TimelineSubmissions(context.Background(), nil, division.ID)
+	if err != nil {
+		t.Fatalf("TimelineSubmissions: %v", err)
+	}
+
+	if len(userRows) != 1 || userRows[0].UserID != user1.ID {
+		t.Fatalf("unexpected division timeline: %+v", userRows)
+	}
+}
+
+func TestScoreboardRepoProfileFilterAndGroups(t *testing.T) {
+	env := setupRepoTest(t)
+	scoreRepo := NewScoreboardRepo(env.db)
+
+	teamA := createTeam(t, env, "Alpha")
+	teamB := createTeam(t, env, "Beta")
+	user1 := createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", teamA.ID)
+	user2 := createUserWithTeam(t, env, "u2@example.com", "u2", "pass", "user", teamA.ID)
+	user3 := createUserWithTeam(t, env, "u3@example.com", "u3", "pass", "user", teamB.ID)
+
+	ctx := context.Background()
+	for _, p := range []struct {
+		id      int64
+		profile models.Profile
+	}{
+		{user1.ID, models.Profile{Country: "KR", Affiliation: "KAIST"}},
+		{user2.ID, models.Profile{Country: "KR", Affiliation: "POSTECH"}},
+		{user3.ID, models.Profile{Country: "US", Affiliation: " kaist"}},
+	} {
+		if err := env.userRepo.UpdateProfile(ctx, p.id, p.profile); err != nil {
+			t.Fatalf("UpdateProfile: %v", err)
+		}
+	}
+
+	if err := env.teamRepo.UpdateProfile(ctx, teamB.ID, models.Profile{Country: "US"}); err != nil {
+		t.Fatalf("team UpdateProfile: %v", err)
+	}
+
+	ch := createChallenge(t, env, "ch1", 100, "FLAG{1}", true)
+	createSubmission(t, env, user1.ID, ch.ID, true, time.Now().Add(-2*time.Minute))
+	createSubmission(t, env, user3.ID, ch.ID, true, time.Now().Add(-1*time.Minute))
+
+	users, err := scoreRepo.Leaderboard(ctx, models.LeaderboardFilter{Country: "KR"})
+	if err != nil {
+		t.Fatalf("Leaderboard: %v", err)
+	}
+
+	if len(users.Entries) != 2 || users.Entries[0].UserID != user1.ID || users.Entries[0].Country != "KR" {
+		t.Fatalf("unexpected country leaderboard: %+v", users.Entries)
+	}
+
+	users, err = scoreRepo.Leaderboard(ctx, models.LeaderboardFilter{Affiliation: "Kaist"})
+	if err != nil {
+		t.Fatalf("Leaderboard: %v", err)
+	}
+
+	if len(users.Entries) != 2 {
+		t.Fatalf("expected case-insensitive affiliation match, got %+v", users.Entries)
+	}
+
+	teams, err := scoreRepo.TeamLeaderboard(ctx, models.LeaderboardFilter{Country: "US"})
+	if err != nil {
+		t.Fatalf("TeamLeaderboard: %v", err)
+	}
+
+	if len(teams.Entries) != 1 || teams.Entries[0].TeamID != teamB.ID || teams.Entries[0].Country != "US" {
+		t.Fatalf("unexpected team country leaderboard: %+v", teams.Entries)
+	}
+
+	countries, err := scoreRepo.GroupLeaderboard(ctx, models.LeaderboardGroupCountry, 0)
+	if err != nil {
+		t.Fatalf("GroupLeaderboard: %v", err)
+	}
+
+	if len(countries) != 2 || countries[0].Key != "KR" || countries[0].Name != "Korea, Republic of" || countries[0].MemberCount != 2 {
+		t.Fatalf("unexpected country groups: %+v", countries)
+	}
+
+	if countries[0].Score != countries[1].Score || countries[1].Key != "US" {
+		t.Fatalf("expected tie broken by key: %+v", countries)
+	}
+
+	affiliations, err := scoreRepo.GroupLeaderboard(ctx, models.LeaderboardGroupAffiliation, 0)
+	if err != nil {
+		t.Fatalf("GroupLeaderboard: %v", err)
+	}
+
+	if len(affiliations) != 2 || affiliations[0].Key != "kaist" || affiliations[0].Name != "KAIST" || affiliations[0].MemberCount != 2 {
+		t.Fatalf("expected affiliations grouped case-insensitively, got %+v", affiliations)
+	}
+
+	if affiliations[1].Key != "postech" || affiliations[1].Name != "POSTECH" || affiliations[1].Score != 0 {
+		t.Fatalf("unexpected affiliation groups: %+v", affiliations)
+	}
+
+	if _, err := scoreRepo.GroupLeaderboard(ctx, "city", 0); err == nil {
+		t.Fatalf("expected error for unknown group")
+	}
+}
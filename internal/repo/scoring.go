@@ -3,6 +3,7 @@ package repo
 import (
 	"context"
 
+	"smctf/internal/models"
 	"smctf/internal/scoring"
 
 	"github.com/uptrace/bun"
@@ -20,17 +21,27 @@ type challengeSolveCountRow struct {
 }
 
 func dynamicPointsMap(ctx context.Context, db *bun.DB) (map[int64]int, error) {
+	return divisionPointsMap(ctx, db, 0)
+}
+
+// Points as seen by one division. Falls back to global points for division 0 or when division scoring is off.
+func divisionPointsMap(ctx context.Context, db *bun.DB, divisionID int64) (map[int64]int, error) {
 	challenges, err := listChallengesForScoring(ctx, db)
 	if err != nil {
 		return nil, err
 	}
 
-	solveCounts, err := solveCountsByChallenge(ctx, db)
+	scope, err := scoringDivision(ctx, db, divisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	solveCounts, err := solveCountsByChallenge(ctx, db, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	decay, err := decayFactor(ctx, db)
+	decay, err := decayFactor(ctx, db, scope)
 	if err != nil {
 		return nil, err
 	}
@@ -58,15 +69,24 @@ func listChallengesForScoring(ctx context.Context, db *bun.DB) ([]challengeScore
 	return rows, nil
 }
 
-func solveCountsByChallenge(ctx context.Context, db *bun.DB) (map[int64]int, error) {
+// Division 0 counts every solve
+func solveCountsByChallenge(ctx context.Context, db *bun.DB, divisionID int64) (map[int64]int, error) {
 	rows := make([]challengeSolveCountRow, 0)
-	if err := db.NewSelect().
-		TableExpr("submissions").
-		ColumnExpr("challenge_id").
+	query := db.NewSelect().
+		TableExpr("submissions AS s").
+		ColumnExpr("s.challenge_id AS challenge_id").
 		ColumnExpr("COUNT(*) AS solve_count").
-		Where("correct = true").
-		GroupExpr("challenge_id").
-		Scan(ctx, &rows); err != nil {
+		Where("s.correct = true").
+		GroupExpr("s.challenge_id")
+
+	if divisionID != 0 {
+		query = query.
+			Join("JOIN users AS u ON u.id = s.user_id").
+			Join("JOIN teams AS t ON t.id = u.team_id").
+			Where("t.division_id = ?", divisionID)
+	}
+
+	if err := query.Scan(ctx, &rows); err != nil {
 		return nil, wrapError("score.solveCountsByChallenge", err)
 	}
 
@@ -79,7 +99,7 @@ func solveCountsByChallenge(ctx context.Context, db *bun.DB) (map[int64]int, err
 }
 
 func challengeSolveCounts(ctx context.Context, db *bun.DB) (map[int64]int, error) {
-	counts, err := solveCountsByChallenge(ctx, db)
+	counts, err := solveCountsByChallenge(ctx, db, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -87,14 +107,73 @@ func challengeSolveCounts(ctx context.Context, db *bun.DB) (map[int64]int, error
 	return counts, nil
 }
 
-func decayFactor(ctx context.Context, db *bun.DB) (int, error) {
-	var teamCount int
+// Teams share the decay in team mode, every user counts in individual mode. A division only counts its own teams.
+func decayFactor(ctx context.Context, db *bun.DB, divisionID int64) (int, error) {
+	if divisionID != 0 {
+		count, err := db.NewSelect().
+			TableExpr("teams").
+			Where("division_id = ?", divisionID).
+			Count(ctx)
+		if err != nil {
+			return 0, wrapError("score.divisionTeamCount", err)
+		}
+
+		return count, nil
+	}
+
+	individual, err := individualMode(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+
+	table := "teams"
+	if individual {
+		table = "users"
+	}
+
+	var count int
 	if err := db.NewSelect().
-		TableExpr("teams").
+		TableExpr(table).
 		ColumnExpr("COUNT(*)").
-		Scan(ctx, &teamCount); err != nil {
-		return 0, wrapError("score.teamCount", err)
+		Scan(ctx, &count); err != nil {
+		return 0, wrapError("score.participantCount", err)
+	}
+
+	return count, nil
+}
+
+// Returns the division dynamic points are computed for, 0 meaning global
+func scoringDivision(ctx context.Context, db bun.IDB, divisionID int64) (int64, error) {
+	if divisionID == 0 {
+		return 0, nil
+	}
+
+	perDivision, err := db.NewSelect().
+		Model((*models.AppConfig)(nil)).
+		Where("key = ?", models.AppConfigKeyDivisionScoring).
+		Where("value = ?", models.DivisionScoringDivision).
+		Exists(ctx)
+	if err != nil {
+		return 0, wrapError("score.divisionScoring", err)
+	}
+
+	if !perDivision {
+		return 0, nil
+	}
+
+	return divisionID, nil
+}
+
+// A missing competition_mode row means team mode
+func individualMode(ctx context.Context, db bun.IDB) (bool, error) {
+	exists, err := db.NewSelect().
+		Model((*models.AppConfig)(nil)).
+		Where("key = ?", models.AppConfigKeyCompetitionMode).
+		Where("value = ?", models.CompetitionModeIndividual).
+		Exists(ctx)
+	if err != nil {
+		return false, wrapError("score.individualMode", err)
 	}
 
-	return teamCount, nil
+	return exists, nil
 }
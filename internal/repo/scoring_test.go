@@ -4,6 +4,9 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"smctf/internal/models"
+	"smctf/internal/scoring"
 )
 
 func TestDynamicPointsMapUsesTeamDecay(t *testing.T) {
@@ -31,3 +34,94 @@ func TestDynamicPointsMapUsesTeamDecay(t *testing.T) {
 		t.Fatalf("expected 400 with decay=2 and solves=1, got %d", got)
 	}
 }
+
+func TestDynamicPointsMapUsesUserDecayInIndividualMode(t *testing.T) {
+	env := setupRepoTest(t)
+
+	team := createTeam(t, env, "Alpha")
+	user := createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", team.ID)
+	_ = createUserWithTeam(t, env, "u2@example.com", "u2", "pass", "user", team.ID)
+	_ = createUserWithTeam(t, env, "u3@example.com", "u3", "pass", "user", 0)
+	_ = createUserWithTeam(t, env, "u4@example.com", "u4", "pass", "user", 0)
+	setIndividualMode(t, env)
+
+	challenge := createChallenge(t, env, "Dynamic", 500, "FLAG{DYN}", true)
+	challenge.MinimumPoints = 100
+	if err := env.challengeRepo.Update(context.Background(), challenge); err != nil {
+		t.Fatalf("update challenge minimum: %v", err)
+	}
+
+	createSubmission(t, env, user.ID, challenge.ID, true, time.Now().UTC())
+
+	decay, err := decayFactor(context.Background(), env.db, 0)
+	if err != nil {
+		t.Fatalf("decayFactor: %v", err)
+	}
+
+	if decay != 4 {
+		t.Fatalf("expected decay of 4 users, got %d", decay)
+	}
+
+	points, err := dynamicPointsMap(context.Background(), env.db)
+	if err != nil {
+		t.Fatalf("dynamicPointsMap: %v", err)
+	}
+
+	if want := scoring.DynamicPoints(500, 100, 1, 4); points[challenge.ID] != want {
+		t.Fatalf("expected %d, got %d", want, points[challenge.ID])
+	}
+}
+
+func TestDivisionPointsMapFollowsDivisionScoring(t *testing.T) {
+	env := setupRepoTest(t)
+
+	division := createDivision(t, env, "High School")
+	teamA := createTeamInDivision(t, env, "Alpha", division.ID)
+	_ = createTeamInDivision(t, env, "Beta", division.ID)
+	teamC := createTeam(t, env, "Gamma")
+	_ = createTeam(t, env, "Delta")
+	userA := createUserWithTeam(t, env, "a@example.com", "a", "pass", "user", teamA.ID)
+	userC := createUserWithTeam(t, env, "c@example.com", "c", "pass", "user", teamC.ID)
+
+	challenge := createChallenge(t, env, "Dynamic", 500, "FLAG{DYN}", true)
+	challenge.MinimumPoints = 100
+	if err := env.challengeRepo.Update(context.Background(), challenge); err != nil {
+		t.Fatalf("update challenge minimum: %v", err)
+	}
+
+	createSubmission(t, env, userA.ID, challenge.ID, true, time.Now().UTC())
+	createSubmission(t, env, userC.ID, challenge.ID, true, time.Now().UTC())
+
+	global := scoring.DynamicPoints(500, 100, 2, 4)
+	points, err := divisionPointsMap(context.Background(), env.db, division.ID)
+	if err != nil {
+		t.Fatalf("divisionPointsMap: %v", err)
+	}
+
+	if points[challenge.ID] != global {
+		t.Fatalf("expected global points %d without division scoring, got %d", global, points[challenge.ID])
+	}
+
+	cfg := &models.AppConfig{Key: models.AppConfigKeyDivisionScoring, Value: models.DivisionScoringDivision, UpdatedAt: time.Now().UTC()}
+	if _, err := env.db.NewInsert().Model(cfg).Exec(context.Background()); err != nil {
+		t.Fatalf("set division scoring: %v", err)
+	}
+
+	points, err = divisionPointsMap(context.Background(), env.db, division.ID)
+	if err != nil {
+		t.Fatalf("divisionPointsMap division: %v", err)
+	}
+
+	if want := scoring.DynamicPoints(500, 100, 1, 2); points[challenge.ID] != want {
+		t.Fatalf("expected division points %d, got %d", want, points[challenge.ID])
+	}
+
+	points, err = divisionPointsMap(context.Background(), env.db, 0)
+	if err != nil {
+		t.Fatalf("divisionPointsMap global: %v", err)
+	}
+
+	if points[challenge.ID] != global {
+		t.Fatalf("expected global points %d, got %d", global, points[challenge.ID])
+	}
+}
@@ -2,6 +2,9 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
 
 	"smctf/internal/models"
 
@@ -16,14 +19,24 @@ func NewStackRepo(db *bun.DB) *StackRepo {
 	return &StackRepo{db: db}
 }
 
-func (r *StackRepo) ListByUser(ctx context.Context, userID int64) ([]models.Stack, error) {
+// Personal stacks are visible to their owner, team stacks to every member of the team
+func visibleStacks(query *bun.SelectQuery, userID, teamID int64) *bun.SelectQuery {
+	return query.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+		q = q.Where("user_id = ? AND team_id = 0", userID)
+		if teamID > 0 {
+			q = q.WhereOr("team_id = ?", teamID)
+		}
+
+		return q
+	})
+}
+
+func (r *StackRepo) ListVisible(ctx context.Context, userID, teamID int64) ([]models.Stack, error) {
 	stacks := make([]models.Stack, 0)
-	if err := r.db.NewSelect().
-		Model(&stacks).
-		Where("user_id = ?", userID).
+	if err := visibleStacks(r.db.NewSelect().Model(&stacks), userID, teamID).
 		Order("created_at DESC").
 		Scan(ctx); err != nil {
-		return nil, wrapError("stackRepo.ListByUser", err)
+		return nil, wrapError("stackRepo.ListVisible", err)
 	}
 
 	return stacks, nil
@@ -41,19 +54,61 @@ func (r *StackRepo) CountByUser(ctx context.Context, userID int64) (int, error)
 	return count, nil
 }
 
-func (r *StackRepo) GetByUserAndChallenge(ctx context.Context, userID, challengeID int64) (*models.Stack, error) {
+// Prefers the team stack when a personal one for the same challenge is also left over
+func (r *StackRepo) GetVisible(ctx context.Context, userID, teamID, challengeID int64) (*models.Stack, error) {
 	stack := new(models.Stack)
-	if err := r.db.NewSelect().
-		Model(stack).
-		Where("user_id = ?", userID).
+	if err := visibleStacks(r.db.NewSelect().Model(stack), userID, teamID).
 		Where("challenge_id = ?", challengeID).
+		OrderExpr("team_id DESC").
+		Limit(1).
 		Scan(ctx); err != nil {
-		return nil, wrapNotFound("stackRepo.GetByUserAndChallenge", err)
+		return nil, wrapNotFound("stackRepo.GetVisible", err)
 	}
 
 	return stack, nil
 }
 
+// Team stack plus every member's personal stack for the challenge
+func (r *StackRepo) ListByTeamAndChallenge(ctx context.Context, teamID, challengeID int64) ([]models.Stack, error) {
+	stacks := make([]models.Stack, 0)
+	if err := r.db.NewSelect().
+		Model(&stacks).
+		Where("challenge_id = ?", challengeID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("team_id = ?", teamID).
+				WhereOr("team_id = 0 AND user_id IN (SELECT id FROM users WHERE team_id = ?)", teamID)
+		}).
+		Order("id ASC").
+		Scan(ctx); err != nil {
+		return nil, wrapError("stackRepo.ListByTeamAndChallenge", err)
+	}
+
+	return stacks, nil
+}
+
+// Team that owns shared stacks for the user, 0 without a team or in individual mode
+func (r *StackRepo) TeamIDForUser(ctx context.Context, userID int64) (int64, error) {
+	individual, err := individualMode(ctx, r.db)
+	if err != nil {
+		return 0, wrapError("stackRepo.TeamIDForUser", err)
+	}
+
+	if individual {
+		return 0, nil
+	}
+
+	var teamID int64
+	if err := r.db.NewSelect().
+		Model((*models.User)(nil)).
+		Column("team_id").
+		Where("id = ?", userID).
+		Scan(ctx, &teamID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, wrapError("stackRepo.TeamIDForUser", err)
+	}
+
+	return teamID, nil
+}
+
 func (r *StackRepo) GetByStackID(ctx context.Context, stackID string) (*models.Stack, error) {
 	stack := new(models.Stack)
 	if err := r.db.NewSelect().
@@ -66,6 +121,18 @@ func (r *StackRepo) GetByStackID(ctx context.Context, stackID string) (*models.S
 	return stack, nil
 }
 
+func (r *StackRepo) GetByID(ctx context.Context, id int64) (*models.Stack, error) {
+	stack := new(models.Stack)
+	if err := r.db.NewSelect().
+		Model(stack).
+		Where("id = ?", id).
+		Scan(ctx); err != nil {
+		return nil, wrapNotFound("stackRepo.GetByID", err)
+	}
+
+	return stack, nil
+}
+
 func (r *StackRepo) Create(ctx context.Context, stack *models.Stack) error {
 	if _, err := r.db.NewInsert().Model(stack).Exec(ctx); err != nil {
 		return wrapError("stackRepo.Create", err)
@@ -74,14 +141,48 @@ func (r *StackRepo) Create(ctx context.Context, stack *models.Stack) error {
 	return nil
 }
 
+// Writes every column but extend_count, which only ReserveExtend and ReleaseExtend change
 func (r *StackRepo) Update(ctx context.Context, stack *models.Stack) error {
-	if _, err := r.db.NewUpdate().Model(stack).WherePK().Exec(ctx); err != nil {
+	if _, err := r.db.NewUpdate().Model(stack).WherePK().ExcludeColumn("extend_count").Exec(ctx); err != nil {
 		return wrapError("stackRepo.Update", err)
 	}
 
 	return nil
 }
 
+// Takes one of max extensions before the provisioner is asked, ErrNotFound when they are used up
+func (r *StackRepo) ReserveExtend(ctx context.Context, id int64, max int) error {
+	res, err := r.db.NewUpdate().
+		Model((*models.Stack)(nil)).
+		Set("extend_count = extend_count + 1").
+		Where("id = ?", id).
+		Where("extend_count < ?", max).
+		Exec(ctx)
+	if err != nil {
+		return wrapError("stackRepo.ReserveExtend", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Gives back a reserved extension the provisioner did not apply
+func (r *StackRepo) ReleaseExtend(ctx context.Context, id int64) error {
+	if _, err := r.db.NewUpdate().
+		Model((*models.Stack)(nil)).
+		Set("extend_count = extend_count - 1").
+		Where("id = ?", id).
+		Where("extend_count > 0").
+		Exec(ctx); err != nil {
+		return wrapError("stackRepo.ReleaseExtend", err)
+	}
+
+	return nil
+}
+
 func (r *StackRepo) Delete(ctx context.Context, stack *models.Stack) error {
 	if _, err := r.db.NewDelete().Model(stack).WherePK().Exec(ctx); err != nil {
 		return wrapError("stackRepo.Delete", err)
@@ -90,6 +191,163 @@ func (r *StackRepo) Delete(ctx context.Context, stack *models.Stack) error {
 	return nil
 }
 
+// Moves a pending row to provisioning so only one worker creates its instance
+func (r *StackRepo) ClaimPending(ctx context.Context, id int64) (*models.Stack, error) {
+	stack := new(models.Stack)
+	if err := r.db.NewUpdate().
+		Model(stack).
+		Set("status = ?", models.StackStatusProvisioning).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("id = ?", id).
+		Where("status = ?", models.StackStatusPending).
+		Returning("*").
+		Scan(ctx); err != nil {
+		return nil, wrapNotFound("stackRepo.ClaimPending", err)
+	}
+
+	return stack, nil
+}
+
+// Stores the created instance, ErrNotFound when the row was deleted or requeued meanwhile
+func (r *StackRepo) CompleteProvisioning(ctx context.Context, stack *models.Stack) error {
+	res, err := r.db.NewUpdate().
+		Model(stack).
+		WherePK().
+		Where("status = ?", models.StackStatusProvisioning).
+		Where("stack_id = ''").
+		Exec(ctx)
+	if err != nil {
+		return wrapError("stackRepo.CompleteProvisioning", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Keeps the provisioner's answer in last_error so admins can see why the row failed
+func (r *StackRepo) MarkFailed(ctx context.Context, id int64, detail string) error {
+	if _, err := r.db.NewUpdate().
+		Model((*models.Stack)(nil)).
+		Set("status = ?", models.StackStatusFailed).
+		Set("last_error = ?", detail).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("id = ?", id).
+		Where("stack_id = ''").
+		Exec(ctx); err != nil {
+		return wrapError("stackRepo.MarkFailed", err)
+	}
+
+	return nil
+}
+
+// Puts a pending or provisioning row untouched since staleBefore back to pending, ErrNotFound when it moved on
+func (r *StackRepo) Requeue(ctx context.Context, id int64, staleBefore time.Time) error {
+	res, err := r.db.NewUpdate().
+		Model((*models.Stack)(nil)).
+		Set("status = ?", models.StackStatusPending).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("id = ?", id).
+		Where("stack_id = ''").
+		Where("status IN (?)", bun.In([]string{models.StackStatusPending, models.StackStatusProvisioning})).
+		Where("updated_at < ?", staleBefore).
+		Exec(ctx)
+	if err != nil {
+		return wrapError("stackRepo.Requeue", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Arbitrary key for pg_advisory_xact_lock, only one admission pass runs at a time across replicas
+const stackAdmissionLockKey = 0x736d637466
+
+// Moves the waiting rows picked by plan to pending, holding them to the estimated resources. plan gets the
+// current usage per challenge and every waiting row oldest first.
+func (r *StackRepo) AdmitWaiting(ctx context.Context, plan func([]models.StackUsage, []models.WaitingStack) []models.WaitingStack) ([]int64, error) {
+	admitted := make([]int64, 0)
+
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(?)", stackAdmissionLockKey); err != nil {
+			return err
+		}
+
+		usage := make([]models.StackUsage, 0)
+		if err := tx.NewSelect().
+			TableExpr("stacks AS s").
+			ColumnExpr("s.challenge_id").
+			ColumnExpr("COUNT(*) AS count").
+			ColumnExpr("COALESCE(SUM(s.requested_cpu_milli), 0) AS cpu_milli").
+			ColumnExpr("COALESCE(SUM(s.requested_memory_bytes), 0) AS memory_bytes").
+			Where("s.status NOT IN (?)", bun.In([]string{models.StackStatusWaiting, models.StackStatusFailed})).
+			GroupExpr("s.challenge_id").
+			Scan(ctx, &usage); err != nil {
+			return err
+		}
+
+		waiting := make([]models.WaitingStack, 0)
+		if err := tx.NewSelect().
+			TableExpr("stacks AS s").
+			ColumnExpr("s.id, s.challenge_id").
+			ColumnExpr("COALESCE(c.stack_cpu_milli, 0) AS cpu_milli").
+			ColumnExpr("COALESCE(c.stack_memory_bytes, 0) AS memory_bytes").
+			Join("LEFT JOIN challenges AS c ON c.id = s.challenge_id").
+			Where("s.status = ?", models.StackStatusWaiting).
+			OrderExpr("s.created_at ASC, s.id ASC").
+			Scan(ctx, &waiting); err != nil {
+			return err
+		}
+
+		if len(waiting) == 0 {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		for _, row := range plan(usage, waiting) {
+			if _, err := tx.NewUpdate().
+				Model((*models.Stack)(nil)).
+				Set("status = ?", models.StackStatusPending).
+				Set("requested_cpu_milli = ?", row.CPUMilli).
+				Set("requested_memory_bytes = ?", row.MemoryBytes).
+				Set("updated_at = ?", now).
+				Where("id = ?", row.ID).
+				Where("status = ?", models.StackStatusWaiting).
+				Exec(ctx); err != nil {
+				return err
+			}
+
+			admitted = append(admitted, row.ID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, wrapError("stackRepo.AdmitWaiting", err)
+	}
+
+	return admitted, nil
+}
+
+// 1 for the oldest waiting row
+func (r *StackRepo) WaitingPosition(ctx context.Context, stack *models.Stack) (int, error) {
+	ahead, err := r.db.NewSelect().
+		Model((*models.Stack)(nil)).
+		Where("status = ?", models.StackStatusWaiting).
+		Where("(created_at, id) < (?, ?)", stack.CreatedAt, stack.ID).
+		Count(ctx)
+	if err != nil {
+		return 0, wrapError("stackRepo.WaitingPosition", err)
+	}
+
+	return ahead + 1, nil
+}
+
 func (r *StackRepo) DeleteByUserAndChallenge(ctx context.Context, userID, challengeID int64) error {
 	if _, err := r.db.NewDelete().
 		Model((*models.Stack)(nil)).
@@ -101,3 +359,95 @@ func (r *StackRepo) DeleteByUserAndChallenge(ctx context.Context, userID, challe
 
 	return nil
 }
+
+func (r *StackRepo) ListAll(ctx context.Context) ([]models.Stack, error) {
+	stacks := make([]models.Stack, 0)
+	if err := r.db.NewSelect().
+		Model(&stacks).
+		Order("id ASC").
+		Scan(ctx); err != nil {
+		return nil, wrapError("stackRepo.ListAll", err)
+	}
+
+	return stacks, nil
+}
+
+func (r *StackRepo) baseSummaryQuery() *bun.SelectQuery {
+	return r.db.NewSelect().
+		TableExpr("stacks AS s").
+		ColumnExpr("s.id, s.stack_id, s.user_id, s.challenge_id, s.status").
+		ColumnExpr("s.node_public_ip, s.node_port, s.target_port, s.ttl_expires_at, s.extend_count, s.last_error, s.created_at, s.updated_at").
+		ColumnExpr("COALESCE(u.username, '') AS username").
+		ColumnExpr("COALESCE(NULLIF(s.team_id, 0), u.team_id, 0) AS team_id").
+		ColumnExpr("COALESCE(g.name, '') AS team_name").
+		ColumnExpr("s.team_id <> 0 AS shared").
+		ColumnExpr("COALESCE(c.title, '') AS challenge_title").
+		Join("LEFT JOIN users AS u ON u.id = s.user_id").
+		Join("LEFT JOIN teams AS g ON g.id = COALESCE(NULLIF(s.team_id, 0), u.team_id)").
+		Join("LEFT JOIN challenges AS c ON c.id = s.challenge_id")
+}
+
+func applyStackFilter(query *bun.SelectQuery, filter models.StackFilter) *bun.SelectQuery {
+	if filter.ChallengeID > 0 {
+		query = query.Where("s.challenge_id = ?", filter.ChallengeID)
+	}
+
+	if filter.UserID > 0 {
+		query = query.Where("s.user_id = ?", filter.UserID)
+	}
+
+	if filter.TeamID > 0 {
+		query = query.Where("COALESCE(NULLIF(s.team_id, 0), u.team_id) = ?", filter.TeamID)
+	}
+
+	if filter.Status != "" {
+		query = query.Where("s.status = ?", filter.Status)
+	}
+
+	return query
+}
+
+// Zero limit returns every matching row, total ignores limit and offset
+func (r *StackRepo) ListSummaries(ctx context.Context, filter models.StackFilter) ([]models.StackSummary, int, error) {
+	rows := make([]models.StackSummary, 0)
+
+	total, err := applyStackFilter(r.baseSummaryQuery(), filter).Count(ctx)
+	if err != nil {
+		return nil, 0, wrapError("stackRepo.ListSummaries count", err)
+	}
+
+	query := applyStackFilter(r.baseSummaryQuery(), filter).OrderExpr("s.id DESC")
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	if err := query.Scan(ctx, &rows); err != nil {
+		return nil, 0, wrapError("stackRepo.ListSummaries", err)
+	}
+
+	return rows, total, nil
+}
+
+func (r *StackRepo) CountByChallengeAndStatus(ctx context.Context) ([]models.StackCount, error) {
+	rows := make([]models.StackCount, 0)
+
+	if err := r.db.NewSelect().
+		TableExpr("stacks AS s").
+		ColumnExpr("s.challenge_id").
+		ColumnExpr("COALESCE(c.title, '') AS challenge_title").
+		ColumnExpr("s.status").
+		ColumnExpr("COUNT(*) AS count").
+		Join("LEFT JOIN challenges AS c ON c.id = s.challenge_id").
+		GroupExpr("s.challenge_id, c.title, s.status").
+		OrderExpr("s.challenge_id ASC, s.status ASC").
+		Scan(ctx, &rows); err != nil {
+		return nil, wrapError("stackRepo.CountByChallengeAndStatus", err)
+	}
+
+	return rows, nil
+}
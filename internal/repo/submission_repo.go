@@ -24,6 +24,19 @@ func (r *SubmissionRepo) Create(ctx context.Context, sub *models.Submission) err
 	return nil
 }
 
+func (r *SubmissionRepo) UserTeamID(ctx context.Context, userID int64) (int64, error) {
+	var teamID int64
+	if err := r.db.NewSelect().
+		TableExpr("users AS u").
+		ColumnExpr("u.team_id").
+		Where("u.id = ?", userID).
+		Scan(ctx, &teamID); err != nil {
+		return 0, wrapNotFound("submissionRepo.UserTeamID", err)
+	}
+
+	return teamID, nil
+}
+
 func (r *SubmissionRepo) lockTeamScope(ctx context.Context, db bun.IDB, userID int64) (int64, error) {
 	var teamID int64
 	if err := db.NewSelect().
@@ -65,12 +78,18 @@ func (r *SubmissionRepo) correctSubmissionCount(
 	ctx context.Context,
 	db bun.IDB,
 	challengeID int64,
+	userID int64,
 	teamID int64,
+	perUser bool,
 ) (int, error) {
 	query := r.baseCorrectSubmissionsQuery(db).
 		Where("s.challenge_id = ?", challengeID)
 
-	query = query.Where("u.team_id = ?", teamID)
+	if perUser {
+		query = query.Where("s.user_id = ?", userID)
+	} else {
+		query = query.Where("u.team_id = ?", teamID)
+	}
 
 	return query.Count(ctx)
 }
@@ -130,7 +149,14 @@ func (r *SubmissionRepo) CreateCorrectIfNotSolvedByTeam(ctx context.Context, sub
 		return false, wrapError("submissionRepo.CreateCorrectIfNotSolvedByTeam lock challenge", err)
 	}
 
-	count, err := r.correctSubmissionCount(ctx, tx, sub.ChallengeID, teamID)
+	individual, err := individualMode(ctx, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, wrapError("submissionRepo.CreateCorrectIfNotSolvedByTeam mode", err)
+	}
+
+	// Users without a team, e.g. registered in individual mode, never share solves
+	count, err := r.correctSubmissionCount(ctx, tx, sub.ChallengeID, sub.UserID, teamID, individual || teamID == 0)
 	if err != nil {
 		_ = tx.Rollback()
 		return false, wrapError("submissionRepo.CreateCorrectIfNotSolvedByTeam check", err)
@@ -162,11 +188,23 @@ func (r *SubmissionRepo) CreateCorrectIfNotSolvedByTeam(ctx context.Context, sub
 }
 
 func (r *SubmissionRepo) HasCorrect(ctx context.Context, userID, challengeID int64) (bool, error) {
-	count, err := r.baseCorrectSubmissionsQuery(r.db).
-		Join("JOIN users AS me ON me.id = ?", userID).
-		Where("s.challenge_id = ?", challengeID).
-		Where("u.team_id = me.team_id").
-		Count(ctx)
+	individual, err := individualMode(ctx, r.db)
+	if err != nil {
+		return false, wrapError("submissionRepo.HasCorrect", err)
+	}
+
+	query := r.baseCorrectSubmissionsQuery(r.db).
+		Where("s.challenge_id = ?", challengeID)
+
+	if individual {
+		query = query.Where("s.user_id = ?", userID)
+	} else {
+		query = query.
+			Join("JOIN users AS me ON me.id = ?", userID).
+			Where("(u.team_id = me.team_id AND me.team_id <> 0) OR u.id = me.id")
+	}
+
+	count, err := query.Count(ctx)
 
 	if err != nil {
 		return false, wrapError("submissionRepo.HasCorrect", err)
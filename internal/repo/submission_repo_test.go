@@ -167,6 +167,95 @@ func TestSubmissionRepoCreateCorrectIfNotSolvedByTeam(t *testing.T) {
 	}
 }
 
+func setIndividualMode(t *testing.T, env repoEnv) {
+	t.Helper()
+	cfg := &models.AppConfig{
+		Key:       models.AppConfigKeyCompetitionMode,
+		Value:     models.CompetitionModeIndividual,
+		UpdatedAt: time.Now().UTC(),
+	}
+	if _, err := env.db.NewInsert().Model(cfg).Exec(context.Background()); err != nil {
+		t.Fatalf("set individual mode: %v", err)
+	}
+}
+
+func TestSubmissionRepoCreateCorrectIndividualMode(t *testing.T) {
+	env := setupRepoTest(t)
+	team := createTeam(t, env, "Alpha")
+	user1 := createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", team.ID)
+	user2 := createUserWithTeam(t, env, "u2@example.com", "u2", "pass", "user", team.ID)
+	ch := createChallenge(t, env, "ch1", 100, "FLAG{1}", true)
+	setIndividualMode(t, env)
+
+	now := time.Now().UTC()
+	for i, user := range []*models.User{user1, user2} {
+		sub := &models.Submission{
+			UserID:      user.ID,
+			ChallengeID: ch.ID,
+			Provided:    "flag{1}",
+			Correct:     true,
+			SubmittedAt: now.Add(time.Duration(i) * time.Second),
+		}
+
+		inserted, err := env.submissionRepo.CreateCorrectIfNotSolvedByTeam(context.Background(), sub)
+		if err != nil {
+			t.Fatalf("CreateCorrectIfNotSolvedByTeam: %v", err)
+		}
+
+		if !inserted {
+			t.Fatalf("expected insert for user %d", user.ID)
+		}
+	}
+
+	repeat := &models.Submission{UserID: user1.ID, ChallengeID: ch.ID, Provided: "flag{1}", Correct: true, SubmittedAt: now.Add(time.Minute)}
+	inserted, err := env.submissionRepo.CreateCorrectIfNotSolvedByTeam(context.Background(), repeat)
+	if err != nil {
+		t.Fatalf("CreateCorrectIfNotSolvedByTeam repeat: %v", err)
+	}
+
+	if inserted {
+		t.Fatalf("expected repeat solve to be blocked")
+	}
+}
+
+func TestSubmissionRepoHasCorrectIndividualMode(t *testing.T) {
+	env := setupRepoTest(t)
+	team := createTeam(t, env, "Alpha")
+	user1 := createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", team.ID)
+	user2 := createUserWithTeam(t, env, "u2@example.com", "u2", "pass", "user", team.ID)
+	ch := createChallenge(t, env, "ch1", 100, "FLAG{1}", true)
+	setIndividualMode(t, env)
+
+	createSubmission(t, env, user1.ID, ch.ID, true, time.Now().UTC())
+
+	if ok, err := env.submissionRepo.HasCorrect(context.Background(), user2.ID, ch.ID); err != nil {
+		t.Fatalf("HasCorrect teammate: %v", err)
+	} else if ok {
+		t.Fatalf("expected teammate to be unsolved in individual mode")
+	}
+}
+
+func TestSubmissionRepoHasCorrectWithoutTeam(t *testing.T) {
+	env := setupRepoTest(t)
+	user1 := createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", 0)
+	user2 := createUserWithTeam(t, env, "u2@example.com", "u2", "pass", "user", 0)
+	ch := createChallenge(t, env, "ch1", 100, "FLAG{1}", true)
+
+	createSubmission(t, env, user1.ID, ch.ID, true, time.Now().UTC())
+
+	if ok, err := env.submissionRepo.HasCorrect(context.Background(), user1.ID, ch.ID); err != nil {
+		t.Fatalf("HasCorrect solver: %v", err)
+	} else if !ok {
+		t.Fatalf("expected solver to have solved")
+	}
+
+	if ok, err := env.submissionRepo.HasCorrect(context.Background(), user2.ID, ch.ID); err != nil {
+		t.Fatalf("HasCorrect other: %v", err)
+	} else if ok {
+		t.Fatalf("expected teamless users not to share solves")
+	}
+}
+
 func TestSubmissionRepoFirstBloodAcrossTeams(t *testing.T) {
 	env := setupRepoTest(t)
 	teamA := createTeam(t, env, "Alpha")
@@ -2,6 +2,8 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"smctf/internal/models"
 
@@ -42,15 +44,326 @@ func (r *TeamRepo) GetByID(ctx context.Context, id int64) (*models.Team, error)
 	return team, nil
 }
 
+func (r *TeamRepo) UpdateName(ctx context.Context, id int64, name string) error {
+	res, err := r.db.NewUpdate().
+		Model((*models.Team)(nil)).
+		Set("name = ?", name).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return wrapError("teamRepo.UpdateName", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Division 0 takes the team out of every division
+func (r *TeamRepo) UpdateDivision(ctx context.Context, id, divisionID int64) error {
+	res, err := r.db.NewUpdate().
+		Model((*models.Team)(nil)).
+		Set("division_id = ?", divisionID).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return wrapError("teamRepo.UpdateDivision", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Captain 0 leaves the team without one
+func (r *TeamRepo) UpdateCaptain(ctx context.Context, id, captainID int64) error {
+	res, err := r.db.NewUpdate().
+		Model((*models.Team)(nil)).
+		Set("captain_id = ?", captainID).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return wrapError("teamRepo.UpdateCaptain", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *TeamRepo) UpdateProfile(ctx context.Context, id int64, profile models.Profile) error {
+	res, err := r.db.NewUpdate().
+		Model((*models.Team)(nil)).
+		Set("affiliation = ?", profile.Affiliation).
+		Set("country = ?", profile.Country).
+		Set("website = ?", profile.Website).
+		Set("bio = ?", profile.Bio).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return wrapError("teamRepo.UpdateProfile", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Deletes the team and revokes its registration keys, which stay behind without a team so their use history is kept.
+// Reports false without changing anything when the team still has members.
+func (r *TeamRepo) DeleteIfEmpty(ctx context.Context, id, revokedBy int64) (bool, error) {
+	deleted := false
+
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockTeams(ctx, tx, id); err != nil {
+			return err
+		}
+
+		members, err := tx.NewSelect().TableExpr("users AS u").Where("u.team_id = ?", id).Count(ctx)
+		if err != nil {
+			return err
+		}
+
+		if members > 0 {
+			return nil
+		}
+
+		// Keys revoked earlier keep their original revocation
+		if _, err := tx.NewUpdate().
+			Model((*models.RegistrationKey)(nil)).
+			Set("team_id = 0").
+			Set("revoked_by = CASE WHEN revoked_at IS NULL THEN ? ELSE revoked_by END", revokedBy).
+			Set("revoked_at = COALESCE(revoked_at, ?)", time.Now().UTC()).
+			Where("team_id = ?", id).
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewDelete().Model((*models.Team)(nil)).Where("id = ?", id).Exec(ctx); err != nil {
+			return err
+		}
+
+		deleted = true
+		return nil
+	})
+	if err != nil {
+		return false, wrapNotFound("teamRepo.DeleteIfEmpty", err)
+	}
+
+	return deleted, nil
+}
+
+// Moves the user and drops solves their new team already had, keeping one correct submission per team and challenge
+func (r *TeamRepo) MoveUser(ctx context.Context, userID, teamID int64) error {
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var lockedID int64
+		if err := tx.NewSelect().
+			TableExpr("users AS u").
+			ColumnExpr("u.id").
+			Where("u.id = ?", userID).
+			For("UPDATE").
+			Scan(ctx, &lockedID); err != nil {
+			return err
+		}
+
+		if err := lockTeams(ctx, tx, teamID); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("team_id = ?", teamID).
+			Set("updated_at = ?", time.Now().UTC()).
+			Where("id = ?", userID).
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		// A captain who leaves gives up the old team's captaincy
+		if _, err := tx.NewUpdate().
+			Model((*models.Team)(nil)).
+			Set("captain_id = 0").
+			Where("captain_id = ?", userID).
+			Where("id <> ?", teamID).
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		return dedupeTeamSolves(ctx, tx, teamID)
+	})
+	if err != nil {
+		return wrapNotFound("teamRepo.MoveUser", err)
+	}
+
+	return nil
+}
+
+// Moves every member and registration key of source into target, deduplicates solves and deletes source
+func (r *TeamRepo) Merge(ctx context.Context, targetID, sourceID int64) error {
+	err := r.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Users before teams, the same order submissions lock them in
+		if _, err := tx.NewSelect().
+			TableExpr("users AS u").
+			ColumnExpr("u.id").
+			Where("u.team_id IN (?)", bun.In([]int64{targetID, sourceID})).
+			OrderExpr("u.id ASC").
+			For("UPDATE").
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if err := lockTeams(ctx, tx, targetID, sourceID); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("team_id = ?", targetID).
+			Set("updated_at = ?", time.Now().UTC()).
+			Where("team_id = ?", sourceID).
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewUpdate().
+			Model((*models.RegistrationKey)(nil)).
+			Set("team_id = ?", targetID).
+			Where("team_id = ?", sourceID).
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		if err := dedupeTeamSolves(ctx, tx, targetID); err != nil {
+			return err
+		}
+
+		// A target without a captain inherits the source's
+		if _, err := tx.NewUpdate().
+			Model((*models.Team)(nil)).
+			Set("captain_id = (SELECT src.captain_id FROM teams AS src WHERE src.id = ?)", sourceID).
+			Where("id = ?", targetID).
+			Where("captain_id = 0").
+			Exec(ctx); err != nil {
+			return err
+		}
+
+		_, err := tx.NewDelete().Model((*models.Team)(nil)).Where("id = ?", sourceID).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return wrapNotFound("teamRepo.Merge", err)
+	}
+
+	return nil
+}
+
+// Locks the teams in id order and fails with sql.ErrNoRows when any of them is missing
+func lockTeams(ctx context.Context, db bun.IDB, ids ...int64) error {
+	locked := make([]int64, 0, len(ids))
+	if err := db.NewSelect().
+		TableExpr("teams AS t").
+		ColumnExpr("t.id").
+		Where("t.id IN (?)", bun.In(ids)).
+		OrderExpr("t.id ASC").
+		For("UPDATE").
+		Scan(ctx, &locked); err != nil {
+		return err
+	}
+
+	if len(locked) != len(ids) {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Keeps the earliest correct submission per challenge within the team, deletes the rest and recomputes first bloods
+func dedupeTeamSolves(ctx context.Context, db bun.IDB, teamID int64) error {
+	ranked := db.NewSelect().
+		TableExpr("submissions AS s").
+		ColumnExpr("s.id AS id").
+		ColumnExpr("s.challenge_id AS challenge_id").
+		ColumnExpr("ROW_NUMBER() OVER (PARTITION BY s.challenge_id ORDER BY s.submitted_at ASC, s.id ASC) AS rn").
+		Join("JOIN users AS u ON u.id = s.user_id").
+		Where("s.correct = true").
+		Where("u.team_id = ?", teamID)
+
+	var dupes []struct {
+		ID          int64 `bun:"id"`
+		ChallengeID int64 `bun:"challenge_id"`
+	}
+	if err := db.NewSelect().
+		TableExpr("(?) AS r", ranked).
+		ColumnExpr("r.id, r.challenge_id").
+		Where("r.rn > 1").
+		Scan(ctx, &dupes); err != nil {
+		return err
+	}
+
+	if len(dupes) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(dupes))
+	challengeIDs := make([]int64, 0, len(dupes))
+	for _, dupe := range dupes {
+		ids = append(ids, dupe.ID)
+		challengeIDs = append(challengeIDs, dupe.ChallengeID)
+	}
+
+	if _, err := db.NewDelete().
+		Model((*models.Submission)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx); err != nil {
+		return err
+	}
+
+	return recomputeFirstBloods(ctx, db, challengeIDs)
+}
+
+func recomputeFirstBloods(ctx context.Context, db bun.IDB, challengeIDs []int64) error {
+	first := db.NewSelect().
+		TableExpr("submissions AS f").
+		ColumnExpr("DISTINCT ON (f.challenge_id) f.id").
+		Where("f.correct = true").
+		Where("f.challenge_id IN (?)", bun.In(challengeIDs)).
+		OrderExpr("f.challenge_id, f.submitted_at ASC, f.id ASC")
+
+	_, err := db.NewUpdate().
+		Model((*models.Submission)(nil)).
+		Set("is_first_blood = (id IN (?))", first).
+		Where("challenge_id IN (?)", bun.In(challengeIDs)).
+		Where("correct = true").
+		Exec(ctx)
+
+	return err
+}
+
 func (r *TeamRepo) baseTeamStatsQuery() *bun.SelectQuery {
 	return r.db.NewSelect().
 		TableExpr("teams AS t").
 		ColumnExpr("t.id AS id").
 		ColumnExpr("t.name AS name").
+		ColumnExpr("t.division_id AS division_id").
+		ColumnExpr("COALESCE(d.name, '') AS division_name").
+		ColumnExpr("t.captain_id AS captain_id").
+		ColumnExpr("t.affiliation AS affiliation").
+		ColumnExpr("t.country AS country").
+		ColumnExpr("t.website AS website").
+		ColumnExpr("t.bio AS bio").
 		ColumnExpr("t.created_at AS created_at").
 		ColumnExpr("COUNT(DISTINCT u.id) AS member_count").
 		Join("LEFT JOIN users AS u ON u.team_id = t.id").
-		GroupExpr("t.id, t.name, t.created_at")
+		Join("LEFT JOIN divisions AS d ON d.id = t.division_id").
+		GroupExpr("t.id, d.name")
 }
 
 func (r *TeamRepo) ListWithStats(ctx context.Context) ([]models.TeamSummary, error) {
@@ -205,3 +205,221 @@ func TestTeamRepoListWithStatsError(t *testing.T) {
 		t.Fatalf("expected error from ListWithStats")
 	}
 }
+
+func TestTeamRepoUpdateName(t *testing.T) {
+	env := setupRepoTest(t)
+	team := createTeam(t, env, "Alpha")
+
+	if err := env.teamRepo.UpdateName(context.Background(), team.ID, "Alpha Prime"); err != nil {
+		t.Fatalf("UpdateName: %v", err)
+	}
+
+	got, err := env.teamRepo.GetByID(context.Background(), team.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if got.Name != "Alpha Prime" {
+		t.Fatalf("expected renamed team, got %+v", got)
+	}
+
+	if err := env.teamRepo.UpdateName(context.Background(), 999, "Ghost"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTeamRepoDeleteIfEmpty(t *testing.T) {
+	env := setupRepoTest(t)
+	empty := createTeam(t, env, "Empty")
+	full := createTeam(t, env, "Full")
+	admin := createUserWithTeam(t, env, "admin@example.com", "admin", "pass", "admin", full.ID)
+
+	key := &models.RegistrationKey{Code: "123456", CreatedBy: admin.ID, TeamID: empty.ID, CreatedAt: time.Now().UTC()}
+	if err := env.regKeyRepo.Create(context.Background(), key); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	deleted, err := env.teamRepo.DeleteIfEmpty(context.Background(), full.ID, admin.ID)
+	if err != nil || deleted {
+		t.Fatalf("expected team with members to stay, got deleted=%v err=%v", deleted, err)
+	}
+
+	deleted, err = env.teamRepo.DeleteIfEmpty(context.Background(), empty.ID, admin.ID)
+	if err != nil || !deleted {
+		t.Fatalf("expected empty team deleted, got deleted=%v err=%v", deleted, err)
+	}
+
+	summary, err := env.regKeyRepo.GetSummaryByID(context.Background(), key.ID)
+	if err != nil {
+		t.Fatalf("expected registration key kept, got %v", err)
+	}
+
+	if summary.TeamID != 0 || summary.RevokedAt == nil {
+		t.Fatalf("expected registration key revoked without a team, got %+v", summary)
+	}
+
+	if _, err := env.teamRepo.DeleteIfEmpty(context.Background(), empty.ID, admin.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTeamRepoMoveUserDedupesSolves(t *testing.T) {
+	env := setupRepoTest(t)
+	teamA := createTeam(t, env, "Alpha")
+	teamB := createTeam(t, env, "Beta")
+	userA := createUserWithTeam(t, env, "a@example.com", "alpha", "pass", "user", teamA.ID)
+	userB := createUserWithTeam(t, env, "b@example.com", "beta", "pass", "user", teamB.ID)
+	challenge := createChallenge(t, env, "Shared", 100, "flag{shared}", true)
+
+	now := time.Now().UTC()
+	early := createSubmission(t, env, userB.ID, challenge.ID, true, now.Add(-2*time.Minute))
+	late := createSubmission(t, env, userA.ID, challenge.ID, true, now.Add(-time.Minute))
+
+	if err := env.teamRepo.MoveUser(context.Background(), userA.ID, teamB.ID); err != nil {
+		t.Fatalf("MoveUser: %v", err)
+	}
+
+	var ids []int64
+	if err := env.db.NewSelect().TableExpr("submissions").ColumnExpr("id").Where("correct = true").Scan(context.Background(), &ids); err != nil {
+		t.Fatalf("select submissions: %v", err)
+	}
+
+	if len(ids) != 1 || ids[0] != early.ID {
+		t.Fatalf("expected only %d kept (dropped %d), got %v", early.ID, late.ID, ids)
+	}
+
+	if err := env.teamRepo.MoveUser(context.Background(), 999, teamB.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for user, got %v", err)
+	}
+}
+
+func TestTeamRepoMerge(t *testing.T) {
+	env := setupRepoTest(t)
+	target := createTeam(t, env, "Target")
+	source := createTeam(t, env, "Source")
+	other := createTeam(t, env, "Other")
+	userT := createUserWithTeam(t, env, "t@example.com", "target", "pass", "user", target.ID)
+	userS := createUserWithTeam(t, env, "s@example.com", "source", "pass", "user", source.ID)
+	userO := createUserWithTeam(t, env, "o@example.com", "other", "pass", "user", other.ID)
+	challenge := createChallenge(t, env, "Shared", 100, "flag{shared}", true)
+
+	key := &models.RegistrationKey{Code: "654321", CreatedBy: userT.ID, TeamID: source.ID, CreatedAt: time.Now().UTC()}
+	if err := env.regKeyRepo.Create(context.Background(), key); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	now := time.Now().UTC()
+	sourceSolve := createSubmission(t, env, userS.ID, challenge.ID, true, now.Add(-3*time.Minute))
+	targetSolve := createSubmission(t, env, userT.ID, challenge.ID, true, now.Add(-2*time.Minute))
+	otherSolve := createSubmission(t, env, userO.ID, challenge.ID, true, now.Add(-time.Minute))
+
+	// Mark the later target solve as first blood to check that it gets recomputed
+	if _, err := env.db.NewUpdate().Model((*models.Submission)(nil)).Set("is_first_blood = (id = ?)", targetSolve.ID).Where("1 = 1").Exec(context.Background()); err != nil {
+		t.Fatalf("set first blood: %v", err)
+	}
+
+	if err := env.teamRepo.Merge(context.Background(), target.ID, source.ID); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if _, err := env.teamRepo.GetByID(context.Background(), source.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected source team deleted, got %v", err)
+	}
+
+	members, err := env.teamRepo.ListMembers(context.Background(), target.ID)
+	if err != nil {
+		t.Fatalf("ListMembers: %v", err)
+	}
+
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %+v", members)
+	}
+
+	movedKey, err := env.regKeyRepo.GetSummaryByID(context.Background(), key.ID)
+	if err != nil || movedKey.TeamID != target.ID {
+		t.Fatalf("expected key moved to target, got %+v err=%v", movedKey, err)
+	}
+
+	var subs []models.Submission
+	if err := env.db.NewSelect().Model(&subs).Where("correct = true").Order("id ASC").Scan(context.Background()); err != nil {
+		t.Fatalf("select submissions: %v", err)
+	}
+
+	if len(subs) != 2 || subs[0].ID != sourceSolve.ID || subs[1].ID != otherSolve.ID {
+		t.Fatalf("expected earliest team solve and other team solve, got %+v", subs)
+	}
+
+	if !subs[0].IsFirstBlood || subs[1].IsFirstBlood {
+		t.Fatalf("expected first blood on earliest solve, got %+v", subs)
+	}
+}
+
+func TestTeamRepoCaptainAndProfile(t *testing.T) {
+	env := setupRepoTest(t)
+	team := createTeam(t, env, "Alpha")
+	other := createTeam(t, env, "Beta")
+	captain := createUserWithTeam(t, env, "c@example.com", "captain", "pass", "user", team.ID)
+
+	if err := env.teamRepo.UpdateCaptain(context.Background(), team.ID, captain.ID); err != nil {
+		t.Fatalf("UpdateCaptain: %v", err)
+	}
+
+	profile := models.Profile{Affiliation: "KAIST", Country: "KR", Website: "https://alpha.example", Bio: "hi"}
+	if err := env.teamRepo.UpdateProfile(context.Background(), team.ID, profile); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	stats, err := env.teamRepo.GetStats(context.Background(), team.ID)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+
+	if stats.CaptainID != captain.ID || stats.Country != "KR" || stats.Affiliation != "KAIST" || stats.Website != profile.Website || stats.Bio != "hi" {
+		t.Fatalf("unexpected team summary: %+v", stats)
+	}
+
+	if err := env.teamRepo.MoveUser(context.Background(), captain.ID, other.ID); err != nil {
+		t.Fatalf("MoveUser: %v", err)
+	}
+
+	moved, err := env.teamRepo.GetByID(context.Background(), team.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if moved.CaptainID != 0 {
+		t.Fatalf("expected captain cleared after move, got %d", moved.CaptainID)
+	}
+
+	if err := env.teamRepo.UpdateCaptain(context.Background(), 999, captain.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := env.teamRepo.UpdateProfile(context.Background(), 999, profile); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTeamRepoMergeInheritsCaptain(t *testing.T) {
+	env := setupRepoTest(t)
+	target := createTeam(t, env, "Target")
+	source := createTeam(t, env, "Source")
+	userS := createUserWithTeam(t, env, "s@example.com", "source", "pass", "user", source.ID)
+
+	if err := env.teamRepo.UpdateCaptain(context.Background(), source.ID, userS.ID); err != nil {
+		t.Fatalf("UpdateCaptain: %v", err)
+	}
+
+	if err := env.teamRepo.Merge(context.Background(), target.ID, source.ID); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	merged, err := env.teamRepo.GetByID(context.Background(), target.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if merged.CaptainID != userS.ID {
+		t.Fatalf("expected captain %d, got %d", userS.ID, merged.CaptainID)
+	}
+}
@@ -24,8 +24,11 @@ type repoEnv struct {
 	userRepo       *UserRepo
 	regKeyRepo     *RegistrationKeyRepo
 	teamRepo       *TeamRepo
+	divisionRepo   *DivisionRepo
 	challengeRepo  *ChallengeRepo
 	submissionRepo *SubmissionRepo
+	apiTokenRepo   *APITokenRepo
+	loginFailures  *LoginFailureRepo
 }
 
 var (
@@ -145,7 +148,10 @@ func setupRepoTest(t *testing.T) repoEnv {
 		db:             repoDB,
 		userRepo:       NewUserRepo(repoDB),
 		regKeyRepo:     NewRegistrationKeyRepo(repoDB),
+		apiTokenRepo:   NewAPITokenRepo(repoDB),
+		loginFailures:  NewLoginFailureRepo(repoDB),
 		teamRepo:       NewTeamRepo(repoDB),
+		divisionRepo:   NewDivisionRepo(repoDB),
 		challengeRepo:  NewChallengeRepo(repoDB),
 		submissionRepo: NewSubmissionRepo(repoDB),
 	}
@@ -153,7 +159,7 @@ func setupRepoTest(t *testing.T) repoEnv {
 
 func resetRepoState(t *testing.T) {
 	t.Helper()
-	if _, err := repoDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, stacks, challenges, users, teams RESTART IDENTITY CASCADE"); err != nil {
+	if _, err := repoDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, api_tokens, login_failures, stacks, challenges, users, teams, divisions RESTART IDENTITY CASCADE"); err != nil {
 		t.Fatalf("truncate tables: %v", err)
 	}
 }
@@ -200,6 +206,30 @@ func createTeam(t *testing.T, env repoEnv, name string) *models.Team {
 	return team
 }
 
+func createDivision(t *testing.T, env repoEnv, name string) *models.Division {
+	t.Helper()
+	division := &models.Division{
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := env.divisionRepo.Create(context.Background(), division); err != nil {
+		t.Fatalf("create division: %v", err)
+	}
+
+	return division
+}
+
+func createTeamInDivision(t *testing.T, env repoEnv, name string, divisionID int64) *models.Team {
+	t.Helper()
+	team := createTeam(t, env, name)
+	if err := env.teamRepo.UpdateDivision(context.Background(), team.ID, divisionID); err != nil {
+		t.Fatalf("set team division: %v", err)
+	}
+	team.DivisionID = divisionID
+
+	return team
+}
+
 func createChallenge(t *testing.T, env repoEnv, title string, points int, flag string, active bool) *models.Challenge {
 	t.Helper()
 	challenge := &models.Challenge{
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"smctf/internal/models"
 
@@ -34,6 +35,16 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User,
 	return user, nil
 }
 
+func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	user := new(models.User)
+
+	if err := r.db.NewSelect().Model(user).Where("username = ?", username).Scan(ctx); err != nil {
+		return nil, wrapNotFound("userRepo.GetByUsername", err)
+	}
+
+	return user, nil
+}
+
 func (r *UserRepo) GetByEmailOrUsername(ctx context.Context, email, username string) (*models.User, error) {
 	user := new(models.User)
 
@@ -50,8 +61,8 @@ func (r *UserRepo) baseUserWithTeamQuery() *bun.SelectQuery {
 	return r.db.NewSelect().
 		TableExpr("users AS u").
 		ColumnExpr("u.*").
-		ColumnExpr("g.name AS team_name").
-		Join("JOIN teams AS g ON g.id = u.team_id")
+		ColumnExpr("COALESCE(g.name, '') AS team_name").
+		Join("LEFT JOIN teams AS g ON g.id = u.team_id")
 }
 
 func (r *UserRepo) GetByID(ctx context.Context, id int64) (*models.User, error) {
@@ -88,3 +99,24 @@ func (r *UserRepo) Update(ctx context.Context, user *models.User) error {
 
 	return nil
 }
+
+func (r *UserRepo) UpdateProfile(ctx context.Context, id int64, profile models.Profile) error {
+	res, err := r.db.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("affiliation = ?", profile.Affiliation).
+		Set("country = ?", profile.Country).
+		Set("website = ?", profile.Website).
+		Set("bio = ?", profile.Bio).
+		Set("updated_at = ?", time.Now().UTC()).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return wrapError("userRepo.UpdateProfile", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -175,3 +175,26 @@ func TestUserRepoCreateError(t *testing.T) {
 		t.Fatalf("expected error from Create")
 	}
 }
+
+func TestUserRepoUpdateProfile(t *testing.T) {
+	env := setupRepoTest(t)
+	user := createUser(t, env, "u1@example.com", "u1", "pass", "user")
+
+	profile := models.Profile{Affiliation: "KAIST", Country: "KR", Website: "https://u1.example", Bio: "hello"}
+	if err := env.userRepo.UpdateProfile(context.Background(), user.ID, profile); err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	got, err := env.userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if got.Affiliation != "KAIST" || got.Country != "KR" || got.Website != profile.Website || got.Bio != "hello" {
+		t.Fatalf("unexpected profile: %+v", got)
+	}
+
+	if err := env.userRepo.UpdateProfile(context.Background(), 999, profile); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
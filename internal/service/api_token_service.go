@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"smctf/internal/auth"
+	"smctf/internal/models"
+	"smctf/internal/repo"
+)
+
+const (
+	maxAPITokenNameLength = 64
+	maxAPITokensPerUser   = 20
+	apiTokenTouchInterval = time.Minute
+)
+
+// Scopes that may be granted, mapped to the permission the owner needs for them
+var apiTokenScopes = map[string]string{
+	models.ScopeRead:            "",
+	models.ScopeSubmit:          "",
+	models.ScopeStacks:          "",
+	models.ScopeAdminChallenges: auth.PermChallengesRead,
+}
+
+func scopeAllowed(role, scope string) bool {
+	permission := apiTokenScopes[scope]
+	return permission == "" || auth.HasPermission(role, permission)
+}
+
+type APITokenService struct {
+	tokenRepo *repo.APITokenRepo
+	userRepo  *repo.UserRepo
+}
+
+func NewAPITokenService(tokenRepo *repo.APITokenRepo, userRepo *repo.UserRepo) *APITokenService {
+	return &APITokenService{tokenRepo: tokenRepo, userRepo: userRepo}
+}
+
+func (s *APITokenService) CreateToken(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time) (string, *models.APIToken, error) {
+	name = normalizeTrim(name)
+	scopes = normalizeScopes(scopes)
+
+	validator := newFieldValidator()
+	validator.PositiveID("user_id", userID)
+	validator.Required("name", name)
+	if len(name) > maxAPITokenNameLength {
+		validator.fields = append(validator.fields, FieldError{Field: "name", Reason: "too long"})
+	}
+
+	if len(scopes) == 0 {
+		validator.fields = append(validator.fields, FieldError{Field: "scopes", Reason: "required"})
+	}
+
+	now := time.Now().UTC()
+	if expiresAt != nil && !expiresAt.After(now) {
+		validator.fields = append(validator.fields, FieldError{Field: "expires_at", Reason: "must be in the future"})
+	}
+
+	if err := validator.Error(); err != nil {
+		return "", nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", nil, fmt.Errorf("apiToken.CreateToken lookup: %w", err)
+	}
+
+	for _, scope := range scopes {
+		if _, ok := apiTokenScopes[scope]; !ok {
+			return "", nil, NewValidationError(FieldError{Field: "scopes", Reason: "invalid"})
+		}
+
+		if !scopeAllowed(user.Role, scope) {
+			return "", nil, NewValidationError(FieldError{Field: "scopes", Reason: "forbidden"})
+		}
+	}
+
+	count, err := s.tokenRepo.CountActiveByUser(ctx, userID)
+	if err != nil {
+		return "", nil, fmt.Errorf("apiToken.CreateToken count: %w", err)
+	}
+
+	if count >= maxAPITokensPerUser {
+		return "", nil, NewValidationError(FieldError{Field: "name", Reason: "token limit reached"})
+	}
+
+	raw, err := auth.GenerateAPIToken()
+	if err != nil {
+		return "", nil, fmt.Errorf("apiToken.CreateToken generate: %w", err)
+	}
+
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	token := &models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: auth.HashAPIToken(raw),
+		Prefix:    auth.APITokenDisplayPrefix(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return "", nil, fmt.Errorf("apiToken.CreateToken create: %w", err)
+	}
+
+	return raw, token, nil
+}
+
+func (s *APITokenService) ListTokens(ctx context.Context, userID int64) ([]models.APIToken, error) {
+	tokens, err := s.tokenRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("apiToken.ListTokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *APITokenService) RevokeToken(ctx context.Context, userID, tokenID int64) error {
+	validator := newFieldValidator()
+	validator.PositiveID("id", tokenID)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	token, err := s.tokenRepo.GetByID(ctx, tokenID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return ErrAPITokenNotFound
+		}
+
+		return fmt.Errorf("apiToken.RevokeToken lookup: %w", err)
+	}
+
+	if token.UserID != userID || token.RevokedAt != nil {
+		return ErrAPITokenNotFound
+	}
+
+	if err := s.tokenRepo.Revoke(ctx, token.ID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("apiToken.RevokeToken: %w", err)
+	}
+
+	return nil
+}
+
+// Revokes every active token of the user, e.g. when an admin signs them out everywhere
+func (s *APITokenService) RevokeUserTokens(ctx context.Context, userID int64) (int, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("id", userID)
+	if err := validator.Error(); err != nil {
+		return 0, err
+	}
+
+	revoked, err := s.tokenRepo.RevokeByUser(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("apiToken.RevokeUserTokens: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// Returns a nil token for unknown, revoked or expired tokens. Scopes are dropped once the owner loses the permission they need.
+func (s *APITokenService) AuthenticateAPIToken(ctx context.Context, raw string) (*models.APIToken, *models.User, error) {
+	if !auth.IsAPIToken(raw) {
+		return nil, nil, nil
+	}
+
+	token, err := s.tokenRepo.GetByHash(ctx, auth.HashAPIToken(raw))
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, nil, nil
+		}
+
+		return nil, nil, fmt.Errorf("apiToken.Authenticate lookup: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if token.RevokedAt != nil || (token.ExpiresAt != nil && !token.ExpiresAt.After(now)) {
+		return nil, nil, nil
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, nil, nil
+		}
+
+		return nil, nil, fmt.Errorf("apiToken.Authenticate user: %w", err)
+	}
+
+	scopes := make([]string, 0, len(token.Scopes))
+	for _, scope := range token.Scopes {
+		if scopeAllowed(user.Role, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	token.Scopes = scopes
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		if err := s.tokenRepo.TouchLastUsed(ctx, token.ID, now); err == nil {
+			token.LastUsedAt = &now
+		}
+	}
+
+	return token, user, nil
+}
+
+func normalizeScopes(scopes []string) []string {
+	out := make([]string, 0, len(scopes))
+	seen := make(map[string]struct{}, len(scopes))
+
+	for _, scope := range scopes {
+		scope = strings.ToLower(normalizeTrim(scope))
+		if scope == "" {
+			continue
+		}
+
+		if _, ok := seen[scope]; ok {
+			continue
+		}
+
+		seen[scope] = struct{}{}
+		out = append(out, scope)
+	}
+
+	return out
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"smctf/internal/models"
+)
+
+func TestAPITokenServiceCreateAndAuthenticate(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	raw, token, err := env.apiTokenSvc.CreateToken(context.Background(), user.ID, "  bot  ", []string{"read", "SUBMIT", "read"}, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	if token.Name != "bot" || len(token.Scopes) != 2 || token.TokenHash == raw {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	got, owner, err := env.apiTokenSvc.AuthenticateAPIToken(context.Background(), raw)
+	if err != nil || got == nil || owner == nil {
+		t.Fatalf("authenticate: token %v err %v", got, err)
+	}
+
+	if owner.ID != user.ID || !got.HasScope(models.ScopeSubmit) || got.LastUsedAt == nil {
+		t.Fatalf("unexpected authentication: %+v %+v", got, owner)
+	}
+
+	if got, _, err := env.apiTokenSvc.AuthenticateAPIToken(context.Background(), raw+"x"); err != nil || got != nil {
+		t.Fatalf("expected unknown token, got %v err %v", got, err)
+	}
+
+	if err := env.apiTokenSvc.RevokeToken(context.Background(), user.ID+1, token.ID); !errors.Is(err, ErrAPITokenNotFound) {
+		t.Fatalf("expected ErrAPITokenNotFound, got %v", err)
+	}
+
+	if err := env.apiTokenSvc.RevokeToken(context.Background(), user.ID, token.ID); err != nil {
+		t.Fatalf("revoke token: %v", err)
+	}
+
+	if got, _, err := env.apiTokenSvc.AuthenticateAPIToken(context.Background(), raw); err != nil || got != nil {
+		t.Fatalf("expected revoked token rejected, got %v err %v", got, err)
+	}
+
+	tokens, err := env.apiTokenSvc.ListTokens(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("list tokens: %v", err)
+	}
+
+	if len(tokens) != 0 {
+		t.Fatalf("expected no active tokens, got %d", len(tokens))
+	}
+}
+
+func TestAPITokenServiceValidation(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+	past := time.Now().Add(-time.Hour)
+
+	cases := []struct {
+		name      string
+		tokenName string
+		scopes    []string
+		expiresAt *time.Time
+	}{
+		{"missing name", "", []string{"read"}, nil},
+		{"missing scopes", "bot", nil, nil},
+		{"unknown scope", "bot", []string{"everything"}, nil},
+		{"admin scope for user", "bot", []string{"admin:challenges"}, nil},
+		{"expired", "bot", []string{"read"}, &past},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := env.apiTokenSvc.CreateToken(context.Background(), user.ID, tc.tokenName, tc.scopes, tc.expiresAt)
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("expected validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAPITokenServiceChallengeAuthorScope(t *testing.T) {
+	env := setupServiceTest(t)
+	author := createUser(t, env, "author@example.com", "author", "pass", "challenge_author")
+	support := createUser(t, env, "support@example.com", "support", "pass", "support")
+
+	if _, _, err := env.apiTokenSvc.CreateToken(context.Background(), author.ID, "ci", []string{"admin:challenges"}, nil); err != nil {
+		t.Fatalf("expected author to get admin:challenges, got %v", err)
+	}
+
+	var ve *ValidationError
+	_, _, err := env.apiTokenSvc.CreateToken(context.Background(), support.ID, "ci", []string{"admin:challenges"}, nil)
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "forbidden" {
+		t.Fatalf("expected forbidden scope for support, got %v", err)
+	}
+}
+
+func TestAPITokenServiceDropsAdminScopesAfterDemotion(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin1", "pass", "admin")
+
+	raw, _, err := env.apiTokenSvc.CreateToken(context.Background(), admin.ID, "ci", []string{"admin:challenges", "read"}, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	admin.Role = "user"
+	if err := env.userRepo.Update(context.Background(), admin); err != nil {
+		t.Fatalf("demote: %v", err)
+	}
+
+	got, _, err := env.apiTokenSvc.AuthenticateAPIToken(context.Background(), raw)
+	if err != nil || got == nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	if got.HasScope(models.ScopeAdminChallenges) || !got.HasScope(models.ScopeRead) {
+		t.Fatalf("unexpected scopes: %v", got.Scopes)
+	}
+}
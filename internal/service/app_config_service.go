@@ -21,6 +21,10 @@ const (
 	appConfigKeyHeaderDesc  = "header_description"
 	appConfigKeyCTFStartAt  = "ctf_start_at"
 	appConfigKeyCTFEndAt    = "ctf_end_at"
+	appConfigKeyPoWRegister = "pow_register_difficulty"
+	appConfigKeyPoWSubmit   = "pow_submit_difficulty"
+	appConfigKeyMode        = models.AppConfigKeyCompetitionMode
+	appConfigKeyDivScoring  = models.AppConfigKeyDivisionScoring
 )
 
 type AppConfig struct {
@@ -30,6 +34,10 @@ type AppConfig struct {
 	HeaderDescription string `json:"header_description"`
 	CTFStartAt        string `json:"ctf_start_at"`
 	CTFEndAt          string `json:"ctf_end_at"`
+	PoWRegister       string `json:"pow_register_difficulty"`
+	PoWSubmit         string `json:"pow_submit_difficulty"`
+	CompetitionMode   string `json:"competition_mode"`
+	DivisionScoring   string `json:"division_scoring"`
 }
 
 type CTFState string
@@ -115,6 +123,50 @@ var appConfigFields = []appConfigField{
 			cfg.CTFEndAt = value
 		},
 	},
+	{
+		key:          appConfigKeyPoWRegister,
+		defaultValue: "0",
+		maxLen:       2,
+		get: func(cfg AppConfig) string {
+			return cfg.PoWRegister
+		},
+		set: func(cfg *AppConfig, value string) {
+			cfg.PoWRegister = value
+		},
+	},
+	{
+		key:          appConfigKeyPoWSubmit,
+		defaultValue: "0",
+		maxLen:       2,
+		get: func(cfg AppConfig) string {
+			return cfg.PoWSubmit
+		},
+		set: func(cfg *AppConfig, value string) {
+			cfg.PoWSubmit = value
+		},
+	},
+	{
+		key:          appConfigKeyMode,
+		defaultValue: models.CompetitionModeTeam,
+		maxLen:       16,
+		get: func(cfg AppConfig) string {
+			return cfg.CompetitionMode
+		},
+		set: func(cfg *AppConfig, value string) {
+			cfg.CompetitionMode = value
+		},
+	},
+	{
+		key:          appConfigKeyDivScoring,
+		defaultValue: models.DivisionScoringGlobal,
+		maxLen:       16,
+		get: func(cfg AppConfig) string {
+			return cfg.DivisionScoring
+		},
+		set: func(cfg *AppConfig, value string) {
+			cfg.DivisionScoring = value
+		},
+	},
 }
 
 type appConfigCache struct {
@@ -143,7 +195,7 @@ func (s *AppConfigService) Get(ctx context.Context) (AppConfig, time.Time, strin
 	return s.load(ctx)
 }
 
-func (s *AppConfigService) Update(ctx context.Context, title *string, description *string, headerTitle *string, headerDescription *string, ctfStartAt *string, ctfEndAt *string) (AppConfig, time.Time, string, error) {
+func (s *AppConfigService) Update(ctx context.Context, title *string, description *string, headerTitle *string, headerDescription *string, ctfStartAt *string, ctfEndAt *string, powRegister *string, powSubmit *string, competitionMode *string, divisionScoring *string) (AppConfig, time.Time, string, error) {
 	cfg, cachedUpdatedAt, cachedETag, err := s.Get(ctx)
 	if err != nil {
 		return AppConfig{}, time.Time{}, "", err
@@ -156,6 +208,10 @@ func (s *AppConfigService) Update(ctx context.Context, title *string, descriptio
 		appConfigKeyHeaderDesc:  headerDescription,
 		appConfigKeyCTFStartAt:  ctfStartAt,
 		appConfigKeyCTFEndAt:    ctfEndAt,
+		appConfigKeyPoWRegister: powRegister,
+		appConfigKeyPoWSubmit:   powSubmit,
+		appConfigKeyMode:        competitionMode,
+		appConfigKeyDivScoring:  divisionScoring,
 	}
 
 	updates, err := applyAppConfigUpdates(&cfg, inputs)
@@ -180,6 +236,20 @@ func (s *AppConfigService) Update(ctx context.Context, title *string, descriptio
 	return cfg, updatedAt, etag, nil
 }
 
+// Teams are disabled in individual mode: registration assigns no team and solves count per user
+func (c AppConfig) IndividualMode() bool {
+	return c.CompetitionMode == models.CompetitionModeIndividual
+}
+
+func (s *AppConfigService) IndividualMode(ctx context.Context) (bool, error) {
+	cfg, _, _, err := s.Get(ctx)
+	if err != nil {
+		return false, fmt.Errorf("appConfig.IndividualMode: %w", err)
+	}
+
+	return cfg.IndividualMode(), nil
+}
+
 func (s *AppConfigService) CTFState(ctx context.Context, now time.Time) (CTFState, error) {
 	cfg, _, _, err := s.Get(ctx)
 	if err != nil {
@@ -368,6 +438,20 @@ func applyAppConfigUpdates(cfg *AppConfig, inputs map[string]*string) (map[strin
 			}
 		}
 
+		if key == appConfigKeyPoWRegister || key == appConfigKeyPoWSubmit {
+			if _, err := parsePoWDifficulty(value); err != nil {
+				return nil, NewValidationError(FieldError{Field: key, Reason: "invalid"})
+			}
+		}
+
+		if key == appConfigKeyMode && value != models.CompetitionModeTeam && value != models.CompetitionModeIndividual {
+			return nil, NewValidationError(FieldError{Field: key, Reason: "invalid"})
+		}
+
+		if key == appConfigKeyDivScoring && value != models.DivisionScoringGlobal && value != models.DivisionScoringDivision {
+			return nil, NewValidationError(FieldError{Field: key, Reason: "invalid"})
+		}
+
 		field.set(cfg, value)
 		updates[key] = value
 	}
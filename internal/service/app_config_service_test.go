@@ -71,7 +71,7 @@ func TestAppConfigServiceUpdatePartial(t *testing.T) {
 	}
 
 	title := "New Title"
-	cfg, _, _, err := svc.Update(context.Background(), &title, nil, nil, nil, nil, nil)
+	cfg, _, _, err := svc.Update(context.Background(), &title, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Update: %v", err)
 	}
@@ -91,7 +91,7 @@ func TestAppConfigServiceUpdateValidation(t *testing.T) {
 	svc := NewAppConfigService(appRepo, env.redis, env.cfg.Cache.AppConfigTTL)
 
 	empty := ""
-	_, _, _, err := svc.Update(context.Background(), &empty, nil, nil, nil, nil, nil)
+	_, _, _, err := svc.Update(context.Background(), &empty, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 	if err == nil {
 		t.Fatal("expected validation error")
 	}
@@ -102,6 +102,38 @@ func TestAppConfigServiceUpdateValidation(t *testing.T) {
 	}
 }
 
+func TestAppConfigServiceCompetitionMode(t *testing.T) {
+	env := setupServiceTest(t)
+	appRepo := repo.NewAppConfigRepo(env.db)
+	svc := NewAppConfigService(appRepo, env.redis, env.cfg.Cache.AppConfigTTL)
+
+	individual, err := svc.IndividualMode(context.Background())
+	if err != nil {
+		t.Fatalf("IndividualMode: %v", err)
+	}
+
+	if individual {
+		t.Fatalf("expected team mode by default")
+	}
+
+	bad := "solo"
+	_, _, _, err = svc.Update(context.Background(), nil, nil, nil, nil, nil, nil, nil, nil, &bad, nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	mode := "individual"
+	cfg, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, nil, nil, nil, nil, &mode, nil)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if cfg.CompetitionMode != "individual" || !cfg.IndividualMode() {
+		t.Fatalf("expected individual mode, got %q", cfg.CompetitionMode)
+	}
+}
+
 func TestAppConfigServiceUpdateCTFTimes(t *testing.T) {
 	env := setupServiceTest(t)
 	appRepo := repo.NewAppConfigRepo(env.db)
@@ -112,7 +144,7 @@ func TestAppConfigServiceUpdateCTFTimes(t *testing.T) {
 	endTime := startTime.Add(2 * time.Hour)
 	start := startTime.Format(time.RFC3339)
 	end := endTime.Format(time.RFC3339)
-	cfg, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end)
+	cfg, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Update: %v", err)
 	}
@@ -122,7 +154,7 @@ func TestAppConfigServiceUpdateCTFTimes(t *testing.T) {
 	}
 
 	invalid := "nope"
-	_, _, _, err = svc.Update(context.Background(), nil, nil, nil, nil, &invalid, nil)
+	_, _, _, err = svc.Update(context.Background(), nil, nil, nil, nil, &invalid, nil, nil, nil, nil, nil)
 	if err == nil {
 		t.Fatalf("expected validation error")
 	}
@@ -132,7 +164,7 @@ func TestAppConfigServiceUpdateCTFTimes(t *testing.T) {
 	}
 
 	badEnd := "2026-02-10T09:00:00Z"
-	_, _, _, err = svc.Update(context.Background(), nil, nil, nil, nil, &start, &badEnd)
+	_, _, _, err = svc.Update(context.Background(), nil, nil, nil, nil, &start, &badEnd, nil, nil, nil, nil)
 	if err == nil {
 		t.Fatalf("expected validation error for end before start")
 	}
@@ -141,7 +173,7 @@ func TestAppConfigServiceUpdateCTFTimes(t *testing.T) {
 	}
 
 	empty := ""
-	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &empty, &empty); err != nil {
+	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &empty, &empty, nil, nil, nil, nil); err != nil {
 		t.Fatalf("expected empty times to be allowed, got %v", err)
 	}
 }
@@ -156,7 +188,7 @@ func TestAppConfigServiceUpdateNoChanges(t *testing.T) {
 		t.Fatalf("Get: %v", err)
 	}
 
-	outCfg, outUpdatedAt, outETag, err := svc.Update(context.Background(), nil, nil, nil, nil, nil, nil)
+	outCfg, outUpdatedAt, outETag, err := svc.Update(context.Background(), nil, nil, nil, nil, nil, nil, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("Update: %v", err)
 	}
@@ -239,7 +271,7 @@ func TestAppConfigServiceCTFState(t *testing.T) {
 	start := now.Add(2 * time.Hour).Format(time.RFC3339)
 	end := now.Add(4 * time.Hour).Format(time.RFC3339)
 
-	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end); err != nil {
+	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end, nil, nil, nil, nil); err != nil {
 		t.Fatalf("update: %v", err)
 	}
 
@@ -253,7 +285,7 @@ func TestAppConfigServiceCTFState(t *testing.T) {
 
 	start = now.Add(-time.Hour).Format(time.RFC3339)
 	end = now.Add(time.Hour).Format(time.RFC3339)
-	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end); err != nil {
+	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end, nil, nil, nil, nil); err != nil {
 		t.Fatalf("update: %v", err)
 	}
 
@@ -266,7 +298,7 @@ func TestAppConfigServiceCTFState(t *testing.T) {
 	}
 
 	end = now.Add(-time.Minute).Format(time.RFC3339)
-	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end); err != nil {
+	if _, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, &start, &end, nil, nil, nil, nil); err != nil {
 		t.Fatalf("update: %v", err)
 	}
 
@@ -19,7 +19,10 @@ import (
 )
 
 const (
-	redisRefreshPrefix = "refresh:"
+	redisRefreshPrefix          = "refresh:"
+	maxRegistrationKeyBatch     = 1000
+	defaultRegistrationKeyLimit = 100
+	maxRegistrationKeyLimit     = 500
 )
 
 type AuthService struct {
@@ -28,11 +31,15 @@ type AuthService struct {
 	userRepo            *repo.UserRepo
 	registrationKeyRepo *repo.RegistrationKeyRepo
 	teamRepo            *repo.TeamRepo
+	loginFailureRepo    *repo.LoginFailureRepo
+	appConfig           *AppConfigService
 	redis               *redis.Client
+	limiter             *RateLimiter
+	revocations         *revocationCache
 }
 
-func NewAuthService(cfg config.Config, db *bun.DB, userRepo *repo.UserRepo, registrationKeyRepo *repo.RegistrationKeyRepo, teamRepo *repo.TeamRepo, redis *redis.Client) *AuthService {
-	return &AuthService{cfg: cfg, db: db, userRepo: userRepo, registrationKeyRepo: registrationKeyRepo, teamRepo: teamRepo, redis: redis}
+func NewAuthService(cfg config.Config, db *bun.DB, userRepo *repo.UserRepo, registrationKeyRepo *repo.RegistrationKeyRepo, teamRepo *repo.TeamRepo, loginFailureRepo *repo.LoginFailureRepo, appConfig *AppConfigService, redis *redis.Client) *AuthService {
+	return &AuthService{cfg: cfg, db: db, userRepo: userRepo, registrationKeyRepo: registrationKeyRepo, teamRepo: teamRepo, loginFailureRepo: loginFailureRepo, appConfig: appConfig, redis: redis, limiter: NewRateLimiter(redis), revocations: newRevocationCache(cfg.JWT.RevocationCacheTTL)}
 }
 
 func (s *AuthService) Register(ctx context.Context, email, username, password, registrationKey, registrationIP string) (*models.User, error) {
@@ -68,12 +75,17 @@ func (s *AuthService) Register(ctx context.Context, email, username, password, r
 		return nil, fmt.Errorf("auth.Register hash: %w", err)
 	}
 
+	individual, err := s.appConfig.IndividualMode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("auth.Register mode: %w", err)
+	}
+
 	now := time.Now().UTC()
 	user := &models.User{
 		Email:        email,
 		Username:     username,
 		PasswordHash: hash,
-		Role:         "user",
+		Role:         auth.RoleUser,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}
@@ -88,11 +100,24 @@ func (s *AuthService) Register(ctx context.Context, email, username, password, r
 			return fmt.Errorf("auth.Register key lookup: %w", err)
 		}
 
-		if key.UsedBy != nil {
+		switch key.Status(time.Now().UTC()) {
+		case models.RegistrationKeyRevoked:
+			return NewValidationError(FieldError{Field: "registration_key", Reason: "revoked"})
+		case models.RegistrationKeyUsed:
 			return NewValidationError(FieldError{Field: "registration_key", Reason: "used"})
+		case models.RegistrationKeyExpired:
+			return NewValidationError(FieldError{Field: "registration_key", Reason: "expired"})
+		}
+
+		if !individual {
+			user.TeamID = key.TeamID
 		}
 
-		user.TeamID = key.TeamID
+		if key.DivisionID != 0 && !individual {
+			if err := s.checkKeyDivision(ctx, key); err != nil {
+				return err
+			}
+		}
 
 		if _, err := tx.NewInsert().Model(user).Exec(ctx); err != nil {
 			if db.IsUniqueViolation(err) {
@@ -102,6 +127,18 @@ func (s *AuthService) Register(ctx context.Context, email, username, password, r
 			return fmt.Errorf("auth.Register create: %w", err)
 		}
 
+		// The first member of a team without a captain becomes its captain
+		if user.TeamID != 0 {
+			if _, err := tx.NewUpdate().
+				Model((*models.Team)(nil)).
+				Set("captain_id = ?", user.ID).
+				Where("id = ?", user.TeamID).
+				Where("captain_id = 0").
+				Exec(ctx); err != nil {
+				return fmt.Errorf("auth.Register captain: %w", err)
+			}
+		}
+
 		var usedByIP *string
 		if registrationIP != "" {
 			usedByIP = &registrationIP
@@ -113,6 +150,7 @@ func (s *AuthService) Register(ctx context.Context, email, username, password, r
 			Set("used_by = ?", user.ID).
 			Set("used_by_ip = ?", usedByIP).
 			Set("used_at = ?", usedAt).
+			Set("use_count = use_count + 1").
 			Where("id = ?", key.ID).
 			Exec(ctx); err != nil {
 			return fmt.Errorf("auth.Register use key: %w", err)
@@ -126,24 +164,84 @@ func (s *AuthService) Register(ctx context.Context, email, username, password, r
 	return user, nil
 }
 
-func (s *AuthService) CreateRegistrationKeys(ctx context.Context, adminID int64, count int, teamID int64) ([]models.RegistrationKey, error) {
+// The key's team must still be in the division the key is restricted to
+func (s *AuthService) checkKeyDivision(ctx context.Context, key *models.RegistrationKey) error {
+	team, err := s.teamRepo.GetByID(ctx, key.TeamID)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return fmt.Errorf("auth.Register team lookup: %w", err)
+	}
+
+	if team == nil || team.DivisionID != key.DivisionID {
+		return NewValidationError(FieldError{Field: "registration_key", Reason: "ineligible"})
+	}
+
+	return nil
+}
+
+// maxUses of 0 creates single-use keys, a nil expiresAt keys that never expire. teamID is optional in individual mode.
+// A non-zero divisionID restricts the keys to the team's current division.
+func (s *AuthService) CreateRegistrationKeys(ctx context.Context, adminID int64, count int, teamID, divisionID int64, maxUses int, expiresAt *time.Time) ([]models.RegistrationKey, error) {
+	if maxUses == 0 {
+		maxUses = 1
+	}
+
+	individual, err := s.appConfig.IndividualMode(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("auth.CreateRegistrationKeys mode: %w", err)
+	}
+
+	now := time.Now().UTC()
 	validator := newFieldValidator()
 	if count < 1 {
 		validator.fields = append(validator.fields, FieldError{Field: "count", Reason: "must be >= 1"})
+	} else if count > maxRegistrationKeyBatch {
+		validator.fields = append(validator.fields, FieldError{Field: "count", Reason: "too large"})
+	}
+
+	switch {
+	case teamID == 0 && !individual:
+		validator.fields = append(validator.fields, FieldError{Field: "team_id", Reason: "required"})
+	case teamID != 0:
+		validator.PositiveID("team_id", teamID)
+	}
+
+	switch {
+	case divisionID != 0 && teamID == 0:
+		validator.fields = append(validator.fields, FieldError{Field: "division_id", Reason: "requires team_id"})
+	case divisionID != 0:
+		validator.PositiveID("division_id", divisionID)
+	}
+
+	if maxUses < 1 {
+		validator.fields = append(validator.fields, FieldError{Field: "max_uses", Reason: "must be >= 1"})
 	}
 
-	validator.PositiveID("team_id", teamID)
+	if expiresAt != nil && !expiresAt.After(now) {
+		validator.fields = append(validator.fields, FieldError{Field: "expires_at", Reason: "must be in the future"})
+	}
 
 	if err := validator.Error(); err != nil {
 		return nil, err
 	}
 
-	if _, err := s.teamRepo.GetByID(ctx, teamID); err != nil {
-		if errors.Is(err, repo.ErrNotFound) {
-			return nil, NewValidationError(FieldError{Field: "team_id", Reason: "invalid"})
+	if teamID != 0 {
+		team, err := s.teamRepo.GetByID(ctx, teamID)
+		if err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				return nil, NewValidationError(FieldError{Field: "team_id", Reason: "invalid"})
+			}
+
+			return nil, fmt.Errorf("auth.CreateRegistrationKeys team lookup: %w", err)
 		}
 
-		return nil, fmt.Errorf("auth.CreateRegistrationKeys team lookup: %w", err)
+		if divisionID != 0 && team.DivisionID != divisionID {
+			return nil, NewValidationError(FieldError{Field: "division_id", Reason: "team not in division"})
+		}
+	}
+
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresAt = &utc
 	}
 
 	created := make([]models.RegistrationKey, 0, count)
@@ -159,10 +257,13 @@ func (s *AuthService) CreateRegistrationKeys(ctx context.Context, adminID int64,
 		}
 
 		key := models.RegistrationKey{
-			Code:      code,
-			CreatedBy: adminID,
-			TeamID:    teamID,
-			CreatedAt: time.Now().UTC(),
+			Code:       code,
+			CreatedBy:  adminID,
+			TeamID:     teamID,
+			DivisionID: divisionID,
+			MaxUses:    maxUses,
+			CreatedAt:  now,
+			ExpiresAt:  expiresAt,
 		}
 
 		if _, err := s.db.NewInsert().Model(&key).Exec(ctx); err != nil {
@@ -179,32 +280,139 @@ func (s *AuthService) CreateRegistrationKeys(ctx context.Context, adminID int64,
 	return created, nil
 }
 
-func (s *AuthService) ListRegistrationKeys(ctx context.Context) ([]models.RegistrationKeySummary, error) {
-	rows, err := s.registrationKeyRepo.List(ctx)
+// A zero limit lists the first page, use ExportRegistrationKeys for every row
+func (s *AuthService) ListRegistrationKeys(ctx context.Context, filter models.RegistrationKeyFilter) ([]models.RegistrationKeySummary, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultRegistrationKeyLimit
+	}
+
+	validator := newFieldValidator()
+	validator.PositiveID("limit", int64(filter.Limit))
+	if filter.Limit > maxRegistrationKeyLimit {
+		validator.fields = append(validator.fields, FieldError{Field: "limit", Reason: "too large"})
+	}
+
+	validator.NonNegative("offset", filter.Offset)
+
+	if filter.TeamID != nil {
+		validator.PositiveID("team_id", *filter.TeamID)
+	}
+
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.registrationKeyRepo.List(ctx, filter)
 	if err != nil {
 		return nil, fmt.Errorf("auth.ListRegistrationKeys: %w", err)
 	}
 
+	setRegistrationKeyStatus(rows)
+
 	return rows, nil
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (string, string, *models.User, error) {
-	email = normalizeEmail(email)
-	user, err := s.userRepo.GetByEmail(ctx, email)
+func (s *AuthService) ExportRegistrationKeys(ctx context.Context, filter models.RegistrationKeyFilter) ([]models.RegistrationKeySummary, error) {
+	validator := newFieldValidator()
+	if filter.TeamID != nil {
+		validator.PositiveID("team_id", *filter.TeamID)
+	}
+
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	filter.Limit = 0
+	filter.Offset = 0
+
+	rows, err := s.registrationKeyRepo.List(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("auth.ExportRegistrationKeys: %w", err)
+	}
+
+	setRegistrationKeyStatus(rows)
+
+	return rows, nil
+}
+
+// Revoked keys stay listed but can no longer register accounts. Revoking twice is a no-op.
+func (s *AuthService) RevokeRegistrationKey(ctx context.Context, adminID, keyID int64) (*models.RegistrationKeySummary, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("id", keyID)
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := s.registrationKeyRepo.Revoke(ctx, keyID, adminID, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("auth.RevokeRegistrationKey: %w", err)
+	}
 
+	key, err := s.registrationKeyRepo.GetSummaryByID(ctx, keyID)
 	if err != nil {
 		if errors.Is(err, repo.ErrNotFound) {
-			return "", "", nil, ErrInvalidCreds
+			return nil, ErrRegistrationKeyNotFound
+		}
+
+		return nil, fmt.Errorf("auth.RevokeRegistrationKey lookup: %w", err)
+	}
+
+	key.Status = models.RegistrationKeyStatus(key.RevokedAt, key.ExpiresAt, key.UseCount, key.MaxUses, time.Now().UTC())
+
+	return key, nil
+}
+
+func setRegistrationKeyStatus(rows []models.RegistrationKeySummary) {
+	now := time.Now().UTC()
+	for i := range rows {
+		rows[i].Status = models.RegistrationKeyStatus(rows[i].RevokedAt, rows[i].ExpiresAt, rows[i].UseCount, rows[i].MaxUses, now)
+	}
+}
+
+func (s *AuthService) Login(ctx context.Context, email, password, device, ip string) (string, string, *models.User, error) {
+	email = normalizeEmail(email)
+	subjects := s.loginSubjects(email, ip)
+
+	if err := s.checkLoginLock(ctx, subjects); err != nil {
+		var locked *LoginLockedError
+		if errors.As(err, &locked) {
+			first, err := s.firstLockedAttempt(ctx, subjects)
+			if err != nil {
+				return "", "", nil, err
+			}
+
+			if first {
+				if err := s.storeLoginFailure(ctx, nil, email, ip, device, models.LoginFailureLocked); err != nil {
+					return "", "", nil, err
+				}
+			}
 		}
 
+		return "", "", nil, err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
 		return "", "", nil, fmt.Errorf("auth.Login lookup: %w", err)
 	}
 
-	if !auth.CheckPassword(user.PasswordHash, password) {
+	if err != nil || !auth.CheckPassword(user.PasswordHash, password) {
+		if err := s.recordLoginFailure(ctx, subjects); err != nil {
+			return "", "", nil, err
+		}
+
+		if err := s.storeLoginFailure(ctx, user, email, ip, device, models.LoginFailureInvalidCredentials); err != nil {
+			return "", "", nil, err
+		}
+
 		return "", "", nil, ErrInvalidCreds
 	}
 
-	accessToken, refreshToken, err := s.issueTokens(ctx, user)
+	if err := s.clearLoginFailures(ctx, subjects[0]); err != nil {
+		return "", "", nil, err
+	}
+
+	session := newSession(user.ID, device, ip)
+	accessToken, refreshToken, err := s.issueTokens(ctx, user, session)
 	if err != nil {
 		return "", "", nil, fmt.Errorf("auth.Login issueTokens: %w", err)
 	}
@@ -212,27 +420,224 @@ func (s *AuthService) Login(ctx context.Context, email, password string) (string
 	return accessToken, refreshToken, user, nil
 }
 
+func (s *AuthService) ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword, keepSessionID string) error {
+	validator := newFieldValidator()
+	validator.Required("current_password", currentPassword)
+	validator.Required("new_password", newPassword)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("auth.ChangePassword lookup: %w", err)
+	}
+
+	if !auth.CheckPassword(user.PasswordHash, currentPassword) {
+		return NewValidationError(FieldError{Field: "current_password", Reason: "invalid"})
+	}
+
+	hash, err := auth.HashPassword(newPassword, s.cfg.PasswordBcryptCost)
+	if err != nil {
+		return fmt.Errorf("auth.ChangePassword hash: %w", err)
+	}
+
+	user.PasswordHash = hash
+	user.UpdatedAt = time.Now().UTC()
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return fmt.Errorf("auth.ChangePassword update: %w", err)
+	}
+
+	if _, err := s.RevokeAllSessions(ctx, userID, keepSessionID); err != nil {
+		return fmt.Errorf("auth.ChangePassword revoke: %w", err)
+	}
+
+	return nil
+}
+
+// Edits of the caller's own account. nil fields keep their current value.
+type AccountUpdate struct {
+	Username        *string
+	CurrentPassword string
+	NewPassword     *string
+	Profile         ProfileUpdate
+}
+
+// Everything is checked before anything is written, and all changes land in one transaction. A new password
+// revokes the other sessions once it is committed.
+func (s *AuthService) UpdateAccount(ctx context.Context, userID int64, update AccountUpdate, keepSessionID string) (*models.User, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("user_id", userID)
+
+	username := ""
+	if update.Username != nil {
+		username = normalizeTrim(*update.Username)
+		validator.Required("username", username)
+	}
+
+	if update.NewPassword != nil {
+		validator.Required("current_password", update.CurrentPassword)
+		validator.Required("new_password", *update.NewPassword)
+	}
+
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("auth.UpdateAccount lookup: %w", err)
+	}
+
+	profile, err := update.Profile.apply(userProfile(user))
+	if err != nil {
+		return nil, err
+	}
+
+	if update.NewPassword != nil && !auth.CheckPassword(user.PasswordHash, update.CurrentPassword) {
+		return nil, NewValidationError(FieldError{Field: "current_password", Reason: "invalid"})
+	}
+
+	if update.Username != nil && username != user.Username {
+		_, err := s.userRepo.GetByUsername(ctx, username)
+		switch {
+		case err == nil:
+			return nil, ErrUserExists
+		case !errors.Is(err, repo.ErrNotFound):
+			return nil, fmt.Errorf("auth.UpdateAccount username: %w", err)
+		}
+
+		user.Username = username
+	}
+
+	if update.NewPassword != nil {
+		hash, err := auth.HashPassword(*update.NewPassword, s.cfg.PasswordBcryptCost)
+		if err != nil {
+			return nil, fmt.Errorf("auth.UpdateAccount hash: %w", err)
+		}
+
+		user.PasswordHash = hash
+	}
+
+	user.Affiliation, user.Country, user.Website, user.Bio = profile.Affiliation, profile.Country, profile.Website, profile.Bio
+	user.UpdatedAt = time.Now().UTC()
+
+	if err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model(user).
+			Column("username", "password_hash", "affiliation", "country", "website", "bio", "updated_at").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			if db.IsUniqueViolation(err) {
+				return ErrUserExists
+			}
+
+			return fmt.Errorf("auth.UpdateAccount: %w", err)
+		}
+
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return repo.ErrNotFound
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if update.NewPassword != nil {
+		if _, err := s.RevokeAllSessions(ctx, userID, keepSessionID); err != nil {
+			return nil, fmt.Errorf("auth.UpdateAccount revoke: %w", err)
+		}
+	}
+
+	return user, nil
+}
+
+// Access tokens carry the role, so they are cut off. Sessions stay and pick up the new role on refresh.
+func (s *AuthService) UpdateRole(ctx context.Context, actorID, userID int64, role string) (*models.User, error) {
+	role = normalizeTrim(role)
+
+	validator := newFieldValidator()
+	validator.PositiveID("id", userID)
+	validator.Required("role", role)
+	if role != "" && !auth.ValidRole(role) {
+		validator.fields = append(validator.fields, FieldError{Field: "role", Reason: "invalid"})
+	}
+
+	if actorID == userID {
+		validator.fields = append(validator.fields, FieldError{Field: "id", Reason: "cannot change own role"})
+	}
+
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("auth.UpdateRole lookup: %w", err)
+	}
+
+	if user.Role == role {
+		return user, nil
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now().UTC()
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("auth.UpdateRole update: %w", err)
+	}
+
+	if err := s.revokeAccessTokens(ctx, userID); err != nil {
+		return nil, fmt.Errorf("auth.UpdateRole revoke: %w", err)
+	}
+
+	return user, nil
+}
+
 func refreshKey(jti string) string {
 	return redisRefreshPrefix + jti
 }
 
-func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (string, string, error) {
+func (s *AuthService) Refresh(ctx context.Context, refreshToken, device, ip string) (string, string, error) {
 	claims, err := s.parseRefreshToken(refreshToken)
 	if err != nil {
 		return "", "", err
 	}
 
+	session, err := s.sessionForRefresh(ctx, claims, device, ip)
+	if err != nil {
+		return "", "", err
+	}
+
 	if err := s.assertRefreshValid(ctx, claims.ID, claims.UserID); err != nil {
 		return "", "", ErrInvalidCreds
 	}
 
-	if err := s.redis.Del(ctx, refreshKey(claims.ID)).Err(); err != nil && err != redis.Nil {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			_ = s.deleteSession(ctx, session)
+			return "", "", ErrInvalidCreds
+		}
+
+		return "", "", fmt.Errorf("auth.Refresh lookup: %w", err)
+	}
+
+	// Consuming the old token must be atomic, a concurrent refresh with the same token counts as reuse
+	deleted, err := s.redis.Del(ctx, refreshKey(claims.ID)).Result()
+	if err != nil {
 		return "", "", fmt.Errorf("auth.Refresh revoke: %w", err)
 	}
 
-	user := &models.User{ID: claims.UserID, Role: claims.Role}
+	if deleted == 0 {
+		_ = s.deleteSession(ctx, session)
+		return "", "", ErrInvalidCreds
+	}
 
-	return s.issueTokens(ctx, user)
+	return s.issueTokens(ctx, user, session)
 }
 
 func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
@@ -241,6 +646,19 @@ func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
 		return err
 	}
 
+	if claims.SessionID != "" {
+		session, err := s.loadSession(ctx, claims.SessionID)
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return fmt.Errorf("auth.Logout session: %w", err)
+		}
+
+		if err == nil && session.UserID == claims.UserID && session.RefreshJTI == claims.ID {
+			if err := s.deleteSession(ctx, session); err != nil {
+				return fmt.Errorf("auth.Logout revoke session: %w", err)
+			}
+		}
+	}
+
 	if err := s.redis.Del(ctx, refreshKey(claims.ID)).Err(); err != nil && err != redis.Nil {
 		return fmt.Errorf("auth.Logout revoke: %w", err)
 	}
@@ -248,15 +666,15 @@ func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
 	return nil
 }
 
-func (s *AuthService) issueTokens(ctx context.Context, user *models.User) (string, string, error) {
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, session *models.Session) (string, string, error) {
 	jti := uuid.NewString()
-	accessToken, err := auth.GenerateAccessToken(s.cfg.JWT, user.ID, user.Role)
+	accessToken, err := auth.GenerateAccessToken(s.cfg.JWT, user.ID, user.Role, session.ID)
 
 	if err != nil {
 		return "", "", fmt.Errorf("auth.issueTokens access: %w", err)
 	}
 
-	refreshToken, err := auth.GenerateRefreshToken(s.cfg.JWT, user.ID, user.Role, jti)
+	refreshToken, err := auth.GenerateRefreshToken(s.cfg.JWT, user.ID, user.Role, session.ID, jti)
 	if err != nil {
 		return "", "", fmt.Errorf("auth.issueTokens refresh: %w", err)
 	}
@@ -265,9 +683,54 @@ func (s *AuthService) issueTokens(ctx context.Context, user *models.User) (strin
 		return "", "", fmt.Errorf("auth.issueTokens store: %w", err)
 	}
 
+	session.RefreshJTI = jti
+	session.LastUsedAt = time.Now().UTC()
+
+	if err := s.storeSession(ctx, session); err != nil {
+		return "", "", fmt.Errorf("auth.issueTokens session: %w", err)
+	}
+
 	return accessToken, refreshToken, nil
 }
 
+func (s *AuthService) sessionForRefresh(ctx context.Context, claims *auth.Claims, device, ip string) (*models.Session, error) {
+	if claims.SessionID == "" {
+		return newSession(claims.UserID, device, ip), nil
+	}
+
+	session, err := s.loadSession(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, ErrInvalidCreds
+		}
+
+		return nil, fmt.Errorf("auth.Refresh session: %w", err)
+	}
+
+	if session.UserID != claims.UserID {
+		return nil, ErrInvalidCreds
+	}
+
+	// A validly signed token that is no longer the session's latest was already rotated, so revoke the family
+	if session.RefreshJTI != claims.ID {
+		if err := s.deleteSession(ctx, session); err != nil {
+			return nil, fmt.Errorf("auth.Refresh reuse: %w", err)
+		}
+
+		return nil, ErrInvalidCreds
+	}
+
+	if device = normalizeTrim(device); device != "" {
+		session.Device = trimTo(device, maxSessionDeviceLength)
+	}
+
+	if ip = normalizeTrim(ip); ip != "" {
+		session.IP = ip
+	}
+
+	return session, nil
+}
+
 func (s *AuthService) assertRefreshValid(ctx context.Context, jti string, userID int64) error {
 	val, err := s.redis.Get(ctx, refreshKey(jti)).Result()
 	if err == redis.Nil {
@@ -9,6 +9,7 @@ import (
 	"smctf/internal/auth"
 	"smctf/internal/models"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -71,11 +72,11 @@ func TestAuthServiceCreateRegistrationKeys(t *testing.T) {
 	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
 	team := createTeam(t, env, "Alpha")
 
-	if _, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 0, team.ID); err == nil {
+	if _, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 0, team.ID, 0, 0, nil); err == nil {
 		t.Fatalf("expected validation error")
 	}
 
-	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 2, team.ID)
+	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 2, team.ID, 0, 0, nil)
 	if err != nil {
 		t.Fatalf("create keys: %v", err)
 	}
@@ -94,7 +95,7 @@ func TestAuthServiceCreateRegistrationKeysWithTeam(t *testing.T) {
 	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
 	team := createTeam(t, env, "Alpha")
 
-	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, team.ID)
+	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, team.ID, 0, 0, nil)
 	if err != nil {
 		t.Fatalf("create keys: %v", err)
 	}
@@ -108,13 +109,113 @@ func TestAuthServiceCreateRegistrationKeysInvalidTeam(t *testing.T) {
 	env := setupServiceTest(t)
 	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
 
-	_, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, 9999)
+	_, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, 9999, 0, 0, nil)
 	var ve *ValidationError
 	if !errors.As(err, &ve) {
 		t.Fatalf("expected validation error, got %v", err)
 	}
 }
 
+func TestAuthServiceCreateRegistrationKeysLifecycleValidation(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	team := createTeam(t, env, "Alpha")
+	past := time.Now().Add(-time.Hour)
+
+	_, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, team.ID, 0, -1, &past)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 2 {
+		t.Fatalf("expected max_uses and expires_at errors, got %v", err)
+	}
+
+	future := time.Now().Add(time.Hour)
+	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, team.ID, 0, 3, &future)
+	if err != nil {
+		t.Fatalf("create keys: %v", err)
+	}
+
+	if keys[0].MaxUses != 3 || keys[0].ExpiresAt == nil {
+		t.Fatalf("unexpected key: %+v", keys[0])
+	}
+}
+
+func TestAuthServiceRegisterMultiUseKey(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	team := createTeam(t, env, "Alpha")
+
+	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, team.ID, 0, 2, nil)
+	if err != nil {
+		t.Fatalf("create keys: %v", err)
+	}
+	code := keys[0].Code
+
+	if _, err := env.authSvc.Register(context.Background(), "u1@example.com", "u1", "pass", code, ""); err != nil {
+		t.Fatalf("register first: %v", err)
+	}
+
+	if _, err := env.authSvc.Register(context.Background(), "u2@example.com", "u2", "pass", code, ""); err != nil {
+		t.Fatalf("register second: %v", err)
+	}
+
+	_, err = env.authSvc.Register(context.Background(), "u3@example.com", "u3", "pass", code, "")
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "used" {
+		t.Fatalf("expected used key error, got %v", err)
+	}
+
+	stored, err := env.regKeyRepo.GetByCodeForUpdate(context.Background(), env.db, code)
+	if err != nil {
+		t.Fatalf("fetch key: %v", err)
+	}
+
+	if stored.UseCount != 2 {
+		t.Fatalf("expected use_count 2, got %d", stored.UseCount)
+	}
+}
+
+func TestAuthServiceRegisterExpiredOrRevokedKey(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	team := createTeam(t, env, "Alpha")
+
+	expiresAt := time.Now().UTC().Add(-time.Minute)
+	expired := &models.RegistrationKey{Code: "333333", CreatedBy: admin.ID, TeamID: team.ID, CreatedAt: time.Now().UTC(), ExpiresAt: &expiresAt}
+	if err := env.regKeyRepo.Create(context.Background(), expired); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	_, err := env.authSvc.Register(context.Background(), "u1@example.com", "u1", "pass", expired.Code, "")
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "expired" {
+		t.Fatalf("expected expired key error, got %v", err)
+	}
+
+	revoked := createRegistrationKeyWithTeam(t, env, "444444", admin.ID, team.ID)
+	summary, err := env.authSvc.RevokeRegistrationKey(context.Background(), admin.ID, revoked.ID)
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	if summary.Status != models.RegistrationKeyRevoked || summary.RevokedAt == nil {
+		t.Fatalf("unexpected revoked key: %+v", summary)
+	}
+
+	_, err = env.authSvc.Register(context.Background(), "u2@example.com", "u2", "pass", revoked.Code, "")
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "revoked" {
+		t.Fatalf("expected revoked key error, got %v", err)
+	}
+}
+
+func TestAuthServiceRevokeRegistrationKeyNotFound(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+
+	if _, err := env.authSvc.RevokeRegistrationKey(context.Background(), admin.ID, 9999); !errors.Is(err, ErrRegistrationKeyNotFound) {
+		t.Fatalf("expected ErrRegistrationKeyNotFound, got %v", err)
+	}
+}
+
 func TestAuthServiceRegisterAssignsTeam(t *testing.T) {
 	env := setupServiceTest(t)
 	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
@@ -131,6 +232,129 @@ func TestAuthServiceRegisterAssignsTeam(t *testing.T) {
 	}
 }
 
+func TestAuthServiceRegisterFirstMemberBecomesCaptain(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	team := createTeam(t, env, "Alpha")
+
+	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, team.ID, 0, 2, nil)
+	if err != nil {
+		t.Fatalf("create keys: %v", err)
+	}
+
+	first, err := env.authSvc.Register(context.Background(), "u1@example.com", "u1", "pass", keys[0].Code, "")
+	if err != nil {
+		t.Fatalf("register first: %v", err)
+	}
+
+	if _, err := env.authSvc.Register(context.Background(), "u2@example.com", "u2", "pass", keys[0].Code, ""); err != nil {
+		t.Fatalf("register second: %v", err)
+	}
+
+	stored, err := env.teamRepo.GetByID(context.Background(), team.ID)
+	if err != nil {
+		t.Fatalf("fetch team: %v", err)
+	}
+
+	if stored.CaptainID != first.ID {
+		t.Fatalf("expected captain %d, got %d", first.ID, stored.CaptainID)
+	}
+}
+
+func setIndividualMode(t *testing.T, env serviceEnv) {
+	t.Helper()
+	mode := models.CompetitionModeIndividual
+	if _, _, _, err := env.appConfigSvc.Update(context.Background(), nil, nil, nil, nil, nil, nil, nil, nil, &mode, nil); err != nil {
+		t.Fatalf("set individual mode: %v", err)
+	}
+}
+
+func TestAuthServiceRegisterIndividualMode(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	team := createTeam(t, env, "Alpha")
+	key := createRegistrationKeyWithTeam(t, env, "654321", admin.ID, team.ID)
+	setIndividualMode(t, env)
+
+	user, err := env.authSvc.Register(context.Background(), "user@example.com", "user1", "pass1", key.Code, "")
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if user.TeamID != 0 {
+		t.Fatalf("expected no team in individual mode, got %d", user.TeamID)
+	}
+}
+
+func TestAuthServiceCreateRegistrationKeysWithoutTeam(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+
+	_, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, 0, 0, 0, nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Field != "team_id" || ve.Fields[0].Reason != "required" {
+		t.Fatalf("expected team_id required in team mode, got %v", err)
+	}
+
+	setIndividualMode(t, env)
+
+	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, 0, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("create keys: %v", err)
+	}
+
+	if len(keys) != 1 || keys[0].TeamID != 0 {
+		t.Fatalf("expected key without team, got %+v", keys)
+	}
+}
+
+func TestAuthServiceRegistrationKeyDivision(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	team := createTeam(t, env, "Alpha")
+	highSchool, err := env.teamSvc.CreateDivision(context.Background(), "High School")
+	if err != nil {
+		t.Fatalf("create division: %v", err)
+	}
+
+	open, err := env.teamSvc.CreateDivision(context.Background(), "Open")
+	if err != nil {
+		t.Fatalf("create division: %v", err)
+	}
+
+	_, err = env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 1, team.ID, highSchool.ID, 0, nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "division_id" {
+		t.Fatalf("expected division mismatch, got %v", err)
+	}
+
+	if _, err := env.teamSvc.SetTeamDivision(context.Background(), team.ID, highSchool.ID); err != nil {
+		t.Fatalf("set division: %v", err)
+	}
+
+	keys, err := env.authSvc.CreateRegistrationKeys(context.Background(), admin.ID, 2, team.ID, highSchool.ID, 0, nil)
+	if err != nil {
+		t.Fatalf("create keys: %v", err)
+	}
+
+	if keys[0].DivisionID != highSchool.ID {
+		t.Fatalf("expected division on key, got %+v", keys[0])
+	}
+
+	if _, err := env.authSvc.Register(context.Background(), "u1@example.com", "u1", "pass1", keys[0].Code, ""); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if _, err := env.teamSvc.SetTeamDivision(context.Background(), team.ID, open.ID); err != nil {
+		t.Fatalf("move division: %v", err)
+	}
+
+	_, err = env.authSvc.Register(context.Background(), "u2@example.com", "u2", "pass2", keys[1].Code, "")
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "ineligible" {
+		t.Fatalf("expected ineligible key, got %v", err)
+	}
+}
+
 func TestAuthServiceListRegistrationKeys(t *testing.T) {
 	env := setupServiceTest(t)
 	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
@@ -153,7 +377,7 @@ func TestAuthServiceListRegistrationKeys(t *testing.T) {
 		t.Fatalf("create key: %v", err)
 	}
 
-	rows, err := env.authSvc.ListRegistrationKeys(context.Background())
+	rows, err := env.authSvc.ListRegistrationKeys(context.Background(), models.RegistrationKeyFilter{})
 	if err != nil {
 		t.Fatalf("list keys: %v", err)
 	}
@@ -171,11 +395,11 @@ func TestAuthServiceLoginRefreshLogout(t *testing.T) {
 	env := setupServiceTest(t)
 	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
 
-	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "wrong"); !errors.Is(err, ErrInvalidCreds) {
+	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "wrong", "", ""); !errors.Is(err, ErrInvalidCreds) {
 		t.Fatalf("expected ErrInvalidCreds, got %v", err)
 	}
 
-	access, refresh, got, err := env.authSvc.Login(context.Background(), "user@example.com", "pass")
+	access, refresh, got, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "test-agent", "127.0.0.1")
 	if err != nil {
 		t.Fatalf("login: %v", err)
 	}
@@ -194,11 +418,11 @@ func TestAuthServiceLoginRefreshLogout(t *testing.T) {
 		t.Fatalf("expected refresh token stored, err %v val %s", err, val)
 	}
 
-	if _, _, err := env.authSvc.Refresh(context.Background(), "bad-token"); !errors.Is(err, ErrInvalidCreds) {
+	if _, _, err := env.authSvc.Refresh(context.Background(), "bad-token", "", ""); !errors.Is(err, ErrInvalidCreds) {
 		t.Fatalf("expected ErrInvalidCreds, got %v", err)
 	}
 
-	newAccess, newRefresh, err := env.authSvc.Refresh(context.Background(), refresh)
+	newAccess, newRefresh, err := env.authSvc.Refresh(context.Background(), refresh, "test-agent", "127.0.0.1")
 	if err != nil {
 		t.Fatalf("refresh: %v", err)
 	}
@@ -227,6 +451,165 @@ func TestAuthServiceLoginRefreshLogout(t *testing.T) {
 	if _, err := env.redis.Get(context.Background(), refreshKey(newClaims.ID)).Result(); !errors.Is(err, redis.Nil) {
 		t.Fatalf("expected refresh revoked, got %v", err)
 	}
+
+	if _, err := env.redis.Get(context.Background(), sessionKey(newClaims.SessionID)).Result(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("expected session revoked, got %v", err)
+	}
+}
+
+func TestAuthServiceSessions(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+	other := createUser(t, env, "other@example.com", "user2", "pass", "user")
+
+	_, refreshA, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "agent-a", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("login a: %v", err)
+	}
+
+	_, refreshB, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "agent-b", "10.0.0.2")
+	if err != nil {
+		t.Fatalf("login b: %v", err)
+	}
+
+	sessions, err := env.authSvc.ListSessions(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+
+	claimsA, err := auth.ParseToken(env.cfg.JWT, refreshA)
+	if err != nil {
+		t.Fatalf("parse refresh a: %v", err)
+	}
+
+	claimsB, err := auth.ParseToken(env.cfg.JWT, refreshB)
+	if err != nil {
+		t.Fatalf("parse refresh b: %v", err)
+	}
+
+	for _, session := range sessions {
+		if session.ID == claimsB.SessionID && (session.Device != "agent-b" || session.IP != "10.0.0.2") {
+			t.Fatalf("unexpected session: %+v", session)
+		}
+	}
+
+	if err := env.authSvc.RevokeSession(context.Background(), other.ID, claimsA.SessionID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	}
+
+	if err := env.authSvc.RevokeSession(context.Background(), user.ID, claimsA.SessionID); err != nil {
+		t.Fatalf("revoke session: %v", err)
+	}
+
+	if _, _, err := env.authSvc.Refresh(context.Background(), refreshA, "", ""); !errors.Is(err, ErrInvalidCreds) {
+		t.Fatalf("expected ErrInvalidCreds, got %v", err)
+	}
+
+	if _, _, err := env.authSvc.Refresh(context.Background(), refreshB, "", ""); err != nil {
+		t.Fatalf("refresh b: %v", err)
+	}
+
+	revoked, err := env.authSvc.RevokeAllSessions(context.Background(), user.ID, "")
+	if err != nil {
+		t.Fatalf("revoke all: %v", err)
+	}
+
+	if revoked != 1 {
+		t.Fatalf("expected 1 revoked, got %d", revoked)
+	}
+
+	if _, _, err := env.authSvc.Refresh(context.Background(), refreshB, "", ""); !errors.Is(err, ErrInvalidCreds) {
+		t.Fatalf("expected ErrInvalidCreds, got %v", err)
+	}
+}
+
+func TestAuthServiceChangePassword(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	_, refreshA, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "", "")
+	if err != nil {
+		t.Fatalf("login a: %v", err)
+	}
+
+	_, refreshB, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "", "")
+	if err != nil {
+		t.Fatalf("login b: %v", err)
+	}
+
+	claimsA, err := auth.ParseToken(env.cfg.JWT, refreshA)
+	if err != nil {
+		t.Fatalf("parse refresh a: %v", err)
+	}
+
+	var ve *ValidationError
+	if err := env.authSvc.ChangePassword(context.Background(), user.ID, "wrong", "newpass", claimsA.SessionID); !errors.As(err, &ve) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	if err := env.authSvc.ChangePassword(context.Background(), user.ID, "pass", "newpass", claimsA.SessionID); err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+
+	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "", ""); !errors.Is(err, ErrInvalidCreds) {
+		t.Fatalf("expected old password rejected, got %v", err)
+	}
+
+	if _, _, err := env.authSvc.Refresh(context.Background(), refreshB, "", ""); !errors.Is(err, ErrInvalidCreds) {
+		t.Fatalf("expected other session revoked, got %v", err)
+	}
+
+	if _, _, err := env.authSvc.Refresh(context.Background(), refreshA, "", ""); err != nil {
+		t.Fatalf("expected current session kept, got %v", err)
+	}
+}
+
+func TestAuthServiceUpdateAccountValidatesFirst(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+	createUser(t, env, "other@example.com", "taken", "pass", "user")
+
+	var ve *ValidationError
+	update := AccountUpdate{Username: ptrString("renamed"), CurrentPassword: "wrong", NewPassword: ptrString("newpass"), Profile: ProfileUpdate{Affiliation: ptrString("KAIST")}}
+	if _, err := env.authSvc.UpdateAccount(context.Background(), user.ID, update, ""); !errors.As(err, &ve) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	update = AccountUpdate{Username: ptrString("taken"), CurrentPassword: "pass", NewPassword: ptrString("newpass"), Profile: ProfileUpdate{Affiliation: ptrString("KAIST")}}
+	if _, err := env.authSvc.UpdateAccount(context.Background(), user.ID, update, ""); !errors.Is(err, ErrUserExists) {
+		t.Fatalf("expected ErrUserExists, got %v", err)
+	}
+
+	stored, err := env.userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+
+	if stored.Username != "user1" || stored.Affiliation != "" {
+		t.Fatalf("expected nothing written, got %+v", stored)
+	}
+
+	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "", ""); err != nil {
+		t.Fatalf("expected old password kept, got %v", err)
+	}
+
+	update = AccountUpdate{Username: ptrString(" renamed "), CurrentPassword: "pass", NewPassword: ptrString("newpass"), Profile: ProfileUpdate{Affiliation: ptrString("KAIST")}}
+	updated, err := env.authSvc.UpdateAccount(context.Background(), user.ID, update, "")
+	if err != nil {
+		t.Fatalf("update account: %v", err)
+	}
+
+	if updated.Username != "renamed" || updated.Affiliation != "KAIST" {
+		t.Fatalf("unexpected account: %+v", updated)
+	}
+
+	if _, _, _, err := env.authSvc.Login(context.Background(), "user@example.com", "newpass", "", ""); err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
 }
 
 func TestAuthServiceRegisterMissingKey(t *testing.T) {
@@ -241,3 +624,178 @@ func TestAuthServiceRegisterMissingKey(t *testing.T) {
 		t.Fatalf("expected validation error, got %v", err)
 	}
 }
+
+func TestAuthServiceRefreshReuseRevokesSession(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	_, refresh, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "", "")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	_, rotated, err := env.authSvc.Refresh(context.Background(), refresh, "", "")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, _, err := env.authSvc.Refresh(context.Background(), refresh, "", ""); !errors.Is(err, ErrInvalidCreds) {
+		t.Fatalf("expected ErrInvalidCreds on reuse, got %v", err)
+	}
+
+	if _, _, err := env.authSvc.Refresh(context.Background(), rotated, "", ""); !errors.Is(err, ErrInvalidCreds) {
+		t.Fatalf("expected rotated token revoked after reuse, got %v", err)
+	}
+
+	sessions, err := env.authSvc.ListSessions(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("list sessions: %v", err)
+	}
+
+	if len(sessions) != 0 {
+		t.Fatalf("expected session revoked, got %d", len(sessions))
+	}
+}
+
+func TestAuthServiceRefreshReloadsRole(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "admin@example.com", "admin1", "pass", "admin")
+
+	_, refresh, _, err := env.authSvc.Login(context.Background(), "admin@example.com", "pass", "", "")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	user.Role = "user"
+	if err := env.userRepo.Update(context.Background(), user); err != nil {
+		t.Fatalf("demote: %v", err)
+	}
+
+	access, _, err := env.authSvc.Refresh(context.Background(), refresh, "", "")
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	claims, err := auth.ParseToken(env.cfg.JWT, access)
+	if err != nil {
+		t.Fatalf("parse access: %v", err)
+	}
+
+	if claims.Role != "user" {
+		t.Fatalf("expected refreshed role user, got %s", claims.Role)
+	}
+}
+
+func TestAuthServiceAccessRevocation(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	access, refresh, _, err := env.authSvc.Login(context.Background(), "user@example.com", "pass", "", "")
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	claims, err := auth.ParseToken(env.cfg.JWT, access)
+	if err != nil {
+		t.Fatalf("parse access: %v", err)
+	}
+
+	revoked, err := env.authSvc.IsAccessRevoked(context.Background(), claims)
+	if err != nil || revoked {
+		t.Fatalf("expected active token, revoked %v err %v", revoked, err)
+	}
+
+	if err := env.authSvc.Logout(context.Background(), refresh); err != nil {
+		t.Fatalf("logout: %v", err)
+	}
+
+	revoked, err = env.authSvc.IsAccessRevoked(context.Background(), claims)
+	if err != nil || !revoked {
+		t.Fatalf("expected revoked after logout, revoked %v err %v", revoked, err)
+	}
+
+	legacy := &auth.Claims{UserID: user.ID}
+	legacy.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	// Issued in the same second as the revocation
+	sameSecond := &auth.Claims{UserID: user.ID}
+	sameSecond.IssuedAt = jwt.NewNumericDate(time.Now())
+
+	if _, err := env.authSvc.RevokeUser(context.Background(), user.ID); err != nil {
+		t.Fatalf("revoke user: %v", err)
+	}
+
+	for _, claims := range []*auth.Claims{legacy, sameSecond} {
+		revoked, err = env.authSvc.IsAccessRevoked(context.Background(), claims)
+		if err != nil || !revoked {
+			t.Fatalf("expected revoked before cutoff, revoked %v err %v", revoked, err)
+		}
+	}
+}
+
+func TestAuthServiceUpdateRole(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin1", "pass", "admin")
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	stale := &auth.Claims{UserID: user.ID, Role: "user"}
+	stale.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	updated, err := env.authSvc.UpdateRole(context.Background(), admin.ID, user.ID, "challenge_author")
+	if err != nil {
+		t.Fatalf("update role: %v", err)
+	}
+
+	if updated.Role != "challenge_author" {
+		t.Fatalf("unexpected role %s", updated.Role)
+	}
+
+	revoked, err := env.authSvc.IsAccessRevoked(context.Background(), stale)
+	if err != nil || !revoked {
+		t.Fatalf("expected stale access token revoked, revoked %v err %v", revoked, err)
+	}
+
+	var ve *ValidationError
+	_, err = env.authSvc.UpdateRole(context.Background(), admin.ID, user.ID, "root")
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "role" {
+		t.Fatalf("expected role validation error, got %v", err)
+	}
+
+	_, err = env.authSvc.UpdateRole(context.Background(), admin.ID, admin.ID, "user")
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "cannot change own role" {
+		t.Fatalf("expected self change validation error, got %v", err)
+	}
+}
+
+func TestAuthServiceListRegistrationKeysFilters(t *testing.T) {
+	env := setupServiceTest(t)
+	admin := createUser(t, env, "admin@example.com", "admin", "pass", "admin")
+	alpha := createTeam(t, env, "Alpha")
+	beta := createTeam(t, env, "Beta")
+	_ = createRegistrationKeyWithTeam(t, env, "555551", admin.ID, alpha.ID)
+	_ = createRegistrationKeyWithTeam(t, env, "555552", admin.ID, beta.ID)
+
+	rows, err := env.authSvc.ListRegistrationKeys(context.Background(), models.RegistrationKeyFilter{TeamID: &beta.ID})
+	if err != nil {
+		t.Fatalf("list keys: %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].Code != "555552" || rows[0].Status != models.RegistrationKeyActive {
+		t.Fatalf("unexpected rows: %+v", rows)
+	}
+
+	_, err = env.authSvc.ListRegistrationKeys(context.Background(), models.RegistrationKeyFilter{Limit: maxRegistrationKeyLimit + 1, Offset: -1})
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 2 {
+		t.Fatalf("expected limit and offset errors, got %v", err)
+	}
+
+	rows, err = env.authSvc.ExportRegistrationKeys(context.Background(), models.RegistrationKeyFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("export keys: %v", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected export to ignore paging, got %d rows", len(rows))
+	}
+}
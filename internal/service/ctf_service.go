@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"smctf/internal/auth"
 	"smctf/internal/config"
 	"smctf/internal/models"
 	"smctf/internal/repo"
@@ -18,8 +19,7 @@ import (
 )
 
 const (
-	redisSubmitPrefix = "submit:"
-	maxFlagLength     = 128
+	maxFlagLength = 128
 )
 
 var challengeCategories = map[string]struct{}{
@@ -44,11 +44,12 @@ type CTFService struct {
 	challengeRepo  *repo.ChallengeRepo
 	submissionRepo *repo.SubmissionRepo
 	redis          *redis.Client
+	limiter        *RateLimiter
 	fileStore      storage.ChallengeFileStore
 }
 
 func NewCTFService(cfg config.Config, challengeRepo *repo.ChallengeRepo, submissionRepo *repo.SubmissionRepo, redis *redis.Client, fileStore storage.ChallengeFileStore) *CTFService {
-	return &CTFService{cfg: cfg, challengeRepo: challengeRepo, submissionRepo: submissionRepo, redis: redis, fileStore: fileStore}
+	return &CTFService{cfg: cfg, challengeRepo: challengeRepo, submissionRepo: submissionRepo, redis: redis, limiter: NewRateLimiter(redis), fileStore: fileStore}
 }
 
 func (s *CTFService) ListChallenges(ctx context.Context) ([]models.Challenge, error) {
@@ -87,7 +88,7 @@ func (s *CTFService) GetChallengeByID(ctx context.Context, id int64) (*models.Ch
 	return challenge, nil
 }
 
-func (s *CTFService) CreateChallenge(ctx context.Context, title, description, category string, points int, minimumPoints int, flag string, active bool, stackEnabled bool, stackTargetPort int, stackPodSpec *string) (*models.Challenge, error) {
+func (s *CTFService) CreateChallenge(ctx context.Context, title, description, category string, points int, minimumPoints int, flag string, active bool, stackEnabled bool, stackTargetPort int, stackPodSpec *string, stackTeamShared bool, createdBy int64) (*models.Challenge, error) {
 	title = normalizeTrim(title)
 	description = normalizeTrim(description)
 	category = normalizeTrim(category)
@@ -115,6 +116,14 @@ func (s *CTFService) CreateChallenge(ctx context.Context, title, description, ca
 
 		if stackPodSpec == nil || normalizeTrim(*stackPodSpec) == "" {
 			validator.fields = append(validator.fields, FieldError{Field: "stack_pod_spec", Reason: "required"})
+		} else {
+			// An out of range port is already reported above and is not checked against the spec
+			port := 0
+			if stackTargetPort >= 1 && stackTargetPort <= 65535 {
+				port = stackTargetPort
+			}
+
+			validator.fields = append(validator.fields, validatePodSpec(s.cfg.Stack, *stackPodSpec, port)...)
 		}
 	}
 
@@ -128,6 +137,7 @@ func (s *CTFService) CreateChallenge(ctx context.Context, title, description, ca
 		podSpec = &trimmed
 	} else if !stackEnabled {
 		stackTargetPort = 0
+		stackTeamShared = false
 	}
 
 	challenge := &models.Challenge{
@@ -140,10 +150,15 @@ func (s *CTFService) CreateChallenge(ctx context.Context, title, description, ca
 		StackEnabled:    stackEnabled,
 		StackTargetPort: stackTargetPort,
 		StackPodSpec:    podSpec,
+		StackTeamShared: stackTeamShared,
 		IsActive:        active,
 		CreatedAt:       time.Now().UTC(),
 	}
 
+	if createdBy > 0 {
+		challenge.CreatedBy = &createdBy
+	}
+
 	if err := s.challengeRepo.Create(ctx, challenge); err != nil {
 		return nil, fmt.Errorf("ctf.CreateChallenge: %w", err)
 	}
@@ -155,7 +170,28 @@ func (s *CTFService) CreateChallenge(ctx context.Context, title, description, ca
 	return challenge, nil
 }
 
-func (s *CTFService) UpdateChallenge(ctx context.Context, id int64, title, description, category *string, points *int, minimumPoints *int, flag *string, active *bool, stackEnabled *bool, stackTargetPort *int, stackPodSpec *string) (*models.Challenge, error) {
+// Roles without challenges:any may only manage challenges they created
+func (s *CTFService) AuthorizeChallenge(ctx context.Context, id, userID int64, role string) error {
+	if auth.HasPermission(role, auth.PermChallengesAny) {
+		return nil
+	}
+
+	challenge, err := s.challengeRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return ErrChallengeNotFound
+		}
+		return fmt.Errorf("ctf.AuthorizeChallenge lookup: %w", err)
+	}
+
+	if challenge.CreatedBy == nil || *challenge.CreatedBy != userID {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func (s *CTFService) UpdateChallenge(ctx context.Context, id int64, title, description, category *string, points *int, minimumPoints *int, flag *string, active *bool, stackEnabled *bool, stackTargetPort *int, stackPodSpec *string, stackTeamShared *bool) (*models.Challenge, error) {
 	normalizedTitle := normalizeOptional(title)
 	normalizedDescription := normalizeOptional(description)
 	normalizedCategory := normalizeOptional(category)
@@ -233,6 +269,7 @@ func (s *CTFService) UpdateChallenge(ctx context.Context, id int64, title, descr
 		if !*stackEnabled {
 			challenge.StackTargetPort = 0
 			challenge.StackPodSpec = nil
+			challenge.StackTeamShared = false
 		}
 	}
 
@@ -260,6 +297,14 @@ func (s *CTFService) UpdateChallenge(ctx context.Context, id int64, title, descr
 		}
 	}
 
+	if stackTeamShared != nil {
+		if *stackTeamShared && !challenge.StackEnabled {
+			return nil, NewValidationError(FieldError{Field: "stack_team_shared", Reason: "stack disabled"})
+		}
+
+		challenge.StackTeamShared = *stackTeamShared
+	}
+
 	if challenge.StackEnabled {
 		if challenge.StackTargetPort <= 0 {
 			return nil, NewValidationError(FieldError{Field: "stack_target_port", Reason: "required"})
@@ -268,6 +313,13 @@ func (s *CTFService) UpdateChallenge(ctx context.Context, id int64, title, descr
 		if challenge.StackPodSpec == nil || normalizeTrim(*challenge.StackPodSpec) == "" {
 			return nil, NewValidationError(FieldError{Field: "stack_pod_spec", Reason: "required"})
 		}
+
+		// Specs saved before the policy was tightened stay editable until their stack settings change
+		if stackEnabled != nil || stackTargetPort != nil || normalizedPodSpec != nil {
+			if fields := validatePodSpec(s.cfg.Stack, *challenge.StackPodSpec, challenge.StackTargetPort); len(fields) > 0 {
+				return nil, NewValidationError(fields...)
+			}
+		}
 	}
 
 	if challenge.MinimumPoints > challenge.Points {
@@ -311,7 +363,7 @@ func (s *CTFService) SubmitFlag(ctx context.Context, userID, challengeID int64,
 		return false, err
 	}
 
-	if err := s.rateLimit(ctx, userID); err != nil {
+	if err := s.rateLimit(ctx, userID, challengeID); err != nil {
 		return false, err
 	}
 
@@ -56,7 +56,7 @@ func newClosedServiceDB(t *testing.T) *bun.DB {
 func TestCTFServiceCreateAndListChallenges(t *testing.T) {
 	env := setupServiceTest(t)
 
-	challenge, err := env.ctfSvc.CreateChallenge(context.Background(), "Title", "Desc", "Misc", 100, 80, "FLAG{1}", true, false, 0, nil)
+	challenge, err := env.ctfSvc.CreateChallenge(context.Background(), "Title", "Desc", "Misc", 100, 80, "FLAG{1}", true, false, 0, nil, false, 0)
 	if err != nil {
 		t.Fatalf("create challenge: %v", err)
 	}
@@ -85,32 +85,63 @@ func TestCTFServiceCreateAndListChallenges(t *testing.T) {
 
 func TestCTFServiceCreateChallengeValidation(t *testing.T) {
 	env := setupServiceTest(t)
-	_, err := env.ctfSvc.CreateChallenge(context.Background(), "", "", "Nope", -1, 0, "", true, false, 0, nil)
+	_, err := env.ctfSvc.CreateChallenge(context.Background(), "", "", "Nope", -1, 0, "", true, false, 0, nil, false, 0)
 
 	var ve *ValidationError
 	if !errors.As(err, &ve) {
 		t.Fatalf("expected validation error, got %v", err)
 	}
 
-	_, err = env.ctfSvc.CreateChallenge(context.Background(), "Title", "Desc", "Misc", 100, 200, "FLAG{X}", true, false, 0, nil)
+	_, err = env.ctfSvc.CreateChallenge(context.Background(), "Title", "Desc", "Misc", 100, 200, "FLAG{X}", true, false, 0, nil, false, 0)
 	if !errors.As(err, &ve) {
 		t.Fatalf("expected validation error for minimum_points, got %v", err)
 	}
 
 	podSpec := "apiVersion: v1\nkind: Pod\nmetadata:\n  name: test\nspec:\n  containers:\n    - name: app\n      image: nginx\n      ports:\n        - containerPort: 80\n"
-	_, err = env.ctfSvc.CreateChallenge(context.Background(), "Stack", "Desc", "Web", 100, 80, "FLAG{S}", true, true, 0, &podSpec)
+	_, err = env.ctfSvc.CreateChallenge(context.Background(), "Stack", "Desc", "Web", 100, 80, "FLAG{S}", true, true, 0, &podSpec, false, 0)
 	if !errors.As(err, &ve) {
 		t.Fatalf("expected validation error for stack_target_port, got %v", err)
 	}
 }
 
+func TestCTFServiceAuthorizeChallenge(t *testing.T) {
+	env := setupServiceTest(t)
+	author := createUser(t, env, "author@example.com", "author", "pass", "challenge_author")
+	other := createUser(t, env, "other@example.com", "other", "pass", "challenge_author")
+
+	challenge, err := env.ctfSvc.CreateChallenge(context.Background(), "Owned", "Desc", "Misc", 100, 100, "FLAG{OWN}", true, false, 0, nil, false, author.ID)
+	if err != nil {
+		t.Fatalf("create challenge: %v", err)
+	}
+
+	if challenge.CreatedBy == nil || *challenge.CreatedBy != author.ID {
+		t.Fatalf("expected created_by %d, got %v", author.ID, challenge.CreatedBy)
+	}
+
+	if err := env.ctfSvc.AuthorizeChallenge(context.Background(), challenge.ID, author.ID, "challenge_author"); err != nil {
+		t.Fatalf("expected author access, got %v", err)
+	}
+
+	if err := env.ctfSvc.AuthorizeChallenge(context.Background(), challenge.ID, other.ID, "challenge_author"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+
+	if err := env.ctfSvc.AuthorizeChallenge(context.Background(), challenge.ID, other.ID, "reviewer"); err != nil {
+		t.Fatalf("expected reviewer access, got %v", err)
+	}
+
+	if err := env.ctfSvc.AuthorizeChallenge(context.Background(), 9999, author.ID, "challenge_author"); !errors.Is(err, ErrChallengeNotFound) {
+		t.Fatalf("expected ErrChallengeNotFound, got %v", err)
+	}
+}
+
 func TestCTFServiceListChallengesDynamicPoints(t *testing.T) {
 	env := setupServiceTest(t)
 	team := createTeam(t, env, "Alpha")
 	teamUser := createUserWithTeam(t, env, "t1@example.com", "t1", "pass", "user", team.ID)
 	soloUser := createUser(t, env, "s1@example.com", "s1", "pass", "user")
 
-	challenge, err := env.ctfSvc.CreateChallenge(context.Background(), "Dynamic", "Desc", "Misc", 500, 100, "FLAG{DYN}", true, false, 0, nil)
+	challenge, err := env.ctfSvc.CreateChallenge(context.Background(), "Dynamic", "Desc", "Misc", 500, 100, "FLAG{DYN}", true, false, 0, nil, false, 0)
 	if err != nil {
 		t.Fatalf("create challenge: %v", err)
 	}
@@ -174,7 +205,7 @@ func TestCTFServiceUpdateChallenge(t *testing.T) {
 	newActive := false
 
 	newMin := 40
-	updated, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, &newTitle, &newDesc, &newCat, &newPoints, &newMin, nil, &newActive, nil, nil, nil)
+	updated, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, &newTitle, &newDesc, &newCat, &newPoints, &newMin, nil, &newActive, nil, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("update challenge: %v", err)
 	}
@@ -184,16 +215,16 @@ func TestCTFServiceUpdateChallenge(t *testing.T) {
 	}
 
 	flag := "FLAG{IMMUTABLE}"
-	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, &flag, nil, nil, nil, nil); err == nil {
+	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, &flag, nil, nil, nil, nil, nil); err == nil {
 		t.Fatalf("expected flag immutable error")
 	}
 
 	badCat := "Bad"
-	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, &badCat, nil, nil, nil, nil, nil, nil, nil); err == nil {
+	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, &badCat, nil, nil, nil, nil, nil, nil, nil, nil); err == nil {
 		t.Fatalf("expected validation error")
 	}
 
-	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), 9999, &newTitle, nil, nil, nil, nil, nil, nil, nil, nil, nil); !errors.Is(err, ErrChallengeNotFound) {
+	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), 9999, &newTitle, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil); !errors.Is(err, ErrChallengeNotFound) {
 		t.Fatalf("expected ErrChallengeNotFound, got %v", err)
 	}
 }
@@ -562,33 +593,38 @@ func TestCTFServiceStackFields(t *testing.T) {
 	env := setupServiceTest(t)
 	podSpec := "apiVersion: v1\nkind: Pod\nmetadata:\n  name: test\nspec:\n  containers:\n    - name: app\n      image: nginx\n      ports:\n        - containerPort: 80\n"
 
-	challenge, err := env.ctfSvc.CreateChallenge(context.Background(), "Stack", "Desc", "Web", 100, 80, "FLAG{STACK}", true, true, 80, &podSpec)
+	challenge, err := env.ctfSvc.CreateChallenge(context.Background(), "Stack", "Desc", "Web", 100, 80, "FLAG{STACK}", true, true, 80, &podSpec, true, 0)
 	if err != nil {
 		t.Fatalf("create challenge: %v", err)
 	}
 
-	if !challenge.StackEnabled || challenge.StackTargetPort != 80 || challenge.StackPodSpec == nil {
+	if !challenge.StackEnabled || challenge.StackTargetPort != 80 || challenge.StackPodSpec == nil || !challenge.StackTeamShared {
 		t.Fatalf("unexpected stack fields: %+v", challenge)
 	}
 
 	disable := false
-	updated, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, &disable, nil, nil)
+	updated, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, &disable, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("disable stack: %v", err)
 	}
 
-	if updated.StackEnabled || updated.StackTargetPort != 0 || updated.StackPodSpec != nil {
+	if updated.StackEnabled || updated.StackTargetPort != 0 || updated.StackPodSpec != nil || updated.StackTeamShared {
 		t.Fatalf("expected stack cleared, got %+v", updated)
 	}
 
+	shared := true
+	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, &shared); err == nil {
+		t.Fatalf("expected validation error for team shared without stack")
+	}
+
 	newPort := 80
-	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, nil, &newPort, nil); err == nil {
+	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, nil, &newPort, nil, nil); err == nil {
 		t.Fatalf("expected validation error when stack disabled")
 	}
 
 	enable := true
 	empty := ""
-	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, &enable, &newPort, &empty); err == nil {
+	if _, err := env.ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, &enable, &newPort, &empty, nil); err == nil {
 		t.Fatalf("expected validation error for empty pod spec")
 	} else {
 		var ve *ValidationError
@@ -598,6 +634,44 @@ func TestCTFServiceStackFields(t *testing.T) {
 	}
 }
 
+func TestCTFServicePodSpecPolicy(t *testing.T) {
+	env := setupServiceTest(t)
+	cfg := env.cfg
+	cfg.Stack.PodRequireLimits = true
+	cfg.Stack.PodAllowedRegistries = []string{"ghcr.io/smctf"}
+	ctfSvc := NewCTFService(cfg, env.challengeRepo, env.submissionRepo, env.redis, nil)
+
+	privileged := "kind: Pod\nspec:\n  containers:\n    - name: app\n      image: ghcr.io/smctf/web\n      ports:\n        - containerPort: 80\n      resources:\n        limits:\n          cpu: 500m\n          memory: 128Mi\n      securityContext:\n        privileged: true\n"
+	_, err := ctfSvc.CreateChallenge(context.Background(), "Stack", "Desc", "Web", 100, 80, "FLAG{STACK}", true, true, 80, &privileged, false, 0)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Reason != "privileged containers not allowed" {
+		t.Fatalf("expected privileged field error, got %v", err)
+	}
+
+	podSpec := strings.Replace(privileged, "true", "false", 1)
+	_, err = ctfSvc.CreateChallenge(context.Background(), "Stack", "Desc", "Web", 100, 80, "FLAG{STACK}", true, true, 65616, &podSpec, false, 0)
+	if !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Field != "stack_target_port" || ve.Fields[0].Reason != "invalid" {
+		t.Fatalf("expected only the invalid port error, got %v", err)
+	}
+
+	challenge, err := ctfSvc.CreateChallenge(context.Background(), "Stack", "Desc", "Web", 100, 80, "FLAG{STACK}", true, true, 80, &podSpec, false, 0)
+	if err != nil {
+		t.Fatalf("create challenge: %v", err)
+	}
+
+	port := 8080
+	_, err = ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, nil, &port, nil, nil)
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "stack_target_port" {
+		t.Fatalf("expected target port field error, got %v", err)
+	}
+
+	dockerHub := strings.Replace(podSpec, "ghcr.io/smctf/web", "nginx", 1)
+	_, err = ctfSvc.UpdateChallenge(context.Background(), challenge.ID, nil, nil, nil, nil, nil, nil, nil, nil, nil, &dockerHub, nil)
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "image registry not allowed" {
+		t.Fatalf("expected registry field error, got %v", err)
+	}
+}
+
 func ptrString(value string) *string {
 	return &value
 }
@@ -1,22 +1,38 @@
 package service
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
-	ErrUserExists            = errors.New("user already exists")
-	ErrInvalidCreds          = errors.New("invalid credentials")
-	ErrInvalidInput          = errors.New("invalid input")
-	ErrChallengeNotFound     = errors.New("challenge not found")
-	ErrChallengeFileNotFound = errors.New("challenge file not found")
-	ErrStorageUnavailable    = errors.New("storage unavailable")
-	ErrAlreadySolved         = errors.New("challenge already solved")
-	ErrRateLimited           = errors.New("too many submissions")
-	ErrStackDisabled         = errors.New("stack feature disabled")
-	ErrStackNotEnabled       = errors.New("stack not enabled for challenge")
-	ErrStackLimitReached     = errors.New("stack limit reached")
-	ErrStackNotFound         = errors.New("stack not found")
-	ErrStackProvisionerDown  = errors.New("stack provisioner unavailable")
-	ErrStackInvalidSpec      = errors.New("stack spec invalid")
+	ErrUserExists              = errors.New("user already exists")
+	ErrTeamNotEmpty            = errors.New("team has members")
+	ErrNotCaptain              = errors.New("team captain only")
+	ErrInvalidCreds            = errors.New("invalid credentials")
+	ErrLoginLocked             = errors.New("too many login attempts")
+	ErrPoWRequired             = errors.New("proof of work required")
+	ErrPoWInvalid              = errors.New("invalid proof of work")
+	ErrSessionNotFound         = errors.New("session not found")
+	ErrAPITokenNotFound        = errors.New("api token not found")
+	ErrRegistrationKeyNotFound = errors.New("registration key not found")
+	ErrInvalidInput            = errors.New("invalid input")
+	ErrForbidden               = errors.New("forbidden")
+	ErrChallengeNotFound       = errors.New("challenge not found")
+	ErrChallengeFileNotFound   = errors.New("challenge file not found")
+	ErrStorageUnavailable      = errors.New("storage unavailable")
+	ErrAlreadySolved           = errors.New("challenge already solved")
+	ErrRateLimited             = errors.New("too many submissions")
+	ErrStackDisabled           = errors.New("stack feature disabled")
+	ErrStackNotEnabled         = errors.New("stack not enabled for challenge")
+	ErrStackLimitReached       = errors.New("stack limit reached")
+	ErrStackNotFound           = errors.New("stack not found")
+	ErrStackProvisionerDown    = errors.New("stack provisioner unavailable")
+	ErrStackInvalidSpec        = errors.New("stack spec invalid")
+	ErrStackExtendLimit        = errors.New("stack extension limit reached")
+	ErrStackNotReady           = errors.New("stack not ready")
+	ErrStackCallbackSignature  = errors.New("invalid callback signature")
+	ErrStackCallbackStale      = errors.New("stale callback")
 )
 
 type FieldError struct {
@@ -41,9 +57,10 @@ func NewValidationError(fields ...FieldError) *ValidationError {
 }
 
 type RateLimitInfo struct {
-	Limit        int `json:"limit"`
-	Remaining    int `json:"remaining"`
-	ResetSeconds int `json:"reset_seconds"`
+	Limit        int    `json:"limit"`
+	Remaining    int    `json:"remaining"`
+	ResetSeconds int    `json:"reset_seconds"`
+	Policy       string `json:"policy,omitempty"`
 }
 
 type RateLimitError struct {
@@ -57,3 +74,15 @@ func (e *RateLimitError) Error() string {
 func (e *RateLimitError) Unwrap() error {
 	return ErrRateLimited
 }
+
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"smctf/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisLoginLockPrefix     = "login_lock:"
+	redisLoginLockoutsPrefix = "login_lockouts:"
+	redisLoginLockLogPrefix  = "login_lock_logged:"
+	rateLimitLoginFail       = "login_fail"
+	loginLockoutMemory       = 24 * time.Hour
+	defaultLoginFailureLimit = 100
+	maxLoginFailureLimit     = 500
+)
+
+type loginSubject struct {
+	key   string
+	scope string
+	limit RateLimitSubject
+	max   int
+}
+
+func accountSubject(email string) loginSubject {
+	return loginSubject{key: "account:" + email, scope: RateLimitScopeAccount, limit: RateLimitSubject{Account: email}}
+}
+
+func ipSubject(ip string) loginSubject {
+	return loginSubject{key: "ip:" + ip, scope: RateLimitScopeIP, limit: RateLimitSubject{IP: ip}}
+}
+
+func (s loginSubject) failKey() string {
+	key, _ := rateLimitKey(rateLimitLoginFail, s.scope, s.limit)
+	return key
+}
+
+// Counts lockouts and starts their memory on the first one, in one step so a crash cannot leave a counter without expiry
+var loginLockoutScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func (s *AuthService) loginSubjects(email, ip string) []loginSubject {
+	account := accountSubject(email)
+	account.max = s.cfg.Security.LoginAccountMax
+	subjects := []loginSubject{account}
+	if ip != "" {
+		subject := ipSubject(ip)
+		subject.max = s.cfg.Security.LoginIPMax
+		subjects = append(subjects, subject)
+	}
+
+	return subjects
+}
+
+func (s *AuthService) checkLoginLock(ctx context.Context, subjects []loginSubject) error {
+	pipe := s.redis.Pipeline()
+	cmds := make([]*redis.DurationCmd, len(subjects))
+	for i, subject := range subjects {
+		cmds[i] = pipe.PTTL(ctx, redisLoginLockPrefix+subject.key)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("auth.checkLoginLock: %w", err)
+	}
+
+	var retryAfter time.Duration
+	for _, cmd := range cmds {
+		retryAfter = max(retryAfter, cmd.Val())
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// Reports whether the attempt is the first one refused by a lockout. Only that one is stored, so a client
+// retrying a locked login does not add a row per try.
+func (s *AuthService) firstLockedAttempt(ctx context.Context, subjects []loginSubject) (bool, error) {
+	first := false
+	for _, subject := range subjects {
+		ttl, err := s.redis.PTTL(ctx, redisLoginLockPrefix+subject.key).Result()
+		if err != nil {
+			return false, fmt.Errorf("auth.firstLockedAttempt: %w", err)
+		}
+
+		if ttl <= 0 {
+			continue
+		}
+
+		logged, err := s.redis.SetNX(ctx, redisLoginLockLogPrefix+subject.key, "1", ttl).Result()
+		if err != nil {
+			return false, fmt.Errorf("auth.firstLockedAttempt mark: %w", err)
+		}
+
+		first = first || logged
+	}
+
+	return first, nil
+}
+
+// Counts the failure per subject over a sliding window. Reaching the limit locks the subject, doubling the lock
+// for every lockout within a day.
+func (s *AuthService) recordLoginFailure(ctx context.Context, subjects []loginSubject) error {
+	// The failure count must not end up in the RateLimit-* headers of the login response
+	ctx = withoutRateLimitResult(ctx)
+	window := s.cfg.Security.LoginWindow
+
+	for _, subject := range subjects {
+		if subject.max <= 0 || window <= 0 {
+			continue
+		}
+
+		policy := RateLimitPolicy{Scope: subject.scope, Limit: subject.max, Window: window}
+		info, err := s.limiter.Allow(ctx, rateLimitLoginFail, subject.limit, policy)
+		if err != nil {
+			// A full window means a concurrent failure reached the limit and is locking the subject
+			var rl *RateLimitError
+			if errors.As(err, &rl) {
+				continue
+			}
+			return fmt.Errorf("auth.recordLoginFailure: %w", err)
+		}
+
+		if info.Remaining > 0 {
+			continue
+		}
+
+		if err := s.lockLoginSubject(ctx, subject); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *AuthService) lockLoginSubject(ctx context.Context, subject loginSubject) error {
+	lockouts, err := loginLockoutScript.Run(ctx, s.redis, []string{redisLoginLockoutsPrefix + subject.key}, loginLockoutMemory.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("auth.lockLoginSubject: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, redisLoginLockPrefix+subject.key, "1", s.lockoutDuration(lockouts))
+	pipe.Del(ctx, subject.failKey(), redisLoginLockLogPrefix+subject.key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("auth.lockLoginSubject set: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AuthService) lockoutDuration(lockouts int64) time.Duration {
+	duration := s.cfg.Security.LoginLockoutBase
+	for i := int64(1); i < lockouts && duration < s.cfg.Security.LoginLockoutMax; i++ {
+		duration *= 2
+	}
+
+	return min(duration, s.cfg.Security.LoginLockoutMax)
+}
+
+func (s *AuthService) clearLoginFailures(ctx context.Context, subject loginSubject) error {
+	if err := s.redis.Del(ctx, subject.failKey(), redisLoginLockoutsPrefix+subject.key).Err(); err != nil {
+		return fmt.Errorf("auth.clearLoginFailures: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AuthService) storeLoginFailure(ctx context.Context, user *models.User, email, ip, device, reason string) error {
+	failure := &models.LoginFailure{
+		Email:     email,
+		IP:        ip,
+		Device:    device,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if user != nil {
+		failure.UserID = &user.ID
+	}
+
+	if err := s.loginFailureRepo.Create(ctx, failure); err != nil {
+		return fmt.Errorf("auth.storeLoginFailure: %w", err)
+	}
+
+	return nil
+}
+
+// Lifts the account lockout and resets its failure count and backoff
+func (s *AuthService) UnlockAccount(ctx context.Context, userID int64) error {
+	validator := newFieldValidator()
+	validator.PositiveID("id", userID)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("auth.UnlockAccount lookup: %w", err)
+	}
+
+	subject := accountSubject(normalizeEmail(user.Email))
+	if err := s.redis.Del(ctx, redisLoginLockPrefix+subject.key, subject.failKey(), redisLoginLockoutsPrefix+subject.key, redisLoginLockLogPrefix+subject.key).Err(); err != nil {
+		return fmt.Errorf("auth.UnlockAccount: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AuthService) ListLoginFailures(ctx context.Context, email, ip string, limit int) ([]models.LoginFailure, error) {
+	if limit == 0 {
+		limit = defaultLoginFailureLimit
+	}
+
+	validator := newFieldValidator()
+	validator.PositiveID("limit", int64(limit))
+	if limit > maxLoginFailureLimit {
+		validator.fields = append(validator.fields, FieldError{Field: "limit", Reason: "too large"})
+	}
+
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	email = normalizeEmail(email)
+	failures, err := s.loginFailureRepo.List(ctx, email, normalizeTrim(ip), limit)
+	if err != nil {
+		return nil, fmt.Errorf("auth.ListLoginFailures: %w", err)
+	}
+
+	return failures, nil
+}
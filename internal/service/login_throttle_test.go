@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"smctf/internal/config"
+	"smctf/internal/models"
+	"smctf/internal/repo"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLoginLockoutDuration(t *testing.T) {
+	svc := &AuthService{cfg: config.Config{Security: config.SecurityConfig{
+		LoginLockoutBase: time.Minute,
+		LoginLockoutMax:  10 * time.Minute,
+	}}}
+
+	cases := map[int64]time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		4: 8 * time.Minute,
+		5: 10 * time.Minute,
+		9: 10 * time.Minute,
+	}
+
+	for lockouts, want := range cases {
+		if got := svc.lockoutDuration(lockouts); got != want {
+			t.Fatalf("lockoutDuration(%d) = %v, want %v", lockouts, got, want)
+		}
+	}
+}
+
+func TestFirstLockedAttempt(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	svc := &AuthService{cfg: config.Config{Security: config.SecurityConfig{LoginLockoutBase: time.Minute, LoginLockoutMax: time.Hour}}, redis: client}
+	account := accountSubject("user@example.com")
+	ip := ipSubject("10.0.0.1")
+
+	if err := svc.lockLoginSubject(context.Background(), account); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	for i, want := range []bool{true, false, false} {
+		first, err := svc.firstLockedAttempt(context.Background(), []loginSubject{account, ip})
+		if err != nil || first != want {
+			t.Fatalf("attempt %d: expected first=%v, got %v err %v", i, want, first, err)
+		}
+	}
+
+	// Another IP is still refused by the same account lockout
+	if first, _ := svc.firstLockedAttempt(context.Background(), []loginSubject{account, ipSubject("10.0.0.2")}); first {
+		t.Fatalf("expected a new ip to reuse the account lockout")
+	}
+
+	// A new lockout is stored again
+	if err := svc.lockLoginSubject(context.Background(), account); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	if first, _ := svc.firstLockedAttempt(context.Background(), []loginSubject{account, ip}); !first {
+		t.Fatalf("expected the next lockout to be stored")
+	}
+}
+
+func TestRecordLoginFailureLocksAtLimit(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	cfg := config.Config{Security: config.SecurityConfig{LoginWindow: time.Minute, LoginAccountMax: 3, LoginLockoutBase: time.Minute, LoginLockoutMax: time.Hour}}
+	svc := &AuthService{cfg: cfg, redis: client, limiter: NewRateLimiter(client)}
+	ctx := WithRateLimitRequest(context.Background(), "10.0.0.1")
+	subject := accountSubject("user@example.com")
+	subject.max = 3
+
+	for i := range 3 {
+		if err := svc.checkLoginLock(ctx, []loginSubject{subject}); err != nil {
+			t.Fatalf("attempt %d: unexpected lock %v", i, err)
+		}
+
+		if err := svc.recordLoginFailure(ctx, []loginSubject{subject}); err != nil {
+			t.Fatalf("attempt %d: record: %v", i, err)
+		}
+	}
+
+	var locked *LoginLockedError
+	if err := svc.checkLoginLock(ctx, []loginSubject{subject}); !errors.As(err, &locked) || locked.RetryAfter != time.Minute {
+		t.Fatalf("expected a one minute lock, got %v", err)
+	}
+
+	if redisServer.Exists(subject.failKey()) {
+		t.Fatalf("expected the failure window to be cleared on lock")
+	}
+
+	if ttl := redisServer.TTL(redisLoginLockoutsPrefix + subject.key); ttl != loginLockoutMemory {
+		t.Fatalf("expected lockout memory %v, got %v", loginLockoutMemory, ttl)
+	}
+
+	if _, ok := RateLimitResult(ctx); ok {
+		t.Fatalf("expected login failures to stay out of the rate limit headers")
+	}
+}
+
+func newThrottledAuthService(env serviceEnv) *AuthService {
+	cfg := env.cfg
+	cfg.Security.LoginWindow = time.Minute
+	cfg.Security.LoginAccountMax = 3
+	cfg.Security.LoginIPMax = 5
+	cfg.Security.LoginLockoutBase = time.Minute
+	cfg.Security.LoginLockoutMax = time.Hour
+
+	return NewAuthService(cfg, env.db, env.userRepo, env.regKeyRepo, env.teamRepo, repo.NewLoginFailureRepo(env.db), env.appConfigSvc, env.redis)
+}
+
+func TestAuthServiceLoginLockout(t *testing.T) {
+	env := setupServiceTest(t)
+	svc := newThrottledAuthService(env)
+	user := createUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := svc.Login(context.Background(), "user@example.com", "wrong", "ua", "10.0.0.1"); !errors.Is(err, ErrInvalidCreds) {
+			t.Fatalf("attempt %d: expected ErrInvalidCreds, got %v", i, err)
+		}
+	}
+
+	// Only the first refused attempt of the lockout is stored
+	for i := 0; i < 3; i++ {
+		_, _, _, err := svc.Login(context.Background(), "user@example.com", "pass", "ua", "10.0.0.2")
+		var locked *LoginLockedError
+		if !errors.As(err, &locked) || locked.RetryAfter <= 0 || locked.RetryAfter > time.Minute {
+			t.Fatalf("expected account lockout, got %v", err)
+		}
+	}
+
+	failures, err := svc.ListLoginFailures(context.Background(), "user@example.com", "", 0)
+	if err != nil {
+		t.Fatalf("list failures: %v", err)
+	}
+
+	if len(failures) != 4 || failures[0].Reason != models.LoginFailureLocked || failures[1].UserID == nil || *failures[1].UserID != user.ID {
+		t.Fatalf("unexpected failures: %+v", failures)
+	}
+
+	if err := svc.UnlockAccount(context.Background(), user.ID); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	if _, _, _, err := svc.Login(context.Background(), "user@example.com", "pass", "ua", "10.0.0.2"); err != nil {
+		t.Fatalf("login after unlock: %v", err)
+	}
+}
+
+func TestAuthServiceLoginIPLockout(t *testing.T) {
+	env := setupServiceTest(t)
+	svc := newThrottledAuthService(env)
+	createUser(t, env, "user@example.com", "user1", "pass", "user")
+
+	for i := 0; i < 5; i++ {
+		email := fmt.Sprintf("nobody%d@example.com", i)
+		if _, _, _, err := svc.Login(context.Background(), email, "wrong", "ua", "10.0.0.9"); !errors.Is(err, ErrInvalidCreds) {
+			t.Fatalf("attempt %d: expected ErrInvalidCreds, got %v", i, err)
+		}
+	}
+
+	if _, _, _, err := svc.Login(context.Background(), "user@example.com", "pass", "ua", "10.0.0.9"); !errors.Is(err, ErrLoginLocked) {
+		t.Fatalf("expected ip lockout, got %v", err)
+	}
+
+	if _, _, _, err := svc.Login(context.Background(), "user@example.com", "pass", "ua", "10.0.0.10"); err != nil {
+		t.Fatalf("login from other ip: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	PoWPurposeRegister = "register"
+	PoWPurposeSubmit   = "submit"
+
+	redisPoWPrefix   = "pow:"
+	maxPoWDifficulty = 32
+	maxPoWSolution   = 64
+)
+
+type PoWChallenge struct {
+	Nonce      string
+	Purpose    string
+	Difficulty int
+	ExpiresAt  time.Time
+}
+
+// Hashcash-style gate: sha256(nonce + ":" + solution) must start with difficulty zero bits
+type PoWService struct {
+	appConfig *AppConfigService
+	redis     *redis.Client
+	ttl       time.Duration
+}
+
+func NewPoWService(appConfig *AppConfigService, redis *redis.Client, ttl time.Duration) *PoWService {
+	return &PoWService{appConfig: appConfig, redis: redis, ttl: ttl}
+}
+
+func (s *PoWService) Difficulty(ctx context.Context, purpose string) (int, error) {
+	cfg, _, _, err := s.appConfig.Get(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("pow.Difficulty: %w", err)
+	}
+
+	var value string
+	switch purpose {
+	case PoWPurposeRegister:
+		value = cfg.PoWRegister
+	case PoWPurposeSubmit:
+		value = cfg.PoWSubmit
+	default:
+		return 0, NewValidationError(FieldError{Field: "purpose", Reason: "invalid"})
+	}
+
+	difficulty, err := parsePoWDifficulty(value)
+	if err != nil {
+		return 0, fmt.Errorf("pow.Difficulty parse: %w", err)
+	}
+
+	return difficulty, nil
+}
+
+func (s *PoWService) Issue(ctx context.Context, purpose string) (PoWChallenge, error) {
+	purpose = normalizeTrim(purpose)
+	difficulty, err := s.Difficulty(ctx, purpose)
+	if err != nil {
+		return PoWChallenge{}, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return PoWChallenge{}, fmt.Errorf("pow.Issue nonce: %w", err)
+	}
+
+	challenge := PoWChallenge{
+		Nonce:      hex.EncodeToString(buf),
+		Purpose:    purpose,
+		Difficulty: difficulty,
+		ExpiresAt:  time.Now().UTC().Add(s.ttl),
+	}
+
+	if difficulty == 0 {
+		return challenge, nil
+	}
+
+	value := purpose + ":" + strconv.Itoa(difficulty)
+	if err := s.redis.Set(ctx, redisPoWPrefix+challenge.Nonce, value, s.ttl).Err(); err != nil {
+		return PoWChallenge{}, fmt.Errorf("pow.Issue store: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// Consumes the nonce, so every solution is single use. Passes when the purpose has no difficulty set.
+func (s *PoWService) Verify(ctx context.Context, purpose, nonce, solution string) error {
+	difficulty, err := s.Difficulty(ctx, purpose)
+	if err != nil {
+		return err
+	}
+
+	if difficulty == 0 {
+		return nil
+	}
+
+	nonce = normalizeTrim(nonce)
+	solution = normalizeTrim(solution)
+	if nonce == "" || solution == "" {
+		return ErrPoWRequired
+	}
+
+	if len(solution) > maxPoWSolution {
+		return ErrPoWInvalid
+	}
+
+	stored, err := s.redis.GetDel(ctx, redisPoWPrefix+nonce).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrPoWInvalid
+	}
+
+	if err != nil {
+		return fmt.Errorf("pow.Verify: %w", err)
+	}
+
+	storedPurpose, storedDifficulty, ok := strings.Cut(stored, ":")
+	if !ok || storedPurpose != purpose {
+		return ErrPoWInvalid
+	}
+
+	required, err := strconv.Atoi(storedDifficulty)
+	if err != nil {
+		return ErrPoWInvalid
+	}
+
+	if !PoWSolved(nonce, solution, required) {
+		return ErrPoWInvalid
+	}
+
+	return nil
+}
+
+func PoWSolved(nonce, solution string, difficulty int) bool {
+	sum := sha256.Sum256([]byte(nonce + ":" + solution))
+
+	zeros := 0
+	for _, b := range sum {
+		if b != 0 {
+			zeros += bits.LeadingZeros8(b)
+			break
+		}
+		zeros += 8
+	}
+
+	return zeros >= difficulty
+}
+
+func (c AppConfig) PoWRegisterDifficulty() int {
+	difficulty, _ := parsePoWDifficulty(c.PoWRegister)
+	return difficulty
+}
+
+func (c AppConfig) PoWSubmitDifficulty() int {
+	difficulty, _ := parsePoWDifficulty(c.PoWSubmit)
+	return difficulty
+}
+
+func parsePoWDifficulty(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	difficulty, err := strconv.Atoi(value)
+	if err != nil || difficulty < 0 || difficulty > maxPoWDifficulty {
+		return 0, fmt.Errorf("invalid pow difficulty %q", value)
+	}
+
+	return difficulty, nil
+}
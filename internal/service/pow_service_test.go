@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"smctf/internal/repo"
+)
+
+func solvePoW(t *testing.T, nonce string, difficulty int) string {
+	t.Helper()
+
+	for i := 0; i < 1<<22; i++ {
+		solution := strconv.Itoa(i)
+		if PoWSolved(nonce, solution, difficulty) {
+			return solution
+		}
+	}
+
+	t.Fatalf("no solution found for difficulty %d", difficulty)
+	return ""
+}
+
+func TestPoWSolved(t *testing.T) {
+	if !PoWSolved("nonce", "anything", 0) {
+		t.Fatalf("expected difficulty 0 to always pass")
+	}
+
+	solution := solvePoW(t, "nonce", 8)
+	if !PoWSolved("nonce", solution, 8) {
+		t.Fatalf("expected solution to pass")
+	}
+
+	if PoWSolved("nonce", solution, 256+1) {
+		t.Fatalf("expected impossible difficulty to fail")
+	}
+}
+
+func TestParsePoWDifficulty(t *testing.T) {
+	cases := map[string]bool{
+		"":    true,
+		"0":   true,
+		"20":  true,
+		"32":  true,
+		"33":  false,
+		"-1":  false,
+		"abc": false,
+	}
+
+	for value, ok := range cases {
+		if _, err := parsePoWDifficulty(value); (err == nil) != ok {
+			t.Fatalf("parsePoWDifficulty(%q) err = %v", value, err)
+		}
+	}
+}
+
+func TestPoWServiceIssueVerify(t *testing.T) {
+	env := setupServiceTest(t)
+	appConfigSvc := NewAppConfigService(repo.NewAppConfigRepo(env.db), env.redis, env.cfg.Cache.AppConfigTTL)
+	svc := NewPoWService(appConfigSvc, env.redis, time.Minute)
+	ctx := context.Background()
+
+	if err := svc.Verify(ctx, PoWPurposeRegister, "", ""); err != nil {
+		t.Fatalf("expected pass with difficulty 0, got %v", err)
+	}
+
+	difficulty := "8"
+	if _, _, _, err := appConfigSvc.Update(ctx, nil, nil, nil, nil, nil, nil, &difficulty, nil, nil, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if err := svc.Verify(ctx, PoWPurposeRegister, "", ""); !errors.Is(err, ErrPoWRequired) {
+		t.Fatalf("expected ErrPoWRequired, got %v", err)
+	}
+
+	if err := svc.Verify(ctx, PoWPurposeSubmit, "", ""); err != nil {
+		t.Fatalf("expected submit to stay open, got %v", err)
+	}
+
+	challenge, err := svc.Issue(ctx, PoWPurposeRegister)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if challenge.Difficulty != 8 || challenge.Nonce == "" {
+		t.Fatalf("unexpected challenge: %+v", challenge)
+	}
+
+	solution := solvePoW(t, challenge.Nonce, challenge.Difficulty)
+	if err := svc.Verify(ctx, PoWPurposeSubmit, challenge.Nonce, solution); !errors.Is(err, ErrPoWInvalid) {
+		t.Fatalf("expected purpose mismatch to fail, got %v", err)
+	}
+
+	challenge, err = svc.Issue(ctx, PoWPurposeRegister)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	solution = solvePoW(t, challenge.Nonce, challenge.Difficulty)
+	if err := svc.Verify(ctx, PoWPurposeRegister, challenge.Nonce, solution); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if err := svc.Verify(ctx, PoWPurposeRegister, challenge.Nonce, solution); !errors.Is(err, ErrPoWInvalid) {
+		t.Fatalf("expected reused nonce to fail, got %v", err)
+	}
+
+	if _, err := svc.Issue(ctx, "other"); err == nil {
+		t.Fatalf("expected invalid purpose error")
+	}
+}
+
+func TestAppConfigServiceUpdatePoWValidation(t *testing.T) {
+	env := setupServiceTest(t)
+	svc := NewAppConfigService(repo.NewAppConfigRepo(env.db), env.redis, env.cfg.Cache.AppConfigTTL)
+
+	bad := "40"
+	_, _, _, err := svc.Update(context.Background(), nil, nil, nil, nil, nil, nil, nil, &bad, nil, nil)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) == 0 || ve.Fields[0].Field != "pow_submit_difficulty" {
+		t.Fatalf("expected pow_submit_difficulty validation error, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"smctf/internal/country"
+	"smctf/internal/models"
+	"smctf/internal/repo"
+)
+
+const (
+	maxAffiliationLength = 100
+	maxWebsiteLength     = 200
+	maxBioLength         = 500
+)
+
+// Partial profile edit, nil fields keep their current value and "" clears one
+type ProfileUpdate struct {
+	Affiliation *string
+	Country     *string
+	Website     *string
+	Bio         *string
+}
+
+func userProfile(user *models.User) models.Profile {
+	return models.Profile{Affiliation: user.Affiliation, Country: user.Country, Website: user.Website, Bio: user.Bio}
+}
+
+func teamProfile(team *models.Team) models.Profile {
+	return models.Profile{Affiliation: team.Affiliation, Country: team.Country, Website: team.Website, Bio: team.Bio}
+}
+
+// Country must be an ISO 3166-1 alpha-2 code and website an absolute http(s) URL
+func (u ProfileUpdate) apply(current models.Profile) (models.Profile, error) {
+	next := current
+	if u.Affiliation != nil {
+		next.Affiliation = normalizeTrim(*u.Affiliation)
+	}
+
+	if u.Country != nil {
+		next.Country = country.Normalize(*u.Country)
+	}
+
+	if u.Website != nil {
+		next.Website = normalizeTrim(*u.Website)
+	}
+
+	if u.Bio != nil {
+		next.Bio = normalizeTrim(*u.Bio)
+	}
+
+	validator := newFieldValidator()
+	validator.MaxLength("affiliation", next.Affiliation, maxAffiliationLength)
+	validator.MaxLength("website", next.Website, maxWebsiteLength)
+	validator.MaxLength("bio", next.Bio, maxBioLength)
+
+	if next.Country != "" && !country.Valid(next.Country) {
+		validator.fields = append(validator.fields, FieldError{Field: "country", Reason: "invalid"})
+	}
+
+	if next.Website != "" && !validWebsite(next.Website) {
+		validator.fields = append(validator.fields, FieldError{Field: "website", Reason: "invalid format"})
+	}
+
+	if err := validator.Error(); err != nil {
+		return models.Profile{}, err
+	}
+
+	return next, nil
+}
+
+func validWebsite(value string) bool {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func (s *AuthService) UpdateProfile(ctx context.Context, userID int64, update ProfileUpdate) (*models.User, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("user_id", userID)
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("auth.UpdateProfile lookup: %w", err)
+	}
+
+	profile, err := update.apply(userProfile(user))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, userID, profile); err != nil {
+		return nil, fmt.Errorf("auth.UpdateProfile: %w", err)
+	}
+
+	user.Affiliation, user.Country, user.Website, user.Bio = profile.Affiliation, profile.Country, profile.Website, profile.Bio
+	return user, nil
+}
+
+// Only the team's captain may edit the team profile
+func (s *TeamService) UpdateTeamProfile(ctx context.Context, userID, teamID int64, update ProfileUpdate) (*models.TeamSummary, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("user_id", userID)
+	validator.PositiveID("team_id", teamID)
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	team, err := s.teamRepo.GetByID(ctx, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("team.UpdateTeamProfile lookup: %w", err)
+	}
+
+	if team.CaptainID != userID {
+		return nil, ErrNotCaptain
+	}
+
+	profile, err := update.apply(teamProfile(team))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.teamRepo.UpdateProfile(ctx, teamID, profile); err != nil {
+		return nil, fmt.Errorf("team.UpdateTeamProfile: %w", err)
+	}
+
+	return s.GetTeam(ctx, teamID)
+}
+
+// The captain must already be a member of the team. userID 0 removes the captain.
+func (s *TeamService) SetCaptain(ctx context.Context, teamID, userID int64) (*models.TeamSummary, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("id", teamID)
+	if userID < 0 {
+		validator.fields = append(validator.fields, FieldError{Field: "user_id", Reason: "invalid"})
+	}
+
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureTeamExists(ctx, teamID, "team.SetCaptain"); err != nil {
+		return nil, err
+	}
+
+	if userID != 0 {
+		members, err := s.teamRepo.ListMembers(ctx, teamID)
+		if err != nil {
+			return nil, fmt.Errorf("team.SetCaptain members: %w", err)
+		}
+
+		if !hasMember(members, userID) {
+			return nil, NewValidationError(FieldError{Field: "user_id", Reason: "not a team member"})
+		}
+	}
+
+	if err := s.teamRepo.UpdateCaptain(ctx, teamID, userID); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, repo.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("team.SetCaptain: %w", err)
+	}
+
+	return s.GetTeam(ctx, teamID)
+}
+
+func hasMember(members []models.TeamMember, userID int64) bool {
+	for _, member := range members {
+		if member.ID == userID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"smctf/internal/models"
+)
+
+func TestProfileUpdateApply(t *testing.T) {
+	current := models.Profile{Affiliation: "KAIST", Country: "KR", Website: "https://old.example", Bio: "old"}
+
+	next, err := ProfileUpdate{Country: ptrString(" us "), Bio: ptrString("")}.apply(current)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	if next.Country != "US" || next.Bio != "" || next.Affiliation != "KAIST" || next.Website != "https://old.example" {
+		t.Fatalf("unexpected profile: %+v", next)
+	}
+
+	_, err = ProfileUpdate{
+		Affiliation: ptrString(strings.Repeat("a", maxAffiliationLength+1)),
+		Country:     ptrString("XX"),
+		Website:     ptrString("javascript:alert(1)"),
+		Bio:         ptrString(strings.Repeat("b", maxBioLength+1)),
+	}.apply(current)
+
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 4 {
+		t.Fatalf("expected 4 field errors, got %v", err)
+	}
+
+	for _, website := range []string{"ftp://example.com", "example.com", "https://"} {
+		if _, err := (ProfileUpdate{Website: ptrString(website)}).apply(current); err == nil {
+			t.Fatalf("expected %q to be rejected", website)
+		}
+	}
+}
+
+func TestAuthServiceUpdateProfile(t *testing.T) {
+	env := setupServiceTest(t)
+	user := createUser(t, env, "u1@example.com", "u1", "pass", "user")
+
+	updated, err := env.authSvc.UpdateProfile(context.Background(), user.ID, ProfileUpdate{Country: ptrString("kr"), Affiliation: ptrString(" KAIST ")})
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+
+	if updated.Country != "KR" || updated.Affiliation != "KAIST" {
+		t.Fatalf("unexpected user: %+v", updated)
+	}
+
+	stored, err := env.userRepo.GetByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if stored.Country != "KR" || stored.Affiliation != "KAIST" {
+		t.Fatalf("profile not stored: %+v", stored)
+	}
+
+	_, err = env.authSvc.UpdateProfile(context.Background(), user.ID, ProfileUpdate{Country: ptrString("ZZ")})
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "country" {
+		t.Fatalf("expected country error, got %v", err)
+	}
+}
+
+func TestTeamServiceUpdateTeamProfileAndCaptain(t *testing.T) {
+	env := setupServiceTest(t)
+	team := createTeam(t, env, "Alpha")
+	captain := createUserWithTeam(t, env, "c@example.com", "captain", "pass", "user", team.ID)
+	member := createUserWithTeam(t, env, "m@example.com", "member", "pass", "user", team.ID)
+	outsider := createUser(t, env, "o@example.com", "outsider", "pass", "user")
+
+	update := ProfileUpdate{Country: ptrString("DE"), Website: ptrString("https://alpha.example")}
+	if _, err := env.teamSvc.UpdateTeamProfile(context.Background(), member.ID, team.ID, update); !errors.Is(err, ErrNotCaptain) {
+		t.Fatalf("expected ErrNotCaptain without captain, got %v", err)
+	}
+
+	_, err := env.teamSvc.SetCaptain(context.Background(), team.ID, outsider.ID)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "user_id" {
+		t.Fatalf("expected non-member error, got %v", err)
+	}
+
+	summary, err := env.teamSvc.SetCaptain(context.Background(), team.ID, captain.ID)
+	if err != nil {
+		t.Fatalf("SetCaptain: %v", err)
+	}
+
+	if summary.CaptainID != captain.ID {
+		t.Fatalf("unexpected captain: %+v", summary)
+	}
+
+	if _, err := env.teamSvc.UpdateTeamProfile(context.Background(), member.ID, team.ID, update); !errors.Is(err, ErrNotCaptain) {
+		t.Fatalf("expected ErrNotCaptain for member, got %v", err)
+	}
+
+	summary, err = env.teamSvc.UpdateTeamProfile(context.Background(), captain.ID, team.ID, update)
+	if err != nil {
+		t.Fatalf("UpdateTeamProfile: %v", err)
+	}
+
+	if summary.Country != "DE" || summary.Website != "https://alpha.example" {
+		t.Fatalf("unexpected team: %+v", summary)
+	}
+
+	summary, err = env.teamSvc.SetCaptain(context.Background(), team.ID, 0)
+	if err != nil || summary.CaptainID != 0 {
+		t.Fatalf("expected captain cleared, got %+v %v", summary, err)
+	}
+}
@@ -2,7 +2,8 @@ package service
 
 import (
 	"context"
-	"errors"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"strconv"
@@ -11,84 +12,262 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-func (s *CTFService) rateLimit(ctx context.Context, userID int64) error {
+const (
+	RateLimitScopeUser      = "user"
+	RateLimitScopeTeam      = "team"
+	RateLimitScopeIP        = "ip"
+	RateLimitScopeChallenge = "challenge"
+	RateLimitScopeGlobal    = "global"
+	RateLimitScopeAccount   = "account"
+
+	redisRateLimitPrefix = "ratelimit:"
+	rateLimitSubmit      = "submit"
+	rateLimitStackCreate = "stack_create"
+)
+
+func (s *CTFService) rateLimit(ctx context.Context, userID, challengeID int64) error {
 	if userID <= 0 {
 		return NewValidationError(FieldError{Field: "user_id", Reason: "invalid"})
 	}
 
-	key := rateLimitKey(userID)
-	if err := rateLimit(ctx, s.redis, key, s.cfg.Security.SubmissionWindow, s.cfg.Security.SubmissionMax); err != nil {
+	security := s.cfg.Security
+	subject := RateLimitSubject{UserID: userID, ChallengeID: challengeID, IP: rateLimitIP(ctx)}
+	if security.SubmissionTeamMax > 0 {
+		teamID, err := s.submissionRepo.UserTeamID(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("ctf.rateLimit team: %w", err)
+		}
+		subject.TeamID = teamID
+	}
+
+	policies := []RateLimitPolicy{
+		{Scope: RateLimitScopeUser, Limit: security.SubmissionMax, Window: security.SubmissionWindow},
+		{Scope: RateLimitScopeTeam, Limit: security.SubmissionTeamMax, Window: security.SubmissionWindow},
+		{Scope: RateLimitScopeIP, Limit: security.SubmissionIPMax, Window: security.SubmissionWindow},
+		{Scope: RateLimitScopeChallenge, Limit: security.SubmissionChallengeMax, Window: security.SubmissionWindow},
+		{Scope: RateLimitScopeGlobal, Limit: security.SubmissionGlobalMax, Window: security.SubmissionWindow},
+	}
+
+	if _, err := s.limiter.Allow(ctx, rateLimitSubmit, subject, policies...); err != nil {
 		return fmt.Errorf("ctf.rateLimit: %w", err)
 	}
 
 	return nil
 }
 
-func rateLimitKey(userID int64) string {
-	return redisSubmitPrefix + strconv.FormatInt(userID, 10)
+type RateLimitPolicy struct {
+	Scope  string
+	Limit  int
+	Window time.Duration
 }
 
-func rateLimit(ctx context.Context, redisClient *redis.Client, key string, window time.Duration, max int) error {
-	count, ttl, err := rateLimitState(ctx, redisClient, key)
-	if err != nil {
-		return err
+// Identifies who is being limited. Policies whose scope has no value here are skipped.
+type RateLimitSubject struct {
+	UserID      int64
+	TeamID      int64
+	ChallengeID int64
+	IP          string
+	Account     string
+}
+
+// Sliding window log per key: a sorted set of request timestamps. All policies of one call are checked
+// and recorded in a single script, so a request either counts against every policy or none.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local member = ARGV[2]
+local allowed = 1
+local result = {}
+
+for i, key in ipairs(KEYS) do
+	local limit = tonumber(ARGV[1 + i * 2])
+	local window = tonumber(ARGV[2 + i * 2])
+
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+	local count = redis.call('ZCARD', key)
+	local reset = window
+	if count > 0 then
+		local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+		reset = tonumber(oldest[2]) + window - now
+	end
+
+	if count >= limit then
+		allowed = 0
+	end
+
+	result[#result + 1] = count
+	result[#result + 1] = reset
+end
+
+if allowed == 1 then
+	for i, key in ipairs(KEYS) do
+		redis.call('ZADD', key, now, member)
+		redis.call('PEXPIRE', key, tonumber(ARGV[2 + i * 2]))
+	end
+end
+
+table.insert(result, 1, allowed)
+return result
+`)
+
+type RateLimiter struct {
+	redis *redis.Client
+	now   func() time.Time
+}
+
+func NewRateLimiter(redis *redis.Client) *RateLimiter {
+	return &RateLimiter{redis: redis, now: time.Now}
+}
+
+// Returns the state of the tightest policy. A denied request gets a *RateLimitError and is not counted.
+func (l *RateLimiter) Allow(ctx context.Context, name string, subject RateLimitSubject, policies ...RateLimitPolicy) (RateLimitInfo, error) {
+	active := make([]RateLimitPolicy, 0, len(policies))
+	keys := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		key, ok := rateLimitKey(name, policy.Scope, subject)
+		if !ok || policy.Limit <= 0 || policy.Window <= 0 {
+			continue
+		}
+
+		active = append(active, policy)
+		keys = append(keys, key)
+	}
+
+	if len(active) == 0 {
+		return RateLimitInfo{}, nil
+	}
+
+	member := make([]byte, 8)
+	if _, err := rand.Read(member); err != nil {
+		return RateLimitInfo{}, fmt.Errorf("rateLimiter.Allow member: %w", err)
+	}
+
+	args := []any{l.now().UnixMilli(), hex.EncodeToString(member)}
+	for _, policy := range active {
+		args = append(args, policy.Limit, policy.Window.Milliseconds())
 	}
 
-	ttl, err = ensureRateLimitTTL(ctx, redisClient, key, ttl, window)
+	values, err := slidingWindowScript.Run(ctx, l.redis, keys, args...).Int64Slice()
 	if err != nil {
-		return err
+		return RateLimitInfo{}, fmt.Errorf("rateLimiter.Allow: %w", err)
 	}
 
-	return evaluateRateLimit(count, ttl, max, window)
-}
+	if len(values) != 1+2*len(active) {
+		return RateLimitInfo{}, fmt.Errorf("rateLimiter.Allow: unexpected script result length %d", len(values))
+	}
+
+	allowed := values[0] == 1
+	var info RateLimitInfo
+	for i, policy := range active {
+		count := values[1+2*i]
+		if allowed {
+			count++
+		}
 
-func rateLimitState(ctx context.Context, redisClient *redis.Client, key string) (int64, time.Duration, error) {
-	pipe := redisClient.TxPipeline()
-	cntCmd := pipe.Incr(ctx, key)
-	ttlCmd := pipe.TTL(ctx, key)
+		candidate := RateLimitInfo{
+			Limit:        policy.Limit,
+			Remaining:    max(policy.Limit-int(count), 0),
+			ResetSeconds: max(int(math.Ceil(float64(values[2+2*i])/1000)), 1),
+			Policy:       policy.Scope,
+		}
 
-	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
-		return 0, 0, err
+		if i == 0 || tighterRateLimit(candidate, info) {
+			info = candidate
+		}
 	}
 
-	if err := cntCmd.Err(); err != nil {
-		return 0, 0, err
+	recordRateLimit(ctx, info)
+
+	if !allowed {
+		return info, &RateLimitError{Info: info}
 	}
 
-	if err := ttlCmd.Err(); err != nil {
-		return 0, 0, err
+	return info, nil
+}
+
+func tighterRateLimit(a, b RateLimitInfo) bool {
+	if a.Remaining != b.Remaining {
+		return a.Remaining < b.Remaining
 	}
 
-	return cntCmd.Val(), ttlCmd.Val(), nil
+	return a.ResetSeconds > b.ResetSeconds
 }
 
-func ensureRateLimitTTL(ctx context.Context, redisClient *redis.Client, key string, ttl time.Duration, window time.Duration) (time.Duration, error) {
-	if ttl > 0 {
-		return ttl, nil
+func rateLimitKey(name, scope string, subject RateLimitSubject) (string, bool) {
+	prefix := redisRateLimitPrefix + name + ":" + scope
+
+	switch scope {
+	case RateLimitScopeUser:
+		if subject.UserID <= 0 {
+			return "", false
+		}
+		return prefix + ":" + strconv.FormatInt(subject.UserID, 10), true
+	case RateLimitScopeTeam:
+		if subject.TeamID <= 0 {
+			return "", false
+		}
+		return prefix + ":" + strconv.FormatInt(subject.TeamID, 10), true
+	case RateLimitScopeIP:
+		if subject.IP == "" {
+			return "", false
+		}
+		return prefix + ":" + subject.IP, true
+	case RateLimitScopeChallenge:
+		if subject.ChallengeID <= 0 || subject.UserID <= 0 {
+			return "", false
+		}
+		return prefix + ":" + strconv.FormatInt(subject.ChallengeID, 10) + ":" + strconv.FormatInt(subject.UserID, 10), true
+	case RateLimitScopeGlobal:
+		return prefix, true
+	case RateLimitScopeAccount:
+		if subject.Account == "" {
+			return "", false
+		}
+		return prefix + ":" + subject.Account, true
+	default:
+		return "", false
 	}
+}
+
+type rateLimitContextKey struct{}
+
+type rateLimitRequest struct {
+	ip   string
+	info *RateLimitInfo
+}
+
+// Attaches the client IP for IP policies and a slot that receives the outcome of the last limit checked during the request
+func WithRateLimitRequest(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, rateLimitContextKey{}, &rateLimitRequest{ip: ip})
+}
 
-	if err := redisClient.Expire(ctx, key, window).Err(); err != nil {
-		return 0, err
+func RateLimitResult(ctx context.Context) (RateLimitInfo, bool) {
+	req, ok := ctx.Value(rateLimitContextKey{}).(*rateLimitRequest)
+	if !ok || req.info == nil {
+		return RateLimitInfo{}, false
 	}
 
-	return window, nil
+	return *req.info, true
 }
 
-func evaluateRateLimit(count int64, ttl time.Duration, maxAllowed int, window time.Duration) error {
-	remaining := max(maxAllowed-int(count), 0)
+func rateLimitIP(ctx context.Context) string {
+	if req, ok := ctx.Value(rateLimitContextKey{}).(*rateLimitRequest); ok {
+		return req.ip
+	}
 
-	if count > int64(maxAllowed) {
-		resetSeconds := int(math.Ceil(ttl.Seconds()))
-		if resetSeconds <= 0 {
-			resetSeconds = int(window.Seconds())
-		}
+	return ""
+}
 
-		return &RateLimitError{Info: RateLimitInfo{
-			Limit:        maxAllowed,
-			Remaining:    remaining,
-			ResetSeconds: resetSeconds,
-		}}
+// Keeps the client IP but gives limit checks a slot of their own, so their outcome is not reported on the response
+func withoutRateLimitResult(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(rateLimitContextKey{}).(*rateLimitRequest); !ok {
+		return ctx
 	}
 
-	return nil
+	return WithRateLimitRequest(ctx, rateLimitIP(ctx))
+}
+
+func recordRateLimit(ctx context.Context, info RateLimitInfo) {
+	if req, ok := ctx.Value(rateLimitContextKey{}).(*rateLimitRequest); ok {
+		req.info = &info
+	}
 }
@@ -34,108 +34,102 @@ func newRateLimitService(t *testing.T, window time.Duration, max int) *CTFServic
 		},
 	}
 
-	return &CTFService{cfg: cfg, redis: client}
+	return &CTFService{cfg: cfg, redis: client, limiter: NewRateLimiter(client)}
 }
 
 func TestRateLimitKey(t *testing.T) {
-	if got := rateLimitKey(42); got != "submit:42" {
-		t.Fatalf("unexpected key: %s", got)
+	subject := RateLimitSubject{UserID: 42, TeamID: 7, ChallengeID: 3, IP: "10.0.0.1"}
+	cases := map[string]string{
+		RateLimitScopeUser:      "ratelimit:submit:user:42",
+		RateLimitScopeTeam:      "ratelimit:submit:team:7",
+		RateLimitScopeIP:        "ratelimit:submit:ip:10.0.0.1",
+		RateLimitScopeChallenge: "ratelimit:submit:challenge:3:42",
+		RateLimitScopeGlobal:    "ratelimit:submit:global",
 	}
-}
-
-func TestRateLimitStateIncrements(t *testing.T) {
-	svc := newRateLimitService(t, 10*time.Second, 2)
-	ctx := context.Background()
-	key := rateLimitKey(11)
 
-	count, ttl, err := rateLimitState(ctx, svc.redis, key)
-	if err != nil {
-		t.Fatalf("rateLimitState: %v", err)
+	for scope, want := range cases {
+		if got, ok := rateLimitKey(rateLimitSubmit, scope, subject); !ok || got != want {
+			t.Fatalf("rateLimitKey(%s) = %q, want %q", scope, got, want)
+		}
 	}
 
-	if count != 1 {
-		t.Fatalf("expected count 1, got %d", count)
+	if _, ok := rateLimitKey(rateLimitSubmit, RateLimitScopeTeam, RateLimitSubject{UserID: 1}); ok {
+		t.Fatalf("expected team scope to be skipped without team")
 	}
 
-	if ttl > 0 {
-		t.Fatalf("expected no ttl yet, got %v", ttl)
-	}
-
-	count, ttl, err = rateLimitState(ctx, svc.redis, key)
-	if err != nil {
-		t.Fatalf("rateLimitState second: %v", err)
-	}
-
-	if count != 2 {
-		t.Fatalf("expected count 2, got %d", count)
-	}
-
-	if ttl > 0 {
-		t.Fatalf("expected no ttl yet, got %v", ttl)
+	if _, ok := rateLimitKey(rateLimitSubmit, "bogus", subject); ok {
+		t.Fatalf("expected unknown scope to be skipped")
 	}
 }
 
-func TestEnsureRateLimitTTLWhenMissing(t *testing.T) {
-	svc := newRateLimitService(t, 45*time.Second, 5)
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	svc := newRateLimitService(t, 10*time.Second, 2)
 	ctx := context.Background()
-	key := rateLimitKey(22)
 
-	if err := svc.redis.Set(ctx, key, "1", 0).Err(); err != nil {
-		t.Fatalf("set key: %v", err)
-	}
-
-	initialTTL := svc.redis.TTL(ctx, key).Val()
-	if initialTTL > 0 {
-		t.Fatalf("expected missing ttl, got %v", initialTTL)
-	}
+	now := time.Unix(1_700_000_000, 0)
+	svc.limiter.now = func() time.Time { return now }
 
-	gotTTL, err := ensureRateLimitTTL(ctx, svc.redis, key, initialTTL, svc.cfg.Security.SubmissionWindow)
-	if err != nil {
-		t.Fatalf("ensureRateLimitTTL: %v", err)
-	}
+	policy := RateLimitPolicy{Scope: RateLimitScopeUser, Limit: 2, Window: 10 * time.Second}
+	subject := RateLimitSubject{UserID: 1}
 
-	if gotTTL != svc.cfg.Security.SubmissionWindow {
-		t.Fatalf("expected window %v, got %v", svc.cfg.Security.SubmissionWindow, gotTTL)
+	info, err := svc.limiter.Allow(ctx, "test", subject, policy)
+	if err != nil || info.Remaining != 1 || info.Limit != 2 {
+		t.Fatalf("first Allow: info %+v err %v", info, err)
 	}
 
-	storedTTL := svc.redis.TTL(ctx, key).Val()
-	if storedTTL <= 0 || storedTTL > svc.cfg.Security.SubmissionWindow {
-		t.Fatalf("unexpected stored ttl: %v", storedTTL)
+	now = now.Add(6 * time.Second)
+	if info, err = svc.limiter.Allow(ctx, "test", subject, policy); err != nil || info.Remaining != 0 {
+		t.Fatalf("second Allow: info %+v err %v", info, err)
 	}
-}
-
-func TestEvaluateRateLimit(t *testing.T) {
-	svc := newRateLimitService(t, 10*time.Second, 2)
 
-	if err := evaluateRateLimit(2, 3*time.Second, svc.cfg.Security.SubmissionMax, svc.cfg.Security.SubmissionWindow); err != nil {
-		t.Fatalf("expected no error, got %v", err)
+	// A fixed window would allow two fresh requests here; the request at 6s still counts
+	now = now.Add(5 * time.Second)
+	if info, err = svc.limiter.Allow(ctx, "test", subject, policy); err != nil || info.Remaining != 0 {
+		t.Fatalf("third Allow: info %+v err %v", info, err)
 	}
 
-	err := evaluateRateLimit(3, 1500*time.Millisecond, svc.cfg.Security.SubmissionMax, svc.cfg.Security.SubmissionWindow)
+	_, err = svc.limiter.Allow(ctx, "test", subject, policy)
 	var rlErr *RateLimitError
 	if !errors.As(err, &rlErr) {
 		t.Fatalf("expected rate limit error, got %v", err)
 	}
 
-	if rlErr.Info.Limit != 2 {
-		t.Fatalf("expected limit 2, got %d", rlErr.Info.Limit)
+	if rlErr.Info.ResetSeconds != 5 || rlErr.Info.Policy != RateLimitScopeUser {
+		t.Fatalf("unexpected rate limit info: %+v", rlErr.Info)
 	}
+}
 
-	if rlErr.Info.Remaining != 0 {
-		t.Fatalf("expected remaining 0, got %d", rlErr.Info.Remaining)
+func TestRateLimiterTightestPolicy(t *testing.T) {
+	svc := newRateLimitService(t, 10*time.Second, 2)
+	ctx := WithRateLimitRequest(context.Background(), "10.0.0.1")
+
+	policies := []RateLimitPolicy{
+		{Scope: RateLimitScopeUser, Limit: 5, Window: time.Minute},
+		{Scope: RateLimitScopeIP, Limit: 2, Window: time.Minute},
+		{Scope: RateLimitScopeTeam, Limit: 1, Window: time.Minute},
 	}
 
-	if rlErr.Info.ResetSeconds != 2 {
-		t.Fatalf("expected reset 2, got %d", rlErr.Info.ResetSeconds)
+	for userID := int64(1); userID <= 2; userID++ {
+		subject := RateLimitSubject{UserID: userID, IP: rateLimitIP(ctx)}
+		if _, err := svc.limiter.Allow(ctx, "test", subject, policies...); err != nil {
+			t.Fatalf("Allow user %d: %v", userID, err)
+		}
 	}
 
-	err = evaluateRateLimit(3, 0, svc.cfg.Security.SubmissionMax, svc.cfg.Security.SubmissionWindow)
-	if !errors.As(err, &rlErr) {
-		t.Fatalf("expected rate limit error, got %v", err)
+	info, ok := RateLimitResult(ctx)
+	if !ok || info.Policy != RateLimitScopeIP || info.Remaining != 0 {
+		t.Fatalf("unexpected recorded info: %+v", info)
+	}
+
+	_, err := svc.limiter.Allow(ctx, "test", RateLimitSubject{UserID: 3, IP: "10.0.0.1"}, policies...)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ip limit, got %v", err)
 	}
 
-	if rlErr.Info.ResetSeconds != int(svc.cfg.Security.SubmissionWindow.Seconds()) {
-		t.Fatalf("expected reset %d, got %d", int(svc.cfg.Security.SubmissionWindow.Seconds()), rlErr.Info.ResetSeconds)
+	// Denied requests are not counted against the other policies
+	count, err := svc.redis.ZCard(ctx, "ratelimit:test:user:3").Result()
+	if err != nil || count != 0 {
+		t.Fatalf("expected user key untouched, got %d (%v)", count, err)
 	}
 }
 
@@ -143,7 +137,7 @@ func TestRateLimitInvalidUser(t *testing.T) {
 	svc := newRateLimitService(t, 10*time.Second, 2)
 	ctx := context.Background()
 
-	err := svc.rateLimit(ctx, 0)
+	err := svc.rateLimit(ctx, 0, 1)
 	var ve *ValidationError
 	if !errors.As(err, &ve) {
 		t.Fatalf("expected validation error, got %v", err)
@@ -162,15 +156,15 @@ func TestRateLimitEnforcesLimit(t *testing.T) {
 	svc := newRateLimitService(t, 12*time.Second, 2)
 	ctx := context.Background()
 
-	if err := svc.rateLimit(ctx, 101); err != nil {
+	if err := svc.rateLimit(ctx, 101, 1); err != nil {
 		t.Fatalf("first rateLimit: %v", err)
 	}
 
-	if err := svc.rateLimit(ctx, 101); err != nil {
+	if err := svc.rateLimit(ctx, 101, 2); err != nil {
 		t.Fatalf("second rateLimit: %v", err)
 	}
 
-	err := svc.rateLimit(ctx, 101)
+	err := svc.rateLimit(ctx, 101, 3)
 	var rlErr *RateLimitError
 	if !errors.As(err, &rlErr) {
 		t.Fatalf("expected rate limit error, got %v", err)
@@ -188,3 +182,21 @@ func TestRateLimitEnforcesLimit(t *testing.T) {
 		t.Fatalf("unexpected reset seconds: %d", rlErr.Info.ResetSeconds)
 	}
 }
+
+func TestRateLimitPerChallenge(t *testing.T) {
+	svc := newRateLimitService(t, time.Minute, 10)
+	svc.cfg.Security.SubmissionChallengeMax = 1
+	ctx := context.Background()
+
+	if err := svc.rateLimit(ctx, 5, 1); err != nil {
+		t.Fatalf("first challenge: %v", err)
+	}
+
+	if err := svc.rateLimit(ctx, 5, 2); err != nil {
+		t.Fatalf("other challenge: %v", err)
+	}
+
+	if err := svc.rateLimit(ctx, 5, 1); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected per-challenge limit, got %v", err)
+	}
+}
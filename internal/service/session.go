@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"smctf/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisSessionPrefix      = "session:"
+	redisUserSessionsPrefix = "user_sessions:"
+	maxSessionDeviceLength  = 256
+)
+
+func sessionKey(id string) string {
+	return redisSessionPrefix + id
+}
+
+func userSessionsKey(userID int64) string {
+	return redisUserSessionsPrefix + strconv.FormatInt(userID, 10)
+}
+
+func newSession(userID int64, device, ip string) *models.Session {
+	now := time.Now().UTC()
+
+	return &models.Session{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		Device:     trimTo(normalizeTrim(device), maxSessionDeviceLength),
+		IP:         normalizeTrim(ip),
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+}
+
+func (s *AuthService) ListSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	ids, err := s.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("auth.ListSessions members: %w", err)
+	}
+
+	sessions := make([]models.Session, 0, len(ids))
+	stale := make([]any, 0)
+
+	for _, id := range ids {
+		session, err := s.loadSession(ctx, id)
+		if errors.Is(err, ErrSessionNotFound) {
+			stale = append(stale, id)
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("auth.ListSessions: %w", err)
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	if len(stale) > 0 {
+		_ = s.redis.SRem(ctx, userSessionsKey(userID), stale...).Err()
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+func (s *AuthService) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	sessionID = normalizeTrim(sessionID)
+	validator := newFieldValidator()
+	validator.Required("id", sessionID)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	session, err := s.loadSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	if err := s.deleteSession(ctx, session); err != nil {
+		return fmt.Errorf("auth.RevokeSession: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AuthService) RevokeAllSessions(ctx context.Context, userID int64, exceptSessionID string) (int, error) {
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for i := range sessions {
+		if sessions[i].ID == exceptSessionID {
+			continue
+		}
+
+		if err := s.deleteSession(ctx, &sessions[i]); err != nil {
+			return revoked, fmt.Errorf("auth.RevokeAllSessions: %w", err)
+		}
+
+		revoked++
+	}
+
+	return revoked, nil
+}
+
+func (s *AuthService) loadSession(ctx context.Context, id string) (*models.Session, error) {
+	val, err := s.redis.Get(ctx, sessionKey(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("auth.loadSession: %w", err)
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(val), &session); err != nil {
+		_ = s.redis.Del(ctx, sessionKey(id)).Err()
+		return nil, ErrSessionNotFound
+	}
+
+	return &session, nil
+}
+
+func (s *AuthService) storeSession(ctx context.Context, session *models.Session) error {
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("auth.storeSession marshal: %w", err)
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, sessionKey(session.ID), payload, s.cfg.JWT.RefreshTTL)
+	pipe.SAdd(ctx, userSessionsKey(session.UserID), session.ID)
+	pipe.Expire(ctx, userSessionsKey(session.UserID), s.cfg.JWT.RefreshTTL)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("auth.storeSession: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AuthService) deleteSession(ctx context.Context, session *models.Session) error {
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, sessionKey(session.ID))
+	if session.RefreshJTI != "" {
+		pipe.Del(ctx, refreshKey(session.RefreshJTI))
+	}
+	pipe.SRem(ctx, userSessionsKey(session.UserID), session.ID)
+	pipe.Set(ctx, revokedSessionKey(session.ID), 1, s.cfg.JWT.AccessTTL)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("auth.deleteSession: %w", err)
+	}
+
+	s.revocations.clear()
+
+	return nil
+}
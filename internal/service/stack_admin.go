@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"smctf/internal/models"
+	"smctf/internal/repo"
+)
+
+const (
+	defaultAdminStackLimit = 100
+	maxAdminStackLimit     = 500
+)
+
+// Rows come from the database, the reaper keeps their status close to the provisioner
+func (s *StackService) AdminListStacks(ctx context.Context, filter models.StackFilter) ([]models.StackSummary, int, error) {
+	if err := s.ensureEnabled(); err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultAdminStackLimit
+	}
+
+	validator := newFieldValidator()
+	validator.PositiveID("limit", int64(filter.Limit))
+	if filter.Limit > maxAdminStackLimit {
+		validator.fields = append(validator.fields, FieldError{Field: "limit", Reason: "too large"})
+	}
+
+	validator.NonNegative("offset", filter.Offset)
+	if err := validateStackFilter(validator, &filter); err != nil {
+		return nil, 0, err
+	}
+
+	rows, total, err := s.stackRepo.ListSummaries(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("stack.AdminListStacks: %w", err)
+	}
+
+	return rows, total, nil
+}
+
+func (s *StackService) AdminStackCounts(ctx context.Context) ([]models.StackCount, error) {
+	if err := s.ensureEnabled(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.stackRepo.CountByChallengeAndStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("stack.AdminStackCounts: %w", err)
+	}
+
+	return rows, nil
+}
+
+// Removes the instance from the provisioner and the row, whoever owns it. Keyed on the row id so rows
+// that never got a stack_id, e.g. waiting or failed ones, can be removed too.
+func (s *StackService) AdminDeleteStack(ctx context.Context, id int64) error {
+	if err := s.ensureEnabled(); err != nil {
+		return err
+	}
+
+	validator := newFieldValidator()
+	validator.PositiveID("id", id)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	existing, err := s.stackRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return ErrStackNotFound
+		}
+
+		return fmt.Errorf("stack.AdminDeleteStack lookup: %w", err)
+	}
+
+	if err := s.reapStack(ctx, existing); err != nil {
+		return err
+	}
+
+	s.releaseCapacity(ctx)
+
+	return nil
+}
+
+// Needs at least one filter so a typo cannot wipe every stack. Stacks whose provisioner delete failed keep their row.
+func (s *StackService) AdminDeleteStacks(ctx context.Context, filter models.StackFilter) (int, int, error) {
+	if err := s.ensureEnabled(); err != nil {
+		return 0, 0, err
+	}
+
+	validator := newFieldValidator()
+	if filter.Empty() {
+		validator.fields = append(validator.fields, FieldError{Field: "filter", Reason: "required"})
+	}
+
+	if err := validateStackFilter(validator, &filter); err != nil {
+		return 0, 0, err
+	}
+
+	filter.Limit, filter.Offset = 0, 0
+	rows, _, err := s.stackRepo.ListSummaries(ctx, filter)
+	if err != nil {
+		return 0, 0, fmt.Errorf("stack.AdminDeleteStacks list: %w", err)
+	}
+
+	deleted, failed := 0, 0
+	for _, row := range rows {
+		existing := &models.Stack{ID: row.ID, StackID: row.StackID}
+		if s.reapStack(ctx, existing) == nil {
+			deleted++
+		} else {
+			failed++
+		}
+	}
+
+	if deleted > 0 {
+		s.releaseCapacity(ctx)
+	}
+
+	return deleted, failed, nil
+}
+
+func validateStackFilter(validator *fieldValidator, filter *models.StackFilter) error {
+	for _, id := range []struct {
+		field string
+		value int64
+	}{
+		{field: "challenge_id", value: filter.ChallengeID},
+		{field: "user_id", value: filter.UserID},
+		{field: "team_id", value: filter.TeamID},
+	} {
+		if id.value < 0 {
+			validator.fields = append(validator.fields, FieldError{Field: id.field, Reason: "invalid"})
+		}
+	}
+
+	filter.Status = normalizeTrim(filter.Status)
+
+	return validator.Error()
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"smctf/internal/models"
+	"smctf/internal/repo"
+	"smctf/internal/stack"
+)
+
+const (
+	StackEventUpdated = "stack.updated"
+	StackEventDeleted = "stack.deleted"
+)
+
+// Change to a stack pushed to the players who can see it
+type StackEvent struct {
+	Type  string       `json:"type"`
+	Stack models.Stack `json:"stack"`
+}
+
+// Status report pushed by the provisioner. Fields left out keep their stored value.
+type stackCallback struct {
+	StackID      string     `json:"stack_id"`
+	Status       string     `json:"status"`
+	TTL          *time.Time `json:"ttl"`
+	NodePort     *int       `json:"node_port"`
+	TargetPort   *int       `json:"target_port"`
+	NodePublicIP *string    `json:"node_public_ip"`
+}
+
+// Fills the fields missing from the callback with the stored ones
+func (c *stackCallback) merge(existing *models.Stack) *stack.StackStatus {
+	status := &stack.StackStatus{StackID: c.StackID, Status: c.Status, TargetPort: existing.TargetPort}
+	if existing.TTLExpiresAt != nil {
+		status.TTL = *existing.TTLExpiresAt
+	}
+
+	if existing.NodePort != nil {
+		status.NodePort = *existing.NodePort
+	}
+
+	if existing.NodePublicIP != nil {
+		status.NodePublicIP = *existing.NodePublicIP
+	}
+
+	if c.TTL != nil {
+		status.TTL = *c.TTL
+	}
+
+	if c.NodePort != nil {
+		status.NodePort = *c.NodePort
+	}
+
+	if c.TargetPort != nil {
+		status.TargetPort = *c.TargetPort
+	}
+
+	if c.NodePublicIP != nil {
+		status.NodePublicIP = *c.NodePublicIP
+	}
+
+	return status
+}
+
+// Applies a signed status report from the provisioner to the stacks table and notifies the players of the stack
+func (s *StackService) HandleStatusCallback(ctx context.Context, timestamp, signature string, body []byte) error {
+	if err := stack.VerifyCallback(s.cfg.CallbackSecret, timestamp, signature, body, time.Now()); err != nil {
+		return ErrStackCallbackSignature
+	}
+
+	var status stackCallback
+	if err := json.Unmarshal(body, &status); err != nil {
+		return NewValidationError(FieldError{Field: "body", Reason: "invalid json"})
+	}
+
+	validator := newFieldValidator()
+	validator.Required("stack_id", status.StackID)
+	validator.Required("status", status.Status)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	existing, err := s.stackRepo.GetByStackID(ctx, status.StackID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return ErrStackNotFound
+		}
+
+		return fmt.Errorf("stack.HandleStatusCallback lookup: %w", err)
+	}
+
+	// A replayed or delayed report must not roll back a newer sync. The timestamp only has second precision.
+	sent, _ := strconv.ParseInt(timestamp, 10, 64)
+	if time.Unix(sent, 0).Before(existing.UpdatedAt.Truncate(time.Second)) {
+		return ErrStackCallbackStale
+	}
+
+	if isTerminalStackStatus(status.Status) {
+		if err := s.stackRepo.Delete(ctx, existing); err != nil {
+			return fmt.Errorf("stack.HandleStatusCallback delete: %w", err)
+		}
+
+		existing.Status = status.Status
+		s.publishStackEvent(ctx, StackEventDeleted, existing)
+		s.releaseCapacity(ctx)
+		return nil
+	}
+
+	changed := applyStackStatus(existing, status.merge(existing))
+	existing.UpdatedAt = time.Now().UTC()
+
+	if err := s.stackRepo.Update(ctx, existing); err != nil {
+		return fmt.Errorf("stack.HandleStatusCallback update: %w", err)
+	}
+
+	if changed {
+		s.publishStackEvent(ctx, StackEventUpdated, existing)
+	}
+
+	return nil
+}
+
+// Shared stacks go to their team, personal stacks to their owner
+func stackEventChannel(stackModel *models.Stack) string {
+	if stackModel.TeamID > 0 {
+		return fmt.Sprintf("stack_events:team:%d", stackModel.TeamID)
+	}
+
+	return fmt.Sprintf("stack_events:user:%d", stackModel.UserID)
+}
+
+// Delivery is best effort, players who miss an event still see the change on their next poll
+func (s *StackService) publishStackEvent(ctx context.Context, eventType string, stackModel *models.Stack) {
+	payload, err := json.Marshal(StackEvent{Type: eventType, Stack: *stackModel})
+	if err != nil {
+		log.Printf("stack event %d encode error: %v", stackModel.ID, err)
+		return
+	}
+
+	if err := s.redis.Publish(ctx, stackEventChannel(stackModel), payload).Err(); err != nil {
+		log.Printf("stack event %d publish error: %v", stackModel.ID, err)
+	}
+}
+
+// Streams events for the user's personal stacks and their team's shared stacks until ctx is done.
+// The team is resolved once, so a player who changes team has to reconnect.
+func (s *StackService) SubscribeStackEvents(ctx context.Context, userID int64) (<-chan StackEvent, error) {
+	if err := s.ensureEnabled(); err != nil {
+		return nil, err
+	}
+
+	teamID, err := s.stackRepo.TeamIDForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("stack.SubscribeStackEvents team: %w", err)
+	}
+
+	channels := []string{stackEventChannel(&models.Stack{UserID: userID})}
+	if teamID > 0 {
+		channels = append(channels, stackEventChannel(&models.Stack{TeamID: teamID}))
+	}
+
+	sub := s.redis.Subscribe(ctx, channels...)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, fmt.Errorf("stack.SubscribeStackEvents subscribe: %w", err)
+	}
+
+	events := make(chan StackEvent)
+	go func() {
+		defer close(events)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var event StackEvent
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+					continue
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
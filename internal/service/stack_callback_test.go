@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smctf/internal/config"
+	"smctf/internal/models"
+	"smctf/internal/repo"
+	"smctf/internal/stack"
+)
+
+func sendStackCallback(t *testing.T, svc *StackService, secret, body string) error {
+	t.Helper()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return svc.HandleStatusCallback(context.Background(), timestamp, stack.SignCallback(secret, timestamp, []byte(body)), []byte(body))
+}
+
+func nextStackEvent(t *testing.T, events <-chan StackEvent) StackEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for stack event")
+		return StackEvent{}
+	}
+}
+
+func TestStackServiceStatusCallback(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var statusCalls atomic.Int32
+	mock := &stack.MockClient{
+		GetStackStatusFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			statusCalls.Add(1)
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80}, nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, CreateWindow: time.Minute, CreateMax: 5, CallbackSecret: "secret", StatusMaxAge: time.Minute}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+
+	old := time.Now().UTC().Add(-time.Hour)
+	row := &models.Stack{UserID: 1, ChallengeID: challenge.ID, StackID: "stack-cb", Status: "creating", TargetPort: 80, CreatedAt: old, UpdatedAt: old}
+	if err := stackRepo.Create(context.Background(), row); err != nil {
+		t.Fatalf("create row: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := stackSvc.SubscribeStackEvents(ctx, 1)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	if err := sendStackCallback(t, stackSvc, "wrong", `{"stack_id":"stack-cb","status":"running"}`); !errors.Is(err, ErrStackCallbackSignature) {
+		t.Fatalf("expected ErrStackCallbackSignature, got %v", err)
+	}
+
+	if err := sendStackCallback(t, stackSvc, "secret", `{"stack_id":"unknown","status":"running"}`); !errors.Is(err, ErrStackNotFound) {
+		t.Fatalf("expected ErrStackNotFound, got %v", err)
+	}
+
+	if err := sendStackCallback(t, stackSvc, "secret", `{"stack_id":"stack-cb","status":"running","node_port":31000,"target_port":80,"node_public_ip":"127.0.0.1"}`); err != nil {
+		t.Fatalf("running callback: %v", err)
+	}
+
+	event := nextStackEvent(t, events)
+	if event.Type != StackEventUpdated || event.Stack.StackID != "stack-cb" || event.Stack.Status != "running" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	fresh, err := stackSvc.GetStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetStack: %v", err)
+	}
+
+	if fresh.Status != "running" || fresh.NodePort == nil || *fresh.NodePort != 31000 || statusCalls.Load() != 0 {
+		t.Fatalf("expected fresh row without polling, got %+v after %d polls", fresh, statusCalls.Load())
+	}
+
+	if err := sendStackCallback(t, stackSvc, "secret", `{"stack_id":"stack-cb","status":"stopped"}`); err != nil {
+		t.Fatalf("stopped callback: %v", err)
+	}
+
+	event = nextStackEvent(t, events)
+	if event.Type != StackEventDeleted || event.Stack.ChallengeID != challenge.ID {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+
+	if _, err := stackRepo.GetByStackID(context.Background(), "stack-cb"); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("expected row deleted, got %v", err)
+	}
+}
+
+func TestStackServiceStatusCallbackPartialAndStale(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, CreateWindow: time.Minute, CreateMax: 5, CallbackSecret: "secret"}
+	stackSvc, stackRepo := newStackService(env, &stack.MockClient{}, cfg)
+
+	old := time.Now().UTC().Add(-time.Hour)
+	ttl := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	nodePort, nodeIP := 31000, "127.0.0.1"
+	row := &models.Stack{UserID: 1, ChallengeID: challenge.ID, StackID: "stack-partial", Status: "running", NodePublicIP: &nodeIP, NodePort: &nodePort, TargetPort: 80, TTLExpiresAt: &ttl, CreatedAt: old, UpdatedAt: old}
+	if err := stackRepo.Create(context.Background(), row); err != nil {
+		t.Fatalf("create row: %v", err)
+	}
+
+	if err := sendStackCallback(t, stackSvc, "secret", `{"stack_id":"stack-partial","status":"creating"}`); err != nil {
+		t.Fatalf("partial callback: %v", err)
+	}
+
+	updated, err := stackRepo.GetByStackID(context.Background(), "stack-partial")
+	if err != nil {
+		t.Fatalf("get stack: %v", err)
+	}
+
+	if updated.Status != "creating" || updated.NodePort == nil || *updated.NodePort != nodePort ||
+		updated.NodePublicIP == nil || *updated.NodePublicIP != nodeIP ||
+		updated.TTLExpiresAt == nil || !updated.TTLExpiresAt.Equal(ttl) || updated.TargetPort != 80 {
+		t.Fatalf("expected missing fields to be kept, got %+v", updated)
+	}
+
+	// Sent before the last sync, e.g. a replay or a report overtaken by a newer one
+	body := []byte(`{"stack_id":"stack-partial","status":"running","node_port":32000}`)
+	timestamp := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	if err := stackSvc.HandleStatusCallback(context.Background(), timestamp, stack.SignCallback("secret", timestamp, body), body); !errors.Is(err, ErrStackCallbackStale) {
+		t.Fatalf("expected ErrStackCallbackStale, got %v", err)
+	}
+
+	unchanged, err := stackRepo.GetByStackID(context.Background(), "stack-partial")
+	if err != nil {
+		t.Fatalf("get stack: %v", err)
+	}
+
+	if unchanged.Status != "creating" || *unchanged.NodePort != nodePort {
+		t.Fatalf("stale callback changed the row: %+v", unchanged)
+	}
+}
+
+func TestStackServiceStatusMaxAge(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var statusCalls atomic.Int32
+	mock := &stack.MockClient{
+		GetStackStatusFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			statusCalls.Add(1)
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80}, nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, CreateWindow: time.Minute, CreateMax: 5, StatusMaxAge: time.Minute}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+
+	old := time.Now().UTC().Add(-time.Hour)
+	row := &models.Stack{UserID: 1, ChallengeID: challenge.ID, StackID: "stack-age", Status: "running", TargetPort: 80, CreatedAt: old, UpdatedAt: old}
+	if err := stackRepo.Create(context.Background(), row); err != nil {
+		t.Fatalf("create row: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := stackSvc.ListUserStacks(context.Background(), 1); err != nil {
+			t.Fatalf("ListUserStacks: %v", err)
+		}
+	}
+
+	if statusCalls.Load() != 1 {
+		t.Fatalf("expected a stale row to be polled once, got %d", statusCalls.Load())
+	}
+}
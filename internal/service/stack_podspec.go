@@ -0,0 +1,83 @@
+package service
+
+import (
+	"strings"
+
+	"smctf/internal/config"
+	"smctf/internal/stack"
+)
+
+// Checks a challenge pod spec against the configured policy before it is saved
+func validatePodSpec(cfg config.StackConfig, raw string, targetPort int) []FieldError {
+	spec, err := stack.ParsePodSpec(raw)
+	if err != nil {
+		return []FieldError{{Field: "stack_pod_spec", Reason: "invalid"}}
+	}
+
+	fields := make([]FieldError, 0)
+	add := func(field, reason string) {
+		for _, existing := range fields {
+			if existing.Field == field && existing.Reason == reason {
+				return
+			}
+		}
+
+		fields = append(fields, FieldError{Field: field, Reason: reason})
+	}
+
+	if !cfg.PodAllowHostAccess {
+		if spec.HostNetwork || spec.HostPID || spec.HostIPC {
+			add("stack_pod_spec", "host namespaces not allowed")
+		}
+
+		for _, volume := range spec.Volumes {
+			if volume.HostPath != nil {
+				add("stack_pod_spec", "hostPath volumes not allowed")
+			}
+		}
+	}
+
+	for _, container := range spec.AllContainers() {
+		if !cfg.PodAllowPrivileged && container.Privileged() {
+			add("stack_pod_spec", "privileged containers not allowed")
+		}
+
+		if !cfg.PodAllowHostAccess {
+			for _, port := range container.Ports {
+				if port.HostPort != 0 {
+					add("stack_pod_spec", "host ports not allowed")
+				}
+			}
+		}
+
+		if cfg.PodRequireLimits && !container.HasLimits() {
+			add("stack_pod_spec", "cpu and memory limits required")
+		}
+
+		if !imageAllowed(cfg.PodAllowedRegistries, container.ImageReference()) {
+			add("stack_pod_spec", "image registry not allowed")
+		}
+	}
+
+	if targetPort > 0 && !spec.ExposesPort(targetPort) {
+		add("stack_target_port", "not exposed by pod spec")
+	}
+
+	return fields
+}
+
+// An empty allowlist allows any registry. Entries match a registry host or a repository prefix below it.
+func imageAllowed(registries []string, image string) bool {
+	if len(registries) == 0 {
+		return true
+	}
+
+	for _, registry := range registries {
+		registry = strings.TrimRight(registry, "/")
+		if registry != "" && strings.HasPrefix(image, registry+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"smctf/internal/config"
+)
+
+func TestValidatePodSpec(t *testing.T) {
+	safe := "kind: Pod\nspec:\n  containers:\n    - name: app\n      image: ghcr.io/smctf/web:1\n      ports:\n        - containerPort: 80\n      resources:\n        limits:\n          cpu: 500m\n          memory: 128Mi\n"
+	unsafe := "kind: Pod\nspec:\n  hostPID: true\n  containers:\n    - name: app\n      image: nginx\n      ports:\n        - containerPort: 80\n          hostPort: 80\n      securityContext:\n        privileged: true\n  volumes:\n    - name: root\n      hostPath:\n        path: /\n"
+	strict := config.StackConfig{PodRequireLimits: true, PodAllowedRegistries: []string{"ghcr.io/smctf"}}
+
+	tests := []struct {
+		name     string
+		cfg      config.StackConfig
+		raw      string
+		port     int
+		expected string
+	}{
+		{name: "safe", cfg: strict, raw: safe, port: 80, expected: "[]"},
+		{name: "port not exposed", cfg: strict, raw: safe, port: 8080, expected: "[stack_target_port:not exposed by pod spec]"},
+		{name: "port skipped", cfg: strict, raw: safe, port: 0, expected: "[]"},
+		{name: "invalid", cfg: strict, raw: "containers: {", port: 80, expected: "[stack_pod_spec:invalid]"},
+		{
+			name:     "unsafe",
+			cfg:      strict,
+			raw:      unsafe,
+			port:     80,
+			expected: "[stack_pod_spec:host namespaces not allowed stack_pod_spec:hostPath volumes not allowed stack_pod_spec:privileged containers not allowed stack_pod_spec:host ports not allowed stack_pod_spec:cpu and memory limits required stack_pod_spec:image registry not allowed]",
+		},
+		{
+			name:     "docker hub official image",
+			cfg:      config.StackConfig{PodAllowPrivileged: true, PodAllowHostAccess: true, PodAllowedRegistries: []string{"docker.io/library"}},
+			raw:      unsafe,
+			port:     80,
+			expected: "[]",
+		},
+		{
+			name:     "relaxed",
+			cfg:      config.StackConfig{PodAllowPrivileged: true, PodAllowHostAccess: true},
+			raw:      unsafe,
+			port:     80,
+			expected: "[]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := validatePodSpec(tt.cfg, tt.raw, tt.port)
+			got := make([]string, 0, len(fields))
+			for _, field := range fields {
+				got = append(got, field.Field+":"+field.Reason)
+			}
+
+			if fmt.Sprint(got) != tt.expected {
+				t.Fatalf("expected %s, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestImageAllowed(t *testing.T) {
+	registries := []string{"ghcr.io/smctf/", "docker.io"}
+
+	cases := map[string]bool{
+		"ghcr.io/smctf/web:1":     true,
+		"ghcr.io/smctf-evil/web":  false,
+		"ghcr.io/other/web":       false,
+		"docker.io/nginx":         true,
+		"docker.io.evil.com/app":  false,
+		"registry.example.com/ok": false,
+	}
+
+	for image, expected := range cases {
+		if imageAllowed(registries, image) != expected {
+			t.Fatalf("image %s: expected %t", image, expected)
+		}
+	}
+
+	if !imageAllowed(nil, "anything/at/all") {
+		t.Fatalf("expected empty allowlist to allow any image")
+	}
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"smctf/internal/config"
+	"smctf/internal/models"
+	"smctf/internal/repo"
+	"smctf/internal/stack"
+)
+
+const (
+	maxStackWait      = 10 * time.Second
+	stackWaitInterval = time.Second
+)
+
+// Provisions queued rows until ctx is done. Rows left pending or provisioning at shutdown are requeued by the reaper.
+func (s *StackService) RunProvisionWorkers(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.ProvisionWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-s.jobs:
+					if _, err := s.provision(ctx, id); err != nil && !errors.Is(err, ErrStackNotFound) {
+						log.Printf("stack provision %d error: %v", id, err)
+						s.releaseCapacity(ctx)
+					}
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Queues a pending row, or provisions it inline without workers
+func (s *StackService) start(ctx context.Context, id int64) {
+	if s.jobs != nil {
+		s.enqueue(id)
+		return
+	}
+
+	if _, err := s.provision(ctx, id); err != nil && !errors.Is(err, ErrStackNotFound) {
+		log.Printf("stack provision %d error: %v", id, err)
+	}
+}
+
+// A full queue leaves the row pending until the reaper finds it stale
+func (s *StackService) enqueue(id int64) {
+	select {
+	case s.jobs <- id:
+	default:
+		log.Printf("stack provision queue full, stack %d left pending", id)
+	}
+}
+
+// Creates the instance for a pending row. The row is marked failed when that does not work, and a new instance
+// is deleted again when its row was removed while it was being created.
+func (s *StackService) provision(ctx context.Context, id int64) (*models.Stack, error) {
+	claimed, err := s.stackRepo.ClaimPending(ctx, id)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrStackNotFound
+		}
+
+		return nil, fmt.Errorf("stack.provision claim: %w", err)
+	}
+
+	info, err := s.createInstance(ctx, claimed)
+	if err != nil {
+		_ = s.stackRepo.MarkFailed(ctx, claimed.ID, provisionFailureDetail(err))
+		return nil, err
+	}
+
+	claimed.StackID = info.StackID
+	claimed.Status = info.Status
+	claimed.NodePublicIP = nullIfEmpty(info.NodePublicIP)
+	claimed.NodePort = intPtrOrNil(info.NodePort)
+	claimed.TargetPort = info.TargetPort
+	claimed.TTLExpiresAt = timePtr(info.TTLExpiresAt)
+	claimed.LastError = nil
+	claimed.UpdatedAt = time.Now().UTC()
+
+	reported := info.RequestedCPUMilli > 0 || info.RequestedMemoryBytes > 0
+	if reported {
+		claimed.RequestedCPUMilli = info.RequestedCPUMilli
+		claimed.RequestedMemoryBytes = int64(info.RequestedMemoryBytes)
+	}
+
+	if err := s.stackRepo.CompleteProvisioning(ctx, claimed); err != nil {
+		if !s.storedByOtherWorker(ctx, claimed.ID, info.StackID) {
+			_ = s.client.DeleteStack(ctx, info.StackID)
+		}
+
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrStackNotFound
+		}
+
+		return nil, fmt.Errorf("stack.provision complete: %w", err)
+	}
+
+	if reported {
+		_ = s.challengeRepo.UpdateStackUsage(ctx, claimed.ChallengeID, claimed.RequestedCPUMilli, claimed.RequestedMemoryBytes)
+	}
+
+	s.publishStackEvent(ctx, StackEventUpdated, claimed)
+
+	return claimed, nil
+}
+
+// A requeued row is created again with the same idempotency key, so a slow worker and the one that took over
+// get the same instance back. Only the worker whose completion lost must leave that instance alone.
+func (s *StackService) storedByOtherWorker(ctx context.Context, id int64, stackID string) bool {
+	current, err := s.stackRepo.GetByID(ctx, id)
+	return err == nil && current.StackID == stackID
+}
+
+// Reloads the challenge so a spec edited while the row waited is used
+func (s *StackService) createInstance(ctx context.Context, row *models.Stack) (*stack.StackInfo, error) {
+	challenge, podSpec, err := s.loadChallengeSpec(ctx, row.ChallengeID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = stack.WithIdempotencyKey(ctx, stackIdempotencyKey(row))
+	info, err := s.client.CreateStack(ctx, challenge.StackTargetPort, podSpec)
+	if err != nil {
+		return nil, mapProvisionerError(err)
+	}
+
+	return info, nil
+}
+
+// Like GetStack, but holds the request for up to wait while the stack is still being provisioned or started
+func (s *StackService) WaitStack(ctx context.Context, userID, challengeID int64, wait time.Duration) (*models.Stack, error) {
+	if wait < 0 || wait > maxStackWait {
+		return nil, NewValidationError(FieldError{Field: "wait", Reason: "invalid"})
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		stackModel, err := s.GetStack(ctx, userID, challengeID)
+		if err != nil || !stackInProgress(stackModel.Status) || !time.Now().Add(stackWaitInterval).Before(deadline) {
+			return stackModel, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return stackModel, nil
+		case <-time.After(stackWaitInterval):
+		}
+	}
+}
+
+func stackInProgress(status string) bool {
+	switch status {
+	case models.StackStatusWaiting, models.StackStatusPending, models.StackStatusProvisioning, "creating":
+		return true
+	default:
+		return false
+	}
+}
+
+// Stable for the lifetime of a row, a retried or requeued create of the same row reuses it
+func stackIdempotencyKey(row *models.Stack) string {
+	return fmt.Sprintf("stack-%d-%d", row.ID, row.CreatedAt.UnixNano())
+}
+
+// Prefers the provisioner's own answer over the whole wrapped chain
+func provisionFailureDetail(err error) string {
+	var apiErr *stack.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Error()
+	}
+
+	return err.Error()
+}
+
+// Rows untouched this long lost their worker, twice the time a create can take with all its retries covers one
+// still in flight
+func (s *StackService) provisionStaleAfter() time.Duration {
+	return max(2*time.Duration(s.cfg.ProvisionerRetries+1)*s.cfg.ProvisionerTimeout, time.Minute)
+}
+
+// Drops stale failed rows and requeues stale pending or provisioning ones
+func (s *StackService) reconcileUnprovisioned(ctx context.Context, existing *models.Stack, now time.Time, report *StackReconcileReport) error {
+	staleBefore := now.Add(-s.provisionStaleAfter())
+	if existing.Status == models.StackStatusWaiting || !existing.UpdatedAt.Before(staleBefore) {
+		return nil
+	}
+
+	if existing.Status == models.StackStatusFailed {
+		if err := s.stackRepo.Delete(ctx, existing); err != nil {
+			return fmt.Errorf("stack.Reconcile delete: %w", err)
+		}
+
+		report.Terminal++
+		return nil
+	}
+
+	if err := s.stackRepo.Requeue(ctx, existing.ID, staleBefore); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("stack.Reconcile requeue: %w", err)
+	}
+
+	report.Requeued++
+	s.start(ctx, existing.ID)
+
+	return nil
+}
+
+func (s *StackService) capacityLimited() bool {
+	return s.cfg.MaxActive > 0 || s.cfg.MaxActivePerChallenge > 0 || s.cfg.MaxCPUMilli > 0 || s.cfg.MaxMemoryMB > 0
+}
+
+// Starts the waiting stacks that fit the capacity limits now
+func (s *StackService) admitWaiting(ctx context.Context) error {
+	admitted, err := s.stackRepo.AdmitWaiting(ctx, func(usage []models.StackUsage, waiting []models.WaitingStack) []models.WaitingStack {
+		return planAdmission(s.cfg, usage, waiting)
+	})
+	if err != nil {
+		return fmt.Errorf("stack.admitWaiting: %w", err)
+	}
+
+	for _, id := range admitted {
+		s.start(ctx, id)
+	}
+
+	return nil
+}
+
+// Called once stacks went away so waiting ones can take their place
+func (s *StackService) releaseCapacity(ctx context.Context) {
+	if !s.capacityLimited() {
+		return
+	}
+
+	if err := s.admitWaiting(ctx); err != nil {
+		log.Printf("stack admission error: %v", err)
+	}
+}
+
+// Admits in FIFO order. The global and resource limits stop at the first row that does not fit, a full challenge only
+// holds back its own rows. The resource limits are skipped while nothing runs, so one oversized stack cannot block the queue.
+func planAdmission(cfg config.StackConfig, usage []models.StackUsage, waiting []models.WaitingStack) []models.WaitingStack {
+	var total models.StackUsage
+	perChallenge := make(map[int64]int, len(usage))
+	for _, u := range usage {
+		total.Count += u.Count
+		total.CPUMilli += u.CPUMilli
+		total.MemoryBytes += u.MemoryBytes
+		perChallenge[u.ChallengeID] = u.Count
+	}
+
+	maxMemory := int64(cfg.MaxMemoryMB) << 20
+	admitted := make([]models.WaitingStack, 0)
+
+	for _, row := range waiting {
+		if cfg.MaxActive > 0 && total.Count >= cfg.MaxActive {
+			break
+		}
+
+		if total.Count > 0 {
+			if cfg.MaxCPUMilli > 0 && total.CPUMilli+int64(row.CPUMilli) > int64(cfg.MaxCPUMilli) {
+				break
+			}
+
+			if maxMemory > 0 && total.MemoryBytes+row.MemoryBytes > maxMemory {
+				break
+			}
+		}
+
+		if cfg.MaxActivePerChallenge > 0 && perChallenge[row.ChallengeID] >= cfg.MaxActivePerChallenge {
+			continue
+		}
+
+		admitted = append(admitted, row)
+		total.Count++
+		total.CPUMilli += int64(row.CPUMilli)
+		total.MemoryBytes += row.MemoryBytes
+		perChallenge[row.ChallengeID]++
+	}
+
+	return admitted
+}
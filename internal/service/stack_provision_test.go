@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"smctf/internal/config"
+	"smctf/internal/models"
+	"smctf/internal/repo"
+	"smctf/internal/stack"
+)
+
+func runningStackMock(createCalls *atomic.Int32) *stack.MockClient {
+	return &stack.MockClient{
+		CreateStackFn: func(ctx context.Context, targetPort int, podSpec string) (*stack.StackInfo, error) {
+			createCalls.Add(1)
+			return &stack.StackInfo{StackID: "stack-async", Status: "running", TargetPort: targetPort, NodePort: 31000, NodePublicIP: "127.0.0.1", TTLExpiresAt: time.Now().UTC().Add(time.Hour)}, nil
+		},
+		GetStackStatusFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80, NodePort: 31000, NodePublicIP: "127.0.0.1", TTL: time.Now().UTC().Add(time.Hour)}, nil
+		},
+	}
+}
+
+func TestStackServiceAsyncProvisioning(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var createCalls atomic.Int32
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 2, CreateWindow: time.Minute, CreateMax: 5, ProvisionWorkers: 1, ProvisionQueue: 10}
+	stackSvc, _ := newStackService(env, runningStackMock(&createCalls), cfg)
+
+	pending, err := stackSvc.GetOrCreateStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateStack: %v", err)
+	}
+
+	if pending.Provisioned() || pending.Status != models.StackStatusPending {
+		t.Fatalf("expected pending stack, got %+v", pending)
+	}
+
+	// A second create while the first is queued returns the same row
+	again, err := stackSvc.GetOrCreateStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateStack again: %v", err)
+	}
+
+	if again.ID != pending.ID {
+		t.Fatalf("expected deduped stack, got %d and %d", pending.ID, again.ID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		stackSvc.RunProvisionWorkers(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	ready, err := stackSvc.WaitStack(context.Background(), 1, challenge.ID, 5*time.Second)
+	if err != nil {
+		t.Fatalf("WaitStack: %v", err)
+	}
+
+	if ready.StackID != "stack-async" || ready.Status != "running" || ready.NodePort == nil {
+		t.Fatalf("expected provisioned stack, got %+v", ready)
+	}
+
+	if createCalls.Load() != 1 {
+		t.Fatalf("expected one provisioner create, got %d", createCalls.Load())
+	}
+
+	if _, err := stackSvc.WaitStack(context.Background(), 1, challenge.ID, time.Minute); err == nil {
+		t.Fatalf("expected wait validation error")
+	}
+}
+
+func TestStackServiceProvisionFailure(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	fail := true
+	keys := make([]string, 0)
+	mock := &stack.MockClient{
+		CreateStackFn: func(ctx context.Context, targetPort int, podSpec string) (*stack.StackInfo, error) {
+			keys = append(keys, stack.IdempotencyKey(ctx))
+			if fail {
+				return nil, &stack.APIError{Status: http.StatusServiceUnavailable, Code: "no_capacity", Message: "no nodes available"}
+			}
+
+			return &stack.StackInfo{StackID: "stack-retry", Status: "running", TargetPort: targetPort}, nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, CreateWindow: time.Minute, CreateMax: 5, ProvisionWorkers: 1, ProvisionQueue: 10}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+
+	pending, err := stackSvc.GetOrCreateStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateStack: %v", err)
+	}
+
+	if _, err := stackSvc.provision(context.Background(), pending.ID); !errors.Is(err, ErrStackProvisionerDown) {
+		t.Fatalf("expected provisioner down, got %v", err)
+	}
+
+	failed, err := stackSvc.GetStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetStack: %v", err)
+	}
+
+	if failed.Status != models.StackStatusFailed || failed.Provisioned() {
+		t.Fatalf("expected failed stack, got %+v", failed)
+	}
+
+	stored, err := stackRepo.GetByID(context.Background(), failed.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	if stored.LastError == nil || !strings.Contains(*stored.LastError, "no nodes available") {
+		t.Fatalf("expected provisioner message in last_error, got %v", stored.LastError)
+	}
+
+	// The failed row does not use up the quota and creating again replaces it
+	fail = false
+	retry, err := stackSvc.GetOrCreateStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+
+	if retry.ID == failed.ID || retry.Status != models.StackStatusPending {
+		t.Fatalf("expected new pending stack, got %+v", retry)
+	}
+
+	if _, err := stackSvc.provision(context.Background(), retry.ID); err != nil {
+		t.Fatalf("provision: %v", err)
+	}
+
+	provisioned, err := stackRepo.GetByStackID(context.Background(), "stack-retry")
+	if err != nil {
+		t.Fatalf("expected provisioned row, got %v", err)
+	}
+
+	if provisioned.LastError != nil {
+		t.Fatalf("expected no last_error, got %q", *provisioned.LastError)
+	}
+
+	// Each row gets its own idempotency key
+	if len(keys) != 2 || keys[0] == "" || keys[0] == keys[1] {
+		t.Fatalf("unexpected idempotency keys %v", keys)
+	}
+}
+
+func TestStackServiceProvisionDeletedMeanwhile(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var stackSvc *StackService
+	deleted := ""
+	mock := &stack.MockClient{
+		CreateStackFn: func(ctx context.Context, targetPort int, podSpec string) (*stack.StackInfo, error) {
+			// The user deletes the stack while the provisioner is still creating it
+			if err := stackSvc.DeleteStack(ctx, 1, challenge.ID); err != nil {
+				t.Errorf("delete: %v", err)
+			}
+
+			return &stack.StackInfo{StackID: "stack-orphan", Status: "running", TargetPort: targetPort}, nil
+		},
+		DeleteStackFn: func(ctx context.Context, stackID string) error {
+			deleted = stackID
+			return nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, CreateWindow: time.Minute, CreateMax: 5, ProvisionWorkers: 1, ProvisionQueue: 10}
+	stackSvc, _ = newStackService(env, mock, cfg)
+
+	pending, err := stackSvc.GetOrCreateStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateStack: %v", err)
+	}
+
+	if _, err := stackSvc.provision(context.Background(), pending.ID); !errors.Is(err, ErrStackNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if deleted != "stack-orphan" {
+		t.Fatalf("expected orphaned instance to be deleted, got %q", deleted)
+	}
+}
+
+func TestStackServiceProvisionTakenOver(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var stackSvc *StackService
+	var stackRepo *repo.StackRepo
+	var rowID int64
+	calls := 0
+	deleted := ""
+	mock := &stack.MockClient{
+		CreateStackFn: func(ctx context.Context, targetPort int, podSpec string) (*stack.StackInfo, error) {
+			calls++
+			if calls == 1 {
+				// The row is requeued while this create hangs and another worker completes it
+				if err := stackRepo.Requeue(ctx, rowID, time.Now().Add(time.Hour)); err != nil {
+					t.Errorf("requeue: %v", err)
+				}
+
+				if _, err := stackSvc.provision(ctx, rowID); err != nil {
+					t.Errorf("provision: %v", err)
+				}
+			}
+
+			// Both creates carry the same idempotency key, so the provisioner answers with the same instance
+			return &stack.StackInfo{StackID: "stack-shared", Status: "running", TargetPort: targetPort}, nil
+		},
+		DeleteStackFn: func(ctx context.Context, stackID string) error {
+			deleted = stackID
+			return nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, CreateWindow: time.Minute, CreateMax: 5, ProvisionWorkers: 1, ProvisionQueue: 10}
+	stackSvc, stackRepo = newStackService(env, mock, cfg)
+
+	pending, err := stackSvc.GetOrCreateStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("GetOrCreateStack: %v", err)
+	}
+
+	rowID = pending.ID
+	if _, err := stackSvc.provision(context.Background(), pending.ID); !errors.Is(err, ErrStackNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if deleted != "" {
+		t.Fatalf("expected the instance stored by the other worker to be kept, deleted %q", deleted)
+	}
+
+	if _, err := stackRepo.GetByStackID(context.Background(), "stack-shared"); err != nil {
+		t.Fatalf("expected provisioned row, got %v", err)
+	}
+}
+
+func TestStackServiceReconcileRequeuesStaleProvisioning(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var createCalls atomic.Int32
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 2, CreateWindow: time.Minute, CreateMax: 5}
+	stackSvc, stackRepo := newStackService(env, runningStackMock(&createCalls), cfg)
+
+	old := time.Now().UTC().Add(-time.Hour)
+	stuck := &models.Stack{UserID: 1, ChallengeID: challenge.ID, Status: models.StackStatusProvisioning, TargetPort: 80, CreatedAt: old, UpdatedAt: old}
+	if err := stackRepo.Create(context.Background(), stuck); err != nil {
+		t.Fatalf("create stuck row: %v", err)
+	}
+
+	failed := &models.Stack{UserID: 2, ChallengeID: challenge.ID, Status: models.StackStatusFailed, TargetPort: 80, CreatedAt: old, UpdatedAt: old}
+	if err := stackRepo.Create(context.Background(), failed); err != nil {
+		t.Fatalf("create failed row: %v", err)
+	}
+
+	recent := time.Now().UTC()
+	fresh := &models.Stack{UserID: 3, ChallengeID: challenge.ID, Status: models.StackStatusPending, TargetPort: 80, CreatedAt: recent, UpdatedAt: recent}
+	if err := stackRepo.Create(context.Background(), fresh); err != nil {
+		t.Fatalf("create fresh row: %v", err)
+	}
+
+	report, err := stackSvc.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	if report.Requeued != 1 || report.Terminal != 1 || report.Errors != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// Without workers the requeued row is provisioned inline
+	if createCalls.Load() != 1 {
+		t.Fatalf("expected one provisioner create, got %d", createCalls.Load())
+	}
+
+	provisioned, err := stackRepo.GetByStackID(context.Background(), "stack-async")
+	if err != nil || provisioned.ID != stuck.ID {
+		t.Fatalf("expected stuck row provisioned, got %+v err %v", provisioned, err)
+	}
+
+	remaining, err := stackRepo.ListAll(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if len(remaining) != 2 || remaining[1].ID != fresh.ID || remaining[1].Status != models.StackStatusPending {
+		t.Fatalf("expected fresh pending row untouched, got %+v", remaining)
+	}
+}
+
+func TestPlanAdmission(t *testing.T) {
+	usage := []models.StackUsage{
+		{ChallengeID: 1, Count: 2, CPUMilli: 1000, MemoryBytes: 512 << 20},
+		{ChallengeID: 2, Count: 1, CPUMilli: 500, MemoryBytes: 256 << 20},
+	}
+	waiting := []models.WaitingStack{
+		{ID: 10, ChallengeID: 1, CPUMilli: 500, MemoryBytes: 256 << 20},
+		{ID: 11, ChallengeID: 2, CPUMilli: 500, MemoryBytes: 256 << 20},
+		{ID: 12, ChallengeID: 3, CPUMilli: 500, MemoryBytes: 256 << 20},
+		{ID: 13, ChallengeID: 3, CPUMilli: 500, MemoryBytes: 256 << 20},
+	}
+
+	ids := func(rows []models.WaitingStack) []int64 {
+		out := make([]int64, 0, len(rows))
+		for _, row := range rows {
+			out = append(out, row.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.StackConfig
+		usage    []models.StackUsage
+		expected []int64
+	}{
+		{name: "global count", cfg: config.StackConfig{MaxActive: 5}, usage: usage, expected: []int64{10, 11}},
+		{name: "per challenge skips", cfg: config.StackConfig{MaxActivePerChallenge: 2}, usage: usage, expected: []int64{11, 12, 13}},
+		{name: "cpu stops in order", cfg: config.StackConfig{MaxCPUMilli: 2500}, usage: usage, expected: []int64{10, 11}},
+		{name: "memory", cfg: config.StackConfig{MaxMemoryMB: 1200}, usage: usage, expected: []int64{10}},
+		{name: "oversized first stack", cfg: config.StackConfig{MaxCPUMilli: 100}, usage: nil, expected: []int64{10}},
+		{name: "full", cfg: config.StackConfig{MaxActive: 3}, usage: usage, expected: []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(planAdmission(tt.cfg, tt.usage, waiting))
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStackServiceWaitlist(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var createCalls atomic.Int32
+	mock := &stack.MockClient{
+		CreateStackFn: func(ctx context.Context, targetPort int, podSpec string) (*stack.StackInfo, error) {
+			n := createCalls.Add(1)
+			return &stack.StackInfo{StackID: fmt.Sprintf("stack-%d", n), Status: "running", TargetPort: targetPort, RequestedCPUMilli: 250, RequestedMemoryBytes: 64 << 20}, nil
+		},
+		GetStackStatusFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80, TTL: time.Now().UTC().Add(time.Hour)}, nil
+		},
+		DeleteStackFn: func(ctx context.Context, stackID string) error {
+			return nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, CreateWindow: time.Minute, CreateMax: 5, MaxActive: 1}
+	stackSvc, _ := newStackService(env, mock, cfg)
+
+	first, err := stackSvc.GetOrCreateStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("first create: %v", err)
+	}
+
+	if first.StackID != "stack-1" || first.RequestedCPUMilli != 250 {
+		t.Fatalf("expected first stack admitted, got %+v", first)
+	}
+
+	second, err := stackSvc.GetOrCreateStack(context.Background(), 2, challenge.ID)
+	if err != nil {
+		t.Fatalf("second create: %v", err)
+	}
+
+	third, err := stackSvc.GetOrCreateStack(context.Background(), 3, challenge.ID)
+	if err != nil {
+		t.Fatalf("third create: %v", err)
+	}
+
+	if second.Status != models.StackStatusWaiting || second.QueuePosition != 1 || third.QueuePosition != 2 {
+		t.Fatalf("expected waitlist positions 1 and 2, got %+v and %+v", second, third)
+	}
+
+	stored, err := env.challengeRepo.GetByID(context.Background(), challenge.ID)
+	if err != nil {
+		t.Fatalf("get challenge: %v", err)
+	}
+
+	if stored.StackCPUMilli != 250 || stored.StackMemoryBytes != 64<<20 {
+		t.Fatalf("expected learned usage, got %d/%d", stored.StackCPUMilli, stored.StackMemoryBytes)
+	}
+
+	// Freeing the slot starts the oldest waiting stack
+	if err := stackSvc.DeleteStack(context.Background(), 1, challenge.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	promoted, err := stackSvc.GetStack(context.Background(), 2, challenge.ID)
+	if err != nil {
+		t.Fatalf("get promoted: %v", err)
+	}
+
+	if promoted.StackID != "stack-2" || promoted.Status != "running" {
+		t.Fatalf("expected second stack provisioned, got %+v", promoted)
+	}
+
+	still, err := stackSvc.GetStack(context.Background(), 3, challenge.ID)
+	if err != nil {
+		t.Fatalf("get third: %v", err)
+	}
+
+	if still.Status != models.StackStatusWaiting || still.QueuePosition != 1 {
+		t.Fatalf("expected third to move up, got %+v", still)
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"smctf/internal/models"
+	"smctf/internal/repo"
+	"smctf/internal/stack"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisStackReaperLock = "stack_reaper:lock"
+	stackReaperLockTTL   = 30 * time.Second
+)
+
+// Lock scripts only touch the key while it still holds the caller's token, so an expired lock taken over
+// by another replica is never extended or deleted by its previous owner.
+var (
+	refreshLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+	releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// Outcome of one reconciliation pass. Missing, Terminal and Updated count drift between the stacks table and the provisioner.
+// Requeued counts stuck provisioning jobs that were started again.
+type StackReconcileReport struct {
+	Checked  int
+	Expired  int
+	Inactive int
+	Missing  int
+	Terminal int
+	Updated  int
+	Requeued int
+	Errors   int
+}
+
+func (r StackReconcileReport) Drift() int {
+	return r.Missing + r.Terminal + r.Updated
+}
+
+// Walks every stack row: removes rows past their TTL or whose challenge is gone, inactive or no longer stack enabled,
+// drops rows the provisioner forgot or stopped and syncs the rest. Failed deletes keep their row for the next pass.
+func (s *StackService) Reconcile(ctx context.Context) (StackReconcileReport, error) {
+	var report StackReconcileReport
+	if err := s.ensureEnabled(); err != nil {
+		return report, err
+	}
+
+	stacks, err := s.stackRepo.ListAll(ctx)
+	if err != nil {
+		return report, fmt.Errorf("stack.Reconcile list: %w", err)
+	}
+
+	challenges := make(map[int64]*models.Challenge)
+	now := time.Now().UTC()
+
+	for i := range stacks {
+		existing := &stacks[i]
+		report.Checked++
+
+		challenge, err := s.reconcileChallenge(ctx, challenges, existing.ChallengeID)
+		if err != nil {
+			return report, err
+		}
+
+		switch {
+		case challenge == nil || !challenge.IsActive || !challenge.StackEnabled:
+			if s.reapStack(ctx, existing) == nil {
+				report.Inactive++
+			} else {
+				report.Errors++
+			}
+			continue
+		case !existing.Provisioned():
+			if err := s.reconcileUnprovisioned(ctx, existing, now, &report); err != nil {
+				return report, err
+			}
+			continue
+		case existing.TTLExpiresAt != nil && !existing.TTLExpiresAt.After(now):
+			if s.reapStack(ctx, existing) == nil {
+				report.Expired++
+			} else {
+				report.Errors++
+			}
+			continue
+		}
+
+		status, err := s.client.GetStackStatus(ctx, existing.StackID)
+		switch {
+		case errors.Is(err, stack.ErrNotFound):
+			if err := s.stackRepo.Delete(ctx, existing); err != nil {
+				return report, fmt.Errorf("stack.Reconcile delete: %w", err)
+			}
+			report.Missing++
+			continue
+		case errors.Is(err, stack.ErrUnavailable):
+			return report, ErrStackProvisionerDown
+		case err != nil:
+			report.Errors++
+			continue
+		}
+
+		if isTerminalStackStatus(status.Status) {
+			if err := s.stackRepo.Delete(ctx, existing); err != nil {
+				return report, fmt.Errorf("stack.Reconcile delete: %w", err)
+			}
+			report.Terminal++
+			existing.Status = status.Status
+			s.publishStackEvent(ctx, StackEventDeleted, existing)
+			continue
+		}
+
+		if !applyStackStatus(existing, status) {
+			continue
+		}
+
+		existing.UpdatedAt = now
+		if err := s.stackRepo.Update(ctx, existing); err != nil {
+			return report, fmt.Errorf("stack.Reconcile update: %w", err)
+		}
+		report.Updated++
+		s.publishStackEvent(ctx, StackEventUpdated, existing)
+	}
+
+	// Expired, missing and failed stacks freed capacity above, and waiting rows may fit now
+	s.releaseCapacity(ctx)
+
+	return report, nil
+}
+
+func (s *StackService) reconcileChallenge(ctx context.Context, cache map[int64]*models.Challenge, id int64) (*models.Challenge, error) {
+	if challenge, ok := cache[id]; ok {
+		return challenge, nil
+	}
+
+	challenge, err := s.challengeRepo.GetByID(ctx, id)
+	if err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, fmt.Errorf("stack.Reconcile challenge: %w", err)
+	}
+
+	cache[id] = challenge
+	return challenge, nil
+}
+
+// Deletes the instance and then its row. The row is kept when the provisioner refused.
+func (s *StackService) reapStack(ctx context.Context, existing *models.Stack) error {
+	if err := s.deleteInstance(ctx, existing); err != nil {
+		return err
+	}
+
+	if err := s.stackRepo.Delete(ctx, existing); err != nil {
+		return fmt.Errorf("stack.reapStack delete: %w", err)
+	}
+
+	return nil
+}
+
+// Copies the provisioner view onto the row and reports whether anything changed
+func applyStackStatus(existing *models.Stack, status *stack.StackStatus) bool {
+	next := *existing
+	next.Status = status.Status
+	next.NodePublicIP = nullIfEmpty(status.NodePublicIP)
+	next.NodePort = intPtrOrNil(status.NodePort)
+	next.TargetPort = status.TargetPort
+	next.TTLExpiresAt = timePtr(status.TTL)
+
+	changed := next.Status != existing.Status ||
+		next.TargetPort != existing.TargetPort ||
+		!equalPtr(next.NodePublicIP, existing.NodePublicIP) ||
+		!equalPtr(next.NodePort, existing.NodePort) ||
+		!equalTimePtr(next.TTLExpiresAt, existing.TTLExpiresAt)
+
+	*existing = next
+	return changed
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+// Runs Reconcile on an interval. A Redis lock held for the length of a pass keeps replicas from reconciling at the same time.
+type StackReaper struct {
+	stacks   *StackService
+	redis    *redis.Client
+	interval time.Duration
+}
+
+func NewStackReaper(stacks *StackService, redisClient *redis.Client, interval time.Duration) *StackReaper {
+	return &StackReaper{stacks: stacks, redis: redisClient, interval: interval}
+}
+
+// Blocks until ctx is done
+func (r *StackReaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, ran, err := r.RunOnce(ctx)
+			if err != nil {
+				log.Printf("stack reaper error: %v", err)
+			}
+
+			if ran && (report.Expired+report.Inactive+report.Drift()+report.Requeued+report.Errors) > 0 {
+				log.Printf("stack reaper: checked=%d expired=%d inactive=%d missing=%d terminal=%d updated=%d requeued=%d errors=%d",
+					report.Checked, report.Expired, report.Inactive, report.Missing, report.Terminal, report.Updated, report.Requeued, report.Errors)
+			}
+		}
+	}
+}
+
+// Reports ran=false without doing anything when another replica holds the lock
+func (r *StackReaper) RunOnce(ctx context.Context) (StackReconcileReport, bool, error) {
+	lock, err := acquireLock(ctx, r.redis, redisStackReaperLock, stackReaperLockTTL)
+	if err != nil {
+		return StackReconcileReport{}, false, fmt.Errorf("stackReaper.RunOnce lock: %w", err)
+	}
+
+	if lock == nil {
+		return StackReconcileReport{}, false, nil
+	}
+
+	defer lock.release(context.WithoutCancel(ctx))
+
+	passCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go lock.keepAlive(passCtx)
+
+	report, err := r.stacks.Reconcile(passCtx)
+	return report, true, err
+}
+
+// Redis lock owned through a random token
+type redisLock struct {
+	redis *redis.Client
+	key   string
+	token string
+	ttl   time.Duration
+}
+
+// Returns a nil lock when another owner holds the key
+func acquireLock(ctx context.Context, redisClient *redis.Client, key string, ttl time.Duration) (*redisLock, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	lock := &redisLock{redis: redisClient, key: key, token: hex.EncodeToString(token), ttl: ttl}
+	acquired, err := redisClient.SetNX(ctx, key, lock.token, ttl).Result()
+	if err != nil || !acquired {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// Extends the lock every third of its ttl until ctx is done, so a long pass keeps it
+func (l *redisLock) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			held, err := refreshLockScript.Run(ctx, l.redis, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+			if err != nil && ctx.Err() == nil {
+				log.Printf("lock %s refresh error: %v", l.key, err)
+				continue
+			}
+
+			if err == nil && held == 0 {
+				log.Printf("lock %s lost before the work finished", l.key)
+				return
+			}
+		}
+	}
+}
+
+func (l *redisLock) release(ctx context.Context) {
+	if err := releaseLockScript.Run(ctx, l.redis, []string{l.key}, l.token).Err(); err != nil {
+		log.Printf("lock %s release error: %v", l.key, err)
+	}
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"smctf/internal/config"
+	"smctf/internal/models"
+	"smctf/internal/repo"
+	"smctf/internal/stack"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func createStackRow(t *testing.T, stackRepo *repo.StackRepo, userID, challengeID int64, stackID string, ttl time.Time) *models.Stack {
+	t.Helper()
+	now := time.Now().UTC()
+	row := &models.Stack{
+		UserID:       userID,
+		ChallengeID:  challengeID,
+		StackID:      stackID,
+		Status:       "running",
+		TargetPort:   80,
+		TTLExpiresAt: &ttl,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := stackRepo.Create(context.Background(), row); err != nil {
+		t.Fatalf("create stack row: %v", err)
+	}
+
+	return row
+}
+
+func TestStackServiceReconcile(t *testing.T) {
+	env := setupServiceTest(t)
+	active := createStackChallenge(t, env, "active")
+	inactive := createStackChallenge(t, env, "inactive")
+
+	inactive.IsActive = false
+	if err := env.challengeRepo.Update(context.Background(), inactive); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+
+	future := time.Now().UTC().Add(time.Hour)
+	deleted := make(map[string]bool)
+	mock := &stack.MockClient{
+		GetStackStatusFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			switch stackID {
+			case "stack-missing":
+				return nil, stack.ErrNotFound
+			case "stack-stopped":
+				return &stack.StackStatus{StackID: stackID, Status: "stopped", TargetPort: 80, TTL: future}, nil
+			case "stack-broken":
+				return nil, stack.ErrInvalid
+			}
+
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80, NodePort: 31000, NodePublicIP: "127.0.0.1", TTL: future}, nil
+		},
+		DeleteStackFn: func(ctx context.Context, stackID string) error {
+			if stackID == "stack-stuck" {
+				return stack.ErrInvalid
+			}
+
+			deleted[stackID] = true
+			return nil
+		},
+	}
+
+	stackSvc, stackRepo := newStackService(env, mock, config.StackConfig{Enabled: true, MaxPerUser: 10, CreateWindow: time.Minute, CreateMax: 5})
+
+	createStackRow(t, stackRepo, 1, active.ID, "stack-expired", time.Now().UTC().Add(-time.Minute))
+	createStackRow(t, stackRepo, 2, inactive.ID, "stack-inactive", future)
+	createStackRow(t, stackRepo, 3, active.ID, "stack-missing", future)
+	createStackRow(t, stackRepo, 4, active.ID, "stack-stopped", future)
+	createStackRow(t, stackRepo, 5, active.ID, "stack-drift", future)
+	createStackRow(t, stackRepo, 6, active.ID, "stack-broken", future)
+	createStackRow(t, stackRepo, 7, active.ID, "stack-stuck", time.Now().UTC().Add(-time.Minute))
+
+	report, err := stackSvc.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	expected := StackReconcileReport{Checked: 7, Expired: 1, Inactive: 1, Missing: 1, Terminal: 1, Updated: 1, Errors: 2}
+	if report != expected {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	if !deleted["stack-expired"] || !deleted["stack-inactive"] {
+		t.Fatalf("expected provisioner deletes, got %v", deleted)
+	}
+
+	remaining, err := stackRepo.ListAll(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	ids := make([]string, 0, len(remaining))
+	for _, row := range remaining {
+		ids = append(ids, row.StackID)
+	}
+
+	if len(ids) != 3 || ids[0] != "stack-drift" || ids[1] != "stack-broken" || ids[2] != "stack-stuck" {
+		t.Fatalf("unexpected remaining stacks: %v", ids)
+	}
+
+	if remaining[0].NodePort == nil || *remaining[0].NodePort != 31000 || remaining[0].NodePublicIP == nil {
+		t.Fatalf("expected drift to be synced, got %+v", remaining[0])
+	}
+
+	report, err = stackSvc.Reconcile(context.Background())
+	if err != nil {
+		t.Fatalf("second reconcile: %v", err)
+	}
+
+	if report.Drift() != 0 || report.Checked != 3 {
+		t.Fatalf("expected no drift on second pass, got %+v", report)
+	}
+}
+
+func TestStackServiceReconcileProvisionerDown(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	mock := &stack.MockClient{
+		GetStackStatusFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			return nil, stack.ErrUnavailable
+		},
+	}
+
+	stackSvc, stackRepo := newStackService(env, mock, config.StackConfig{Enabled: true, MaxPerUser: 10, CreateWindow: time.Minute, CreateMax: 5})
+	createStackRow(t, stackRepo, 1, challenge.ID, "stack-1", time.Now().UTC().Add(time.Hour))
+
+	if _, err := stackSvc.Reconcile(context.Background()); !errors.Is(err, ErrStackProvisionerDown) {
+		t.Fatalf("expected provisioner down, got %v", err)
+	}
+
+	if _, err := stackRepo.GetByStackID(context.Background(), "stack-1"); err != nil {
+		t.Fatalf("expected row kept, got %v", err)
+	}
+}
+
+func TestStackReaperLock(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	// Disabled stacks make Reconcile return right away, so only the lock is exercised
+	stackSvc := NewStackService(config.StackConfig{}, nil, nil, nil, nil, client)
+	first := NewStackReaper(stackSvc, client, time.Minute)
+	second := NewStackReaper(stackSvc, client, time.Minute)
+
+	if _, ran, _ := first.RunOnce(context.Background()); !ran {
+		t.Fatalf("expected first reaper to run")
+	}
+
+	if redisServer.Exists(redisStackReaperLock) {
+		t.Fatalf("expected the lock to be released after the pass")
+	}
+
+	// Another replica in the middle of a pass
+	held, err := acquireLock(context.Background(), client, redisStackReaperLock, stackReaperLockTTL)
+	if err != nil || held == nil {
+		t.Fatalf("acquire lock: %v", err)
+	}
+
+	if _, ran, err := second.RunOnce(context.Background()); ran || err != nil {
+		t.Fatalf("expected second reaper to skip, ran=%v err=%v", ran, err)
+	}
+
+	// A stale owner cannot free a lock someone else took over
+	stale := &redisLock{redis: client, key: redisStackReaperLock, token: "stale", ttl: stackReaperLockTTL}
+	stale.release(context.Background())
+	if !redisServer.Exists(redisStackReaperLock) {
+		t.Fatalf("expected the lock to survive a release with the wrong token")
+	}
+
+	held.release(context.Background())
+	if _, ran, _ := second.RunOnce(context.Background()); !ran {
+		t.Fatalf("expected reaper to run after the lock was released")
+	}
+}
+
+func TestRedisLockKeepAlive(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: redisServer.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	lock, err := acquireLock(context.Background(), client, "test:lock", 300*time.Millisecond)
+	if err != nil || lock == nil {
+		t.Fatalf("acquire lock: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go lock.keepAlive(ctx)
+
+	redisServer.SetTTL("test:lock", time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for redisServer.TTL("test:lock") < 100*time.Millisecond {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the lock to be refreshed, ttl %v", redisServer.TTL("test:lock"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
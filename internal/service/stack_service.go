@@ -4,11 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"log"
 	"strings"
 	"time"
 
 	"smctf/internal/config"
+	"smctf/internal/db"
 	"smctf/internal/models"
 	"smctf/internal/repo"
 	"smctf/internal/stack"
@@ -23,17 +24,27 @@ type StackService struct {
 	submissionRepo *repo.SubmissionRepo
 	client         stack.API
 	redis          *redis.Client
+	limiter        *RateLimiter
+	jobs           chan int64
 }
 
 func NewStackService(cfg config.StackConfig, stackRepo *repo.StackRepo, challengeRepo *repo.ChallengeRepo, submissionRepo *repo.SubmissionRepo, client stack.API, redisClient *redis.Client) *StackService {
-	return &StackService{
+	svc := &StackService{
 		cfg:            cfg,
 		stackRepo:      stackRepo,
 		challengeRepo:  challengeRepo,
 		submissionRepo: submissionRepo,
 		client:         client,
 		redis:          redisClient,
+		limiter:        NewRateLimiter(redisClient),
 	}
+
+	// Without workers stacks are provisioned inline in the create request
+	if cfg.ProvisionWorkers > 0 {
+		svc.jobs = make(chan int64, cfg.ProvisionQueue)
+	}
+
+	return svc
 }
 
 func (s *StackService) ListUserStacks(ctx context.Context, userID int64) ([]models.Stack, error) {
@@ -41,7 +52,12 @@ func (s *StackService) ListUserStacks(ctx context.Context, userID int64) ([]mode
 		return nil, err
 	}
 
-	stacks, err := s.stackRepo.ListByUser(ctx, userID)
+	teamID, err := s.stackRepo.TeamIDForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stacks, err := s.stackRepo.ListVisible(ctx, userID, teamID)
 	if err != nil {
 		return nil, err
 	}
@@ -64,12 +80,13 @@ func (s *StackService) ListUserStacks(ctx context.Context, userID int64) ([]mode
 	return updated, nil
 }
 
+// Returns the pending row right away when provisioning runs on workers, clients poll GetStack or WaitStack for readiness
 func (s *StackService) GetOrCreateStack(ctx context.Context, userID, challengeID int64) (*models.Stack, error) {
 	if err := s.ensureEnabled(); err != nil {
 		return nil, err
 	}
 
-	challenge, podSpec, err := s.loadChallengeSpec(ctx, challengeID)
+	challenge, _, err := s.loadChallengeSpec(ctx, challengeID)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +95,12 @@ func (s *StackService) GetOrCreateStack(ctx context.Context, userID, challengeID
 		return nil, err
 	}
 
-	existing, err := s.findExistingStack(ctx, userID, challengeID)
+	teamID, err := s.stackRepo.TeamIDForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("stack.GetOrCreateStack team: %w", err)
+	}
+
+	existing, err := s.findExistingStack(ctx, userID, teamID, challengeID)
 	if err != nil {
 		return nil, err
 	}
@@ -90,11 +112,16 @@ func (s *StackService) GetOrCreateStack(ctx context.Context, userID, challengeID
 		return nil, err
 	}
 
-	if err := s.ensureUserLimit(ctx, userID); err != nil {
+	ownerTeamID := int64(0)
+	if challenge.StackTeamShared {
+		ownerTeamID = teamID
+	}
+
+	if err := s.ensureQuota(ctx, userID, teamID, ownerTeamID); err != nil {
 		return nil, err
 	}
 
-	stackModel, err := s.createStack(ctx, userID, challengeID, challenge.StackTargetPort, podSpec)
+	stackModel, err := s.createStack(ctx, userID, teamID, ownerTeamID, challengeID, challenge.StackTargetPort)
 	if err != nil {
 		return nil, err
 	}
@@ -107,13 +134,9 @@ func (s *StackService) GetStack(ctx context.Context, userID, challengeID int64)
 		return nil, err
 	}
 
-	existing, err := s.stackRepo.GetByUserAndChallenge(ctx, userID, challengeID)
+	existing, err := s.getVisibleStack(ctx, userID, challengeID, "stack.GetStack")
 	if err != nil {
-		if errors.Is(err, repo.ErrNotFound) {
-			return nil, ErrStackNotFound
-		}
-
-		return nil, fmt.Errorf("stack.GetStack lookup: %w", err)
+		return nil, err
 	}
 
 	return s.refreshStack(ctx, existing)
@@ -124,46 +147,209 @@ func (s *StackService) DeleteStack(ctx context.Context, userID, challengeID int6
 		return err
 	}
 
-	existing, err := s.stackRepo.GetByUserAndChallenge(ctx, userID, challengeID)
+	existing, err := s.getVisibleStack(ctx, userID, challengeID, "stack.DeleteStack")
 	if err != nil {
-		if errors.Is(err, repo.ErrNotFound) {
-			return ErrStackNotFound
-		}
-
-		return fmt.Errorf("stack.DeleteStack lookup: %w", err)
+		return err
 	}
 
-	if err := s.client.DeleteStack(ctx, existing.StackID); err != nil && !errors.Is(err, stack.ErrNotFound) {
-		return mapProvisionerError(err)
+	if err := s.deleteInstance(ctx, existing); err != nil {
+		return err
 	}
 
 	if err := s.stackRepo.Delete(ctx, existing); err != nil {
 		return fmt.Errorf("stack.DeleteStack delete: %w", err)
 	}
 
+	s.releaseCapacity(ctx)
+
 	return nil
 }
 
-func (s *StackService) DeleteStackByUserAndChallenge(ctx context.Context, userID, challengeID int64) error {
+// Pushes the TTL out by ExtendDuration, at most ExtendMax times and never past MaxLifetime from creation
+func (s *StackService) ExtendStack(ctx context.Context, userID, challengeID int64) (*models.Stack, error) {
+	existing, err := s.lookupOwnStack(ctx, userID, challengeID, "stack.ExtendStack")
+	if err != nil {
+		return nil, err
+	}
+
+	if !existing.Provisioned() {
+		return nil, ErrStackNotReady
+	}
+
+	if existing.ExtendCount >= s.cfg.ExtendMax {
+		return nil, ErrStackExtendLimit
+	}
+
+	now := time.Now().UTC()
+	base := now
+	if existing.TTLExpiresAt != nil && existing.TTLExpiresAt.After(now) {
+		base = *existing.TTLExpiresAt
+	}
+
+	ttl := base.Add(s.cfg.ExtendDuration)
+	if limit := existing.CreatedAt.Add(s.cfg.MaxLifetime); ttl.After(limit) {
+		ttl = limit
+	}
+
+	if !ttl.After(base) {
+		return nil, ErrStackExtendLimit
+	}
+
+	// Reserved up front so concurrent requests cannot go past the limit
+	if err := s.stackRepo.ReserveExtend(ctx, existing.ID, s.cfg.ExtendMax); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrStackExtendLimit
+		}
+
+		return nil, fmt.Errorf("stack.ExtendStack reserve: %w", err)
+	}
+
+	status, err := s.client.ExtendStack(ctx, existing.StackID, ttl)
+	if err != nil {
+		if releaseErr := s.stackRepo.ReleaseExtend(context.WithoutCancel(ctx), existing.ID); releaseErr != nil {
+			log.Printf("stack %d extend release error: %v", existing.ID, releaseErr)
+		}
+
+		return nil, s.handleActionError(ctx, existing, err)
+	}
+
+	existing.ExtendCount++
+	return s.saveStackStatus(ctx, existing, status, "stack.ExtendStack")
+}
+
+// Restarts the instance in place, it keeps its TTL and does not count against the create limits
+func (s *StackService) RestartStack(ctx context.Context, userID, challengeID int64) (*models.Stack, error) {
+	existing, err := s.lookupOwnStack(ctx, userID, challengeID, "stack.RestartStack")
+	if err != nil {
+		return nil, err
+	}
+
+	if !existing.Provisioned() {
+		return nil, ErrStackNotReady
+	}
+
+	status, err := s.client.RestartStack(ctx, existing.StackID)
+	if err != nil {
+		return nil, s.handleActionError(ctx, existing, err)
+	}
+
+	return s.saveStackStatus(ctx, existing, status, "stack.RestartStack")
+}
+
+func (s *StackService) lookupOwnStack(ctx context.Context, userID, challengeID int64, op string) (*models.Stack, error) {
 	if err := s.ensureEnabled(); err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := s.ensureNotSolved(ctx, userID, challengeID); err != nil {
+		return nil, err
 	}
 
-	existing, err := s.stackRepo.GetByUserAndChallenge(ctx, userID, challengeID)
+	return s.getVisibleStack(ctx, userID, challengeID, op)
+}
+
+func (s *StackService) getVisibleStack(ctx context.Context, userID, challengeID int64, op string) (*models.Stack, error) {
+	teamID, err := s.stackRepo.TeamIDForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s team: %w", op, err)
+	}
+
+	existing, err := s.stackRepo.GetVisible(ctx, userID, teamID, challengeID)
 	if err != nil {
 		if errors.Is(err, repo.ErrNotFound) {
-			return ErrStackNotFound
+			return nil, ErrStackNotFound
 		}
 
-		return fmt.Errorf("stack.DeleteStackByUserAndChallenge lookup: %w", err)
+		return nil, fmt.Errorf("%s lookup: %w", op, err)
 	}
 
-	if err := s.client.DeleteStack(ctx, existing.StackID); err != nil && !errors.Is(err, stack.ErrNotFound) {
-		return mapProvisionerError(err)
+	return existing, nil
+}
+
+// Drops the row when the provisioner no longer knows the stack
+func (s *StackService) handleActionError(ctx context.Context, existing *models.Stack, err error) error {
+	if errors.Is(err, stack.ErrNotFound) {
+		_ = s.stackRepo.Delete(ctx, existing)
 	}
 
-	if err := s.stackRepo.Delete(ctx, existing); err != nil {
-		return fmt.Errorf("stack.DeleteStackByUserAndChallenge delete: %w", err)
+	return mapProvisionerError(err)
+}
+
+func (s *StackService) saveStackStatus(ctx context.Context, existing *models.Stack, status *stack.StackStatus, op string) (*models.Stack, error) {
+	if isTerminalStackStatus(status.Status) {
+		_ = s.stackRepo.Delete(ctx, existing)
+		return nil, ErrStackNotFound
+	}
+
+	applyStackStatus(existing, status)
+	existing.UpdatedAt = time.Now().UTC()
+
+	if err := s.stackRepo.Update(ctx, existing); err != nil {
+		return nil, fmt.Errorf("%s update: %w", op, err)
+	}
+
+	return existing, nil
+}
+
+// Removes every stack that became useless after a solve: the team stack and each member's personal one
+func (s *StackService) DeleteSolvedStacks(ctx context.Context, userID, challengeID int64) error {
+	if err := s.ensureEnabled(); err != nil {
+		return err
+	}
+
+	teamID, err := s.stackRepo.TeamIDForUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("stack.DeleteSolvedStacks team: %w", err)
+	}
+
+	var stacks []models.Stack
+	if teamID > 0 {
+		stacks, err = s.stackRepo.ListByTeamAndChallenge(ctx, teamID, challengeID)
+		if err != nil {
+			return fmt.Errorf("stack.DeleteSolvedStacks list: %w", err)
+		}
+	} else {
+		existing, err := s.stackRepo.GetVisible(ctx, userID, 0, challengeID)
+		if err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				return nil
+			}
+
+			return fmt.Errorf("stack.DeleteSolvedStacks lookup: %w", err)
+		}
+
+		stacks = []models.Stack{*existing}
+	}
+
+	var firstErr error
+	for i := range stacks {
+		if err := s.deleteInstance(ctx, &stacks[i]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if err := s.stackRepo.Delete(ctx, &stacks[i]); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("stack.DeleteSolvedStacks delete: %w", err)
+		}
+	}
+
+	if len(stacks) > 0 {
+		s.releaseCapacity(ctx)
+	}
+
+	return firstErr
+}
+
+// Rows without an instance yet have nothing to delete on the provisioner. A worker still creating one drops it once it sees the row is gone.
+func (s *StackService) deleteInstance(ctx context.Context, existing *models.Stack) error {
+	if !existing.Provisioned() {
+		return nil
+	}
+
+	if err := s.client.DeleteStack(ctx, existing.StackID); err != nil && !errors.Is(err, stack.ErrNotFound) {
+		return mapProvisionerError(err)
 	}
 
 	return nil
@@ -217,17 +403,22 @@ func (s *StackService) ensureNotSolved(ctx context.Context, userID, challengeID
 		return nil
 	}
 
-	existing, err := s.stackRepo.GetByUserAndChallenge(ctx, userID, challengeID)
-	if err == nil {
-		_ = s.client.DeleteStack(ctx, existing.StackID)
-		_ = s.stackRepo.Delete(ctx, existing)
-	}
+	_ = s.DeleteSolvedStacks(ctx, userID, challengeID)
 
 	return ErrAlreadySolved
 }
 
-func (s *StackService) findExistingStack(ctx context.Context, userID, challengeID int64) (*models.Stack, error) {
-	existing, err := s.stackRepo.GetByUserAndChallenge(ctx, userID, challengeID)
+func (s *StackService) findExistingStack(ctx context.Context, userID, teamID, challengeID int64) (*models.Stack, error) {
+	existing, err := s.stackRepo.GetVisible(ctx, userID, teamID, challengeID)
+	if err == nil && !existing.Provisioned() && existing.Status == models.StackStatusFailed {
+		// Creating again replaces a failed attempt
+		if err := s.stackRepo.Delete(ctx, existing); err != nil {
+			return nil, fmt.Errorf("stack.GetOrCreateStack delete failed: %w", err)
+		}
+
+		return nil, nil
+	}
+
 	if err == nil {
 		refreshed, refreshErr := s.refreshStack(ctx, existing)
 		if refreshErr == nil {
@@ -253,51 +444,127 @@ func (s *StackService) applyRateLimit(ctx context.Context, userID int64) error {
 		return nil
 	}
 
-	key := stackRateLimitKey(userID)
-	return rateLimit(ctx, s.redis, key, s.cfg.CreateWindow, s.cfg.CreateMax)
+	subject := RateLimitSubject{UserID: userID}
+	policies := []RateLimitPolicy{
+		{Scope: RateLimitScopeUser, Limit: s.cfg.CreateMax, Window: s.cfg.CreateWindow},
+		{Scope: RateLimitScopeGlobal, Limit: s.cfg.CreateGlobalMax, Window: s.cfg.CreateWindow},
+	}
+
+	_, err := s.limiter.Allow(ctx, rateLimitStackCreate, subject, policies...)
+	return err
 }
 
-func (s *StackService) ensureUserLimit(ctx context.Context, userID int64) error {
+// Team stacks count against MaxPerTeam, personal ones against MaxPerUser
+func (s *StackService) ensureQuota(ctx context.Context, userID, teamID, ownerTeamID int64) error {
 	activeStacks, err := s.ListUserStacks(ctx, userID)
 	if err != nil {
 		return fmt.Errorf("stack.GetOrCreateStack list: %w", err)
 	}
 
-	if len(activeStacks) >= s.cfg.MaxPerUser {
+	personal, team := 0, 0
+	for _, active := range activeStacks {
+		switch {
+		case !active.Provisioned() && active.Status == models.StackStatusFailed:
+			continue
+		case active.TeamID == 0 && active.UserID == userID:
+			personal++
+		case active.TeamID != 0 && active.TeamID == teamID:
+			team++
+		}
+	}
+
+	if ownerTeamID > 0 && team >= s.cfg.MaxPerTeam {
+		return ErrStackLimitReached
+	}
+
+	if ownerTeamID == 0 && personal >= s.cfg.MaxPerUser {
 		return ErrStackLimitReached
 	}
 
 	return nil
 }
 
-func (s *StackService) createStack(ctx context.Context, userID, challengeID int64, targetPort int, podSpec string) (*models.Stack, error) {
-	info, err := s.client.CreateStack(ctx, targetPort, podSpec)
-	if err != nil {
-		return nil, mapProvisionerError(err)
+// Inserts a pending row and provisions it inline, or queues it when workers run. With capacity limits the row
+// is inserted as waiting and started once admitted. The unique indexes on (user, challenge) and (team, challenge) let concurrent creates
+// settle on one row before any instance exists.
+func (s *StackService) createStack(ctx context.Context, userID, teamID, ownerTeamID, challengeID int64, targetPort int) (*models.Stack, error) {
+	status := models.StackStatusPending
+	if s.capacityLimited() {
+		status = models.StackStatusWaiting
 	}
 
 	now := time.Now().UTC()
 	stackModel := &models.Stack{
-		UserID:       userID,
-		ChallengeID:  challengeID,
-		StackID:      info.StackID,
-		Status:       info.Status,
-		NodePublicIP: nullIfEmpty(info.NodePublicIP),
-		NodePort:     intPtrOrNil(info.NodePort),
-		TargetPort:   info.TargetPort,
-		TTLExpiresAt: timePtr(info.TTLExpiresAt),
-		CreatedAt:    now,
-		UpdatedAt:    now,
+		UserID:      userID,
+		TeamID:      ownerTeamID,
+		ChallengeID: challengeID,
+		Status:      status,
+		TargetPort:  targetPort,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
 	if err := s.stackRepo.Create(ctx, stackModel); err != nil {
+		if db.IsUniqueViolation(err) {
+			existing, lookupErr := s.stackRepo.GetVisible(ctx, userID, teamID, challengeID)
+			if lookupErr == nil {
+				return existing, nil
+			}
+		}
+
 		return nil, fmt.Errorf("stack.GetOrCreateStack create: %w", err)
 	}
 
-	return stackModel, nil
+	if stackModel.Status == models.StackStatusWaiting {
+		if err := s.admitWaiting(ctx); err != nil {
+			return nil, err
+		}
+
+		return s.reloadStack(ctx, stackModel.ID)
+	}
+
+	if s.jobs != nil {
+		s.enqueue(stackModel.ID)
+		return stackModel, nil
+	}
+
+	provisioned, err := s.provision(ctx, stackModel.ID)
+	if err != nil {
+		_ = s.stackRepo.Delete(ctx, stackModel)
+		return nil, err
+	}
+
+	return provisioned, nil
+}
+
+func (s *StackService) reloadStack(ctx context.Context, id int64) (*models.Stack, error) {
+	existing, err := s.stackRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, ErrStackNotFound
+		}
+
+		return nil, fmt.Errorf("stack.reloadStack: %w", err)
+	}
+
+	return s.refreshStack(ctx, existing)
 }
 
 func (s *StackService) refreshStack(ctx context.Context, existing *models.Stack) (*models.Stack, error) {
+	if existing.Status == models.StackStatusWaiting {
+		position, err := s.stackRepo.WaitingPosition(ctx, existing)
+		if err != nil {
+			return nil, fmt.Errorf("stack.refreshStack position: %w", err)
+		}
+
+		existing.QueuePosition = position
+		return existing, nil
+	}
+
+	if !existing.Provisioned() || s.statusFresh(existing) {
+		return existing, nil
+	}
+
 	status, err := s.client.GetStackStatus(ctx, existing.StackID)
 	if err != nil {
 		if errors.Is(err, stack.ErrNotFound) {
@@ -328,6 +595,11 @@ func (s *StackService) refreshStack(ctx context.Context, existing *models.Stack)
 	return existing, nil
 }
 
+// Rows synced within StatusMaxAge, by a callback or an earlier poll, skip the provisioner. Stacks still starting are always polled.
+func (s *StackService) statusFresh(existing *models.Stack) bool {
+	return s.cfg.StatusMaxAge > 0 && !stackInProgress(existing.Status) && time.Since(existing.UpdatedAt) < s.cfg.StatusMaxAge
+}
+
 func isTerminalStackStatus(status string) bool {
 	switch status {
 	case "stopped", "failed", "node_deleted":
@@ -337,14 +609,15 @@ func isTerminalStackStatus(status string) bool {
 	}
 }
 
+// Keeps the provisioner error in the chain so its details reach the logs and the failed row
 func mapProvisionerError(err error) error {
 	switch {
 	case errors.Is(err, stack.ErrNotFound):
-		return ErrStackNotFound
+		return fmt.Errorf("%w: %w", ErrStackNotFound, err)
 	case errors.Is(err, stack.ErrInvalid):
-		return ErrStackInvalidSpec
+		return fmt.Errorf("%w: %w", ErrStackInvalidSpec, err)
 	case errors.Is(err, stack.ErrUnavailable):
-		return ErrStackProvisionerDown
+		return fmt.Errorf("%w: %w", ErrStackProvisionerDown, err)
 	default:
 		return fmt.Errorf("stack provisioner: %w", err)
 	}
@@ -373,7 +646,3 @@ func timePtr(value time.Time) *time.Time {
 
 	return &value
 }
-
-func stackRateLimitKey(userID int64) string {
-	return "stack:create:" + strconv.FormatInt(userID, 10)
-}
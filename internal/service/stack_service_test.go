@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -244,3 +245,290 @@ func TestStackServiceAlreadySolvedDeletesExisting(t *testing.T) {
 		t.Fatalf("expected stack deleted, got %v", err)
 	}
 }
+
+func TestStackServiceExtendStack(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	var requested []time.Time
+	mock := &stack.MockClient{
+		ExtendStackFn: func(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*stack.StackStatus, error) {
+			requested = append(requested, ttlExpiresAt)
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80, TTL: ttlExpiresAt}, nil
+		},
+	}
+
+	cfg := config.StackConfig{
+		Enabled:        true,
+		MaxPerUser:     2,
+		CreateWindow:   time.Minute,
+		CreateMax:      5,
+		ExtendDuration: 30 * time.Minute,
+		ExtendMax:      3,
+		MaxLifetime:    90 * time.Minute,
+	}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+
+	created := time.Now().UTC().Truncate(time.Second)
+	row := createStackRow(t, stackRepo, 1, challenge.ID, "stack-ext", created.Add(80*time.Minute))
+	row.CreatedAt = created
+	if err := stackRepo.Update(context.Background(), row); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	extended, err := stackSvc.ExtendStack(context.Background(), 1, challenge.ID)
+	if err != nil {
+		t.Fatalf("extend: %v", err)
+	}
+
+	if extended.ExtendCount != 1 || !extended.TTLExpiresAt.Equal(requested[0]) {
+		t.Fatalf("unexpected stack after extend: %+v", extended)
+	}
+
+	if got := requested[0].Sub(created); got != 90*time.Minute {
+		t.Fatalf("expected ttl capped at lifetime, got %v", got)
+	}
+
+	if _, err := stackSvc.ExtendStack(context.Background(), 1, challenge.ID); !errors.Is(err, ErrStackExtendLimit) {
+		t.Fatalf("expected lifetime limit, got %v", err)
+	}
+
+	if len(requested) != 1 {
+		t.Fatalf("expected single provisioner call, got %d", len(requested))
+	}
+
+	if _, err := stackSvc.ExtendStack(context.Background(), 2, challenge.ID); !errors.Is(err, ErrStackNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestStackServiceExtendStackCountLimit(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	mock := &stack.MockClient{
+		ExtendStackFn: func(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*stack.StackStatus, error) {
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80, TTL: ttlExpiresAt}, nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 2, CreateWindow: time.Minute, CreateMax: 5, ExtendDuration: time.Minute, ExtendMax: 1, MaxLifetime: time.Hour}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+	createStackRow(t, stackRepo, 1, challenge.ID, "stack-ext", time.Now().UTC().Add(10*time.Minute))
+
+	if _, err := stackSvc.ExtendStack(context.Background(), 1, challenge.ID); err != nil {
+		t.Fatalf("extend: %v", err)
+	}
+
+	if _, err := stackSvc.ExtendStack(context.Background(), 1, challenge.ID); !errors.Is(err, ErrStackExtendLimit) {
+		t.Fatalf("expected extend limit, got %v", err)
+	}
+}
+
+func TestStackServiceExtendStackReservesCount(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	entered := make(chan struct{})
+	proceed := make(chan error)
+	mock := &stack.MockClient{
+		ExtendStackFn: func(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*stack.StackStatus, error) {
+			entered <- struct{}{}
+			if err := <-proceed; err != nil {
+				return nil, err
+			}
+
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80, TTL: ttlExpiresAt}, nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 2, CreateWindow: time.Minute, CreateMax: 5, ExtendDuration: time.Minute, ExtendMax: 1, MaxLifetime: time.Hour}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+	createStackRow(t, stackRepo, 1, challenge.ID, "stack-ext", time.Now().UTC().Add(10*time.Minute))
+
+	extend := func() <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := stackSvc.ExtendStack(context.Background(), 1, challenge.ID)
+			done <- err
+		}()
+		<-entered
+		return done
+	}
+
+	// A failed provisioner call gives the extension back
+	first := extend()
+	proceed <- stack.ErrUnavailable
+	if err := <-first; !errors.Is(err, ErrStackProvisionerDown) {
+		t.Fatalf("expected provisioner down, got %v", err)
+	}
+
+	// While one extension is in flight the next one is refused
+	second := extend()
+	if _, err := stackSvc.ExtendStack(context.Background(), 1, challenge.ID); !errors.Is(err, ErrStackExtendLimit) {
+		t.Fatalf("expected extend limit while reserved, got %v", err)
+	}
+
+	proceed <- nil
+	if err := <-second; err != nil {
+		t.Fatalf("extend: %v", err)
+	}
+
+	row, err := stackRepo.GetByStackID(context.Background(), "stack-ext")
+	if err != nil {
+		t.Fatalf("get stack: %v", err)
+	}
+
+	if row.ExtendCount != 1 {
+		t.Fatalf("expected one extension stored, got %d", row.ExtendCount)
+	}
+}
+
+func TestStackServiceRestartStack(t *testing.T) {
+	env := setupServiceTest(t)
+	challenge := createStackChallenge(t, env, "stack")
+
+	restarts := 0
+	mock := &stack.MockClient{
+		RestartStackFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			restarts++
+			if stackID == "stack-gone" {
+				return nil, stack.ErrNotFound
+			}
+
+			return &stack.StackStatus{StackID: stackID, Status: "creating", TargetPort: 80, NodePort: 31002, TTL: time.Now().UTC().Add(time.Hour)}, nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 2, CreateWindow: time.Minute, CreateMax: 1}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+	createStackRow(t, stackRepo, 1, challenge.ID, "stack-restart", time.Now().UTC().Add(time.Hour))
+	createStackRow(t, stackRepo, 2, challenge.ID, "stack-gone", time.Now().UTC().Add(time.Hour))
+
+	for i := 0; i < 3; i++ {
+		restarted, err := stackSvc.RestartStack(context.Background(), 1, challenge.ID)
+		if err != nil {
+			t.Fatalf("restart %d: %v", i, err)
+		}
+
+		if restarted.Status != "creating" || restarted.NodePort == nil || *restarted.NodePort != 31002 {
+			t.Fatalf("unexpected stack after restart: %+v", restarted)
+		}
+	}
+
+	if _, err := stackSvc.RestartStack(context.Background(), 2, challenge.ID); !errors.Is(err, ErrStackNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if _, err := stackRepo.GetByStackID(context.Background(), "stack-gone"); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("expected forgotten stack removed, got %v", err)
+	}
+
+	if restarts != 4 {
+		t.Fatalf("expected 4 restarts, got %d", restarts)
+	}
+}
+
+func TestStackServiceTeamSharedStacks(t *testing.T) {
+	env := setupServiceTest(t)
+	team := createTeam(t, env, "red")
+	alice := createUserWithTeam(t, env, "alice@example.com", "alice", "pass", "user", team.ID)
+	bob := createUserWithTeam(t, env, "bob@example.com", "bob", "pass", "user", team.ID)
+	carol := createUser(t, env, "carol@example.com", "carol", "pass", "user")
+
+	shared := createStackChallenge(t, env, "shared")
+	shared.StackTeamShared = true
+	if err := env.challengeRepo.Update(context.Background(), shared); err != nil {
+		t.Fatalf("update challenge: %v", err)
+	}
+
+	otherShared := createStackChallenge(t, env, "other shared")
+	otherShared.StackTeamShared = true
+	if err := env.challengeRepo.Update(context.Background(), otherShared); err != nil {
+		t.Fatalf("update challenge: %v", err)
+	}
+
+	personal := createStackChallenge(t, env, "personal")
+
+	createCalls := 0
+	deleted := make(map[string]bool)
+	mock := &stack.MockClient{
+		CreateStackFn: func(ctx context.Context, targetPort int, podSpec string) (*stack.StackInfo, error) {
+			createCalls++
+			return &stack.StackInfo{StackID: fmt.Sprintf("stack-%d", createCalls), Status: "running", TargetPort: targetPort, TTLExpiresAt: time.Now().UTC().Add(time.Hour)}, nil
+		},
+		GetStackStatusFn: func(ctx context.Context, stackID string) (*stack.StackStatus, error) {
+			if deleted[stackID] {
+				return nil, stack.ErrNotFound
+			}
+
+			return &stack.StackStatus{StackID: stackID, Status: "running", TargetPort: 80, TTL: time.Now().UTC().Add(time.Hour)}, nil
+		},
+		DeleteStackFn: func(ctx context.Context, stackID string) error {
+			deleted[stackID] = true
+			return nil
+		},
+	}
+
+	cfg := config.StackConfig{Enabled: true, MaxPerUser: 1, MaxPerTeam: 1, CreateWindow: time.Minute, CreateMax: 5}
+	stackSvc, stackRepo := newStackService(env, mock, cfg)
+
+	teamStack, err := stackSvc.GetOrCreateStack(context.Background(), alice.ID, shared.ID)
+	if err != nil {
+		t.Fatalf("alice create: %v", err)
+	}
+
+	if teamStack.TeamID != team.ID || teamStack.UserID != alice.ID {
+		t.Fatalf("expected team stack, got %+v", teamStack)
+	}
+
+	bobStack, err := stackSvc.GetOrCreateStack(context.Background(), bob.ID, shared.ID)
+	if err != nil {
+		t.Fatalf("bob create: %v", err)
+	}
+
+	if bobStack.StackID != teamStack.StackID || createCalls != 1 {
+		t.Fatalf("expected shared instance, got %s after %d creates", bobStack.StackID, createCalls)
+	}
+
+	if _, err := stackSvc.GetStack(context.Background(), carol.ID, shared.ID); !errors.Is(err, ErrStackNotFound) {
+		t.Fatalf("expected other team not to see stack, got %v", err)
+	}
+
+	if _, err := stackSvc.GetOrCreateStack(context.Background(), bob.ID, otherShared.ID); !errors.Is(err, ErrStackLimitReached) {
+		t.Fatalf("expected team quota, got %v", err)
+	}
+
+	// The team stack does not use up bob's personal quota
+	if _, err := stackSvc.GetOrCreateStack(context.Background(), bob.ID, personal.ID); err != nil {
+		t.Fatalf("bob personal create: %v", err)
+	}
+
+	stacks, err := stackSvc.ListUserStacks(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if len(stacks) != 2 {
+		t.Fatalf("expected team and personal stack, got %+v", stacks)
+	}
+
+	// A personal stack left over from before the challenge became shared
+	leftover := createStackRow(t, stackRepo, alice.ID, shared.ID, "stack-leftover", time.Now().UTC().Add(time.Hour))
+
+	if err := stackSvc.DeleteSolvedStacks(context.Background(), bob.ID, shared.ID); err != nil {
+		t.Fatalf("delete solved: %v", err)
+	}
+
+	if !deleted[teamStack.StackID] || !deleted[leftover.StackID] {
+		t.Fatalf("expected team and member stacks deleted, got %v", deleted)
+	}
+
+	if _, err := stackSvc.GetStack(context.Background(), alice.ID, shared.ID); !errors.Is(err, ErrStackNotFound) {
+		t.Fatalf("expected stack gone for alice, got %v", err)
+	}
+
+	if _, err := stackSvc.GetStack(context.Background(), bob.ID, personal.ID); err != nil {
+		t.Fatalf("expected unrelated stack kept, got %v", err)
+	}
+}
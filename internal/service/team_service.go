@@ -13,11 +13,12 @@ import (
 )
 
 type TeamService struct {
-	teamRepo *repo.TeamRepo
+	teamRepo     *repo.TeamRepo
+	divisionRepo *repo.DivisionRepo
 }
 
-func NewTeamService(teamRepo *repo.TeamRepo) *TeamService {
-	return &TeamService{teamRepo: teamRepo}
+func NewTeamService(teamRepo *repo.TeamRepo, divisionRepo *repo.DivisionRepo) *TeamService {
+	return &TeamService{teamRepo: teamRepo, divisionRepo: divisionRepo}
 }
 
 func (s *TeamService) CreateTeam(ctx context.Context, name string) (*models.Team, error) {
@@ -44,6 +45,212 @@ func (s *TeamService) CreateTeam(ctx context.Context, name string) (*models.Team
 	return team, nil
 }
 
+func (s *TeamService) RenameTeam(ctx context.Context, id int64, name string) (*models.Team, error) {
+	name = strings.TrimSpace(name)
+	validator := newFieldValidator()
+	validator.PositiveID("id", id)
+	validator.Required("name", name)
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := s.teamRepo.UpdateName(ctx, id, name); err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, NewValidationError(FieldError{Field: "name", Reason: "duplicate"})
+		}
+
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, repo.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("team.RenameTeam: %w", err)
+	}
+
+	team, err := s.teamRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("team.RenameTeam lookup: %w", err)
+	}
+
+	return team, nil
+}
+
+// Only empty teams can be deleted. Their registration keys are revoked by the actor.
+func (s *TeamService) DeleteTeam(ctx context.Context, actorID, id int64) error {
+	validator := newFieldValidator()
+	validator.PositiveID("id", id)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	deleted, err := s.teamRepo.DeleteIfEmpty(ctx, id, actorID)
+	if err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return repo.ErrNotFound
+		}
+
+		return fmt.Errorf("team.DeleteTeam: %w", err)
+	}
+
+	if !deleted {
+		return ErrTeamNotEmpty
+	}
+
+	return nil
+}
+
+// When the user and the new team solved the same challenge, only the earliest correct submission is kept,
+// whoever made it, so the team scores each challenge once
+func (s *TeamService) MoveUser(ctx context.Context, userID, teamID int64) error {
+	validator := newFieldValidator()
+	validator.PositiveID("id", userID)
+	validator.PositiveID("team_id", teamID)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	if _, err := s.teamRepo.GetByID(ctx, teamID); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return NewValidationError(FieldError{Field: "team_id", Reason: "invalid"})
+		}
+
+		return fmt.Errorf("team.MoveUser team lookup: %w", err)
+	}
+
+	if err := s.teamRepo.MoveUser(ctx, userID, teamID); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return repo.ErrNotFound
+		}
+
+		return fmt.Errorf("team.MoveUser: %w", err)
+	}
+
+	return nil
+}
+
+// Moves members and registration keys of sourceID into id, then deletes sourceID
+func (s *TeamService) MergeTeams(ctx context.Context, id, sourceID int64) (*models.TeamSummary, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("id", id)
+	validator.PositiveID("source_team_id", sourceID)
+	if id > 0 && id == sourceID {
+		validator.fields = append(validator.fields, FieldError{Field: "source_team_id", Reason: "must differ from target"})
+	}
+
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureTeamExists(ctx, id, "team.MergeTeams"); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.teamRepo.GetByID(ctx, sourceID); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, NewValidationError(FieldError{Field: "source_team_id", Reason: "invalid"})
+		}
+
+		return nil, fmt.Errorf("team.MergeTeams source lookup: %w", err)
+	}
+
+	if err := s.teamRepo.Merge(ctx, id, sourceID); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, repo.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("team.MergeTeams: %w", err)
+	}
+
+	return s.GetTeam(ctx, id)
+}
+
+// Division 0 takes the team out of its division
+func (s *TeamService) SetTeamDivision(ctx context.Context, id, divisionID int64) (*models.TeamSummary, error) {
+	validator := newFieldValidator()
+	validator.PositiveID("id", id)
+	if divisionID != 0 {
+		validator.PositiveID("division_id", divisionID)
+	}
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureTeamExists(ctx, id, "team.SetTeamDivision"); err != nil {
+		return nil, err
+	}
+
+	if divisionID != 0 {
+		if _, err := s.divisionRepo.GetByID(ctx, divisionID); err != nil {
+			if errors.Is(err, repo.ErrNotFound) {
+				return nil, NewValidationError(FieldError{Field: "division_id", Reason: "invalid"})
+			}
+
+			return nil, fmt.Errorf("team.SetTeamDivision division lookup: %w", err)
+		}
+	}
+
+	if err := s.teamRepo.UpdateDivision(ctx, id, divisionID); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, repo.ErrNotFound
+		}
+
+		return nil, fmt.Errorf("team.SetTeamDivision: %w", err)
+	}
+
+	return s.GetTeam(ctx, id)
+}
+
+func (s *TeamService) CreateDivision(ctx context.Context, name string) (*models.Division, error) {
+	name = strings.TrimSpace(name)
+	validator := newFieldValidator()
+	validator.Required("name", name)
+	if err := validator.Error(); err != nil {
+		return nil, err
+	}
+
+	division := &models.Division{
+		Name:      name,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.divisionRepo.Create(ctx, division); err != nil {
+		if db.IsUniqueViolation(err) {
+			return nil, NewValidationError(FieldError{Field: "name", Reason: "duplicate"})
+		}
+
+		return nil, fmt.Errorf("team.CreateDivision: %w", err)
+	}
+
+	return division, nil
+}
+
+func (s *TeamService) ListDivisions(ctx context.Context) ([]models.DivisionSummary, error) {
+	rows, err := s.divisionRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("team.ListDivisions: %w", err)
+	}
+
+	return rows, nil
+}
+
+// Teams and registration keys in the division are left without one
+func (s *TeamService) DeleteDivision(ctx context.Context, id int64) error {
+	validator := newFieldValidator()
+	validator.PositiveID("id", id)
+	if err := validator.Error(); err != nil {
+		return err
+	}
+
+	if err := s.divisionRepo.Delete(ctx, id); err != nil {
+		if errors.Is(err, repo.ErrNotFound) {
+			return repo.ErrNotFound
+		}
+
+		return fmt.Errorf("team.DeleteDivision: %w", err)
+	}
+
+	return nil
+}
+
 func (s *TeamService) ListTeams(ctx context.Context) ([]models.TeamSummary, error) {
 	rows, err := s.teamRepo.ListWithStats(ctx)
 	if err != nil {
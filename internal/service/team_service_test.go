@@ -102,3 +102,170 @@ func TestTeamServiceSolvedInvalidID(t *testing.T) {
 		t.Fatalf("expected validation error, got %v", err)
 	}
 }
+
+func TestTeamServiceRenameTeam(t *testing.T) {
+	env := setupServiceTest(t)
+	alpha := createTeam(t, env, "Alpha")
+	_ = createTeam(t, env, "Beta")
+
+	team, err := env.teamSvc.RenameTeam(context.Background(), alpha.ID, "  Alpha Prime ")
+	if err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	if team.Name != "Alpha Prime" {
+		t.Fatalf("unexpected team: %+v", team)
+	}
+
+	_, err = env.teamSvc.RenameTeam(context.Background(), alpha.ID, "Beta")
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "duplicate" {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+
+	if _, err := env.teamSvc.RenameTeam(context.Background(), 999, "Ghost"); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTeamServiceDeleteTeam(t *testing.T) {
+	env := setupServiceTest(t)
+	team := createTeam(t, env, "Alpha")
+	_ = createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", team.ID)
+	empty := createTeam(t, env, "Empty")
+
+	if err := env.teamSvc.DeleteTeam(context.Background(), 1, team.ID); !errors.Is(err, ErrTeamNotEmpty) {
+		t.Fatalf("expected ErrTeamNotEmpty, got %v", err)
+	}
+
+	if err := env.teamSvc.DeleteTeam(context.Background(), 1, empty.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if err := env.teamSvc.DeleteTeam(context.Background(), 1, empty.ID); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTeamServiceMoveUser(t *testing.T) {
+	env := setupServiceTest(t)
+	alpha := createTeam(t, env, "Alpha")
+	beta := createTeam(t, env, "Beta")
+	user := createUserWithTeam(t, env, "u1@example.com", "u1", "pass", "user", alpha.ID)
+
+	if err := env.teamSvc.MoveUser(context.Background(), user.ID, beta.ID); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+
+	members, err := env.teamSvc.ListMembers(context.Background(), beta.ID)
+	if err != nil {
+		t.Fatalf("list members: %v", err)
+	}
+
+	if len(members) != 1 || members[0].ID != user.ID {
+		t.Fatalf("expected user in new team, got %+v", members)
+	}
+
+	err = env.teamSvc.MoveUser(context.Background(), user.ID, 999)
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "team_id" {
+		t.Fatalf("expected team_id validation error, got %v", err)
+	}
+
+	if err := env.teamSvc.MoveUser(context.Background(), 999, beta.ID); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTeamServiceMergeTeams(t *testing.T) {
+	env := setupServiceTest(t)
+	target := createTeam(t, env, "Target")
+	source := createTeam(t, env, "Source")
+	userT := createUserWithTeam(t, env, "t@example.com", "target", "pass", "user", target.ID)
+	userS := createUserWithTeam(t, env, "s@example.com", "source", "pass", "user", source.ID)
+	challenge := createChallenge(t, env, "Shared", 100, "flag{shared}", true)
+
+	now := time.Now().UTC()
+	_ = createSubmission(t, env, userT.ID, challenge.ID, true, now.Add(-2*time.Minute))
+	_ = createSubmission(t, env, userS.ID, challenge.ID, true, now.Add(-time.Minute))
+
+	_, err := env.teamSvc.MergeTeams(context.Background(), target.ID, target.ID)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	summary, err := env.teamSvc.MergeTeams(context.Background(), target.ID, source.ID)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	if summary.MemberCount != 2 || summary.TotalScore != 100 {
+		t.Fatalf("expected merged team with one solve, got %+v", summary)
+	}
+
+	_, err = env.teamSvc.MergeTeams(context.Background(), target.ID, source.ID)
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "source_team_id" {
+		t.Fatalf("expected source_team_id validation error, got %v", err)
+	}
+}
+
+func TestTeamServiceDivisions(t *testing.T) {
+	env := setupServiceTest(t)
+	team := createTeam(t, env, "Alpha")
+
+	if _, err := env.teamSvc.CreateDivision(context.Background(), " "); err == nil {
+		t.Fatalf("expected validation error")
+	}
+
+	division, err := env.teamSvc.CreateDivision(context.Background(), "High School")
+	if err != nil {
+		t.Fatalf("create division: %v", err)
+	}
+
+	_, err = env.teamSvc.CreateDivision(context.Background(), "High School")
+	var ve *ValidationError
+	if !errors.As(err, &ve) || ve.Fields[0].Reason != "duplicate" {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+
+	_, err = env.teamSvc.SetTeamDivision(context.Background(), team.ID, division.ID+100)
+	if !errors.As(err, &ve) || ve.Fields[0].Field != "division_id" {
+		t.Fatalf("expected invalid division, got %v", err)
+	}
+
+	summary, err := env.teamSvc.SetTeamDivision(context.Background(), team.ID, division.ID)
+	if err != nil {
+		t.Fatalf("set division: %v", err)
+	}
+
+	if summary.DivisionID != division.ID || summary.DivisionName != "High School" {
+		t.Fatalf("unexpected team: %+v", summary)
+	}
+
+	divisions, err := env.teamSvc.ListDivisions(context.Background())
+	if err != nil {
+		t.Fatalf("list divisions: %v", err)
+	}
+
+	if len(divisions) != 1 || divisions[0].TeamCount != 1 {
+		t.Fatalf("unexpected divisions: %+v", divisions)
+	}
+
+	if err := env.teamSvc.DeleteDivision(context.Background(), division.ID); err != nil {
+		t.Fatalf("delete division: %v", err)
+	}
+
+	if err := env.teamSvc.DeleteDivision(context.Background(), division.ID); !errors.Is(err, repo.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	summary, err = env.teamSvc.GetTeam(context.Background(), team.ID)
+	if err != nil {
+		t.Fatalf("get team: %v", err)
+	}
+
+	if summary.DivisionID != 0 {
+		t.Fatalf("expected division cleared, got %d", summary.DivisionID)
+	}
+}
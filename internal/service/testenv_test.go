@@ -35,6 +35,8 @@ type serviceEnv struct {
 	authSvc        *AuthService
 	ctfSvc         *CTFService
 	teamSvc        *TeamService
+	apiTokenSvc    *APITokenService
+	appConfigSvc   *AppConfigService
 }
 
 var (
@@ -189,9 +191,11 @@ func setupServiceTest(t *testing.T) serviceEnv {
 
 	fileStore := storage.NewMemoryChallengeFileStore(10 * time.Minute)
 
-	authSvc := NewAuthService(serviceCfg, serviceDB, userRepo, regRepo, teamRepo, serviceRedis)
-	teamSvc := NewTeamService(teamRepo)
+	appConfigSvc := NewAppConfigService(repo.NewAppConfigRepo(serviceDB), serviceRedis, serviceCfg.Cache.AppConfigTTL)
+	authSvc := NewAuthService(serviceCfg, serviceDB, userRepo, regRepo, teamRepo, repo.NewLoginFailureRepo(serviceDB), appConfigSvc, serviceRedis)
+	teamSvc := NewTeamService(teamRepo, repo.NewDivisionRepo(serviceDB))
 	ctfSvc := NewCTFService(serviceCfg, challengeRepo, submissionRepo, serviceRedis, fileStore)
+	apiTokenSvc := NewAPITokenService(repo.NewAPITokenRepo(serviceDB), userRepo)
 
 	return serviceEnv{
 		cfg:            serviceCfg,
@@ -205,13 +209,15 @@ func setupServiceTest(t *testing.T) serviceEnv {
 		authSvc:        authSvc,
 		ctfSvc:         ctfSvc,
 		teamSvc:        teamSvc,
+		apiTokenSvc:    apiTokenSvc,
+		appConfigSvc:   appConfigSvc,
 	}
 }
 
 func resetServiceState(t *testing.T) {
 	t.Helper()
 
-	if _, err := serviceDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, stacks, challenges, users, teams RESTART IDENTITY CASCADE"); err != nil {
+	if _, err := serviceDB.ExecContext(context.Background(), "TRUNCATE TABLE app_configs, submissions, registration_keys, api_tokens, login_failures, stacks, challenges, users, teams, divisions RESTART IDENTITY CASCADE"); err != nil {
 		t.Fatalf("truncate tables: %v", err)
 	}
 
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"smctf/internal/auth"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisRevokedSessionPrefix   = "revoked_session:"
+	redisTokensValidAfterPrefix = "tokens_valid_after:"
+	maxRevocationCacheEntries   = 10000
+)
+
+func revokedSessionKey(sessionID string) string {
+	return redisRevokedSessionPrefix + sessionID
+}
+
+func tokensValidAfterKey(userID int64) string {
+	return redisTokensValidAfterPrefix + strconv.FormatInt(userID, 10)
+}
+
+type revocationEntry struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// In-process cache of revocation markers, so access checks skip Redis for a short while
+type revocationCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]revocationEntry
+}
+
+func newRevocationCache(ttl time.Duration) *revocationCache {
+	return &revocationCache{ttl: ttl, entries: make(map[string]revocationEntry)}
+}
+
+func (c *revocationCache) get(key string, now time.Time) (int64, bool) {
+	if c.ttl <= 0 {
+		return 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		return 0, false
+	}
+
+	return entry.value, true
+}
+
+func (c *revocationCache) set(key string, value int64, now time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= maxRevocationCacheEntries {
+		c.entries = make(map[string]revocationEntry)
+	}
+
+	c.entries[key] = revocationEntry{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *revocationCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]revocationEntry)
+}
+
+// Reports whether an access token was revoked by session or by a per-user cutoff
+func (s *AuthService) IsAccessRevoked(ctx context.Context, claims *auth.Claims) (bool, error) {
+	now := time.Now()
+	userKey := tokensValidAfterKey(claims.UserID)
+	keys := []string{userKey}
+
+	if claims.SessionID != "" {
+		keys = append(keys, revokedSessionKey(claims.SessionID))
+	}
+
+	values := make([]int64, len(keys))
+	missing := make([]string, 0, len(keys))
+	missingIdx := make([]int, 0, len(keys))
+
+	for i, key := range keys {
+		if v, ok := s.revocations.get(key, now); ok {
+			values[i] = v
+			continue
+		}
+
+		missing = append(missing, key)
+		missingIdx = append(missingIdx, i)
+	}
+
+	if len(missing) > 0 {
+		rows, err := s.redis.MGet(ctx, missing...).Result()
+		if err != nil && err != redis.Nil {
+			return false, fmt.Errorf("auth.IsAccessRevoked: %w", err)
+		}
+
+		for j, row := range rows {
+			var v int64
+			if str, ok := row.(string); ok {
+				v, _ = strconv.ParseInt(str, 10, 64)
+			}
+
+			values[missingIdx[j]] = v
+			s.revocations.set(missing[j], v, now)
+		}
+	}
+
+	if len(values) > 1 && values[1] != 0 {
+		return true, nil
+	}
+
+	if validAfter := values[0]; validAfter != 0 {
+		if claims.IssuedAt == nil || claims.IssuedAt.Unix() < validAfter {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Revokes all sessions and every access token issued to the user so far
+func (s *AuthService) RevokeUser(ctx context.Context, userID int64) (int, error) {
+	revoked, err := s.RevokeAllSessions(ctx, userID, "")
+	if err != nil {
+		return revoked, err
+	}
+
+	if err := s.revokeAccessTokens(ctx, userID); err != nil {
+		return revoked, fmt.Errorf("auth.RevokeUser: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// iat only has second precision, so the cutoff is the next second. Tokens issued later in the same second
+// are rejected too and have to be refreshed.
+func (s *AuthService) revokeAccessTokens(ctx context.Context, userID int64) error {
+	if err := s.redis.Set(ctx, tokensValidAfterKey(userID), time.Now().Unix()+1, s.cfg.JWT.AccessTTL).Err(); err != nil {
+		return err
+	}
+
+	s.revocations.clear()
+
+	return nil
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"net/mail"
 	"strings"
+	"unicode/utf8"
 )
 
 type fieldValidator struct {
@@ -41,6 +42,12 @@ func (v *fieldValidator) Email(field, value string) {
 	}
 }
 
+func (v *fieldValidator) MaxLength(field, value string, limit int) {
+	if utf8.RuneCountInString(value) > limit {
+		v.fields = append(v.fields, FieldError{Field: field, Reason: "too long"})
+	}
+}
+
 func (v *fieldValidator) Error() error {
 	if len(v.fields) == 0 {
 		return nil
@@ -0,0 +1,50 @@
+package stack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrCallbackSignature = errors.New("invalid callback signature")
+
+const (
+	callbackTolerance = 5 * time.Minute
+	signaturePrefix   = "sha256="
+)
+
+// Signs a status callback body for the given unix timestamp, as sent in the X-Stack-Signature header
+func SignCallback(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Checks the signature and that the timestamp is within 5 minutes of now
+func VerifyCallback(secret, timestamp, signature string, body []byte, now time.Time) error {
+	if secret == "" || timestamp == "" || !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrCallbackSignature
+	}
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrCallbackSignature
+	}
+
+	if age := now.Sub(time.Unix(sent, 0)); age > callbackTolerance || age < -callbackTolerance {
+		return ErrCallbackSignature
+	}
+
+	if !hmac.Equal([]byte(SignCallback(secret, timestamp, body)), []byte(signature)) {
+		return ErrCallbackSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package stack
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyCallback(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"stack_id":"stack-1","status":"running"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		ok        bool
+	}{
+		{name: "valid", secret: "secret", timestamp: timestamp, signature: SignCallback("secret", timestamp, body), ok: true},
+		{name: "wrong secret", secret: "secret", timestamp: timestamp, signature: SignCallback("other", timestamp, body)},
+		{name: "stale", secret: "secret", timestamp: stale, signature: SignCallback("secret", stale, body)},
+		{name: "bad timestamp", secret: "secret", timestamp: "soon", signature: SignCallback("secret", "soon", body)},
+		{name: "missing prefix", secret: "secret", timestamp: timestamp, signature: SignCallback("secret", timestamp, body)[len("sha256="):]},
+		{name: "no secret", secret: "", timestamp: timestamp, signature: SignCallback("", timestamp, body)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyCallback(tt.secret, tt.timestamp, tt.signature, body, now)
+			if tt.ok && err != nil {
+				t.Fatalf("expected valid signature, got %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrCallbackSignature) {
+				t.Fatalf("expected ErrCallbackSignature, got %v", err)
+			}
+		})
+	}
+}
@@ -3,10 +3,13 @@ package stack
 import (
 	"bytes"
 	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"strings"
 	"time"
@@ -19,16 +22,73 @@ var (
 	ErrUnexpected  = errors.New("stack provisioner error")
 )
 
+const (
+	retryBaseDelay     = 200 * time.Millisecond
+	retryMaxDelay      = 2 * time.Second
+	maxErrorBodyBytes  = 64 << 10
+	maxErrorMessageLen = 512
+)
+
 type Client struct {
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
+	retries    int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	breaker    *breaker
+}
+
+// Zero values make a single attempt per call without a circuit breaker
+type ClientPolicy struct {
+	Retries          int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Error answer of the provisioner. Unwraps to the sentinel matching its status.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details json.RawMessage
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("stack provisioner returned %d", e.Status)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return mapStatus(e.Status)
+}
+
+type idempotencyKeyCtx struct{}
+
+// Sets the Idempotency-Key sent by CreateStack, so a create repeated after a lost response returns the same stack
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key
 }
 
 type API interface {
 	CreateStack(ctx context.Context, targetPort int, podSpec string) (*StackInfo, error)
 	GetStackStatus(ctx context.Context, stackID string) (*StackStatus, error)
 	DeleteStack(ctx context.Context, stackID string) error
+	ExtendStack(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*StackStatus, error)
+	RestartStack(ctx context.Context, stackID string) (*StackStatus, error)
 }
 
 type CreateRequest struct {
@@ -36,6 +96,10 @@ type CreateRequest struct {
 	PodSpec    string `json:"pod_spec"`
 }
 
+type ExtendRequest struct {
+	TTLExpiresAt time.Time `json:"ttl_expires_at"`
+}
+
 type StackInfo struct {
 	StackID              string    `json:"stack_id"`
 	PodID                string    `json:"pod_id"`
@@ -63,7 +127,7 @@ type StackStatus struct {
 	NodePublicIP string    `json:"node_public_ip"`
 }
 
-func NewClient(baseURL, apiKey string, timeout time.Duration) *Client {
+func NewClient(baseURL, apiKey string, timeout time.Duration, policy ClientPolicy) *Client {
 	baseURL = strings.TrimRight(baseURL, "/")
 
 	return &Client{
@@ -72,13 +136,23 @@ func NewClient(baseURL, apiKey string, timeout time.Duration) *Client {
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		retries:   max(policy.Retries, 0),
+		baseDelay: retryBaseDelay,
+		maxDelay:  retryMaxDelay,
+		breaker:   newBreaker(policy.BreakerThreshold, policy.BreakerCooldown),
 	}
 }
 
+// Retried like the idempotent calls, since every attempt carries the same idempotency key
 func (c *Client) CreateStack(ctx context.Context, targetPort int, podSpec string) (*StackInfo, error) {
+	key := IdempotencyKey(ctx)
+	if key == "" {
+		key = randomKey()
+	}
+
 	reqBody := CreateRequest{TargetPort: targetPort, PodSpec: podSpec}
 	var resp StackInfo
-	if err := c.doJSON(ctx, http.MethodPost, "/stacks", reqBody, &resp); err != nil {
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/stacks", body: reqBody, out: &resp, retry: true, idempotencyKey: key}); err != nil {
 		return nil, err
 	}
 
@@ -87,7 +161,7 @@ func (c *Client) CreateStack(ctx context.Context, targetPort int, podSpec string
 
 func (c *Client) GetStack(ctx context.Context, stackID string) (*StackInfo, error) {
 	var resp StackInfo
-	if err := c.doJSON(ctx, http.MethodGet, stackPath(stackID), nil, &resp); err != nil {
+	if err := c.do(ctx, request{method: http.MethodGet, path: stackPath(stackID), out: &resp, retry: true}); err != nil {
 		return nil, err
 	}
 
@@ -96,7 +170,7 @@ func (c *Client) GetStack(ctx context.Context, stackID string) (*StackInfo, erro
 
 func (c *Client) GetStackStatus(ctx context.Context, stackID string) (*StackStatus, error) {
 	var resp StackStatus
-	if err := c.doJSON(ctx, http.MethodGet, stackStatusPath(stackID), nil, &resp); err != nil {
+	if err := c.do(ctx, request{method: http.MethodGet, path: stackStatusPath(stackID), out: &resp, retry: true}); err != nil {
 		return nil, err
 	}
 
@@ -104,51 +178,136 @@ func (c *Client) GetStackStatus(ctx context.Context, stackID string) (*StackStat
 }
 
 func (c *Client) DeleteStack(ctx context.Context, stackID string) error {
-	return c.doJSON(ctx, http.MethodDelete, stackPath(stackID), nil, nil)
+	return c.do(ctx, request{method: http.MethodDelete, path: stackPath(stackID), retry: true})
+}
+
+func (c *Client) ExtendStack(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*StackStatus, error) {
+	reqBody := ExtendRequest{TTLExpiresAt: ttlExpiresAt.UTC()}
+	var resp StackStatus
+	if err := c.do(ctx, request{method: http.MethodPost, path: stackActionPath(stackID, "extend"), body: reqBody, out: &resp, retry: true}); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) RestartStack(ctx context.Context, stackID string) (*StackStatus, error) {
+	var resp StackStatus
+	if err := c.do(ctx, request{method: http.MethodPost, path: stackActionPath(stackID, "restart"), out: &resp}); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Extend sets an absolute TTL and is safe to repeat, restart is the only call sent once
+type request struct {
+	method         string
+	path           string
+	body           any
+	out            any
+	retry          bool
+	idempotencyKey string
 }
 
-func (c *Client) doJSON(ctx context.Context, method, path string, body any, out any) error {
-	reader, err := encodeBody(body)
+func (c *Client) do(ctx context.Context, req request) error {
+	payload, err := encodeBody(req.body)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	attempts := 1
+	if req.retry {
+		attempts += c.retries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return lastErr
+			case <-time.After(c.backoff(attempt)):
+			}
+		}
+
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+
+		err := c.doJSON(ctx, req, payload)
+		c.breaker.record(classify(ctx, err))
+		if err == nil || !retryable(ctx, err) {
+			return err
+		}
+
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+// Full jitter over an exponentially growing window
+func (c *Client) backoff(attempt int) time.Duration {
+	window := min(c.baseDelay<<(attempt-1), c.maxDelay)
+	if window <= 0 {
+		return 0
+	}
+
+	return rand.N(window) + 1
+}
+
+func (c *Client) doJSON(ctx context.Context, req request, payload []byte) error {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, reader)
 	if err != nil {
 		return fmt.Errorf("stack client request: %w", err)
 	}
 
-	req.Header.Set("Accept", "application/json")
-	if body != nil {
-		req.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
 	}
 
 	if c.apiKey != "" {
-		req.Header.Set("X-API-KEY", c.apiKey)
+		httpReq.Header.Set("X-API-KEY", c.apiKey)
+	}
+
+	if req.idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", req.idempotencyKey)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("stack client request: %w", err)
+		if ctx.Err() != nil {
+			return fmt.Errorf("stack client request: %w", ctx.Err())
+		}
+
+		return fmt.Errorf("stack client request: %w: %v", ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
-	if err := handleStatus(resp.StatusCode); err != nil {
-		return err
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+		return decodeAPIError(resp.StatusCode, body)
 	}
 
-	if out == nil {
+	if req.out == nil {
 		return nil
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+	if err := json.NewDecoder(resp.Body).Decode(req.out); err != nil {
 		return fmt.Errorf("stack client decode: %w", err)
 	}
 
 	return nil
 }
 
-func encodeBody(body any) (io.Reader, error) {
+func encodeBody(body any) ([]byte, error) {
 	if body == nil {
 		return nil, nil
 	}
@@ -158,30 +317,84 @@ func encodeBody(body any) (io.Reader, error) {
 		return nil, fmt.Errorf("stack client marshal: %w", err)
 	}
 
-	return bytes.NewReader(payload), nil
+	return payload, nil
 }
 
-func handleStatus(status int) error {
-	if status >= 200 && status < 300 {
-		return nil
+// Accepts {"error", "code", "message", "details"} bodies and falls back to the raw text
+func decodeAPIError(status int, body []byte) *APIError {
+	apiErr := &APIError{Status: status}
+
+	var payload struct {
+		Error   string          `json:"error"`
+		Code    string          `json:"code"`
+		Message string          `json:"message"`
+		Details json.RawMessage `json:"details"`
+	}
+
+	if err := json.Unmarshal(body, &payload); err == nil {
+		apiErr.Code = payload.Code
+		apiErr.Message = payload.Message
+		if apiErr.Message == "" {
+			apiErr.Message = payload.Error
+		}
+		apiErr.Details = payload.Details
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	if len(apiErr.Message) > maxErrorMessageLen {
+		apiErr.Message = apiErr.Message[:maxErrorMessageLen]
 	}
 
-	return mapStatus(status)
+	return apiErr
 }
 
 func mapStatus(status int) error {
 	switch status {
 	case http.StatusNotFound:
 		return ErrNotFound
-	case http.StatusBadRequest:
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
 		return ErrInvalid
-	case http.StatusServiceUnavailable:
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
 		return ErrUnavailable
 	default:
 		return ErrUnexpected
 	}
 }
 
+// Transport failures and overload answers are worth another attempt, anything the provisioner decided on is not
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status >= 500 && apiErr.Status != http.StatusNotImplemented || apiErr.Status == http.StatusTooManyRequests
+	}
+
+	return errors.Is(err, ErrUnavailable)
+}
+
+func classify(ctx context.Context, err error) outcome {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case ctx.Err() != nil:
+		return outcomeIgnored
+	case retryable(ctx, err):
+		return outcomeFailure
+	default:
+		return outcomeSuccess
+	}
+}
+
+func randomKey() string {
+	buf := make([]byte, 16)
+	_, _ = crand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
 func stackPath(stackID string) string {
 	return fmt.Sprintf("/stacks/%s", stackID)
 }
@@ -189,3 +402,7 @@ func stackPath(stackID string) string {
 func stackStatusPath(stackID string) string {
 	return fmt.Sprintf("/stacks/%s/status", stackID)
 }
+
+func stackActionPath(stackID, action string) string {
+	return fmt.Sprintf("/stacks/%s/%s", stackID, action)
+}
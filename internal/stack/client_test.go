@@ -0,0 +1,222 @@
+package stack
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, policy ClientPolicy) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "test-key", time.Second, policy)
+	client.baseDelay = time.Millisecond
+	client.maxDelay = 5 * time.Millisecond
+	return client
+}
+
+func TestClientRetriesIdempotentCalls(t *testing.T) {
+	var calls atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"stack_id":"stack-1","status":"running"}`))
+	}, ClientPolicy{Retries: 2})
+
+	status, err := client.GetStackStatus(context.Background(), "stack-1")
+	if err != nil {
+		t.Fatalf("GetStackStatus: %v", err)
+	}
+
+	if status.Status != "running" || calls.Load() != 3 {
+		t.Fatalf("unexpected status %+v after %d calls", status, calls.Load())
+	}
+
+	calls.Store(-10)
+	if _, err := client.GetStackStatus(context.Background(), "stack-1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable once retries run out, got %v", err)
+	}
+}
+
+func TestClientDoesNotRetryRestartOrClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	status := http.StatusServiceUnavailable
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(status)
+	}, ClientPolicy{Retries: 3})
+
+	if _, err := client.RestartStack(context.Background(), "stack-1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single restart attempt, got %d", calls.Load())
+	}
+
+	calls.Store(0)
+	status = http.StatusNotFound
+	if err := client.DeleteStack(context.Background(), "stack-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single delete attempt, got %d", calls.Load())
+	}
+}
+
+func TestClientCreateIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	keys := make([]string, 0)
+	var calls atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		mu.Unlock()
+
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"stack_id":"stack-1","status":"creating"}`))
+	}, ClientPolicy{Retries: 1})
+
+	ctx := WithIdempotencyKey(context.Background(), "stack-7-1")
+	if _, err := client.CreateStack(ctx, 80, "spec"); err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	if len(keys) != 2 || keys[0] != "stack-7-1" || keys[1] != "stack-7-1" {
+		t.Fatalf("expected the same key on every attempt, got %v", keys)
+	}
+
+	keys = keys[:0]
+	if _, err := client.CreateStack(context.Background(), 80, "spec"); err != nil {
+		t.Fatalf("CreateStack: %v", err)
+	}
+
+	if len(keys) != 1 || keys[0] == "" {
+		t.Fatalf("expected a generated key, got %v", keys)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"stack_id":"stack-1","status":"running"}`))
+	}, ClientPolicy{BreakerThreshold: 2, BreakerCooldown: time.Minute})
+
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetStackStatus(context.Background(), "stack-1"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("breaker opened early on call %d", i)
+		}
+	}
+
+	if _, err := client.GetStackStatus(context.Background(), "stack-1"); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+
+	if calls.Load() != 2 {
+		t.Fatalf("expected the open breaker to skip the request, got %d calls", calls.Load())
+	}
+
+	// After the cooldown one failing probe opens it again
+	now = now.Add(time.Minute)
+	if _, err := client.GetStackStatus(context.Background(), "stack-1"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected probe failure, got %v", err)
+	}
+
+	if _, err := client.GetStackStatus(context.Background(), "stack-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit after failed probe, got %v", err)
+	}
+
+	// A successful probe closes it
+	now = now.Add(time.Minute)
+	healthy.Store(true)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetStackStatus(context.Background(), "stack-1"); err != nil {
+			t.Fatalf("expected closed circuit, got %v", err)
+		}
+	}
+}
+
+func TestClientBreakerIgnoresClientErrors(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}, ClientPolicy{BreakerThreshold: 1, BreakerCooldown: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.GetStackStatus(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+}
+
+func TestClientDecodesErrors(t *testing.T) {
+	body := `{"error":"pod spec rejected","code":"invalid_spec","details":{"field":"containers[0].image"}}`
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stacks" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(body))
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("upstream exploded\n"))
+	}, ClientPolicy{})
+
+	_, err := client.CreateStack(context.Background(), 80, "spec")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected invalid api error, got %v", err)
+	}
+
+	if apiErr.Code != "invalid_spec" || apiErr.Message != "pod spec rejected" || string(apiErr.Details) != `{"field":"containers[0].image"}` {
+		t.Fatalf("unexpected api error %+v", apiErr)
+	}
+
+	if apiErr.Error() != "stack provisioner returned 422 invalid_spec: pod spec rejected" {
+		t.Fatalf("unexpected message %q", apiErr.Error())
+	}
+
+	_, err = client.GetStackStatus(context.Background(), "stack-1")
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrUnexpected) || apiErr.Message != "upstream exploded" {
+		t.Fatalf("expected raw text error, got %v", err)
+	}
+}
+
+func TestClientTransportError(t *testing.T) {
+	client := NewClient("http://127.0.0.1:1", "", 100*time.Millisecond, ClientPolicy{})
+	if _, err := client.GetStackStatus(context.Background(), "stack-1"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetStackStatus(ctx, "stack-1"); !errors.Is(err, context.Canceled) || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
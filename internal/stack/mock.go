@@ -2,12 +2,15 @@ package stack
 
 import (
 	"context"
+	"time"
 )
 
 type MockClient struct {
 	CreateStackFn    func(ctx context.Context, targetPort int, podSpec string) (*StackInfo, error)
 	GetStackStatusFn func(ctx context.Context, stackID string) (*StackStatus, error)
 	DeleteStackFn    func(ctx context.Context, stackID string) error
+	ExtendStackFn    func(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*StackStatus, error)
+	RestartStackFn   func(ctx context.Context, stackID string) (*StackStatus, error)
 }
 
 func (m *MockClient) CreateStack(ctx context.Context, targetPort int, podSpec string) (*StackInfo, error) {
@@ -33,3 +36,19 @@ func (m *MockClient) DeleteStack(ctx context.Context, stackID string) error {
 
 	return m.DeleteStackFn(ctx, stackID)
 }
+
+func (m *MockClient) ExtendStack(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*StackStatus, error) {
+	if m.ExtendStackFn == nil {
+		return nil, ErrUnexpected
+	}
+
+	return m.ExtendStackFn(ctx, stackID, ttlExpiresAt)
+}
+
+func (m *MockClient) RestartStack(ctx context.Context, stackID string) (*StackStatus, error) {
+	if m.RestartStackFn == nil {
+		return nil, ErrUnexpected
+	}
+
+	return m.RestartStackFn(ctx, stackID)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 )
 
 func TestMockClient_Defaults(t *testing.T) {
@@ -20,6 +21,14 @@ func TestMockClient_Defaults(t *testing.T) {
 	if err := m.DeleteStack(context.Background(), "id"); !errors.Is(err, ErrUnexpected) {
 		t.Fatalf("expected ErrUnexpected, got %v", err)
 	}
+
+	if _, err := m.ExtendStack(context.Background(), "id", time.Now()); !errors.Is(err, ErrUnexpected) {
+		t.Fatalf("expected ErrUnexpected, got %v", err)
+	}
+
+	if _, err := m.RestartStack(context.Background(), "id"); !errors.Is(err, ErrUnexpected) {
+		t.Fatalf("expected ErrUnexpected, got %v", err)
+	}
 }
 
 func TestMockClient_Functions(t *testing.T) {
@@ -70,4 +79,23 @@ func TestMockClient_Functions(t *testing.T) {
 	if err := m.DeleteStack(context.Background(), "stack-1"); err != nil {
 		t.Fatalf("DeleteStack: %v", err)
 	}
+
+	ttl := time.Now().Add(time.Hour)
+	m.ExtendStackFn = func(ctx context.Context, stackID string, ttlExpiresAt time.Time) (*StackStatus, error) {
+		return &StackStatus{StackID: stackID, Status: "running", TTL: ttlExpiresAt}, nil
+	}
+
+	m.RestartStackFn = func(ctx context.Context, stackID string) (*StackStatus, error) {
+		return &StackStatus{StackID: stackID, Status: "creating"}, nil
+	}
+
+	status, err = m.ExtendStack(context.Background(), "stack-1", ttl)
+	if err != nil || !status.TTL.Equal(ttl) {
+		t.Fatalf("ExtendStack: %+v %v", status, err)
+	}
+
+	status, err = m.RestartStack(context.Background(), "stack-1")
+	if err != nil || status.Status != "creating" {
+		t.Fatalf("RestartStack: %+v %v", status, err)
+	}
 }
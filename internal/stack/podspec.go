@@ -0,0 +1,151 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrPodSpecInvalid = errors.New("pod spec invalid")
+
+var quantityPattern = regexp.MustCompile(`^([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+|[numkMGTPE]|[KMGTPE]i)?$`)
+
+// The subset of a Kubernetes pod the admission policy looks at, unknown fields are ignored
+type PodSpec struct {
+	Containers     []Container `yaml:"containers"`
+	InitContainers []Container `yaml:"initContainers"`
+	Volumes        []Volume    `yaml:"volumes"`
+	HostNetwork    bool        `yaml:"hostNetwork"`
+	HostPID        bool        `yaml:"hostPID"`
+	HostIPC        bool        `yaml:"hostIPC"`
+}
+
+type Container struct {
+	Name            string           `yaml:"name"`
+	Image           string           `yaml:"image"`
+	Ports           []ContainerPort  `yaml:"ports"`
+	Resources       Resources        `yaml:"resources"`
+	SecurityContext *SecurityContext `yaml:"securityContext"`
+}
+
+type ContainerPort struct {
+	ContainerPort int    `yaml:"containerPort"`
+	HostPort      int    `yaml:"hostPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type Resources struct {
+	Limits   map[string]string `yaml:"limits"`
+	Requests map[string]string `yaml:"requests"`
+}
+
+type SecurityContext struct {
+	Privileged               *bool `yaml:"privileged"`
+	AllowPrivilegeEscalation *bool `yaml:"allowPrivilegeEscalation"`
+}
+
+type Volume struct {
+	Name     string    `yaml:"name"`
+	HostPath *struct{} `yaml:"hostPath"`
+}
+
+type podManifest struct {
+	Kind string  `yaml:"kind"`
+	Spec PodSpec `yaml:"spec"`
+}
+
+// Parses a Pod manifest or a bare pod spec, given as YAML or JSON
+func ParsePodSpec(raw string) (*PodSpec, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(raw), &node); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPodSpecInvalid, err)
+	}
+
+	if len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: expected a mapping", ErrPodSpecInvalid)
+	}
+
+	var manifest podManifest
+	if err := node.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPodSpecInvalid, err)
+	}
+
+	spec := &manifest.Spec
+	if manifest.Kind == "" && len(spec.Containers) == 0 {
+		spec = &PodSpec{}
+		if err := node.Decode(spec); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPodSpecInvalid, err)
+		}
+	} else if manifest.Kind != "" && manifest.Kind != "Pod" {
+		return nil, fmt.Errorf("%w: kind %q is not Pod", ErrPodSpecInvalid, manifest.Kind)
+	}
+
+	if len(spec.Containers) == 0 {
+		return nil, fmt.Errorf("%w: no containers", ErrPodSpecInvalid)
+	}
+
+	for _, container := range spec.AllContainers() {
+		if strings.TrimSpace(container.Image) == "" {
+			return nil, fmt.Errorf("%w: container %q has no image", ErrPodSpecInvalid, container.Name)
+		}
+	}
+
+	return spec, nil
+}
+
+func (p *PodSpec) AllContainers() []Container {
+	all := make([]Container, 0, len(p.InitContainers)+len(p.Containers))
+	all = append(all, p.InitContainers...)
+	return append(all, p.Containers...)
+}
+
+// Reports whether a regular container declares port as a TCP containerPort
+func (p *PodSpec) ExposesPort(port int) bool {
+	for _, container := range p.Containers {
+		for _, exposed := range container.Ports {
+			if exposed.ContainerPort == port && (exposed.Protocol == "" || strings.EqualFold(exposed.Protocol, "TCP")) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (c Container) Privileged() bool {
+	if c.SecurityContext == nil {
+		return false
+	}
+
+	return c.SecurityContext.Privileged != nil && *c.SecurityContext.Privileged
+}
+
+// Reports whether both cpu and memory limits are set to valid quantities
+func (c Container) HasLimits() bool {
+	for _, name := range []string{"cpu", "memory"} {
+		if !quantityPattern.MatchString(strings.TrimSpace(c.Resources.Limits[name])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the image with an explicit registry host, docker.io when the reference has none. Docker Hub official
+// images get their implicit library/ namespace, so nginx becomes docker.io/library/nginx.
+func (c Container) ImageReference() string {
+	image := strings.TrimSpace(c.Image)
+	host, rest, found := strings.Cut(image, "/")
+	if !found || !(strings.ContainsAny(host, ".:") || host == "localhost") {
+		host, rest = "docker.io", image
+	}
+
+	if host == "docker.io" && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+
+	return host + "/" + rest
+}
@@ -0,0 +1,102 @@
+package stack
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePodSpec_Manifest(t *testing.T) {
+	raw := "apiVersion: v1\nkind: Pod\nmetadata:\n  name: app\nspec:\n  hostNetwork: true\n  containers:\n    - name: app\n      image: ghcr.io/smctf/web:1\n      ports:\n        - containerPort: 8080\n      resources:\n        limits:\n          cpu: 500m\n          memory: 128Mi\n      securityContext:\n        privileged: true\n  volumes:\n    - name: host\n      hostPath:\n        path: /\n"
+
+	spec, err := ParsePodSpec(raw)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if !spec.HostNetwork || len(spec.Volumes) != 1 || spec.Volumes[0].HostPath == nil {
+		t.Fatalf("unexpected pod fields: %+v", spec)
+	}
+
+	container := spec.Containers[0]
+	if !container.Privileged() || !container.HasLimits() || container.ImageReference() != "ghcr.io/smctf/web:1" {
+		t.Fatalf("unexpected container: %+v", container)
+	}
+
+	if !spec.ExposesPort(8080) || spec.ExposesPort(80) {
+		t.Fatalf("unexpected exposed ports: %+v", container.Ports)
+	}
+}
+
+func TestParsePodSpec_BareJSON(t *testing.T) {
+	raw := `{"containers": [{"name": "app", "image": "nginx", "ports": [{"containerPort": 80, "protocol": "UDP"}], "resources": {"limits": {"cpu": 1, "memory": "1Gi"}}}]}`
+
+	spec, err := ParsePodSpec(raw)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	container := spec.Containers[0]
+	if container.Privileged() || !container.HasLimits() || container.ImageReference() != "docker.io/library/nginx" {
+		t.Fatalf("unexpected container: %+v", container)
+	}
+
+	if spec.ExposesPort(80) {
+		t.Fatalf("expected udp port not to count")
+	}
+}
+
+func TestParsePodSpec_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"syntax":        "spec: [",
+		"scalar":        "pod",
+		"kind":          "kind: Deployment\nspec:\n  containers:\n    - image: nginx\n",
+		"no containers": "kind: Pod\nspec: {}\n",
+		"no image":      "containers:\n  - name: app\n",
+	}
+
+	for name, raw := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParsePodSpec(raw); !errors.Is(err, ErrPodSpecInvalid) {
+				t.Fatalf("expected ErrPodSpecInvalid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestContainerHasLimits(t *testing.T) {
+	cases := []struct {
+		limits   map[string]string
+		expected bool
+	}{
+		{limits: map[string]string{"cpu": "250m", "memory": "64Mi"}, expected: true},
+		{limits: map[string]string{"cpu": "0.5", "memory": "1e9"}, expected: true},
+		{limits: map[string]string{"cpu": "250m"}, expected: false},
+		{limits: map[string]string{"cpu": "lots", "memory": "64Mi"}, expected: false},
+		{limits: nil, expected: false},
+	}
+
+	for _, tc := range cases {
+		container := Container{Resources: Resources{Limits: tc.limits}}
+		if container.HasLimits() != tc.expected {
+			t.Fatalf("limits %v: expected %t", tc.limits, tc.expected)
+		}
+	}
+}
+
+func TestContainerImageReference(t *testing.T) {
+	cases := map[string]string{
+		"nginx:stable":      "docker.io/library/nginx:stable",
+		"docker.io/nginx":   "docker.io/library/nginx",
+		"library/nginx":     "docker.io/library/nginx",
+		"bitnami/redis":     "docker.io/bitnami/redis",
+		"ghcr.io/smctf/app": "ghcr.io/smctf/app",
+		"localhost/app":     "localhost/app",
+		"registry:5000/app": "registry:5000/app",
+	}
+
+	for image, expected := range cases {
+		if got := (Container{Image: image}).ImageReference(); got != expected {
+			t.Fatalf("image %s: expected %s, got %s", image, expected, got)
+		}
+	}
+}